@@ -0,0 +1,301 @@
+package Gparse
+
+import (
+	"fmt"
+	"kugg/compilers/parse"
+	"sort"
+	"strings"
+)
+
+//SymbolSet is a set of symbols
+type SymbolSet map[SymbolType]bool
+
+//HasAll reports whether every symbol of a sentential form is in the set
+func (s SymbolSet) HasAll(f SententialForm) bool {
+	for _, sym := range f {
+		if !s[sym] {
+			return false
+		}
+	}
+	return true
+}
+
+//Sorted returns the symbols in the order of their SymbolTypes
+func (s SymbolSet) Sorted() []SymbolType {
+	syms := make([]SymbolType, 0, len(s))
+	for sym, ok := range s {
+		if ok {
+			syms = append(syms, sym)
+		}
+	}
+	sort.Slice(syms, func(i, j int) bool { return syms[i] < syms[j] })
+	return syms
+}
+
+func (s SymbolSet) String() string {
+	var g *Grammar
+	return g.setString(s)
+}
+
+//setString writes a set of symbols with the names of the grammar
+func (g *Grammar) setString(s SymbolSet) string {
+	return "{" + strings.Join(g.expected(s), ", ") + "}"
+}
+
+//Expected lists the names of the symbols, e.g. for parse.Tree.Unexpected
+func (s SymbolSet) Expected() parse.OneOf {
+	var g *Grammar
+	return g.expected(s)
+}
+
+//expected lists the names of the symbols in the grammar
+func (g *Grammar) expected(s SymbolSet) parse.OneOf {
+	o := make(parse.OneOf, 0, len(s))
+	for _, sym := range s.Sorted() {
+		o = append(o, g.terminalName(sym))
+	}
+	return o
+}
+
+//LookaheadSet is a set of strings of at most k terminals, e.g. FIRST_k or FOLLOW_k of a symbol.
+//
+//Strings shorter than k are the whole rest of the input, and end with EndOfInput in FOLLOW sets.
+type LookaheadSet struct {
+	K       int
+	strings map[string]SententialForm
+}
+
+//NewLookaheadSet creates an empty set of strings of at most k terminals
+func NewLookaheadSet(k int) *LookaheadSet {
+	return &LookaheadSet{K: k, strings: make(map[string]SententialForm)}
+}
+
+func key(f SententialForm) string {
+	var sb strings.Builder
+	for _, s := range f {
+		fmt.Fprintf(&sb, "%d ", int(s))
+	}
+	return sb.String()
+}
+
+//Add adds a string, truncated to k terminals, and reports whether it was new
+func (l *LookaheadSet) Add(f SententialForm) bool {
+	if len(f) > l.K {
+		f = f[:l.K]
+	}
+	k := key(f)
+	if _, ok := l.strings[k]; ok {
+		return false
+	}
+	l.strings[k] = append(SententialForm{}, f...)
+	return true
+}
+
+//AddAll adds the strings of another set, and reports whether any was new
+func (l *LookaheadSet) AddAll(o *LookaheadSet) bool {
+	changed := false
+	for _, f := range o.strings {
+		changed = l.Add(f) || changed
+	}
+	return changed
+}
+
+//Has reports whether a string is in the set
+func (l *LookaheadSet) Has(f ...SymbolType) bool {
+	_, ok := l.strings[key(f)]
+	return ok
+}
+
+//HasEmpty reports whether the empty string is in the set
+func (l *LookaheadSet) HasEmpty() bool {
+	return l.Has()
+}
+
+//Len returns the number of strings in the set
+func (l *LookaheadSet) Len() int {
+	return len(l.strings)
+}
+
+//Strings returns the strings of the set, sorted by their SymbolTypes
+func (l *LookaheadSet) Strings() []SententialForm {
+	fs := make([]SententialForm, 0, len(l.strings))
+	for _, f := range l.strings {
+		fs = append(fs, f)
+	}
+	sort.Slice(fs, func(i, j int) bool {
+		a, b := fs[i], fs[j]
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	return fs
+}
+
+//Terminals returns the terminals which start the strings of the set, which is the set itself for k=1
+func (l *LookaheadSet) Terminals() SymbolSet {
+	ts := make(SymbolSet)
+	for _, f := range l.strings {
+		if len(f) > 0 {
+			ts[f[0]] = true
+		}
+	}
+	return ts
+}
+
+//Intersects reports whether the sets have a string in common
+func (l *LookaheadSet) Intersects(o *LookaheadSet) bool {
+	for k := range l.strings {
+		if _, ok := o.strings[k]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+//concat returns the strings of l followed by the strings of o, truncated to k terminals
+func (l *LookaheadSet) concat(o *LookaheadSet) *LookaheadSet {
+	c := NewLookaheadSet(l.K)
+	for _, a := range l.strings {
+		if len(a) >= l.K {
+			c.Add(a)
+			continue
+		}
+		for _, b := range o.strings {
+			c.Add(append(append(SententialForm{}, a...), b...))
+		}
+	}
+	return c
+}
+
+func (l *LookaheadSet) String() string {
+	var g *Grammar
+	return g.lookaheadString(l)
+}
+
+//lookaheadString writes a set of lookahead strings with the names of the grammar
+func (g *Grammar) lookaheadString(l *LookaheadSet) string {
+	if l == nil {
+		return "{}"
+	}
+	strs := l.Strings()
+	names := make([]string, len(strs))
+	for i, f := range strs {
+		names[i] = g.formString(f)
+	}
+	return "{" + strings.Join(names, ", ") + "}"
+}
+
+//Analysis holds the nullable non-terminals, and the FIRST_k and FOLLOW_k sets of the symbols of a grammar
+type Analysis struct {
+	Grammar  *Grammar
+	K        int
+	Nullable SymbolSet
+	First    map[SymbolType]*LookaheadSet //FIRST_k of every symbol
+	Follow   map[SymbolType]*LookaheadSet //FOLLOW_k of every non-terminal
+}
+
+//Analyze computes the nullable non-terminals and the FIRST_k and FOLLOW_k sets of a grammar, for k >= 1
+func Analyze(g *Grammar, k int) *Analysis {
+	if k < 1 {
+		k = 1
+	}
+	a := &Analysis{
+		Grammar:  g,
+		K:        k,
+		Nullable: g.Nullable(),
+		First:    make(map[SymbolType]*LookaheadSet),
+		Follow:   make(map[SymbolType]*LookaheadSet),
+	}
+	for t := range g.Terminals {
+		a.First[t] = NewLookaheadSet(k)
+		a.First[t].Add(SententialForm{t})
+	}
+	nts := g.Nonterminals()
+	for _, nt := range nts {
+		a.First[nt] = NewLookaheadSet(k)
+		a.Follow[nt] = NewLookaheadSet(k)
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, p := range g.Productions {
+			changed = a.First[p.LHS].AddAll(a.FirstOf(p.RHS)) || changed
+		}
+	}
+
+	if _, ok := a.Follow[g.Start]; ok {
+		a.Follow[g.Start].Add(SententialForm{EndOfInput})
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, p := range g.Productions {
+			for i, s := range p.RHS {
+				if _, ok := a.Follow[s]; !ok {
+					continue
+				}
+				follow := a.FirstOf(p.RHS[i+1:]).concat(a.Follow[p.LHS])
+				changed = a.Follow[s].AddAll(follow) || changed
+			}
+		}
+	}
+	return a
+}
+
+//FirstOf returns FIRST_k of a sentential form
+func (a *Analysis) FirstOf(f SententialForm) *LookaheadSet {
+	first := NewLookaheadSet(a.K)
+	first.Add(SententialForm{})
+	for _, s := range f {
+		fs, ok := a.First[s]
+		if !ok {
+			return NewLookaheadSet(a.K)
+		}
+		first = first.concat(fs)
+	}
+	return first
+}
+
+//Predict returns the lookahead strings for which a production is chosen: FIRST_k of its right hand side
+//followed by FOLLOW_k of its left hand side
+func (a *Analysis) Predict(p Production) *LookaheadSet {
+	follow, ok := a.Follow[p.LHS]
+	if !ok {
+		follow = NewLookaheadSet(a.K)
+	}
+	return a.FirstOf(p.RHS).concat(follow)
+}
+
+//Expected lists the terminals which may start a non-terminal, or follow it if it is nullable
+func (a *Analysis) Expected(nt SymbolType) parse.OneOf {
+	if _, ok := a.Follow[nt]; !ok {
+		return nil
+	}
+	ts := a.First[nt].Terminals()
+	if a.First[nt].HasEmpty() {
+		for t := range a.Follow[nt].Terminals() {
+			ts[t] = true
+		}
+	}
+	return a.Grammar.expected(ts)
+}
+
+//String prints the nullable non-terminals, and the FIRST and FOLLOW sets of the non-terminals
+func (a *Analysis) String() string {
+	var sb strings.Builder
+	k := ""
+	if a.K > 1 {
+		k = fmt.Sprintf("_%d", a.K)
+	}
+	g := a.Grammar
+	fmt.Fprintf(&sb, "Nullable: %s\n", g.setString(a.Nullable))
+	for _, nt := range g.Nonterminals() {
+		fmt.Fprintf(&sb, "FIRST%s(%s) = %s\n", k, g.SymbolName(nt), g.lookaheadString(a.First[nt]))
+	}
+	for _, nt := range g.Nonterminals() {
+		fmt.Fprintf(&sb, "FOLLOW%s(%s) = %s\n", k, g.SymbolName(nt), g.lookaheadString(a.Follow[nt]))
+	}
+	return sb.String()
+}
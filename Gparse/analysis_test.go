@@ -0,0 +1,169 @@
+package Gparse_test
+
+import (
+	"kugg/compilers/Gparse"
+	"kugg/compilers/Gparse/arith"
+	"strings"
+	"testing"
+)
+
+//exprGrammar is the expression grammar without left recursion, with a chain of nullable non-terminals
+//in front of every operand: Sign derives only Neg, which may be empty
+const exprGrammar = `
+E    = T E1 ;
+E1   = "+" T E1 | ;
+T    = F T1 ;
+T1   = "*" F T1 | ;
+F    = Sign P ;
+Sign = Neg ;
+Neg  = "-" | ;
+P    = "(" E ")" | NumberToken ;
+`
+
+func analyzeExpr(t *testing.T, k int) *Gparse.Analysis {
+	g, err := Gparse.Load("expr.ebnf", exprGrammar, arith.LexAny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Gparse.Analyze(g, k)
+}
+
+//TestAnalyze checks the sets of the expression grammar for k = 1 and 2. FOLLOW_2 pads the strings
+//which reach the end of the input with one end of input, like the string after the last ")"
+func TestAnalyze(t *testing.T) {
+	want := map[int]string{1: `
+Nullable: {E1, T1, Sign, Neg}
+FIRST(E) = {"-", "(", NumberToken}
+FIRST(E1) = {ε, "+"}
+FIRST(T) = {"-", "(", NumberToken}
+FIRST(T1) = {ε, "*"}
+FIRST(F) = {"-", "(", NumberToken}
+FIRST(Sign) = {ε, "-"}
+FIRST(Neg) = {ε, "-"}
+FIRST(P) = {"(", NumberToken}
+FOLLOW(E) = {end of input, ")"}
+FOLLOW(E1) = {end of input, ")"}
+FOLLOW(T) = {end of input, "+", ")"}
+FOLLOW(T1) = {end of input, "+", ")"}
+FOLLOW(F) = {end of input, "+", "*", ")"}
+FOLLOW(Sign) = {"(", NumberToken}
+FOLLOW(Neg) = {"(", NumberToken}
+FOLLOW(P) = {end of input, "+", "*", ")"}
+`, 2: `
+Nullable: {E1, T1, Sign, Neg}
+FIRST_2(E) = {"-" "(", "-" NumberToken, "(" "-", "(" "(", "(" NumberToken, NumberToken, NumberToken "+", NumberToken "*"}
+FIRST_2(E1) = {ε, "+" "-", "+" "(", "+" NumberToken}
+FIRST_2(T) = {"-" "(", "-" NumberToken, "(" "-", "(" "(", "(" NumberToken, NumberToken, NumberToken "*"}
+FIRST_2(T1) = {ε, "*" "-", "*" "(", "*" NumberToken}
+FIRST_2(F) = {"-" "(", "-" NumberToken, "(" "-", "(" "(", "(" NumberToken, NumberToken}
+FIRST_2(Sign) = {ε, "-"}
+FIRST_2(Neg) = {ε, "-"}
+FIRST_2(P) = {"(" "-", "(" "(", "(" NumberToken, NumberToken}
+FOLLOW_2(E) = {end of input, ")" end of input, ")" "+", ")" "*", ")" ")"}
+FOLLOW_2(E1) = {end of input, ")" end of input, ")" "+", ")" "*", ")" ")"}
+FOLLOW_2(T) = {end of input, "+" "-", "+" "(", "+" NumberToken, ")" end of input, ")" "+", ")" "*", ")" ")"}
+FOLLOW_2(T1) = {end of input, "+" "-", "+" "(", "+" NumberToken, ")" end of input, ")" "+", ")" "*", ")" ")"}
+FOLLOW_2(F) = {end of input, "+" "-", "+" "(", "+" NumberToken, "*" "-", "*" "(", "*" NumberToken, ")" end of input, ")" "+", ")" "*", ")" ")"}
+FOLLOW_2(Sign) = {"(" "-", "(" "(", "(" NumberToken, NumberToken end of input, NumberToken "+", NumberToken "*", NumberToken ")"}
+FOLLOW_2(Neg) = {"(" "-", "(" "(", "(" NumberToken, NumberToken end of input, NumberToken "+", NumberToken "*", NumberToken ")"}
+FOLLOW_2(P) = {end of input, "+" "-", "+" "(", "+" NumberToken, "*" "-", "*" "(", "*" NumberToken, ")" end of input, ")" "+", ")" "*", ")" ")"}
+`}
+	for k, w := range want {
+		if got := analyzeExpr(t, k).String(); got != w[1:] {
+			t.Errorf("the analysis for k = %d is\n%s\nexpected\n%s", k, got, w[1:])
+		}
+	}
+}
+
+//lookaheads writes a set of lookahead strings with the names of a grammar, like Analysis.String
+func lookaheads(g *Gparse.Grammar, l *Gparse.LookaheadSet) string {
+	var strs []string
+	for _, f := range l.Strings() {
+		names := []string{}
+		for _, s := range f {
+			if s == Gparse.EndOfInput {
+				names = append(names, "end of input")
+			} else {
+				names = append(names, g.SymbolName(s))
+			}
+		}
+		if len(f) == 0 {
+			names = append(names, "ε")
+		}
+		strs = append(strs, strings.Join(names, " "))
+	}
+	return "{" + strings.Join(strs, ", ") + "}"
+}
+
+//TestFirstOf checks FIRST_2 of sentential forms starting with nullable non-terminals
+func TestFirstOf(t *testing.T) {
+	a := analyzeExpr(t, 2)
+	g := a.Grammar
+	sym := func(name string) Gparse.SymbolType {
+		s, ok := g.Symbol(name)
+		if !ok {
+			t.Fatalf("no symbol %s", name)
+		}
+		return s
+	}
+	sign, neg, e1, t1, p := sym("Sign"), sym("Neg"), sym("E1"), sym("T1"), sym("P")
+	for _, c := range []struct {
+		form Gparse.SententialForm
+		want string
+	}{
+		{nil, `{ε}`},
+		{Gparse.SententialForm{sign, neg}, `{ε, "-", "-" "-"}`},
+		{Gparse.SententialForm{sign, neg, sign}, `{ε, "-", "-" "-"}`},
+		{Gparse.SententialForm{t1, e1}, `{ε, "+" "-", "+" "(", "+" NumberToken, "*" "-", "*" "(", "*" NumberToken}`},
+		{Gparse.SententialForm{sign, sign, p, e1}, `{"-" "-", "-" "(", "-" NumberToken, "(" "-", "(" "(", "(" NumberToken, NumberToken, NumberToken "+"}`},
+	} {
+		if got := lookaheads(g, a.FirstOf(c.form)); got != c.want {
+			t.Errorf("FIRST_2 of %d symbols is %s, expected %s", len(c.form), got, c.want)
+		}
+	}
+}
+
+//TestPredict checks the lookahead strings of the productions of E1 and of the nullable chain Sign -> Neg
+func TestPredict(t *testing.T) {
+	want := map[int]map[string]string{
+		1: {
+			`E1 -> "+" T E1`: `{"+"}`,
+			`E1 -> ε`:        `{end of input, ")"}`,
+			`Sign -> Neg`:    `{"-", "(", NumberToken}`,
+			`Neg -> "-"`:     `{"-"}`,
+			`Neg -> ε`:       `{"(", NumberToken}`,
+		},
+		2: {
+			`E1 -> "+" T E1`: `{"+" "-", "+" "(", "+" NumberToken}`,
+			`E1 -> ε`:        `{end of input, ")" end of input, ")" "+", ")" "*", ")" ")"}`,
+			`Sign -> Neg`:    `{"-" "(", "-" NumberToken, "(" "-", "(" "(", "(" NumberToken, NumberToken end of input, NumberToken "+", NumberToken "*", NumberToken ")"}`,
+			`Neg -> "-"`:     `{"-" "(", "-" NumberToken}`,
+			`Neg -> ε`:       `{"(" "-", "(" "(", "(" NumberToken, NumberToken end of input, NumberToken "+", NumberToken "*", NumberToken ")"}`,
+		},
+	}
+	for k, predicts := range want {
+		a := analyzeExpr(t, k)
+		g := a.Grammar
+		for _, p := range g.Productions {
+			rhs := make([]string, len(p.RHS))
+			for i, s := range p.RHS {
+				rhs[i] = g.SymbolName(s)
+			}
+			if len(rhs) == 0 {
+				rhs = []string{"ε"}
+			}
+			prod := g.SymbolName(p.LHS) + " -> " + strings.Join(rhs, " ")
+			w, ok := predicts[prod]
+			if !ok {
+				continue
+			}
+			delete(predicts, prod)
+			if got := lookaheads(g, a.Predict(p)); got != w {
+				t.Errorf("for k = %d, %s is predicted by %s, expected %s", k, prod, got, w)
+			}
+		}
+		for prod := range predicts {
+			t.Errorf("there is no production %s", prod)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+//Package arith is a small arithmetic grammar, to try out the parsers of Gparse
+package arith
+
+import (
+	"kugg/compilers/Gparse"
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+	"unicode"
+)
+
+//Token types
+const (
+	TNumber lex.TokenType = iota
+	TPlus
+	TMinus
+	TTimes
+	TDivide
+	TLParen
+	TRParen
+)
+
+//Symbols, the non-terminals first
+const (
+	Expr Gparse.SymbolType = iota
+	Term
+	Factor
+	Number
+	Plus
+	Minus
+	Times
+	Divide
+	LParen
+	RParen
+)
+
+func init() {
+	for typ, name := range map[lex.TokenType]string{
+		TNumber: "NumberToken", TPlus: "PlusToken", TMinus: "MinusToken", TTimes: "TimesToken",
+		TDivide: "DivideToken", TLParen: "LParenToken", TRParen: "RParenToken",
+	} {
+		lex.TokenNames[typ] = name
+	}
+	for s, name := range map[Gparse.SymbolType]string{
+		Expr: "Expr", Term: "Term", Factor: "Factor", Number: "Number", Plus: "Plus", Minus: "Minus",
+		Times: "Times", Divide: "Divide", LParen: "LParen", RParen: "RParen",
+	} {
+		parse.NodeNames[parse.NodeType(s)] = name
+	}
+	Gparse.Lexers["arith"] = LexAny
+	for typ, samples := range map[lex.TokenType][]string{
+		TNumber: {"0", "1", "7", "42", "1000"}, TPlus: {"+"}, TMinus: {"-"}, TTimes: {"*"},
+		TDivide: {"/"}, TLParen: {"("}, TRParen: {")"},
+	} {
+		Gparse.Samples[typ] = samples
+	}
+}
+
+//Terminals maps the terminals to their token types
+var Terminals = map[Gparse.SymbolType]lex.TokenType{
+	Number: TNumber, Plus: TPlus, Minus: TMinus, Times: TTimes, Divide: TDivide, LParen: TLParen, RParen: TRParen,
+}
+
+//Productions of the grammar, with right associative operators
+var Productions = []Gparse.Production{
+	{LHS: Expr, RHS: Gparse.SententialForm{Term, Plus, Expr}},
+	{LHS: Expr, RHS: Gparse.SententialForm{Term, Minus, Expr}},
+	{LHS: Expr, RHS: Gparse.SententialForm{Term}},
+	{LHS: Term, RHS: Gparse.SententialForm{Factor, Times, Term}},
+	{LHS: Term, RHS: Gparse.SententialForm{Factor, Divide, Term}},
+	{LHS: Term, RHS: Gparse.SententialForm{Factor}},
+	{LHS: Factor, RHS: Gparse.SententialForm{LParen, Expr, RParen}},
+	{LHS: Factor, RHS: Gparse.SententialForm{Minus, Factor}},
+	{LHS: Factor, RHS: Gparse.SententialForm{Number}},
+}
+
+//Grammar returns the grammar, starting at Expr
+func Grammar() *Gparse.Grammar {
+	return Gparse.NewGrammar(Expr, Terminals, Productions...)
+}
+
+//LexAny is the start state of the lexer
+func LexAny(l *lex.BaseLexer) lex.StateFn {
+	l.IgnoreSpaces()
+	r := l.Next()
+	switch {
+	case r == lex.EOF:
+		l.Emit(lex.EOF_Token)
+		return nil
+	case unicode.IsDigit(r):
+		l.AcceptRun("0123456789")
+		l.Accept(".")
+		l.AcceptRun("0123456789")
+		l.Emit(TNumber)
+	case r == '+':
+		l.Emit(TPlus)
+	case r == '-':
+		l.Emit(TMinus)
+	case r == '*':
+		l.Emit(TTimes)
+	case r == '/':
+		l.Emit(TDivide)
+	case r == '(':
+		l.Emit(TLParen)
+	case r == ')':
+		l.Emit(TRParen)
+	default:
+		l.UnexpectedRune(r, "a number, an operator or a parenthesis")
+		return nil
+	}
+	return LexAny
+}
@@ -6,5 +6,27 @@ has a production-function assigned in a map.
 
 The map is populated by calling a second-order function closured
 with the metadata describing the production.
+
+A Grammar lists the productions over SymbolTypes, and the lex.TokenType
+matched by each terminal. NewParser checks the grammar and builds the map,
+and Parser.ParseFn drives a parse.Tree, adding a node for every symbol:
+
+	p, err := Gparse.NewParser(grammar)
+	tree := parse.NewTree(name, source, p.ParseFn())
+	err = tree.Parse(lexer)
+
+NewLL1 and NewLR build table-driven parsers of the same grammars instead.
+NewLR accepts left recursive grammars too, and ambiguous ones given
+precedence levels, and LR.Report describes its states like Bison.
+NewEarley parses any grammar into a Forest of every parse, which
+Forest.Disambiguate filters before Forest.Tree picks a parse.Tree.
+Lint and Loader.Lint check grammars for common mistakes, as cmd/grammarlint does.
+Transform rewrites left recursive grammars for NewParser and NewLL1, and
+Transformed.Reassociate turns their trees back into those of the original grammar.
+NewGenerator produces random sentences of a grammar, and mutations of them,
+to seed fuzz tests of its parsers.
+GenerateGo writes the parser of an LL(1) grammar as recursive descent Go, as cmd/parsegen does.
+
+The package arith has a small arithmetic grammar to try it out.
 */
 package Gparse
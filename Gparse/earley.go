@@ -0,0 +1,339 @@
+package Gparse
+
+import (
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+)
+
+//Earley is a general context free parser of a grammar, which may be left recursive or ambiguous.
+//
+//It builds a shared packed parse forest of every parse of the input, with the algorithm of
+//Scott, "SPPF-Style Parsing From Earley Recognisers" (2008), in cubic time at worst, and in
+//linear time for LR(k) grammars. Right recursion is linear too with the items of Leo,
+//"A general context-free parsing algorithm running in linear time on every LR(k) grammar" (1991),
+//which complete a deterministic chain of right recursive items at once. The nodes of the completions
+//skipped are only built for the chains in the forest, once the input is parsed.
+type Earley struct {
+	Grammar *Grammar
+
+	alts      map[SymbolType][]int //Indices of the productions of each non-terminal
+	terminals *terminals
+}
+
+//NewEarley creates an Earley parser for a grammar
+func NewEarley(g *Grammar) (*Earley, error) {
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+	e := &Earley{Grammar: g, alts: make(map[SymbolType][]int), terminals: newTerminals(g)}
+	for i, p := range g.Productions {
+		e.alts[p.LHS] = append(e.alts[p.LHS], i)
+	}
+	return e, nil
+}
+
+//earleyItem is a production with a position, the token where it started, and the forest node of
+//the symbols before the position
+type earleyItem struct {
+	prod, dot, origin int
+	node              *ForestNode
+}
+
+//earleySet holds the items at a position in the input
+type earleySet struct {
+	items    map[earleyItem]bool
+	list     []earleyItem                //The items, in the order to process them
+	waiting  map[SymbolType][]earleyItem //Items with a non-terminal after the position, by the non-terminal
+	scan     []earleyItem                //Items whose next terminal matches the next token
+	scanned  map[earleyItem]bool
+	expected SymbolSet               //The terminals of items with a terminal after the position
+	leo      map[SymbolType]*leoLink //The Leo items, nil for the symbols without one
+}
+
+//leoLink is the Leo item of a set for a non-terminal X: the only item of the set waiting for X,
+//which X completes, and the Leo item of the set where that item started, for its left hand side
+type leoLink struct {
+	prod, origin int
+	left         *ForestNode //The node of the symbols before X
+	next         *leoLink
+	top          *leoLink //The last link of the chain, whose item is completed
+}
+
+//leoFamily is a derivation of a node completed by a chain of Leo items, from the node of the X of the first link
+type leoFamily struct {
+	link *leoLink
+	v    *ForestNode
+}
+
+func newEarleySet() *earleySet {
+	return &earleySet{
+		items:    make(map[earleyItem]bool),
+		waiting:  make(map[SymbolType][]earleyItem),
+		scanned:  make(map[earleyItem]bool),
+		expected: make(SymbolSet),
+		leo:      make(map[SymbolType]*leoLink),
+	}
+}
+
+//nodeKey identifies a symbol node, or the intermediate node of a position in a production, by its span
+type nodeKey struct {
+	sym        SymbolType
+	prod, dot  int
+	start, end int
+}
+
+//earleyRun holds the state of one parse
+type earleyRun struct {
+	e      *Earley
+	tree   *parse.Tree
+	tokens []lex.Token
+	n      int //The number of tokens, without the EOF token
+	sets   []*earleySet
+	nodes  map[nodeKey]*ForestNode
+}
+
+//add adds an item to the set at a position, or to the items to scan if a terminal follows its position
+func (r *earleyRun) add(i int, it earleyItem) {
+	p := r.e.Grammar.Productions[it.prod]
+	s := r.sets[i]
+	if it.dot < len(p.RHS) && r.e.Grammar.IsTerminal(p.RHS[it.dot]) {
+		t := p.RHS[it.dot]
+		s.expected[t] = true
+		if i < r.n && r.e.terminals.matches(t, r.tokens[i]) && !s.scanned[it] {
+			s.scanned[it] = true
+			s.scan = append(s.scan, it)
+		}
+		return
+	}
+	if s.items[it] {
+		return
+	}
+	s.items[it] = true
+	s.list = append(s.list, it)
+	if it.dot < len(p.RHS) {
+		s.waiting[p.RHS[it.dot]] = append(s.waiting[p.RHS[it.dot]], it)
+	}
+}
+
+//symbolNode returns the node of a symbol over a span, creating it if needed
+func (r *earleyRun) symbolNode(sym SymbolType, start, end int) *ForestNode {
+	k := nodeKey{sym, -1, 0, start, end}
+	n, ok := r.nodes[k]
+	if !ok {
+		n = &ForestNode{Symbol: sym, Start: start, End: end}
+		r.nodes[k] = n
+	}
+	return n
+}
+
+//node returns the node of an item advanced over a symbol of node v, from the node w of the symbols before it.
+//This is MAKE_NODE of Scott.
+func (r *earleyRun) node(prod, dot, origin, end int, w, v *ForestNode) *ForestNode {
+	p := r.e.Grammar.Productions[prod]
+	if dot == 1 && dot < len(p.RHS) {
+		return v
+	}
+	var y *ForestNode
+	if dot == len(p.RHS) {
+		y = r.symbolNode(p.LHS, origin, end)
+	} else {
+		k := nodeKey{p.LHS, prod, dot, origin, end}
+		var ok bool
+		if y, ok = r.nodes[k]; !ok {
+			y = &ForestNode{Symbol: p.LHS, Start: origin, End: end, dot: dot}
+			r.nodes[k] = y
+		}
+	}
+	y.addFamily(prod, w, v)
+	return y
+}
+
+//leo returns the Leo item of a complete set for a non-terminal, or nil if it has none.
+//Items which start at the set itself don't get one, nor does the start symbol over the whole input,
+//so that its node is in the forest as it is parsed.
+func (r *earleyRun) leo(i int, x SymbolType) *leoLink {
+	s := r.sets[i]
+	if l, ok := s.leo[x]; ok {
+		return l
+	}
+	var l *leoLink
+	if w := s.waiting[x]; len(w) == 1 {
+		it := w[0]
+		p := r.e.Grammar.Productions[it.prod]
+		if it.dot == len(p.RHS)-1 && it.origin < i {
+			l = &leoLink{prod: it.prod, origin: it.origin, left: it.node}
+			if !(p.LHS == r.e.Grammar.Start && it.origin == 0) {
+				l.next = r.leo(it.origin, p.LHS)
+			}
+			l.top = l
+			if l.next != nil {
+				l.top = l.next.top
+			}
+		}
+	}
+	s.leo[x] = l
+	return l
+}
+
+//expand builds the nodes skipped by Leo items, for the nodes reachable from the root
+func (r *earleyRun) expand(root *ForestNode) {
+	seen := make(map[*ForestNode]bool)
+	stack := []*ForestNode{root}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if n == nil || n.terminal || seen[n] {
+			continue
+		}
+		seen[n] = true
+		for _, lf := range n.leo {
+			v := lf.v
+			for l := lf.link; l != nil; l = l.next {
+				v = r.node(l.prod, len(r.e.Grammar.Productions[l.prod].RHS), l.origin, n.End, l.left, v)
+				//A node visited already has a new family to visit
+				if v != n && seen[v] {
+					delete(seen, v)
+					stack = append(stack, v)
+				}
+			}
+		}
+		n.leo = nil
+		for _, f := range n.families {
+			stack = append(stack, f.left, f.right)
+		}
+	}
+}
+
+//unexpected panics with the terminals expected at a position
+func (r *earleyRun) unexpected(i int) {
+	expected := make(SymbolSet)
+	for t := range r.sets[i].expected {
+		expected[t] = true
+	}
+	if _, ok := r.nodes[nodeKey{r.e.Grammar.Start, -1, 0, 0, i}]; ok {
+		expected[EndOfInput] = true
+	}
+	if i >= len(r.tokens) {
+		r.tree.Errorf("expected %v, got end of input.", r.e.Grammar.expected(expected))
+	}
+	r.tree.Unexpected(r.tokens[i], r.e.Grammar.expected(expected))
+}
+
+//forest reads the tokens of a tree, and returns the forest of their parses
+func (e *Earley) forest(tree *parse.Tree) *Forest {
+	r := &earleyRun{e: e, tree: tree, nodes: make(map[nodeKey]*ForestNode)}
+	for {
+		tok := tree.Next()
+		if tok == nil {
+			break
+		}
+		r.tokens = append(r.tokens, tok)
+		if tok.Type() == lex.EOF_Token {
+			break
+		}
+	}
+	r.n = len(r.tokens)
+	if r.n > 0 && r.tokens[r.n-1].Type() == lex.EOF_Token {
+		r.n--
+	}
+
+	r.sets = []*earleySet{newEarleySet()}
+	for _, alt := range e.alts[e.Grammar.Start] {
+		r.add(0, earleyItem{alt, 0, 0, nil})
+	}
+	for i := 0; i <= r.n; i++ {
+		s := r.sets[i]
+		held := make(map[SymbolType][]*ForestNode) //Nodes of the nullable non-terminals completed at i, H of Scott
+		for k := 0; k < len(s.list); k++ {
+			it := s.list[k]
+			p := e.Grammar.Productions[it.prod]
+			if it.dot < len(p.RHS) {
+				c := p.RHS[it.dot]
+				for _, alt := range e.alts[c] {
+					r.add(i, earleyItem{alt, 0, i, nil})
+				}
+				for _, v := range held[c] {
+					r.add(i, earleyItem{it.prod, it.dot + 1, it.origin, r.node(it.prod, it.dot+1, it.origin, i, it.node, v)})
+				}
+				continue
+			}
+			w := it.node
+			if w == nil {
+				w = r.symbolNode(p.LHS, i, i)
+				w.addFamily(it.prod, nil, nil)
+			}
+			if it.origin < i {
+				if l := r.leo(it.origin, p.LHS); l != nil {
+					top := l.top
+					y := r.symbolNode(e.Grammar.Productions[top.prod].LHS, top.origin, i)
+					y.addLeo(l, w)
+					r.add(i, earleyItem{top.prod, len(e.Grammar.Productions[top.prod].RHS), top.origin, y})
+					continue
+				}
+			}
+			if it.origin == i && !containsNode(held[p.LHS], w) {
+				held[p.LHS] = append(held[p.LHS], w)
+			}
+			for _, a := range r.sets[it.origin].waiting[p.LHS] {
+				r.add(i, earleyItem{a.prod, a.dot + 1, a.origin, r.node(a.prod, a.dot+1, a.origin, i, a.node, w)})
+			}
+		}
+		if i == r.n {
+			break
+		}
+		if len(s.scan) == 0 {
+			r.unexpected(i)
+		}
+
+		r.sets = append(r.sets, newEarleySet())
+		leaves := make(map[SymbolType]*ForestNode)
+		for _, it := range s.scan {
+			t := e.Grammar.Productions[it.prod].RHS[it.dot]
+			v, ok := leaves[t]
+			if !ok {
+				v = &ForestNode{Symbol: t, Start: i, End: i + 1, Token: r.tokens[i], terminal: true}
+				leaves[t] = v
+			}
+			r.add(i+1, earleyItem{it.prod, it.dot + 1, it.origin, r.node(it.prod, it.dot+1, it.origin, i+1, it.node, v)})
+		}
+	}
+
+	root, ok := r.nodes[nodeKey{e.Grammar.Start, -1, 0, 0, r.n}]
+	if !ok {
+		r.unexpected(r.n)
+	}
+	r.expand(root)
+	return &Forest{Grammar: e.Grammar, Name: tree.Name(), Source: tree.Text(), Tokens: r.tokens, Root: root}
+}
+
+func containsNode(ns []*ForestNode, n *ForestNode) bool {
+	for _, m := range ns {
+		if m == n {
+			return true
+		}
+	}
+	return false
+}
+
+//ParseFn returns a parsing entry point for parse.NewTree, which adds the first tree of the forest.
+//Use Parse to get the whole forest.
+func (e *Earley) ParseFn() parse.ParseFn {
+	return func(tree *parse.Tree) {
+		f := e.forest(tree)
+		d := f.derive(f.Root, nil, make(map[*ForestNode]bool))
+		if d == nil {
+			tree.Errorf("Every parse of %s is infinite.", tree.Name())
+		}
+		f.build(tree, tree.Root, d)
+	}
+}
+
+//Parse lexes a source and returns the forest of its parses
+func (e *Earley) Parse(name, source string, lexStart lex.StateFn) (*Forest, error) {
+	var f *Forest
+	tree := parse.NewTree(name, source, func(tree *parse.Tree) { f = e.forest(tree) })
+	if err := tree.Parse(lex.LexAll(name, source, lexStart).Lexer()); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,180 @@
+package Gparse_test
+
+import (
+	"kugg/compilers/Gparse"
+	"kugg/compilers/Gparse/arith"
+	"kugg/compilers/parse"
+	"strings"
+	"testing"
+	"time"
+)
+
+//gsexpr writes a tree like sexpr, with the names of the symbols of a loaded grammar
+func gsexpr(g *Gparse.Grammar, n parse.Node) string {
+	if n.IsTerminal() {
+		return n.Token().Lexeme()
+	}
+	var parts []string
+	for _, c := range n.Children() {
+		parts = append(parts, gsexpr(g, c))
+	}
+	return g.SymbolName(Gparse.SymbolType(n.Type())) + "(" + strings.Join(parts, " ") + ")"
+}
+
+func loadEarley(t *testing.T, src string) (*Gparse.Grammar, *Gparse.Earley) {
+	g, err := Gparse.Load("test.ebnf", src, arith.LexAny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := Gparse.NewEarley(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g, e
+}
+
+const ambiguousGrammar = `E = E "+" E | E "*" E | NumberToken ;`
+
+func TestEarleyCount(t *testing.T) {
+	_, e := loadEarley(t, ambiguousGrammar)
+	//The trees of n operators are counted by the Catalan numbers
+	for src, want := range map[string]int{"1": 1, "1+2": 1, "1+2*3": 2, "1+2*3+4": 5, "1+2*3+4*5": 14} {
+		f, err := e.Parse(src, src, arith.LexAny)
+		if err != nil {
+			t.Fatalf("%q: %v", src, err)
+		}
+		if got := f.Count(); got != want {
+			t.Errorf("%q has %d trees, expected %d", src, got, want)
+		}
+	}
+}
+
+func TestEarleyFilters(t *testing.T) {
+	const plus, times = 0, 1
+	g, e := loadEarley(t, ambiguousGrammar)
+	for _, c := range []struct {
+		src     string
+		filters []Gparse.Filter
+		want    string
+	}{
+		{"1+2*3+4", []Gparse.Filter{Gparse.Priority([]int{times}, []int{plus}), Gparse.Associativity(Gparse.Left, plus)},
+			"E(E(E(1) + E(E(2) * E(3))) + E(4))"},
+		{"1+2*3+4", []Gparse.Filter{Gparse.Priority([]int{times}, []int{plus}), Gparse.Associativity(Gparse.Right, plus)},
+			"E(E(1) + E(E(E(2) * E(3)) + E(4)))"},
+		{"1+2*3", []Gparse.Filter{Gparse.Priority([]int{plus}, []int{times})},
+			"E(E(E(1) + E(2)) * E(3))"},
+		{"1*2*3", []Gparse.Filter{Gparse.Associativity(Gparse.Left, times)},
+			"E(E(E(1) * E(2)) * E(3))"},
+	} {
+		f, err := e.Parse(c.src, c.src, arith.LexAny)
+		if err != nil {
+			t.Fatalf("%q: %v", c.src, err)
+		}
+		if err := f.Disambiguate(c.filters...); err != nil {
+			t.Fatalf("%q: %v", c.src, err)
+		}
+		if n := f.Count(); n != 1 {
+			t.Errorf("%q has %d trees after filtering, expected 1", c.src, n)
+			continue
+		}
+		tree, err := f.Tree(nil)
+		if err != nil {
+			t.Fatalf("%q: %v", c.src, err)
+		}
+		if got := gsexpr(g, tree.Root.Children()[0]); got != c.want {
+			t.Errorf("%q parsed as\n%s\nexpected\n%s", c.src, got, c.want)
+		}
+	}
+
+	f, err := e.Parse("1+2+3", "1+2+3", arith.LexAny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Disambiguate(Gparse.Associativity(Gparse.NonAssoc, plus)); err == nil {
+		t.Errorf("a non associative operator was chained, to %d trees", f.Count())
+	}
+}
+
+//TestEarleyRightRecursion parses long right recursive lists, which take quadratic time without Leo items
+func TestEarleyRightRecursion(t *testing.T) {
+	g, e := loadEarley(t, `L = NumberToken "+" L | NumberToken ;`)
+	items := []string{"1", "2", "3"}
+	src := strings.Join(items, "+")
+	f, err := e.Parse(src, src, arith.LexAny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := f.Tree(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := gsexpr(g, tree.Root.Children()[0]), "L(1 + L(2 + L(3)))"; got != want {
+		t.Errorf("%q parsed as\n%s\nexpected\n%s", src, got, want)
+	}
+
+	src = strings.Repeat("1+", 3999) + "1"
+	done := make(chan error)
+	go func() {
+		f, err := e.Parse("long", src, arith.LexAny)
+		if err == nil && f.Count() != 1 {
+			t.Errorf("a list of 4000 items has %d trees", f.Count())
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("parsing a list of 4000 items takes longer than 5s")
+	}
+
+	//Every switch from A to B is a tree, and B has no Leo items, as two items wait for it
+	_, e = loadEarley(t, `S = A ; A = NumberToken A | B ; B = NumberToken B | NumberToken ;`)
+	for n := 1; n < 6; n++ {
+		src := strings.TrimSpace(strings.Repeat("1 ", n))
+		f, err := e.Parse(src, src, arith.LexAny)
+		if err != nil {
+			t.Fatalf("%q: %v", src, err)
+		}
+		if got := f.Count(); got != n {
+			t.Errorf("%q has %d trees, expected %d", src, got, n)
+		}
+	}
+}
+
+//TestEarleyArith checks that the trees of the Earley parser are those of the backtracking parser,
+//through the right recursion of arith
+func TestEarleyArith(t *testing.T) {
+	p := arithParser(t)
+	e, err := Gparse.NewEarley(arith.Grammar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen, err := Gparse.NewGenerator(arith.Grammar(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		src := gen.Render(gen.Generate())
+		want, err := p.Parse(src, src, arith.LexAny)
+		if err != nil {
+			t.Fatalf("%q: %v", src, err)
+		}
+		f, err := e.Parse(src, src, arith.LexAny)
+		if err != nil {
+			t.Fatalf("%q: %v", src, err)
+		}
+		if n := f.Count(); n != 1 {
+			t.Fatalf("%q has %d trees", src, n)
+		}
+		got, err := f.Tree(nil)
+		if err != nil {
+			t.Fatalf("%q: %v", src, err)
+		}
+		if !parse.Equal(want, got, parse.EqualOptions{}) {
+			t.Fatalf("%q parsed as\n%s\nby the Earley parser, and as\n%s", src, sexpr(got.Root), sexpr(want.Root))
+		}
+	}
+}
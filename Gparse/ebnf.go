@@ -0,0 +1,247 @@
+package Gparse
+
+import (
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+)
+
+/*
+The grammar of grammar files, lexed with lex and parsed with parse:
+
+	grammar      = rule* ;
+	rule         = Ident Define alternatives ";"? ;
+	alternatives = sequence ( "|" sequence )* ;
+	sequence     = item* ;
+	item         = ( Ident | String | "(" alternatives ")" ) ( "?" | "*" | "+" )? ;
+
+The token and node types are negative, so they don't clash with those of the grammars loaded.
+*/
+
+//Token types of grammar files
+const (
+	tIdent lex.TokenType = -(10 + iota)
+	tString
+	tDefine
+	tBar
+	tLParen
+	tRParen
+	tOption
+	tStar
+	tPlus
+	tSemi
+)
+
+//Node types of grammar files
+const (
+	nGrammar parse.NodeType = -(10 + iota)
+	nRule
+	nAlternatives
+	nSequence
+	nItem
+	nGroup
+	nName
+	nString
+	nOperator
+	nPunct
+)
+
+//lexEBNF is the start state of the lexer of grammar files
+func lexEBNF(l *lex.BaseLexer) lex.StateFn {
+	l.IgnoreSpaces()
+	r := l.Next()
+	switch {
+	case r == lex.EOF:
+		l.Emit(lex.EOF_Token)
+		return nil
+	case r == '#' || r == '/' && l.Peek() == '/':
+		l.AcceptUntil("\n")
+		l.Ignore()
+	case r == '_' || lex.IsAlphaNumeric(r):
+		for r = l.Next(); r == '_' || lex.IsAlphaNumeric(r); r = l.Next() {
+		}
+		l.Back()
+		l.Emit(tIdent)
+	case r == '"' || r == '\'':
+		return lexString(r)
+	case r == '=':
+		l.Emit(tDefine)
+	case r == ':':
+		l.Accept(":")
+		if l.Accept("=") {
+			l.Emit(tDefine)
+		} else if l.CurrentLexeme() == ":" {
+			l.Emit(tDefine)
+		} else {
+			l.Errorf("expected ::=, got %s", l.CurrentLexeme())
+			return nil
+		}
+	case r == '|':
+		l.Emit(tBar)
+	case r == '(':
+		l.Emit(tLParen)
+	case r == ')':
+		l.Emit(tRParen)
+	case r == '?':
+		l.Emit(tOption)
+	case r == '*':
+		l.Emit(tStar)
+	case r == '+':
+		l.Emit(tPlus)
+	case r == ';':
+		l.Emit(tSemi)
+	default:
+		l.UnexpectedRune(r, "a rule, a terminal or an operator")
+		return nil
+	}
+	return lexEBNF
+}
+
+//lexString lexes a quoted terminal. Double quoted strings may contain Go escapes.
+func lexString(quote rune) lex.StateFn {
+	return func(l *lex.BaseLexer) lex.StateFn {
+		for {
+			switch r := l.Next(); r {
+			case quote:
+				l.Emit(tString)
+				return lexEBNF
+			case '\\':
+				if quote == '"' {
+					l.Next()
+				}
+			case '\n', lex.EOF:
+				l.Errorf("unterminated string %s", l.CurrentLexeme())
+				return nil
+			}
+		}
+	}
+}
+
+//ebnfParser parses grammar files, recording the first error
+type ebnfParser struct {
+	tree *parse.Tree
+	name string
+	err  *LoadError
+}
+
+//fail records an error at a token, and stops the parse
+func (p *ebnfParser) fail(tok lex.Token, format string, args ...interface{}) {
+	if tok.Type() == lex.LexingError {
+		p.err = loadErrorf(p.name, tok, "%s", tok.Lexeme())
+	} else {
+		p.err = loadErrorf(p.name, tok, format, args...)
+	}
+	p.tree.Errorf("%v", p.err)
+}
+
+func (p *ebnfParser) expect(typ lex.TokenType, what string) lex.Token {
+	tok := p.tree.Next()
+	if tok.Type() != typ {
+		p.fail(tok, "expected %s, got %s", what, describe(tok))
+	}
+	p.tree.AddTerminal(nPunct, tok).Commit()
+	return tok
+}
+
+func describe(tok lex.Token) string {
+	switch tok.Type() {
+	case lex.EOF_Token:
+		return "end of file"
+	case tString:
+		return tok.Lexeme()
+	}
+	return "\"" + tok.Lexeme() + "\""
+}
+
+//nonterm adds a non-terminal to the current node, and parses its children with f
+func (p *ebnfParser) nonterm(typ parse.NodeType, f func()) parse.Node {
+	tree := p.tree
+	parent := tree.Curr
+	n := tree.AddNonTerminal(typ, tree.Peek())
+	tree.Curr = n
+	f()
+	n.Commit()
+	tree.Curr = parent
+	return n
+}
+
+func (p *ebnfParser) grammar(tree *parse.Tree) {
+	p.tree = tree
+	p.nonterm(nGrammar, func() {
+		for tree.Peek().Type() != lex.EOF_Token {
+			p.rule()
+		}
+	})
+}
+
+func (p *ebnfParser) rule() {
+	tree := p.tree
+	if tok := tree.Peek(); tok.Type() != tIdent {
+		p.fail(tok, "expected a rule name, got %s", describe(tok))
+	}
+	p.nonterm(nRule, func() {
+		tree.AddTerminal(nName, tree.Next()).Commit()
+		p.expect(tDefine, "=")
+		p.alternatives()
+		if tree.Peek().Type() == tSemi {
+			p.expect(tSemi, ";")
+		}
+	})
+}
+
+func (p *ebnfParser) alternatives() {
+	tree := p.tree
+	p.nonterm(nAlternatives, func() {
+		p.sequence()
+		for tree.Peek().Type() == tBar {
+			tree.AddTerminal(nPunct, tree.Next()).Commit()
+			p.sequence()
+		}
+	})
+}
+
+//sequence parses items until the end of the alternative, or the start of the next rule
+func (p *ebnfParser) sequence() {
+	tree := p.tree
+	p.nonterm(nSequence, func() {
+		for {
+			switch tok := tree.Peek(); tok.Type() {
+			case tIdent:
+				tree.Next()
+				next := tree.Peek()
+				tree.Back()
+				if next.Type() == tDefine {
+					return
+				}
+				p.item()
+			case tString, tLParen:
+				p.item()
+			case tBar, tRParen, tSemi, lex.EOF_Token:
+				return
+			default:
+				p.fail(tok, "expected a symbol, |, ) or ;, got %s", describe(tok))
+			}
+		}
+	})
+}
+
+func (p *ebnfParser) item() {
+	tree := p.tree
+	p.nonterm(nItem, func() {
+		switch tok := tree.Next(); tok.Type() {
+		case tIdent:
+			tree.AddTerminal(nName, tok).Commit()
+		case tString:
+			tree.AddTerminal(nString, tok).Commit()
+		case tLParen:
+			p.nonterm(nGroup, func() {
+				tree.AddTerminal(nPunct, tok).Commit()
+				p.alternatives()
+				p.expect(tRParen, ")")
+			})
+		}
+		switch tree.Peek().Type() {
+		case tOption, tStar, tPlus:
+			tree.AddTerminal(nOperator, tree.Next()).Commit()
+		}
+	})
+}
@@ -0,0 +1,361 @@
+package Gparse
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"kugg/compilers/lex"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+//GoOptions configure the source written by GenerateGo
+type GoOptions struct {
+	Package string //The package of the source
+	Source  string //The grammar file, named in the header of the source
+}
+
+//GenerateGo writes the recursive descent parser of an LL(1) grammar as Go source, formatted by gofmt.
+//
+//Every non-terminal has a function, which chooses its production by the next token like the LL1 table,
+//and parses its symbols with the parse.Tree API. The trees are the same as those of Parser and LL1.
+//Node types are the SymbolTypes of the grammar, and token types those of its terminals, with
+//the names of the grammar and of lex.TokenNames, so the parser keeps working with the same lexer.
+//Since the source only depends on the grammar, it is the same for every run.
+//
+//It fails with a ConflictError for grammars which are not LL(1), see NewLL1 and Transform.
+func GenerateGo(g *Grammar, opts GoOptions) ([]byte, error) {
+	ll, err := NewLL1(g)
+	if err != nil {
+		return nil, err
+	}
+	e := &emitter{g: g, ll: ll, opts: opts, names: make(map[SymbolType]string), tokens: make(map[lex.TokenType]string),
+		used: map[string]bool{"Parse": true, "NodeNames": true, "TokenNames": true}}
+	e.name()
+	e.header()
+	e.tables()
+	e.parse()
+	for _, nt := range e.nts {
+		e.nonterminal(nt)
+	}
+	for _, nt := range g.Nonterminals() {
+		if g.Helpers[nt] {
+			e.nonterminal(nt)
+		}
+	}
+	src, err := format.Source(e.buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("Formatting the parser: %v.", err)
+	}
+	return src, nil
+}
+
+//emitter writes the source of a parser
+type emitter struct {
+	g    *Grammar
+	ll   *LL1
+	opts GoOptions
+	buf  bytes.Buffer
+
+	names  map[SymbolType]string    //The identifiers of the node types, and the parse functions of helpers
+	tokens map[lex.TokenType]string //The identifiers of the token types
+	used   map[string]bool
+	nts    []SymbolType //The non-terminals with node types
+	ts     []SymbolType //The terminals, sorted
+	types  []lex.TokenType
+}
+
+func (e *emitter) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&e.buf, format, args...)
+}
+
+//identifier returns an unused Go identifier for a name
+func (e *emitter) identifier(name string) string {
+	id := goName(name)
+	for i := 2; e.used[id]; i++ {
+		id = fmt.Sprintf("%s%d", goName(name), i)
+	}
+	e.used[id] = true
+	return id
+}
+
+//goName turns a name like Expr_tail0 into an exported identifier like ExprTail0
+func goName(name string) string {
+	var sb strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		sb.WriteRune(r)
+	}
+	if sb.Len() == 0 || unicode.IsDigit([]rune(sb.String())[0]) {
+		return "N" + sb.String()
+	}
+	return sb.String()
+}
+
+func isIdentifier(s string) bool {
+	for i, r := range s {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+//punctuation names the lexemes of common quoted terminals
+var punctuation = map[string]string{
+	"+": "Plus", "-": "Minus", "*": "Star", "/": "Slash", "%": "Percent", "^": "Caret", "!": "Bang",
+	"=": "Assign", "==": "Equal", "!=": "NotEqual", "<": "Less", "<=": "LessEqual", ">": "Greater", ">=": "GreaterEqual",
+	"&": "Amp", "&&": "AndAnd", "|": "Pipe", "||": "OrOr", "~": "Tilde", "?": "Question", ":": "Colon", ";": "Semicolon",
+	",": "Comma", ".": "Dot", "(": "LParen", ")": "RParen", "[": "LBracket", "]": "RBracket", "{": "LBrace", "}": "RBrace",
+	"->": "Arrow", ":=": "Define", "++": "Inc", "--": "Dec", "<<": "Shl", ">>": "Shr",
+}
+
+//name names the node types, the token types and the functions of the helpers
+func (e *emitter) name() {
+	for _, nt := range e.g.Nonterminals() {
+		if !e.g.Helpers[nt] {
+			e.nts = append(e.nts, nt)
+			e.names[nt] = e.identifier(e.g.SymbolName(nt))
+		}
+	}
+	for t := range e.g.Terminals {
+		e.ts = append(e.ts, t)
+	}
+	sort.Slice(e.ts, func(i, j int) bool { return e.ts[i] < e.ts[j] })
+	for _, t := range e.ts {
+		lexeme, ok := e.g.Lexemes[t]
+		switch {
+		case !ok:
+			e.names[t] = e.identifier(e.g.SymbolName(t))
+		case punctuation[lexeme] != "":
+			e.names[t] = e.identifier(punctuation[lexeme])
+		case isIdentifier(lexeme):
+			e.names[t] = e.identifier(lexeme) //A keyword
+		default:
+			e.names[t] = e.identifier("Lit")
+		}
+	}
+	seen := make(map[lex.TokenType]bool)
+	for _, t := range e.ts {
+		if typ := e.g.Terminals[t]; !seen[typ] {
+			seen[typ] = true
+			e.types = append(e.types, typ)
+		}
+	}
+	sort.Slice(e.types, func(i, j int) bool { return e.types[i] < e.types[j] })
+	for _, typ := range e.types {
+		name, ok := lex.TokenNames[typ]
+		if !ok {
+			name = fmt.Sprintf("Token%d", int(typ))
+		}
+		e.tokens[typ] = e.identifier("T" + goName(name))
+	}
+	for _, nt := range e.g.Nonterminals() {
+		if e.g.Helpers[nt] {
+			e.names[nt] = e.identifier(e.g.SymbolName(nt))
+		}
+	}
+}
+
+func (e *emitter) header() {
+	from := ""
+	if e.opts.Source != "" {
+		from = " from " + e.opts.Source
+	}
+	e.printf("// Code generated by parsegen%s. DO NOT EDIT.\n\n", from)
+	e.printf("package %s\n\n", e.opts.Package)
+	e.printf("import (\n\t\"kugg/compilers/lex\"\n\t\"kugg/compilers/parse\"\n)\n\n")
+}
+
+//tables writes the node and token types with their names, and the tokens the terminals match
+func (e *emitter) tables() {
+	e.printf("//Token types, as lexed by the lexer of the grammar\nconst (\n")
+	for _, typ := range e.types {
+		e.printf("\t%s lex.TokenType = %d\n", e.tokens[typ], int(typ))
+	}
+	e.printf(")\n\n//Node types, the non-terminals first\nconst (\n")
+	for _, s := range append(append([]SymbolType{}, e.nts...), e.ts...) {
+		e.printf("\t%s parse.NodeType = %d\n", e.names[s], int(s))
+	}
+	e.printf(")\n\n//TokenNames are the names of the token types, registered in lex.TokenNames\n")
+	e.printf("var TokenNames = map[lex.TokenType]string{\n")
+	for _, typ := range e.types {
+		name, ok := lex.TokenNames[typ]
+		if !ok {
+			name = e.tokens[typ][1:]
+		}
+		e.printf("\t%s: %s,\n", e.tokens[typ], goString(name))
+	}
+	e.printf("}\n\n//NodeNames are the names of the node types, registered in parse.NodeNames\n")
+	e.printf("var NodeNames = map[parse.NodeType]string{\n")
+	for _, s := range append(append([]SymbolType{}, e.nts...), e.ts...) {
+		e.printf("\t%s: %s,\n", e.names[s], goString(e.g.SymbolName(s)))
+	}
+	e.printf("}\n\n")
+	e.printf(`func init() {
+	for typ, name := range TokenNames {
+		lex.TokenNames[typ] = name
+	}
+	for typ, name := range NodeNames {
+		parse.NodeNames[typ] = name
+	}
+}
+
+//terminal is the token a terminal matches
+type terminal struct {
+	typ    lex.TokenType
+	lexeme string // Any lexeme if empty
+}
+
+var terminals = map[parse.NodeType]terminal{
+`)
+	for _, t := range e.ts {
+		e.printf("\t%s: {%s, %s},\n", e.names[t], e.tokens[e.g.Terminals[t]], goString(e.g.Lexemes[t]))
+	}
+	e.printf("}\n\n")
+}
+
+//goString quotes a string, with backquotes if it has double quotes
+func goString(s string) string {
+	if strings.Contains(s, `"`) && strconv.CanBackquote(s) {
+		return "`" + s + "`"
+	}
+	return strconv.Quote(s)
+}
+
+//parse writes the entry point, and expect which parses the terminals
+func (e *emitter) parse() {
+	e.printf(`//Parse parses the start symbol %[1]s, up to the end of the input. It is the parsing entry point for parse.NewTree.
+func Parse(t *parse.Tree) {
+	%[2]s(t)
+	if tok := t.Next(); tok.Type() != lex.EOF_Token {
+		t.Unexpected(tok, "end of input")
+	}
+}
+
+//expect adds a terminal node of the next token, which must match the terminal
+func expect(t *parse.Tree, typ parse.NodeType) {
+	tok := t.Next()
+	want := terminals[typ]
+	if tok.Type() != want.typ || want.lexeme != "" && tok.Lexeme() != want.lexeme {
+		t.Unexpected(tok, NodeNames[typ])
+	}
+	t.AddTerminal(typ, tok).Commit()
+}
+`, e.g.Start, e.function(e.g.Start))
+}
+
+func (e *emitter) function(nt SymbolType) string {
+	return "parse" + e.names[nt]
+}
+
+//nonterminal writes the function of a non-terminal
+func (e *emitter) nonterminal(nt SymbolType) {
+	alts := e.ll.alts(nt)
+	e.printf("\n//%s parses\n//\n", e.function(nt))
+	for _, i := range alts {
+		e.printf("//\t%s\n", e.g.productionString(e.g.Productions[i]))
+	}
+	if e.g.Helpers[nt] {
+		e.printf("//\n//Its symbols are added to the node of its parent.\n")
+	}
+	e.printf("func %s(t *parse.Tree) {\n", e.function(nt))
+	if !e.g.Helpers[nt] {
+		e.printf("\tparent := t.Curr\n\tn := t.AddNonTerminal(%s, t.Peek())\n\tt.Curr = n\n", e.names[nt])
+	}
+	if len(alts) == 1 {
+		e.symbols(e.g.Productions[alts[0]].RHS, "\t")
+	} else {
+		e.printf("\tswitch tok := t.Peek(); {\n")
+		for _, i := range alts {
+			if conds := e.conditions(nt, i); len(conds) > 0 {
+				e.printf("\tcase %s:\n", strings.Join(conds, ",\n\t\t"))
+				e.symbols(e.g.Productions[i].RHS, "\t\t")
+			}
+		}
+		var expected []string
+		for _, s := range e.ll.Analysis.Expected(nt) {
+			expected = append(expected, goString(s))
+		}
+		e.printf("\tdefault:\n\t\tt.Unexpected(tok, parse.OneOf{%s})\n\t}\n", strings.Join(expected, ", "))
+	}
+	if !e.g.Helpers[nt] {
+		e.printf("\tn.Commit()\n\tt.Curr = parent\n")
+	}
+	e.printf("}\n")
+}
+
+func (e *emitter) symbols(rhs SententialForm, indent string) {
+	for _, s := range rhs {
+		if e.g.IsTerminal(s) {
+			e.printf("%sexpect(t, %s)\n", indent, e.names[s])
+		} else {
+			e.printf("%s%s(t)\n", indent, e.function(s))
+		}
+	}
+}
+
+//conditions returns the conditions on the next token which predict a production of a non-terminal,
+//one per lookahead. Like the LL1 table, a token of a quoted terminal predicting another production
+//doesn't predict it by its token type.
+func (e *emitter) conditions(nt SymbolType, prod int) []string {
+	row := e.ll.Table[nt]
+	var conds []string
+	seen := make(map[string]bool)
+	for _, la := range e.ll.lookaheads(nt, prod).Sorted() {
+		var cond string
+		switch lexeme, ok := e.g.Lexemes[la]; {
+		case la == EndOfInput:
+			cond = "tok.Type() == lex.EOF_Token"
+		case ok:
+			cond = fmt.Sprintf("tok.Type() == %s && tok.Lexeme() == %s", e.tokens[e.g.Terminals[la]], goString(lexeme))
+		default:
+			typ := e.g.Terminals[la]
+			cond = fmt.Sprintf("tok.Type() == %s", e.tokens[typ])
+			for _, t := range e.ts {
+				if j, found := row[t]; found && j != prod && e.g.Terminals[t] == typ {
+					if lexeme, ok := e.g.Lexemes[t]; ok {
+						cond += fmt.Sprintf(" && tok.Lexeme() != %s", goString(lexeme))
+					}
+				}
+			}
+		}
+		if !seen[cond] {
+			seen[cond] = true
+			conds = append(conds, cond)
+		}
+	}
+	return conds
+}
+
+//alts returns the indices of the productions of a non-terminal
+func (t *LL1) alts(nt SymbolType) []int {
+	var alts []int
+	for i, p := range t.Grammar.Productions {
+		if p.LHS == nt {
+			alts = append(alts, i)
+		}
+	}
+	return alts
+}
+
+//lookaheads returns the terminals predicting a production in the table
+func (t *LL1) lookaheads(nt SymbolType, prod int) SymbolSet {
+	las := make(SymbolSet)
+	for la, i := range t.Table[nt] {
+		if i == prod {
+			las[la] = true
+		}
+	}
+	return las
+}
@@ -0,0 +1,510 @@
+package Gparse
+
+import (
+	"fmt"
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+	"math"
+	"strings"
+)
+
+//Forest is a shared packed parse forest: every parse of an input, sharing the nodes of a symbol over a span.
+//
+//Disambiguate filters the alternatives of its nodes, and Tree and Trees build parse.Trees from it.
+type Forest struct {
+	Grammar *Grammar
+	Name    string
+	Source  string
+	Tokens  []lex.Token //The tokens parsed, ending with the EOF token
+	Root    *ForestNode //The node of the start symbol over every token
+}
+
+//ForestNode is a symbol derived from the tokens [Start,End)
+type ForestNode struct {
+	Symbol     SymbolType
+	Start, End int
+	Token      lex.Token //The token of a terminal
+
+	terminal bool
+	dot      int //The position in the production of intermediate nodes, which stand for the first children of an alternative
+	families []family
+	leo      []leoFamily   //Families completed by Leo items, until the parse builds them
+	alts     []Alternative //The alternatives, once expanded
+	expanded bool
+}
+
+//family is a packed node: a derivation of a node by a production, with the node of the last child,
+//and the node of the children before it
+type family struct {
+	prod        int
+	left, right *ForestNode
+}
+
+func (n *ForestNode) addFamily(prod int, left, right *ForestNode) {
+	f := family{prod, left, right}
+	for _, g := range n.families {
+		if g == f {
+			return
+		}
+	}
+	n.families = append(n.families, f)
+}
+
+func (n *ForestNode) addLeo(link *leoLink, v *ForestNode) {
+	f := leoFamily{link, v}
+	for _, g := range n.leo {
+		if g == f {
+			return
+		}
+	}
+	n.leo = append(n.leo, f)
+}
+
+//Alternative is a derivation of a node by a production, with the nodes of its right hand side
+type Alternative struct {
+	Production int //Index in Grammar.Productions
+	Children   []*ForestNode
+}
+
+//IsTerminal reports whether the node is a terminal
+func (n *ForestNode) IsTerminal() bool {
+	return n.terminal
+}
+
+//Alternatives returns the derivations of a non-terminal node, which Disambiguate may have filtered
+func (n *ForestNode) Alternatives() []Alternative {
+	if !n.expanded {
+		for _, f := range n.families {
+			for _, children := range f.left.prefixes() {
+				if f.right != nil {
+					children = append(children, f.right)
+				}
+				n.alts = append(n.alts, Alternative{f.prod, children})
+			}
+		}
+		n.expanded = true
+	}
+	return n.alts
+}
+
+//prefixes returns the lists of children an intermediate node stands for
+func (n *ForestNode) prefixes() [][]*ForestNode {
+	if n == nil {
+		return [][]*ForestNode{nil}
+	}
+	if n.dot == 0 {
+		return [][]*ForestNode{{n}}
+	}
+	var lists [][]*ForestNode
+	for _, f := range n.families {
+		for _, left := range f.left.prefixes() {
+			lists = append(lists, append(append([]*ForestNode{}, left...), f.right))
+		}
+	}
+	return lists
+}
+
+func (n *ForestNode) String() string {
+	var f *Forest
+	return f.nodeString(n)
+}
+
+//nodeString prints a node with the names of the grammar of the forest
+func (f *Forest) nodeString(n *ForestNode) string {
+	var g *Grammar
+	if f != nil {
+		g = f.Grammar
+	}
+	return fmt.Sprintf("%s[%d:%d]", g.SymbolName(n.Symbol), n.Start, n.End)
+}
+
+//alternativeString prints an alternative with the spans of its children
+func (f *Forest) alternativeString(a Alternative) string {
+	children := make([]string, len(a.Children))
+	for i, c := range a.Children {
+		children[i] = f.nodeString(c)
+	}
+	if len(children) == 0 {
+		children = append(children, "ε")
+	}
+	return fmt.Sprintf("%s -> %s", f.Grammar.SymbolName(f.Grammar.Productions[a.Production].LHS), strings.Join(children, " "))
+}
+
+//walk calls visit on every non-terminal node reachable from the root, once, before its children
+func (f *Forest) walk(visit func(n *ForestNode)) {
+	seen := make(map[*ForestNode]bool)
+	var walk func(n *ForestNode)
+	walk = func(n *ForestNode) {
+		if n.terminal || seen[n] {
+			return
+		}
+		seen[n] = true
+		visit(n)
+		for _, a := range n.Alternatives() {
+			for _, c := range a.Children {
+				walk(c)
+			}
+		}
+	}
+	walk(f.Root)
+}
+
+//Ambiguities returns the nodes with more than one alternative
+func (f *Forest) Ambiguities() []*ForestNode {
+	var ns []*ForestNode
+	f.walk(func(n *ForestNode) {
+		if len(n.Alternatives()) > 1 {
+			ns = append(ns, n)
+		}
+	})
+	return ns
+}
+
+//String prints every non-terminal node with its alternatives, marking ambiguous nodes with "*"
+func (f *Forest) String() string {
+	var sb strings.Builder
+	f.walk(func(n *ForestNode) {
+		alts := n.Alternatives()
+		mark := ""
+		if len(alts) > 1 {
+			mark = " *"
+		}
+		fmt.Fprintf(&sb, "%s%s\n", f.nodeString(n), mark)
+		for _, a := range alts {
+			fmt.Fprintf(&sb, "\t%s\n", f.alternativeString(a))
+		}
+	})
+	return sb.String()
+}
+
+//Count returns the number of trees in the forest, up to math.MaxInt.
+//Trees of cyclic grammars, which have infinitely many, are counted without their cycles.
+func (f *Forest) Count() int {
+	counts := make(map[*ForestNode]int)
+	onStack := make(map[*ForestNode]bool)
+	var count func(n *ForestNode) int
+	count = func(n *ForestNode) int {
+		if n.terminal {
+			return 1
+		}
+		if c, ok := counts[n]; ok {
+			return c
+		}
+		if onStack[n] {
+			return 0
+		}
+		onStack[n] = true
+		total := 0
+		for _, a := range n.Alternatives() {
+			product := 1
+			for _, c := range a.Children {
+				k := count(c)
+				if k != 0 && product > math.MaxInt/k {
+					product = math.MaxInt
+				} else {
+					product *= k
+				}
+			}
+			if total > math.MaxInt-product {
+				total = math.MaxInt
+			} else {
+				total += product
+			}
+		}
+		delete(onStack, n)
+		counts[n] = total
+		return total
+	}
+	return count(f.Root)
+}
+
+//Filter chooses among the alternatives of a node, see Disambiguate
+type Filter func(n *ForestNode, alts []Alternative) []Alternative
+
+//Disambiguate filters the alternatives of every node, after those of its children.
+//
+//Alternatives with a child left without alternatives are removed first. It fails if the root is left without any.
+func (f *Forest) Disambiguate(filters ...Filter) error {
+	const (
+		visiting = iota + 1
+		done
+	)
+	state := make(map[*ForestNode]int)
+	var visit func(n *ForestNode)
+	visit = func(n *ForestNode) {
+		if n.terminal || state[n] != 0 {
+			return
+		}
+		state[n] = visiting
+		var alts []Alternative
+	next:
+		for _, a := range n.Alternatives() {
+			for _, c := range a.Children {
+				visit(c)
+				if state[c] == done && !c.terminal && len(c.alts) == 0 {
+					continue next
+				}
+			}
+			alts = append(alts, a)
+		}
+		for _, filter := range filters {
+			alts = filter(n, alts)
+		}
+		n.alts = alts
+		state[n] = done
+	}
+	visit(f.Root)
+	if len(f.Root.alts) == 0 {
+		return fmt.Errorf("Every parse of %s was rejected.", f.Name)
+	}
+	return nil
+}
+
+func productionSet(prods []int) map[int]bool {
+	set := make(map[int]bool)
+	for _, p := range prods {
+		set[p] = true
+	}
+	return set
+}
+
+//Reject removes the nodes which can be derived by one of the productions, like {reject} in SDF,
+//e.g. Identifier -> Keyword keeps keywords from being identifiers
+func Reject(prods ...int) Filter {
+	reject := productionSet(prods)
+	return func(n *ForestNode, alts []Alternative) []Alternative {
+		for _, a := range alts {
+			if reject[a.Production] {
+				return nil
+			}
+		}
+		return alts
+	}
+}
+
+//Prefer keeps the alternatives derived by one of the productions, if there are any
+func Prefer(prods ...int) Filter {
+	prefer := productionSet(prods)
+	return func(n *ForestNode, alts []Alternative) []Alternative {
+		var preferred []Alternative
+		for _, a := range alts {
+			if prefer[a.Production] {
+				preferred = append(preferred, a)
+			}
+		}
+		if len(preferred) == 0 {
+			return alts
+		}
+		return preferred
+	}
+}
+
+//only reports whether every alternative of a non-terminal node is accepted
+func (n *ForestNode) only(accept func(prod int) bool) bool {
+	if n.terminal || len(n.alts) == 0 {
+		return false
+	}
+	for _, a := range n.alts {
+		if !accept(a.Production) {
+			return false
+		}
+	}
+	return true
+}
+
+//Priority removes the alternatives with a child derived only by productions of a lower priority.
+//The levels list productions from the highest priority, like E = E "*" E > E = E "+" E in SDF.
+func Priority(levels ...[]int) Filter {
+	level := make(map[int]int)
+	for i, prods := range levels {
+		for _, p := range prods {
+			level[p] = i
+		}
+	}
+	return func(n *ForestNode, alts []Alternative) []Alternative {
+		var kept []Alternative
+		for _, a := range alts {
+			l, ok := level[a.Production]
+			lower := func(prod int) bool {
+				m, ok := level[prod]
+				return ok && m > l
+			}
+			if ok && anyChild(a.Children, func(c *ForestNode) bool { return c.only(lower) }) {
+				continue
+			}
+			kept = append(kept, a)
+		}
+		return kept
+	}
+}
+
+func anyChild(children []*ForestNode, f func(*ForestNode) bool) bool {
+	for _, c := range children {
+		if f(c) {
+			return true
+		}
+	}
+	return false
+}
+
+//Associativity removes the alternatives of a group of productions of the same priority, which have a child
+//derived only by the group as their last child for Left, as their first for Right, or as either for NonAssoc
+func Associativity(assoc Assoc, prods ...int) Filter {
+	group := productionSet(prods)
+	inGroup := func(prod int) bool { return group[prod] }
+	return func(n *ForestNode, alts []Alternative) []Alternative {
+		var kept []Alternative
+		for _, a := range alts {
+			if k := len(a.Children); group[a.Production] && k > 0 {
+				first, last := a.Children[0].only(inGroup), a.Children[k-1].only(inGroup)
+				if assoc == Left && last || assoc == Right && first || assoc == NonAssoc && (first || last) {
+					continue
+				}
+			}
+			kept = append(kept, a)
+		}
+		return kept
+	}
+}
+
+//Chooser picks the index of an alternative of a node, see Forest.Tree
+type Chooser func(n *ForestNode, alts []Alternative) int
+
+//derivation is a tree of the forest
+type derivation struct {
+	node     *ForestNode
+	alt      Alternative
+	children []*derivation
+}
+
+//derive chooses a finite tree of a node, or returns nil if there is none
+func (f *Forest) derive(n *ForestNode, choose Chooser, onStack map[*ForestNode]bool) *derivation {
+	if n.terminal {
+		return &derivation{node: n}
+	}
+	onStack[n] = true
+	defer delete(onStack, n)
+	var alts []Alternative
+	for _, a := range n.Alternatives() {
+		if !anyChild(a.Children, func(c *ForestNode) bool { return onStack[c] }) {
+			alts = append(alts, a)
+		}
+	}
+	for len(alts) > 0 {
+		i := 0
+		if choose != nil {
+			i = choose(n, alts)
+		}
+		d := &derivation{node: n, alt: alts[i]}
+		for _, c := range alts[i].Children {
+			cd := f.derive(c, choose, onStack)
+			if cd == nil {
+				d = nil
+				break
+			}
+			d.children = append(d.children, cd)
+		}
+		if d != nil {
+			return d
+		}
+		alts = append(alts[:i:i], alts[i+1:]...)
+	}
+	return nil
+}
+
+//derivations returns up to max trees of a node
+func (f *Forest) derivations(n *ForestNode, max int, memo map[*ForestNode][]*derivation, onStack map[*ForestNode]bool) []*derivation {
+	if n.terminal {
+		return []*derivation{{node: n}}
+	}
+	if ds, ok := memo[n]; ok {
+		return ds
+	}
+	onStack[n] = true
+	var ds []*derivation
+	for _, a := range n.Alternatives() {
+		combos := [][]*derivation{nil}
+		for _, c := range a.Children {
+			if onStack[c] {
+				combos = nil
+				break
+			}
+			var next [][]*derivation
+			for _, combo := range combos {
+				for _, cd := range f.derivations(c, max, memo, onStack) {
+					if len(next) < max {
+						next = append(next, append(append([]*derivation{}, combo...), cd))
+					}
+				}
+			}
+			combos = next
+		}
+		for _, combo := range combos {
+			if len(ds) < max {
+				ds = append(ds, &derivation{n, a, combo})
+			}
+		}
+	}
+	delete(onStack, n)
+	memo[n] = ds
+	return ds
+}
+
+//build adds the nodes of a tree of the forest to a parent, splicing helpers into it
+func (f *Forest) build(tree *parse.Tree, parent parse.Node, d *derivation) {
+	n := d.node
+	if n.terminal {
+		parent.AddTerminal(parse.NodeType(n.Symbol), n.Token).Commit()
+		return
+	}
+	p := f.Grammar.Productions[d.alt.Production]
+	defer tree.Trace(f.Grammar.productionString(p))()
+	if f.Grammar.Helpers[p.LHS] {
+		for _, c := range d.children {
+			f.build(tree, parent, c)
+		}
+		return
+	}
+	var first lex.Token
+	if n.Start < len(f.Tokens) {
+		first = f.Tokens[n.Start]
+	}
+	node := parent.AddNonTerminal(parse.NodeType(p.LHS), first)
+	for _, c := range d.children {
+		f.build(tree, node, c)
+	}
+	node.Commit()
+}
+
+//materialize builds a parse.Tree of a tree of the forest
+func (f *Forest) materialize(d *derivation) (*parse.Tree, error) {
+	tree := parse.NewTree(f.Name, f.Source, func(tree *parse.Tree) {
+		for tok := tree.Next(); tok != nil && tok.Type() != lex.EOF_Token; tok = tree.Next() {
+		}
+		f.build(tree, tree.Root, d)
+	})
+	return tree, tree.Parse(lex.Replay(f.Name, f.Source, f.Tokens))
+}
+
+//Tree builds the parse.Tree of the alternatives chosen at every node, or of the first ones for a nil Chooser.
+//Alternatives which would make the tree infinite are left out.
+func (f *Forest) Tree(choose Chooser) (*parse.Tree, error) {
+	d := f.derive(f.Root, choose, make(map[*ForestNode]bool))
+	if d == nil {
+		return nil, fmt.Errorf("Every parse of %s is infinite.", f.Name)
+	}
+	return f.materialize(d)
+}
+
+//Trees builds up to max trees of the forest
+func (f *Forest) Trees(max int) ([]*parse.Tree, error) {
+	var trees []*parse.Tree
+	for _, d := range f.derivations(f.Root, max, make(map[*ForestNode][]*derivation), make(map[*ForestNode]bool)) {
+		tree, err := f.materialize(d)
+		if err != nil {
+			return nil, err
+		}
+		trees = append(trees, tree)
+	}
+	return trees, nil
+}
@@ -0,0 +1,318 @@
+package Gparse
+
+import (
+	"fmt"
+	"kugg/compilers/lex"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+//Samples are lexemes of each token type, which Generator renders terminals without a lexeme with.
+//Languages register them next to their lex.TokenNames.
+var Samples = map[lex.TokenType][]string{}
+
+//Generator produces random sentences of a grammar, to fuzz its parsers.
+//
+//It expands the non-terminals from the start symbol, choosing their alternatives at random by their weights,
+//among those which can finish within MaxDepth nested productions and MaxSize tokens.
+//When none can, it takes the alternative finishing soonest, so sentences can exceed the limits
+//only as much as the grammar forces them to. Mutate breaks sentences into near-valid inputs.
+//
+//Seed adds them to the seed corpus of a fuzz test:
+//
+//	func FuzzParse(f *testing.F) {
+//		gen, err := Gparse.NewGenerator(arith.Grammar(), 1)
+//		...
+//		gen.Seed(f, 100, 100)
+//		f.Fuzz(func(t *testing.T, source string) {
+//			p.Parse("fuzz", source, arith.LexAny)
+//		})
+//	}
+type Generator struct {
+	Grammar   *Grammar
+	Rand      *rand.Rand
+	MaxDepth  int                     //The number of nested productions to stay within, 16 by default
+	MaxSize   int                     //The number of tokens to stay within, 64 by default
+	Weights   map[int]float64         //The weights of the productions, by index in Grammar.Productions, 1 if missing. 0 to avoid one.
+	Mutations []Mutation              //The mutations Mutate chooses from, all of them if empty
+	Separator string                  //Put between lexemes by Render, a space by default
+	Samples   map[SymbolType][]string //The lexemes of each terminal
+
+	alts   map[SymbolType][]int
+	tokens []SymbolType       //The terminals, sorted so that the same seed mutates alike
+	size   map[SymbolType]int //The fewest tokens derived by each symbol
+	height map[SymbolType]int //The fewest nested productions to derive a string of terminals from each symbol
+}
+
+//NewGenerator creates a generator of a grammar, seeding its random numbers.
+//It fails if a symbol derives no string of terminals, or a terminal has neither a lexeme nor Samples.
+func NewGenerator(g *Grammar, seed int64) (*Generator, error) {
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+	gen := &Generator{
+		Grammar:   g,
+		Rand:      rand.New(rand.NewSource(seed)),
+		MaxDepth:  16,
+		MaxSize:   64,
+		Weights:   make(map[int]float64),
+		Mutations: allMutations,
+		Separator: " ",
+		Samples:   make(map[SymbolType][]string),
+		alts:      make(map[SymbolType][]int),
+		size:      make(map[SymbolType]int),
+		height:    make(map[SymbolType]int),
+	}
+	for t, typ := range g.Terminals {
+		if lexeme, ok := g.Lexemes[t]; ok {
+			gen.Samples[t] = []string{lexeme}
+		} else if len(Samples[typ]) > 0 {
+			gen.Samples[t] = Samples[typ]
+		} else {
+			return nil, fmt.Errorf("Terminal %s of token type %d has no sample lexemes, see Samples.", g.SymbolName(t), int(typ))
+		}
+		gen.tokens = append(gen.tokens, t)
+	}
+	sort.Slice(gen.tokens, func(i, j int) bool { return gen.tokens[i] < gen.tokens[j] })
+	for i, p := range g.Productions {
+		gen.alts[p.LHS] = append(gen.alts[p.LHS], i)
+	}
+
+	for s, w := range g.shortest() {
+		gen.size[s] = len(w)
+	}
+	for t := range g.Terminals {
+		gen.height[t] = 0
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, p := range g.Productions {
+			h, ok := gen.prodHeight(p)
+			if old, found := gen.height[p.LHS]; ok && (!found || h < old) {
+				gen.height[p.LHS] = h
+				changed = true
+			}
+		}
+	}
+	for _, nt := range g.Nonterminals() {
+		if _, ok := gen.height[nt]; !ok {
+			return nil, fmt.Errorf("Symbol %s derives no string of terminals.", g.SymbolName(nt))
+		}
+	}
+	return gen, nil
+}
+
+//prodHeight returns the fewest nested productions to derive a string of terminals with a production,
+//if the heights of its symbols are known
+func (gen *Generator) prodHeight(p Production) (int, bool) {
+	h := 1
+	for _, s := range p.RHS {
+		sh, ok := gen.height[s]
+		if !ok {
+			return 0, false
+		}
+		if sh+1 > h {
+			h = sh + 1
+		}
+	}
+	return h, true
+}
+
+func (gen *Generator) prodSize(p Production) int {
+	n := 0
+	for _, s := range p.RHS {
+		n += gen.size[s]
+	}
+	return n
+}
+
+//Sentence is a string of terminals of a grammar, with a lexeme for each
+type Sentence struct {
+	Symbols   SententialForm
+	Lexemes   []string
+	Mutations []Mutation //The mutations applied to the sentence, if any
+}
+
+//Valid returns whether no mutations were applied to the sentence.
+//A mutated sentence may still happen to be valid.
+func (s Sentence) Valid() bool {
+	return len(s.Mutations) == 0
+}
+
+//generation holds the state of generating a sentence
+type generation struct {
+	gen     *Generator
+	out     Sentence
+	pending int //The fewest tokens of the symbols left to expand
+}
+
+//Generate returns a random sentence of the grammar
+func (gen *Generator) Generate() Sentence {
+	r := &generation{gen: gen, pending: gen.size[gen.Grammar.Start]}
+	r.expand(gen.Grammar.Start, 0)
+	return r.out
+}
+
+func (r *generation) expand(s SymbolType, depth int) {
+	gen := r.gen
+	r.pending -= gen.size[s]
+	if gen.Grammar.IsTerminal(s) {
+		r.out.Symbols = append(r.out.Symbols, s)
+		r.out.Lexemes = append(r.out.Lexemes, gen.lexeme(s))
+		return
+	}
+	p := gen.Grammar.Productions[r.choose(s, depth)]
+	r.pending += gen.prodSize(p)
+	for _, c := range p.RHS {
+		r.expand(c, depth+1)
+	}
+}
+
+//choose returns the production to expand a non-terminal with
+func (r *generation) choose(nt SymbolType, depth int) int {
+	gen := r.gen
+	var fits []int
+	total := 0.0
+	for _, i := range gen.alts[nt] {
+		p := gen.Grammar.Productions[i]
+		h, _ := gen.prodHeight(p)
+		w := gen.weight(i)
+		if w > 0 && depth+h <= gen.MaxDepth && len(r.out.Symbols)+r.pending+gen.prodSize(p) <= gen.MaxSize {
+			fits = append(fits, i)
+			total += w
+		}
+	}
+	if len(fits) > 0 {
+		x := gen.Rand.Float64() * total
+		for _, i := range fits {
+			if x -= gen.weight(i); x < 0 {
+				return i
+			}
+		}
+		return fits[len(fits)-1]
+	}
+
+	best, bestHeight, bestSize := -1, 0, 0
+	for _, i := range gen.alts[nt] {
+		p := gen.Grammar.Productions[i]
+		h, _ := gen.prodHeight(p)
+		n := gen.prodSize(p)
+		if best < 0 || h < bestHeight || h == bestHeight && n < bestSize {
+			best, bestHeight, bestSize = i, h, n
+		}
+	}
+	return best
+}
+
+func (gen *Generator) weight(prod int) float64 {
+	if w, ok := gen.Weights[prod]; ok {
+		return w
+	}
+	return 1
+}
+
+func (gen *Generator) lexeme(t SymbolType) string {
+	samples := gen.Samples[t]
+	return samples[gen.Rand.Intn(len(samples))]
+}
+
+//Render returns the source of a sentence
+func (gen *Generator) Render(s Sentence) string {
+	return strings.Join(s.Lexemes, gen.Separator)
+}
+
+//Mutation is a change to a sentence which likely makes it invalid
+type Mutation int
+
+//Mutations
+const (
+	DeleteToken    Mutation = iota //Removes a token
+	DuplicateToken                 //Repeats a token
+	SwapTokens                     //Swaps two adjacent tokens
+	InsertToken                    //Inserts a random terminal
+	ReplaceToken                   //Replaces a token by a random terminal
+)
+
+var allMutations = []Mutation{DeleteToken, DuplicateToken, SwapTokens, InsertToken, ReplaceToken}
+
+var mutationNames = map[Mutation]string{
+	DeleteToken: "delete", DuplicateToken: "duplicate", SwapTokens: "swap", InsertToken: "insert", ReplaceToken: "replace",
+}
+
+func (m Mutation) String() string {
+	return mutationNames[m]
+}
+
+//Mutate returns a sentence with n random mutations applied.
+//Without terminals in the grammar, tokens are deleted instead of inserted or replaced, and an empty sentence is left as it is.
+func (gen *Generator) Mutate(s Sentence, n int) Sentence {
+	out := Sentence{
+		Symbols:   append(SententialForm{}, s.Symbols...),
+		Lexemes:   append([]string{}, s.Lexemes...),
+		Mutations: append([]Mutation{}, s.Mutations...),
+	}
+	mutations := gen.Mutations
+	if len(mutations) == 0 {
+		mutations = allMutations
+	}
+	for k := 0; k < n; k++ {
+		m := mutations[gen.Rand.Intn(len(mutations))]
+		if len(out.Symbols) == 0 || m == SwapTokens && len(out.Symbols) < 2 {
+			m = InsertToken
+		}
+		if len(gen.tokens) == 0 && (m == InsertToken || m == ReplaceToken) {
+			if len(out.Symbols) == 0 {
+				break
+			}
+			m = DeleteToken
+		}
+		switch m {
+		case DeleteToken:
+			i := gen.Rand.Intn(len(out.Symbols))
+			out.Symbols = append(out.Symbols[:i], out.Symbols[i+1:]...)
+			out.Lexemes = append(out.Lexemes[:i], out.Lexemes[i+1:]...)
+		case DuplicateToken:
+			i := gen.Rand.Intn(len(out.Symbols))
+			out.insert(i, out.Symbols[i], out.Lexemes[i])
+		case SwapTokens:
+			i := gen.Rand.Intn(len(out.Symbols) - 1)
+			out.Symbols[i], out.Symbols[i+1] = out.Symbols[i+1], out.Symbols[i]
+			out.Lexemes[i], out.Lexemes[i+1] = out.Lexemes[i+1], out.Lexemes[i]
+		case InsertToken:
+			t := gen.terminal()
+			out.insert(gen.Rand.Intn(len(out.Symbols)+1), t, gen.lexeme(t))
+		case ReplaceToken:
+			i := gen.Rand.Intn(len(out.Symbols))
+			t := gen.terminal()
+			out.Symbols[i], out.Lexemes[i] = t, gen.lexeme(t)
+		}
+		out.Mutations = append(out.Mutations, m)
+	}
+	return out
+}
+
+func (s *Sentence) insert(i int, t SymbolType, lexeme string) {
+	s.Symbols = append(s.Symbols[:i], append(SententialForm{t}, s.Symbols[i:]...)...)
+	s.Lexemes = append(s.Lexemes[:i], append([]string{lexeme}, s.Lexemes[i:]...)...)
+}
+
+//terminal returns a random terminal of the grammar, which must have one
+func (gen *Generator) terminal() SymbolType {
+	return gen.tokens[gen.Rand.Intn(len(gen.tokens))]
+}
+
+//Corpus is where Seed adds inputs, like a *testing.F
+type Corpus interface {
+	Add(args ...interface{})
+}
+
+//Seed adds valid random sentences to a corpus, and invalid ones with a mutation or two
+func (gen *Generator) Seed(c Corpus, valid, invalid int) {
+	for i := 0; i < valid; i++ {
+		c.Add(gen.Render(gen.Generate()))
+	}
+	for i := 0; i < invalid; i++ {
+		c.Add(gen.Render(gen.Mutate(gen.Generate(), 1+gen.Rand.Intn(2))))
+	}
+}
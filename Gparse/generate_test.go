@@ -0,0 +1,60 @@
+package Gparse_test
+
+import (
+	"kugg/compilers/Gparse"
+	"kugg/compilers/Gparse/arith"
+	"kugg/compilers/parse"
+	"testing"
+)
+
+//FuzzParse checks that the LR and backtracking parsers of arith accept the same inputs, with the same trees
+func FuzzParse(f *testing.F) {
+	gen, err := Gparse.NewGenerator(arith.Grammar(), 1)
+	if err != nil {
+		f.Fatal(err)
+	}
+	lr, err := Gparse.NewLR(arith.Grammar(), Gparse.LROptions{})
+	if err != nil {
+		f.Fatal(err)
+	}
+	p, err := Gparse.NewParser(arith.Grammar())
+	if err != nil {
+		f.Fatal(err)
+	}
+	gen.Seed(f, 100, 100)
+	f.Fuzz(func(t *testing.T, source string) {
+		got, lrErr := lr.Parse("fuzz", source, arith.LexAny)
+		want, err := p.Parse("fuzz", source, arith.LexAny)
+		if (lrErr == nil) != (err == nil) {
+			t.Fatalf("%q: the LR parser returned %v, and the backtracking parser %v", source, lrErr, err)
+		}
+		if err == nil && !parse.Equal(want, got, parse.EqualOptions{}) {
+			t.Fatalf("%q parsed as\n%s\nby the LR parser, and as\n%s", source, sexpr(got.Root), sexpr(want.Root))
+		}
+	})
+}
+
+func TestMutate(t *testing.T) {
+	gen, err := Gparse.NewGenerator(arith.Grammar(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.Mutations = nil
+	s := gen.Generate()
+	if m := gen.Mutate(s, 3); len(m.Mutations) != 3 {
+		t.Errorf("%d mutations were applied without Mutations, expected 3", len(m.Mutations))
+	}
+
+	//A grammar without terminals derives only the empty sentence, which can't be mutated
+	g, err := Gparse.Load("empty.ebnf", `S = ;`, arith.LexAny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen, err = Gparse.NewGenerator(g, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := gen.Mutate(gen.Generate(), 3); len(m.Symbols) != 0 || len(m.Mutations) != 0 {
+		t.Errorf("the empty sentence was mutated to %v by %v", m.Lexemes, m.Mutations)
+	}
+}
@@ -1,11 +1,27 @@
 package Gparse
 
+import (
+	"fmt"
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+	"sort"
+	"strings"
+)
+
 /*
 Type for describing a grammar
 */
 
+//SymbolType identifies a terminal or a non-terminal of a grammar.
+//
+//The nodes built for a symbol have the parse.NodeType of the same value,
+//so symbols are named by parse.NodeNames, unless their grammar names them, see Grammar.Names.
 type SymbolType int
 
+func (s SymbolType) String() string {
+	return parse.NodeType(s).String()
+}
+
 type Symbol struct {
 	SymbolType SymbolType
 	terminal   bool
@@ -14,7 +30,311 @@ type Symbol struct {
 
 type SententialForm []SymbolType
 
+func (f SententialForm) String() string {
+	if len(f) == 0 {
+		return "ε"
+	}
+	names := make([]string, len(f))
+	for i, s := range f {
+		names[i] = s.String()
+	}
+	return strings.Join(names, " ")
+}
+
 type Production struct {
 	LHS SymbolType
 	RHS SententialForm
 }
+
+func (p Production) String() string {
+	return fmt.Sprintf("%v -> %v", p.LHS, p.RHS)
+}
+
+//Grammar is a context free grammar, whose terminals match the tokens of a lexer
+type Grammar struct {
+	Name        string
+	Start       SymbolType
+	Productions []Production
+	Terminals   map[SymbolType]lex.TokenType //The token type each terminal matches
+	Lexemes     map[SymbolType]string        //The lexeme a terminal must have as well, for quoted terminals
+	Helpers     map[SymbolType]bool          //Non-terminals made up to desugar a grammar file, see Loader
+	Positions   map[SymbolType]Position      //Where the symbols were defined, for grammars loaded from files
+	Names       map[SymbolType]string        //The names of the symbols of grammars loaded from files, see SymbolName
+}
+
+//SymbolName returns the name of a symbol in Names, or in parse.NodeNames if it has none.
+//A nil Grammar names every symbol by parse.NodeNames.
+func (g *Grammar) SymbolName(s SymbolType) string {
+	if g != nil {
+		if name, ok := g.Names[s]; ok {
+			return name
+		}
+	}
+	return s.String()
+}
+
+//RegisterNames registers the Names in parse.NodeNames, so the trees of the grammar print their nodes
+//by name, and queries and rewrite patterns can name them.
+//
+//Grammars whose symbols have the same SymbolTypes overwrite each other's names, see Loader.First.
+func (g *Grammar) RegisterNames() {
+	for s, name := range g.Names {
+		parse.NodeNames[parse.NodeType(s)] = name
+	}
+}
+
+//terminalName returns the name of a terminal, or "end of input" for EndOfInput
+func (g *Grammar) terminalName(s SymbolType) string {
+	if s == EndOfInput {
+		return "end of input"
+	}
+	return g.SymbolName(s)
+}
+
+//formString writes a sentential form with the names of the grammar
+func (g *Grammar) formString(f SententialForm) string {
+	if len(f) == 0 {
+		return "ε"
+	}
+	names := make([]string, len(f))
+	for i, s := range f {
+		names[i] = g.terminalName(s)
+	}
+	return strings.Join(names, " ")
+}
+
+//productionString writes a production with the names of the grammar
+func (g *Grammar) productionString(p Production) string {
+	return g.SymbolName(p.LHS) + " -> " + g.formString(p.RHS)
+}
+
+//String prints the productions of the grammar, one per line
+func (g *Grammar) String() string {
+	lines := make([]string, len(g.Productions))
+	for i, p := range g.Productions {
+		lines[i] = g.productionString(p)
+	}
+	return strings.Join(lines, "\n")
+}
+
+//NewGrammar creates a grammar
+func NewGrammar(start SymbolType, terminals map[SymbolType]lex.TokenType, productions ...Production) *Grammar {
+	return &Grammar{Start: start, Productions: productions, Terminals: terminals}
+}
+
+//IsTerminal reports whether a symbol is a terminal of the grammar
+func (g *Grammar) IsTerminal(s SymbolType) bool {
+	_, ok := g.Terminals[s]
+	return ok
+}
+
+//Alternatives returns the productions of a non-terminal, in the order of the grammar
+func (g *Grammar) Alternatives(lhs SymbolType) []Production {
+	var alts []Production
+	for _, p := range g.Productions {
+		if p.LHS == lhs {
+			alts = append(alts, p)
+		}
+	}
+	return alts
+}
+
+//Index returns the index of a production in Productions, or -1
+func (g *Grammar) Index(lhs SymbolType, rhs ...SymbolType) int {
+next:
+	for i, p := range g.Productions {
+		if p.LHS != lhs || len(p.RHS) != len(rhs) {
+			continue
+		}
+		for j, s := range rhs {
+			if p.RHS[j] != s {
+				continue next
+			}
+		}
+		return i
+	}
+	return -1
+}
+
+//Symbol returns the symbol of the grammar with a name, e.g. "Expr" or "\"+\"" for a quoted terminal
+func (g *Grammar) Symbol(name string) (SymbolType, bool) {
+	for s := range g.Terminals {
+		if g.SymbolName(s) == name {
+			return s, true
+		}
+	}
+	for _, s := range g.Nonterminals() {
+		if g.SymbolName(s) == name {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+//Nonterminals returns the non-terminals of the grammar, in the order of their first production
+func (g *Grammar) Nonterminals() []SymbolType {
+	seen := make(map[SymbolType]bool)
+	var nts []SymbolType
+	for _, p := range g.Productions {
+		if !seen[p.LHS] {
+			seen[p.LHS] = true
+			nts = append(nts, p.LHS)
+		}
+	}
+	return nts
+}
+
+//Validate checks that every symbol is either a terminal or has productions
+func (g *Grammar) Validate() error {
+	defined := make(map[SymbolType]bool)
+	for _, p := range g.Productions {
+		if g.IsTerminal(p.LHS) {
+			return fmt.Errorf("Terminal %s has a production %s.", g.SymbolName(p.LHS), g.productionString(p))
+		}
+		defined[p.LHS] = true
+	}
+	if !defined[g.Start] {
+		return fmt.Errorf("Start symbol %s has no productions.", g.SymbolName(g.Start))
+	}
+	for _, p := range g.Productions {
+		for _, s := range p.RHS {
+			if !defined[s] && !g.IsTerminal(s) {
+				return fmt.Errorf("Symbol %s in %s is neither a terminal nor has productions.", g.SymbolName(s), g.productionString(p))
+			}
+		}
+	}
+	return nil
+}
+
+//Nullable returns the non-terminals which derive the empty string
+func (g *Grammar) Nullable() SymbolSet {
+	nullable := make(SymbolSet)
+	for changed := true; changed; {
+		changed = false
+		for _, p := range g.Productions {
+			if !nullable[p.LHS] && nullable.HasAll(p.RHS) {
+				nullable[p.LHS] = true
+				changed = true
+			}
+		}
+	}
+	return nullable
+}
+
+//leftCorners returns the non-terminals which can start a derivation of each non-terminal in one step
+func (g *Grammar) leftCorners() map[SymbolType][]SymbolType {
+	nullable := g.Nullable()
+	left := make(map[SymbolType][]SymbolType)
+	for _, p := range g.Productions {
+		for _, s := range p.RHS {
+			if !g.IsTerminal(s) {
+				left[p.LHS] = append(left[p.LHS], s)
+			}
+			if !nullable[s] {
+				break
+			}
+		}
+	}
+	return left
+}
+
+//leftRecursion returns a cycle of non-terminals which derive themselves at their start, or nil
+func (g *Grammar) leftRecursion() []SymbolType {
+	left := g.leftCorners()
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[SymbolType]int)
+	var stack []SymbolType
+	var visit func(a SymbolType) []SymbolType
+	visit = func(a SymbolType) []SymbolType {
+		state[a] = visiting
+		stack = append(stack, a)
+		for _, b := range left[a] {
+			switch state[b] {
+			case visiting:
+				for i, s := range stack {
+					if s == b {
+						return append(append([]SymbolType{}, stack[i:]...), b)
+					}
+				}
+			case unvisited:
+				if cycle := visit(b); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[a] = done
+		return nil
+	}
+	for _, a := range g.Nonterminals() {
+		if state[a] == unvisited {
+			if cycle := visit(a); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+//terminals finds the terminals a token can be
+type terminals struct {
+	g        *Grammar
+	byType   map[lex.TokenType][]SymbolType //Terminals without lexemes by token type
+	byLexeme map[lex.TokenType]map[string]SymbolType
+}
+
+func newTerminals(g *Grammar) *terminals {
+	ts := &terminals{
+		g:        g,
+		byType:   map[lex.TokenType][]SymbolType{lex.EOF_Token: {EndOfInput}},
+		byLexeme: make(map[lex.TokenType]map[string]SymbolType),
+	}
+	//In order of SymbolType, so that the terminals of a token type are tried in the same order every time
+	syms := make([]SymbolType, 0, len(g.Terminals))
+	for s := range g.Terminals {
+		syms = append(syms, s)
+	}
+	sort.Slice(syms, func(i, j int) bool { return syms[i] < syms[j] })
+	for _, s := range syms {
+		typ := g.Terminals[s]
+		if lexeme, ok := g.Lexemes[s]; ok {
+			if ts.byLexeme[typ] == nil {
+				ts.byLexeme[typ] = make(map[string]SymbolType)
+			}
+			ts.byLexeme[typ][lexeme] = s
+		} else {
+			ts.byType[typ] = append(ts.byType[typ], s)
+		}
+	}
+	return ts
+}
+
+//lookup returns the terminal of a token which is accepted, preferring the quoted terminal of its lexeme
+func (ts *terminals) lookup(tok lex.Token, accept func(SymbolType) bool) (SymbolType, bool) {
+	if s, ok := ts.byLexeme[tok.Type()][tok.Lexeme()]; ok && accept(s) {
+		return s, true
+	}
+	for _, s := range ts.byType[tok.Type()] {
+		if accept(s) {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+//matches reports whether a token matches a terminal
+func (ts *terminals) matches(s SymbolType, tok lex.Token) bool {
+	if s == EndOfInput {
+		return tok.Type() == lex.EOF_Token
+	}
+	if typ, ok := ts.g.Terminals[s]; !ok || typ != tok.Type() {
+		return false
+	}
+	lexeme, ok := ts.g.Lexemes[s]
+	return !ok || lexeme == tok.Lexeme()
+}
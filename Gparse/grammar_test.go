@@ -0,0 +1,40 @@
+package Gparse_test
+
+import (
+	"kugg/compilers/Gparse"
+	"kugg/compilers/Gparse/arith"
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+	"testing"
+)
+
+//TestTerminalOrder checks that a token matching two terminals becomes the one with the lower SymbolType,
+//for every parser built from the grammar
+func TestTerminalOrder(t *testing.T) {
+	g := Gparse.NewGrammar(arith.Expr, map[Gparse.SymbolType]lex.TokenType{arith.Plus: arith.TNumber, arith.Number: arith.TNumber},
+		Gparse.Production{LHS: arith.Expr, RHS: Gparse.SententialForm{arith.Plus}},
+		Gparse.Production{LHS: arith.Expr, RHS: Gparse.SententialForm{arith.Number}},
+	)
+	for i := 0; i < 20; i++ {
+		ll1, err := Gparse.NewLL1(g)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lr, err := Gparse.NewLR(g, Gparse.LROptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, parseFn := range map[string]func(name, source string, lexStart lex.StateFn) (*parse.Tree, error){
+			"LL1": ll1.Parse,
+			"LR":  lr.Parse,
+		} {
+			tree, err := parseFn("7", "7", arith.LexAny)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if got := sexpr(tree.Root.Children()[0]); got != "Expr(7)" || tree.Root.Children()[0].Children()[0].Type() != parse.NodeType(arith.Number) {
+				t.Fatalf("%s parsed 7 as %s of %v", name, got, tree.Root.Children()[0].Children()[0].Type())
+			}
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package Gparse
+
+import (
+	"fmt"
+	"kugg/compilers/lex"
+	"sort"
+)
+
+//Finding is a likely mistake in a grammar, found by Lint
+type Finding struct {
+	Position        //Where the symbol of the finding was defined or first used, if the grammar was loaded from a file
+	Check    string //The check which found it, one of LintChecks
+	Msg      string
+}
+
+func (f Finding) String() string {
+	if f.Line == 0 {
+		return fmt.Sprintf("%s: %s: %s", f.File, f.Check, f.Msg)
+	}
+	return fmt.Sprintf("%v: %s: %s", f.Position, f.Check, f.Msg)
+}
+
+//LintChecks are the checks of Lint
+var LintChecks = []string{"undefined", "unreachable", "nonproductive", "left-recursion", "duplicate", "token"}
+
+//Lint checks a grammar for symbols which are neither rules nor tokens, rules which are unreachable from the
+//start symbol or derive no string of terminals, left recursion, alternatives listed twice, and terminals whose
+//token types have no name in lex.TokenNames.
+//
+//Helper non-terminals are only reported for left recursion and duplicate alternatives,
+//since they are unreachable or nonproductive along with their rules.
+func Lint(g *Grammar) []Finding {
+	l := &linter{g: g, defined: make(SymbolSet)}
+	for _, p := range g.Productions {
+		l.defined[p.LHS] = true
+	}
+	l.undefined()
+	l.unreachable()
+	l.nonproductive()
+	l.leftRecursion()
+	l.duplicates()
+	l.tokens()
+	sortFindings(l.findings)
+	return l.findings
+}
+
+//sortFindings sorts findings by their position, keeping the order of the checks at a position
+func sortFindings(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i].Position, findings[j].Position
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Col < b.Col
+	})
+}
+
+//Lint reads a grammar file like Load, and checks it with Lint. Names which are neither rules nor tokens,
+//and quoted terminals which are not lexed as one token, are reported instead of failing the load.
+//It only fails for syntax errors.
+func (l *Loader) Lint(name, source string) ([]Finding, error) {
+	ld, err := l.load(name, source, true)
+	if err != nil {
+		return nil, err
+	}
+	findings := append(ld.findings, Lint(ld.g)...)
+	sortFindings(findings)
+	return findings, nil
+}
+
+type linter struct {
+	g        *Grammar
+	defined  SymbolSet //The non-terminals with productions
+	findings []Finding
+}
+
+//report records a finding about a symbol, formatting symbols and sentential forms with the names of the grammar
+func (l *linter) report(s SymbolType, check, format string, args ...interface{}) {
+	pos, ok := l.g.Positions[s]
+	if !ok {
+		pos = Position{File: l.g.Name}
+	}
+	for i, arg := range args {
+		switch arg := arg.(type) {
+		case SymbolType:
+			args[i] = l.g.SymbolName(arg)
+		case SententialForm:
+			args[i] = l.g.formString(arg)
+		}
+	}
+	l.findings = append(l.findings, Finding{pos, check, fmt.Sprintf(format, args...)})
+}
+
+func (l *linter) undefined() {
+	if !l.defined[l.g.Start] {
+		l.report(l.g.Start, "undefined", "start symbol %v has no productions", l.g.Start)
+	}
+	seen := make(SymbolSet)
+	for _, p := range l.g.Productions {
+		for _, s := range p.RHS {
+			if !l.defined[s] && !l.g.IsTerminal(s) && !seen[s] {
+				seen[s] = true
+				l.report(s, "undefined", "%v is neither a rule nor a token", s)
+			}
+		}
+	}
+}
+
+func (l *linter) unreachable() {
+	reached := SymbolSet{l.g.Start: true}
+	for work := []SymbolType{l.g.Start}; len(work) > 0; {
+		a := work[len(work)-1]
+		work = work[:len(work)-1]
+		for _, p := range l.g.Productions {
+			if p.LHS != a {
+				continue
+			}
+			for _, s := range p.RHS {
+				if !reached[s] {
+					reached[s] = true
+					work = append(work, s)
+				}
+			}
+		}
+	}
+	for _, nt := range l.g.Nonterminals() {
+		if !reached[nt] && !l.g.Helpers[nt] {
+			l.report(nt, "unreachable", "rule %v is not reachable from %v", nt, l.g.Start)
+		}
+	}
+}
+
+func (l *linter) nonproductive() {
+	productive := make(SymbolSet)
+	for changed := true; changed; {
+		changed = false
+		for _, p := range l.g.Productions {
+			if productive[p.LHS] {
+				continue
+			}
+			ok := true
+			for _, s := range p.RHS {
+				//Undefined symbols are reported already
+				if !productive[s] && !l.g.IsTerminal(s) && l.defined[s] {
+					ok = false
+					break
+				}
+			}
+			if ok {
+				productive[p.LHS] = true
+				changed = true
+			}
+		}
+	}
+	for _, nt := range l.g.Nonterminals() {
+		if !productive[nt] && !l.g.Helpers[nt] {
+			l.report(nt, "nonproductive", "rule %v derives no string of terminals, every alternative recurses forever", nt)
+		}
+	}
+}
+
+//leftRecursion reports every group of non-terminals which derive each other at their start,
+//the strongly connected components of their left corners, with a shortest cycle through the first one
+func (l *linter) leftRecursion() {
+	left := l.g.leftCorners()
+	order := make(map[SymbolType]int)
+	for i, nt := range l.g.Nonterminals() {
+		order[nt] = i
+	}
+	for _, c := range l.g.leftComponents(left) {
+		sort.Slice(c, func(i, j int) bool { return order[c[i]] < order[c[j]] })
+		a := c[0]
+		cycle := l.cycle(a, left, c)
+		switch {
+		case cycle == nil:
+		case len(cycle) == 2:
+			l.report(a, "left-recursion", "rule %v is left recursive: %v", a, l.g.arrows(cycle))
+		default:
+			l.report(a, "left-recursion", "rule %v is indirectly left recursive: %v", a, l.g.arrows(cycle))
+		}
+	}
+}
+
+//cycle returns a shortest cycle from a back to itself within a component, or nil
+func (l *linter) cycle(a SymbolType, left map[SymbolType][]SymbolType, component []SymbolType) []SymbolType {
+	in := make(SymbolSet)
+	for _, s := range component {
+		in[s] = true
+	}
+	prev := make(map[SymbolType]SymbolType)
+	for queue := []SymbolType{a}; len(queue) > 0; queue = queue[1:] {
+		b := queue[0]
+		for _, c := range left[b] {
+			if c == a {
+				cycle := []SymbolType{a}
+				for s := b; s != a; s = prev[s] {
+					cycle = append(cycle, s)
+				}
+				cycle = append(cycle, a)
+				for i, j := 1, len(cycle)-2; i < j; i, j = i+1, j-1 {
+					cycle[i], cycle[j] = cycle[j], cycle[i]
+				}
+				return cycle
+			}
+			if _, seen := prev[c]; !seen && in[c] {
+				prev[c] = b
+				queue = append(queue, c)
+			}
+		}
+	}
+	return nil
+}
+
+func (l *linter) duplicates() {
+	seen := make(map[string]bool)
+	for _, p := range l.g.Productions {
+		k := fmt.Sprintf("%d:%s", p.LHS, key(p.RHS))
+		if seen[k] {
+			l.report(p.LHS, "duplicate", "the alternative %v of %v is listed twice", p.RHS, p.LHS)
+		}
+		seen[k] = true
+	}
+}
+
+func (l *linter) tokens() {
+	var ts []SymbolType
+	for t := range l.g.Terminals {
+		ts = append(ts, t)
+	}
+	sort.Slice(ts, func(i, j int) bool { return ts[i] < ts[j] })
+	for _, t := range ts {
+		typ := l.g.Terminals[t]
+		if typ == lex.LexingError {
+			continue //Reported by the Loader
+		}
+		if _, ok := lex.TokenNames[typ]; !ok || typ == lex.EOF_Token {
+			l.report(t, "token", "terminal %v matches token type %d, which is not a token type of lex.TokenNames", t, int(typ))
+		}
+	}
+}
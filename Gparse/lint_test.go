@@ -0,0 +1,60 @@
+package Gparse_test
+
+import (
+	"kugg/compilers/Gparse"
+	"kugg/compilers/Gparse/arith"
+	"kugg/compilers/lex"
+	"strings"
+	"testing"
+)
+
+func findingLines(findings []Gparse.Finding) string {
+	lines := make([]string, len(findings))
+	for i, f := range findings {
+		lines[i] = f.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+//TestLintSorted checks that the findings of the Loader and of Lint are sorted by position, in the order
+//of LintChecks at the same position. The helper of the repetition of Loop is not reported.
+func TestLintSorted(t *testing.T) {
+	findings, err := (&Gparse.Loader{Lex: arith.LexAny}).Lint("mixed.ebnf", `
+Expr = Expr "+" Term | Term ;
+Term = Facto | NumberToken ;
+Loop = Loop ( "*" Loop )* ;
+Term = "1 2" ;
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `
+mixed.ebnf:2:1: left-recursion: rule Expr is left recursive: Expr => Expr
+mixed.ebnf:3:8: undefined: Facto is neither a rule nor a token
+mixed.ebnf:4:1: unreachable: rule Loop is not reachable from Expr
+mixed.ebnf:4:1: nonproductive: rule Loop derives no string of terminals, every alternative recurses forever
+mixed.ebnf:4:1: left-recursion: rule Loop is left recursive: Loop => Loop
+mixed.ebnf:5:1: duplicate: rule Term is already defined at mixed.ebnf:3:1
+mixed.ebnf:5:8: token: terminal "1 2" is not lexed as one token`
+	if got := findingLines(findings); got != want[1:] {
+		t.Errorf("the findings are\n%s\nexpected\n%s", got, want[1:])
+	}
+}
+
+//TestLintGrammar lints a grammar built without a file, whose findings have no position
+func TestLintGrammar(t *testing.T) {
+	g := Gparse.NewGrammar(arith.Expr, map[Gparse.SymbolType]lex.TokenType{arith.Number: lex.TokenType(999)},
+		Gparse.Production{LHS: arith.Term, RHS: Gparse.SententialForm{arith.Number}},
+	)
+	g.Name = "built"
+	want := `
+built: undefined: start symbol Expr has no productions
+built: unreachable: rule Term is not reachable from Expr
+built: token: terminal Number matches token type 999, which is not a token type of lex.TokenNames`
+	if got := findingLines(Gparse.Lint(g)); got != want[1:] {
+		t.Errorf("the findings are\n%s\nexpected\n%s", got, want[1:])
+	}
+	if findings := Gparse.Lint(arith.Grammar()); len(findings) != 0 {
+		t.Errorf("arith has findings\n%s", findingLines(findings))
+	}
+}
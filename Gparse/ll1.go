@@ -0,0 +1,276 @@
+package Gparse
+
+import (
+	"fmt"
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+	"strings"
+)
+
+//LL1 is an LL(1) prediction table of a grammar, with a table-driven parser using it.
+//
+//The table maps a non-terminal and the terminal of the next token to the production to expand.
+//A token matching a quoted terminal is that terminal where the table has an entry for it,
+//and otherwise the terminal of its token type.
+type LL1 struct {
+	Grammar   *Grammar
+	Analysis  *Analysis
+	Table     map[SymbolType]map[SymbolType]int //Index in Grammar.Productions by non-terminal and lookahead terminal
+	Conflicts []Conflict
+
+	terminals *terminals
+}
+
+//ConflictKind tells why two productions are predicted by the same lookahead
+type ConflictKind int
+
+const (
+	FirstFirst   ConflictKind = iota //Both productions can start with the lookahead
+	FirstFollow                      //One can start with it, and the other derives ε and is followed by it
+	ShiftReduce                      //An LR state can shift the lookahead, or reduce by a production
+	ReduceReduce                     //An LR state can reduce by two productions
+)
+
+var conflictKindNames = map[ConflictKind]string{
+	FirstFirst:   "FIRST/FIRST",
+	FirstFollow:  "FIRST/FOLLOW",
+	ShiftReduce:  "shift/reduce",
+	ReduceReduce: "reduce/reduce",
+}
+
+func (k ConflictKind) String() string {
+	return conflictKindNames[k]
+}
+
+//Conflict is a lookahead predicting two productions of a non-terminal
+type Conflict struct {
+	Kind        ConflictKind
+	Nonterminal SymbolType
+	Lookahead   SymbolType
+	Productions [2]Production  //The production in the table first, and the one left out
+	Example     SententialForm //An input prefix reaching the conflict, ending with the lookahead
+
+	grammar *Grammar
+}
+
+func (c Conflict) String() string {
+	g := c.grammar
+	return fmt.Sprintf("%v conflict in %s on %s between\n\t%s\n\t%s\nexample input: %s ...",
+		c.Kind, g.SymbolName(c.Nonterminal), g.terminalName(c.Lookahead),
+		g.productionString(c.Productions[0]), g.productionString(c.Productions[1]), g.formString(c.Example))
+}
+
+//ConflictError lists the conflicts which make a grammar not LL(1)
+type ConflictError struct {
+	Grammar   string
+	Conflicts []Conflict
+}
+
+func (e *ConflictError) Error() string {
+	name := "The grammar"
+	if e.Grammar != "" {
+		name = "Grammar " + e.Grammar
+	}
+	lines := []string{fmt.Sprintf("%s is not LL(1), it has %d conflicts:", name, len(e.Conflicts))}
+	for _, c := range e.Conflicts {
+		lines = append(lines, c.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+//NewLL1 builds the LL(1) table of a grammar.
+//
+//If the grammar is not LL(1), the table is returned with a ConflictError listing every conflict,
+//and prefers the production which comes first in the grammar, like Parser.
+func NewLL1(g *Grammar) (*LL1, error) {
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+	t := &LL1{
+		Grammar:   g,
+		Analysis:  Analyze(g, 1),
+		Table:     make(map[SymbolType]map[SymbolType]int),
+		terminals: newTerminals(g),
+	}
+
+	for i, p := range g.Productions {
+		row := t.Table[p.LHS]
+		if row == nil {
+			row = make(map[SymbolType]int)
+			t.Table[p.LHS] = row
+		}
+		for _, la := range t.Analysis.Predict(p).Terminals().Sorted() {
+			j, ok := row[la]
+			if !ok {
+				row[la] = i
+				continue
+			}
+			kind := FirstFollow
+			first := t.Analysis.FirstOf(p.RHS)
+			if first.Has(la) && t.Analysis.FirstOf(g.Productions[j].RHS).Has(la) {
+				kind = FirstFirst
+			}
+			t.Conflicts = append(t.Conflicts, Conflict{
+				Kind:        kind,
+				Nonterminal: p.LHS,
+				Lookahead:   la,
+				Productions: [2]Production{g.Productions[j], p},
+				grammar:     g,
+			})
+		}
+	}
+
+	if len(t.Conflicts) > 0 {
+		prefixes := g.prefixes()
+		for i, c := range t.Conflicts {
+			t.Conflicts[i].Example = append(append(SententialForm{}, prefixes[c.Nonterminal]...), c.Lookahead)
+		}
+		return t, &ConflictError{g.Name, t.Conflicts}
+	}
+	return t, nil
+}
+
+//shortest returns a shortest string of terminals derived by each symbol
+func (g *Grammar) shortest() map[SymbolType]SententialForm {
+	short := make(map[SymbolType]SententialForm)
+	for s := range g.Terminals {
+		short[s] = SententialForm{s}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, p := range g.Productions {
+			var w SententialForm
+			ok := true
+			for _, s := range p.RHS {
+				sw, found := short[s]
+				if !found {
+					ok = false
+					break
+				}
+				w = append(w, sw...)
+			}
+			if old, found := short[p.LHS]; ok && (!found || len(w) < len(old)) {
+				short[p.LHS] = append(SententialForm{}, w...)
+				changed = true
+			}
+		}
+	}
+	return short
+}
+
+//prefixes returns a shortest string of terminals after which each non-terminal is parsed
+func (g *Grammar) prefixes() map[SymbolType]SententialForm {
+	short := g.shortest()
+	prefix := map[SymbolType]SententialForm{g.Start: {}}
+	for changed := true; changed; {
+		changed = false
+		for _, p := range g.Productions {
+			w, ok := prefix[p.LHS]
+			if !ok {
+				continue
+			}
+			w = append(SententialForm{}, w...)
+			for _, s := range p.RHS {
+				if !g.IsTerminal(s) {
+					if old, found := prefix[s]; !found || len(w) < len(old) {
+						prefix[s] = append(SententialForm{}, w...)
+						changed = true
+					}
+				}
+				sw, found := short[s]
+				if !found {
+					break
+				}
+				w = append(w, sw...)
+			}
+		}
+	}
+	return prefix
+}
+
+//Production returns the production to expand for a non-terminal at a token
+func (t *LL1) Production(nt SymbolType, tok lex.Token) (Production, bool) {
+	row := t.Table[nt]
+	s, ok := t.terminals.lookup(tok, func(s SymbolType) bool {
+		_, ok := row[s]
+		return ok
+	})
+	if !ok {
+		return Production{}, false
+	}
+	return t.Grammar.Productions[row[s]], true
+}
+
+//String prints the table, one entry per line
+func (t *LL1) String() string {
+	var sb strings.Builder
+	for _, nt := range t.Grammar.Nonterminals() {
+		row := make(SymbolSet)
+		for la := range t.Table[nt] {
+			row[la] = true
+		}
+		for _, la := range row.Sorted() {
+			g := t.Grammar
+			fmt.Fprintf(&sb, "%s, %s: %s\n", g.SymbolName(nt), g.terminalName(la), g.productionString(g.Productions[t.Table[nt][la]]))
+		}
+	}
+	return sb.String()
+}
+
+//ll1Item is a symbol to parse on the stack of the driver, or the end of a non-terminal
+type ll1Item struct {
+	sym    SymbolType
+	parent parse.Node
+	end    parse.Node //The non-terminal to finish, for end items
+	exit   func()     //Ends the trace of the production
+}
+
+//ParseFn returns a parsing entry point for parse.NewTree, which parses with the table and a stack
+func (t *LL1) ParseFn() parse.ParseFn {
+	return func(tree *parse.Tree) {
+		stack := []ll1Item{{sym: EndOfInput, parent: tree.Root}, {sym: t.Grammar.Start, parent: tree.Root}}
+		for len(stack) > 0 {
+			item := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			switch {
+			case item.end != nil:
+				item.end.Commit()
+				item.exit()
+				if t.Grammar.Helpers[SymbolType(item.end.Type())] {
+					item.parent.RemoveChild(item.end)
+					item.parent.AddChildren(item.end.Children())
+				}
+			case item.sym == EndOfInput || t.Grammar.IsTerminal(item.sym):
+				tok := tree.Next()
+				if !t.terminals.matches(item.sym, tok) {
+					tree.Unexpected(tok, t.Grammar.terminalName(item.sym))
+				}
+				if item.sym != EndOfInput {
+					item.parent.AddTerminal(parse.NodeType(item.sym), tok).Commit()
+				}
+			default:
+				tok := tree.Peek()
+				p, ok := t.Production(item.sym, tok)
+				if !ok {
+					tree.Unexpected(tok, t.Analysis.Expected(item.sym))
+				}
+				exit := tree.Trace(t.Grammar.productionString(p))
+				n := item.parent.AddNonTerminal(parse.NodeType(p.LHS), tok)
+				stack = append(stack, ll1Item{parent: item.parent, end: n, exit: exit})
+				for i := len(p.RHS) - 1; i >= 0; i-- {
+					stack = append(stack, ll1Item{sym: p.RHS[i], parent: n})
+				}
+			}
+		}
+	}
+}
+
+//Parse lexes and parses a source with the table
+func (t *LL1) Parse(name, source string, lexStart lex.StateFn) (*parse.Tree, error) {
+	l := lex.Lex(name, source)
+	l.Run(lexStart)
+	defer l.Drain()
+	tree := parse.NewTree(name, source, t.ParseFn())
+	return tree, tree.Parse(l)
+}
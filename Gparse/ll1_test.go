@@ -0,0 +1,117 @@
+package Gparse_test
+
+import (
+	"errors"
+	"kugg/compilers/Gparse"
+	"kugg/compilers/Gparse/arith"
+	"strings"
+	"testing"
+)
+
+//TestLL1Conflicts checks the conflicts of grammars which are not LL(1), and that their tables
+//prefer the production which comes first
+func TestLL1Conflicts(t *testing.T) {
+	for _, c := range []struct {
+		src   string
+		err   string
+		input string
+		tree  string
+	}{
+		{`
+S = "-" X ;
+X = A | B ;
+A = "(" NumberToken ")" ;
+B = "(" "+" ;
+`, `
+Grammar conflict.ebnf is not LL(1), it has 1 conflicts:
+FIRST/FIRST conflict in X on "(" between
+	X -> A
+	X -> B
+example input: "-" "(" ...`, "-(7)", `S(- X(A(( 7 ))))`},
+		{`
+S = "(" O NumberToken ")" ;
+O = NumberToken | ;
+`, `
+Grammar conflict.ebnf is not LL(1), it has 1 conflicts:
+FIRST/FOLLOW conflict in O on NumberToken between
+	O -> NumberToken
+	O -> ε
+example input: "(" NumberToken ...`, "(1 2)", `S(( O(1) 2 ))`},
+	} {
+		g, err := Gparse.Load("conflict.ebnf", c.src, arith.LexAny)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ll1, err := Gparse.NewLL1(g)
+		var conflicts *Gparse.ConflictError
+		if !errors.As(err, &conflicts) || err.Error() != c.err[1:] {
+			t.Errorf("building the table returned\n%v\nexpected\n%s", err, c.err[1:])
+			continue
+		}
+		if len(ll1.Conflicts) != 1 || len(conflicts.Conflicts) != 1 {
+			t.Fatalf("the table has conflicts %v", ll1.Conflicts)
+		}
+		conflict := ll1.Conflicts[0]
+		if want := g.Alternatives(conflict.Nonterminal)[0]; g.Index(want.LHS, want.RHS...) != g.Index(conflict.Productions[0].LHS, conflict.Productions[0].RHS...) {
+			t.Errorf("the table keeps %v, expected %v", conflict.Productions[0], want)
+		}
+		if last := conflict.Example[len(conflict.Example)-1]; last != conflict.Lookahead {
+			t.Errorf("the example %v does not end with the lookahead %v", conflict.Example, conflict.Lookahead)
+		}
+		tree, err := ll1.Parse(c.input, c.input, arith.LexAny)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := gsexpr(g, tree.Root.Children()[0]); got != c.tree {
+			t.Errorf("%s parses as %s, expected %s", c.input, got, c.tree)
+		}
+	}
+}
+
+//TestLL1Parse parses with the table of the expression grammar, whose repetitions are desugared into
+//helpers. The driver moves the children of the helpers to their parents.
+func TestLL1Parse(t *testing.T) {
+	g, err := Gparse.Load("expr.ebnf", `
+Expr   = Term ( ( "+" | "-" ) Term )* ;
+Term   = Factor ( ( "*" | "/" ) Factor )* ;
+Factor = "(" Expr ")" | "-" Factor | NumberToken ;
+`, arith.LexAny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ll1, err := Gparse.NewLL1(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(ll1.String(), "\n"); got != 23 {
+		t.Errorf("the table has %d entries\n%s", got, ll1)
+	}
+	for _, c := range []struct {
+		src  string
+		tree string
+		err  string
+	}{
+		{"1", `Expr(Term(Factor(1)))`, ""},
+		{"1 + 2 * 3", `Expr(Term(Factor(1)) + Term(Factor(2) * Factor(3)))`, ""},
+		{"1 - 2 + 3", `Expr(Term(Factor(1)) - Term(Factor(2)) + Term(Factor(3)))`, ""},
+		{"-(1 - 2) / 3 * 4", `Expr(Term(Factor(- Factor(( Expr(Term(Factor(1)) - Term(Factor(2))) ))) / Factor(3) * Factor(4)))`, ""},
+		{"1 +", "", `1,3 : expected one of "-", "(", NumberToken, got EOF_Token("") (type:-2).`},
+		{"1 2", "", `1,2 : expected one of end of input, "+", "-", "*", "/", ")", got NumberToken("2") (type:0).`},
+		{"(1", "", `1,2 : expected ")", got EOF_Token("") (type:-2).`},
+	} {
+		tree, err := ll1.Parse(c.src, c.src, arith.LexAny)
+		if c.err != "" {
+			if err == nil || strings.SplitN(err.Error(), "\n", 2)[0] != c.err {
+				t.Errorf("parsing %q returned %v, expected %s", c.src, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsing %q: %v", c.src, err)
+			continue
+		}
+		if got := gsexpr(g, tree.Root.Children()[0]); got != c.tree {
+			t.Errorf("%q parses as %s, expected %s", c.src, got, c.tree)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package Gparse
+
+import (
+	"fmt"
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+	"strconv"
+)
+
+//Position is a place in a grammar file
+type Position struct {
+	File      string
+	Line, Col int //Line and column, from 1
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Col)
+}
+
+//LoadError is an error in a grammar file
+type LoadError struct {
+	Position
+	Msg string
+}
+
+func (e *LoadError) Error() string {
+	return fmt.Sprintf("%v: %s", e.Position, e.Msg)
+}
+
+func positionOf(file string, tok lex.Token) Position {
+	return Position{file, tok.Line(), tok.Row() + 1}
+}
+
+func loadErrorf(file string, tok lex.Token, format string, args ...interface{}) *LoadError {
+	return &LoadError{positionOf(file, tok), fmt.Sprintf(format, args...)}
+}
+
+//Loader reads grammars in an EBNF format:
+//
+//	// Comments start with // or #
+//	Expr   = Term ( ( "+" | "-" ) Term )* ;
+//	Term   = Factor ( ( "*" | "/" ) Factor )* ;
+//	Factor = "(" Expr ")" | "-" Factor | Number ;
+//
+//A rule is defined with =, : or ::= and may end with a semicolon. The first rule is the start symbol.
+//A name is a rule, or if there is no rule of the name, a token type named in Tokens.
+//A quoted terminal matches a token with the same lexeme, and the token type it is lexed as by Lex.
+//Alternatives are separated by |, an empty alternative matches nothing, and parentheses group them.
+//An item followed by ? is optional, by * repeated, and by + repeated at least once.
+//
+//Groups and operators are desugared into helper productions, which are listed in Grammar.Helpers
+//and spliced into their parents by Parser. Every rule, token and terminal is given a SymbolType,
+//counting up from First, and its name in Grammar.Names. Call Grammar.RegisterNames to name the nodes
+//of its trees in parse.NodeNames.
+type Loader struct {
+	Lex    lex.StateFn              //The lexer of the language, to find the token types of quoted terminals
+	Tokens map[string]lex.TokenType //Token types by name, from lex.TokenNames if nil
+	First  SymbolType               //The SymbolType of the first rule
+}
+
+//Load reads a grammar from the source of a file with a name
+func (l *Loader) Load(name, source string) (*Grammar, error) {
+	ld, err := l.load(name, source, false)
+	if err != nil {
+		return nil, err
+	}
+	return ld.g, nil
+}
+
+//load parses a grammar file, and turns it into a grammar. When linting, names which are neither rules
+//nor tokens become undefined symbols, and errors in terminals become findings.
+func (l *Loader) load(name, source string, lint bool) (*loading, error) {
+	p := &ebnfParser{name: name}
+	lexer := lex.Lex(name, source)
+	lexer.Run(lexEBNF)
+	defer lexer.Drain()
+	tree := parse.NewTree(name, source, p.grammar)
+	if err := tree.Parse(lexer); err != nil {
+		if p.err != nil {
+			return nil, p.err
+		}
+		return nil, err
+	}
+
+	ld := &loading{
+		Loader:   l,
+		file:     name,
+		rules:    make(map[string]SymbolType),
+		tokens:   make(map[string]SymbolType),
+		literals: make(map[string]SymbolType),
+		next:     l.First,
+		lint:     lint,
+		g: &Grammar{
+			Name:      name,
+			Terminals: make(map[SymbolType]lex.TokenType),
+			Lexemes:   make(map[SymbolType]string),
+			Helpers:   make(map[SymbolType]bool),
+			Positions: make(map[SymbolType]Position),
+			Names:     make(map[SymbolType]string),
+		},
+	}
+	if ld.Tokens == nil {
+		ld.Tokens = make(map[string]lex.TokenType)
+		for typ, name := range lex.TokenNames {
+			ld.Tokens[name] = typ
+		}
+	}
+	if err := ld.grammar(tree.Root.Children()[0]); err != nil {
+		return nil, err
+	}
+	return ld, nil
+}
+
+//Lexers are the lexers of languages by name, for tools loading their grammars like cmd/grammarlint.
+//Packages of languages register their lexers in it.
+var Lexers = map[string]lex.StateFn{}
+
+//Load reads a grammar with a Loader of a lexer, using the token names in lex.TokenNames
+func Load(name, source string, lexStart lex.StateFn) (*Grammar, error) {
+	return (&Loader{Lex: lexStart}).Load(name, source)
+}
+
+//loading turns the parse tree of a grammar file into a Grammar
+type loading struct {
+	*Loader
+	file     string
+	g        *Grammar
+	rules    map[string]SymbolType
+	tokens   map[string]SymbolType
+	literals map[string]SymbolType
+	next     SymbolType
+	err      *LoadError
+	lint     bool
+	findings []Finding
+}
+
+//symbol creates a symbol with a name
+func (ld *loading) symbol(name string, tok lex.Token) SymbolType {
+	s := ld.next
+	ld.next++
+	ld.g.Names[s] = name
+	ld.g.Positions[s] = positionOf(ld.file, tok)
+	return s
+}
+
+//fail records the first error, or a finding of a check when linting
+func (ld *loading) fail(check string, tok lex.Token, format string, args ...interface{}) {
+	if ld.lint {
+		ld.findings = append(ld.findings, Finding{positionOf(ld.file, tok), check, fmt.Sprintf(format, args...)})
+		return
+	}
+	if ld.err == nil {
+		ld.err = loadErrorf(ld.file, tok, format, args...)
+	}
+}
+
+func (ld *loading) grammar(root parse.Node) error {
+	rules := root.Children()
+	if len(rules) == 0 {
+		return &LoadError{Position{ld.file, 1, 1}, "the grammar has no rules"}
+	}
+	for _, rule := range rules {
+		tok := rule.Children()[0].Token()
+		if s, ok := ld.rules[tok.Lexeme()]; ok {
+			ld.fail("duplicate", tok, "rule %s is already defined at %v", tok.Lexeme(), ld.g.Positions[s])
+			continue
+		}
+		ld.rules[tok.Lexeme()] = ld.symbol(tok.Lexeme(), tok)
+	}
+	ld.g.Start = ld.rules[rules[0].Children()[0].Token().Lexeme()]
+
+	for _, rule := range rules {
+		name := rule.Children()[0].Token()
+		lhs := ld.rules[name.Lexeme()]
+		for _, seq := range ld.alternatives(rule.Children()[2], name.Lexeme()) {
+			ld.g.Productions = append(ld.g.Productions, Production{lhs, seq})
+		}
+	}
+	if ld.err != nil {
+		return ld.err
+	}
+	return nil
+}
+
+//alternatives desugars the alternatives of a rule or group
+func (ld *loading) alternatives(alts parse.Node, rule string) []SententialForm {
+	var forms []SententialForm
+	for _, seq := range alts.Children() {
+		if seq.Type() != nSequence {
+			continue
+		}
+		form := SententialForm{}
+		for _, item := range seq.Children() {
+			form = append(form, ld.item(item, rule)...)
+		}
+		forms = append(forms, form)
+	}
+	return forms
+}
+
+//item desugars an item into the symbols replacing it in its sequence
+func (ld *loading) item(item parse.Node, rule string) SententialForm {
+	children := item.Children()
+	primary := children[0]
+	var op string
+	if len(children) > 1 {
+		op = children[1].Token().Lexeme()
+	}
+
+	var form SententialForm
+	switch primary.Type() {
+	case nName:
+		form = SententialForm{ld.name(primary.Token())}
+	case nString:
+		form = SententialForm{ld.literal(primary.Token())}
+	case nGroup:
+		if alts := ld.alternatives(primary.Children()[1], rule); len(alts) == 1 {
+			form = alts[0]
+		} else {
+			form = SententialForm{ld.helper(rule, "group", item.Token(), alts...)}
+		}
+	}
+
+	switch op {
+	case "?":
+		return SententialForm{ld.helper(rule, "opt", item.Token(), form, SententialForm{})}
+	case "*":
+		return SententialForm{ld.star(rule, item.Token(), form)}
+	case "+":
+		return append(form, ld.star(rule, item.Token(), form))
+	}
+	return form
+}
+
+//star creates a helper H = form H | ε
+func (ld *loading) star(rule string, tok lex.Token, form SententialForm) SymbolType {
+	h := ld.helper(rule, "rep", tok)
+	ld.g.Productions = append(ld.g.Productions,
+		Production{h, append(append(SententialForm{}, form...), h)},
+		Production{h, SententialForm{}})
+	return h
+}
+
+//helper creates a helper non-terminal with alternatives
+func (ld *loading) helper(rule, kind string, tok lex.Token, alts ...SententialForm) SymbolType {
+	h := ld.symbol(fmt.Sprintf("%s_%s%d", rule, kind, int(ld.next-ld.First)), tok)
+	ld.g.Helpers[h] = true
+	for _, alt := range alts {
+		ld.g.Productions = append(ld.g.Productions, Production{h, alt})
+	}
+	return h
+}
+
+//name resolves a name to a rule or a token
+func (ld *loading) name(tok lex.Token) SymbolType {
+	name := tok.Lexeme()
+	if s, ok := ld.rules[name]; ok {
+		return s
+	}
+	if s, ok := ld.tokens[name]; ok {
+		return s
+	}
+	typ, ok := ld.Tokens[name]
+	if !ok && !ld.lint {
+		ld.fail("undefined", tok, "%s is neither a rule nor a token", name)
+		return ld.next
+	}
+	s := ld.symbol(name, tok)
+	ld.tokens[name] = s
+	if ok {
+		ld.g.Terminals[s] = typ
+	}
+	return s
+}
+
+//literal resolves a quoted terminal, lexing it to find its token type
+func (ld *loading) literal(tok lex.Token) SymbolType {
+	quoted := tok.Lexeme()
+	lexeme := quoted[1 : len(quoted)-1]
+	if quoted[0] == '"' {
+		var err error
+		if lexeme, err = strconv.Unquote(quoted); err != nil {
+			ld.fail("token", tok, "bad string %s: %v", quoted, err)
+			return ld.unlexed(tok, quoted)
+		}
+	}
+	if s, ok := ld.literals[lexeme]; ok {
+		return s
+	}
+	if ld.Lex == nil {
+		ld.fail("token", tok, "quoted terminal %s needs the lexer of the language", quoted)
+		return ld.unlexed(tok, lexeme)
+	}
+	lexed := lex.LexAll(ld.file, lexeme, ld.Lex)
+	if len(lexed.Tokens) == 0 || lexed.Tokens[0].Lexeme() != lexeme || lexed.Tokens[0].Type() == lex.LexingError {
+		ld.fail("token", tok, "terminal %s is not lexed as one token", quoted)
+		return ld.unlexed(tok, lexeme)
+	}
+	s := ld.symbol(strconv.Quote(lexeme), tok)
+	ld.literals[lexeme] = s
+	ld.g.Terminals[s] = lexed.Tokens[0].Type()
+	ld.g.Lexemes[s] = lexeme
+	return s
+}
+
+//unlexed returns a terminal matching lexing errors for a quoted terminal which matches no token,
+//so linting goes on after reporting it once
+func (ld *loading) unlexed(tok lex.Token, lexeme string) SymbolType {
+	if !ld.lint {
+		return ld.next
+	}
+	s := ld.symbol(strconv.Quote(lexeme), tok)
+	ld.literals[lexeme] = s
+	ld.g.Terminals[s] = lex.LexingError
+	ld.g.Lexemes[s] = lexeme
+	return s
+}
@@ -0,0 +1,172 @@
+package Gparse_test
+
+import (
+	"fmt"
+	"kugg/compilers/Gparse"
+	"kugg/compilers/Gparse/arith"
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const listGrammar = `
+List  = "(" Items ")" ;
+Items = Items "+" NumberToken | NumberToken ;
+`
+
+//TestLoadNames checks that loading grammars names their symbols in the grammar only, so grammars whose
+//symbols share SymbolTypes, like this one and arith, don't rename each other
+func TestLoadNames(t *testing.T) {
+	names := make(map[parse.NodeType]string)
+	for typ, name := range parse.NodeNames {
+		names[typ] = name
+	}
+	tokens := len(lex.TokenNames)
+
+	var wg sync.WaitGroup
+	grammars := make([]*Gparse.Grammar, 8)
+	for i := range grammars {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			g, err := Gparse.Load("list.ebnf", listGrammar, arith.LexAny)
+			if err != nil {
+				t.Error(err)
+			}
+			grammars[i] = g
+		}(i)
+	}
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+	if len(parse.NodeNames) != len(names) || len(lex.TokenNames) != tokens {
+		t.Fatalf("loading grammars registered names")
+	}
+	for typ, name := range names {
+		if parse.NodeNames[typ] != name {
+			t.Fatalf("loading grammars renamed node type %d from %s to %s", int(typ), name, parse.NodeNames[typ])
+		}
+	}
+
+	g := grammars[0]
+	if g.Start != 0 || g.SymbolName(g.Start) != "List" || arith.Expr.String() != "Expr" {
+		t.Errorf("the start symbol %d is named %s, and arith's %s", int(g.Start), g.SymbolName(g.Start), arith.Expr)
+	}
+	if s, ok := g.Symbol("Items"); !ok || g.SymbolName(s) != "Items" {
+		t.Errorf("Items is not found by name")
+	}
+	_, err := Gparse.NewParser(g)
+	if err == nil || !strings.Contains(err.Error(), "Items => Items") {
+		t.Errorf("the left recursion is not reported with the names of the grammar: %v", err)
+	}
+
+	tr := Gparse.Transform(g)
+	if err := tr.EliminateLeftRecursion(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(tr.Grammar.String(), "Items_tail") {
+		t.Errorf("the transformed grammar does not name its new symbols after the old ones:\n%v", tr.Grammar)
+	}
+	if len(parse.NodeNames) != len(names) {
+		t.Errorf("transforming a grammar registered names")
+	}
+}
+
+//TestLoadDesugar checks that optional, repeated and grouped items become helpers, which Parser splices
+func TestLoadDesugar(t *testing.T) {
+	g, err := Gparse.Load("sugar.ebnf", `S = "("? NumberToken* "+"+ ("-" | "*") ("/" ")") ;`, arith.LexAny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `
+S_opt2 -> "("
+S_opt2 -> ε
+S_rep4 -> NumberToken S_rep4
+S_rep4 -> ε
+S_rep6 -> "+" S_rep6
+S_rep6 -> ε
+S_group9 -> "-"
+S_group9 -> "*"
+S -> S_opt2 S_rep4 "+" S_rep6 S_group9 "/" ")"`
+	if g.String() != want[1:] {
+		t.Errorf("the grammar is desugared to\n%v\nexpected\n%s", g, want[1:])
+	}
+	var helpers []string
+	for _, s := range g.Nonterminals() {
+		if g.Helpers[s] {
+			helpers = append(helpers, g.SymbolName(s))
+		}
+	}
+	if strings.Join(helpers, " ") != "S_opt2 S_rep4 S_rep6 S_group9" {
+		t.Errorf("the helpers are %v", helpers)
+	}
+
+	p, err := Gparse.NewParser(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for src, want := range map[string]string{
+		"( 1 2 + + - / )": "S(( 1 2 + + - / ))",
+		"+ * / )":         "S(+ * / ))",
+	} {
+		tree, err := p.Parse(src, src, arith.LexAny)
+		if err != nil {
+			t.Errorf("%s: %v", src, err)
+			continue
+		}
+		if got := gsexpr(g, tree.Root.Children()[0]); got != want {
+			t.Errorf("%s is parsed as %s, expected %s", src, got, want)
+		}
+	}
+	if _, err := p.Parse("s", "( - / )", arith.LexAny); err == nil {
+		t.Errorf("a + is not required")
+	}
+}
+
+//TestLoadDefine checks that rules are defined with =, :, ::= or :=, with or without semicolons
+func TestLoadDefine(t *testing.T) {
+	for _, define := range []string{"=", ":", "::=", ":="} {
+		src := fmt.Sprintf("S %s NumberToken T\nT %[1]s PlusToken | ;", define)
+		g, err := Gparse.Load("define.ebnf", src, arith.LexAny)
+		if err != nil {
+			t.Errorf("%s: %v", define, err)
+			continue
+		}
+		if got := g.String(); got != "S -> NumberToken T\nT -> PlusToken\nT -> ε" {
+			t.Errorf("%s: the grammar is\n%s", define, got)
+		}
+	}
+}
+
+//TestLoadErrors checks the messages and positions of the errors in malformed grammar files
+func TestLoadErrors(t *testing.T) {
+	for _, c := range []struct {
+		src       string
+		line, col int
+		msg       string
+	}{
+		{"", 1, 1, "the grammar has no rules"},
+		{"S = \n  ( NumberToken ;", 2, 17, `expected ), got ";"`},
+		{"S = NumberToken\nT = Undefined", 2, 5, "Undefined is neither a rule nor a token"},
+		{"S = 'unterminated", 1, 5, "unterminated string 'unterminated"},
+		{"S :: NumberToken", 1, 3, "expected ::=, got ::"},
+		{"S = NumberToken ;\n\n  S = PlusToken ;", 3, 3, "rule S is already defined at bad.ebnf:1:1"},
+		{`S = "+-" ;`, 1, 5, `terminal "+-" is not lexed as one token`},
+		{"= S", 1, 1, `expected a rule name, got "="`},
+		{"S = NumberToken @", 1, 17, "expected a rule, a terminal or an operator, got '@'."},
+		{`S = "\q"`, 1, 5, `bad string "\q": invalid syntax`},
+	} {
+		_, err := Gparse.Load("bad.ebnf", c.src, arith.LexAny)
+		lerr, ok := err.(*Gparse.LoadError)
+		if !ok {
+			t.Errorf("%q: got %T %v, expected a LoadError", c.src, err, err)
+			continue
+		}
+		if lerr.File != "bad.ebnf" || lerr.Line != c.line || lerr.Col != c.col || lerr.Msg != c.msg {
+			t.Errorf("%q: got\n%v\nexpected\nbad.ebnf:%d:%d: %s", c.src, err, c.line, c.col, c.msg)
+		}
+	}
+}
@@ -0,0 +1,753 @@
+package Gparse
+
+import (
+	"fmt"
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+	"math"
+	"sort"
+	"strings"
+)
+
+//Assoc is the associativity of a precedence level
+type Assoc int
+
+const (
+	Left Assoc = iota
+	Right
+	NonAssoc
+)
+
+var assocNames = map[Assoc]string{Left: "%left", Right: "%right", NonAssoc: "%nonassoc"}
+
+var resolutionNames = map[ActionKind]string{Shift: "shift", Reduce: "reduce", Fail: "an error"}
+
+//PrecedenceLevel is a group of terminals of the same precedence, like %left in Bison
+type PrecedenceLevel struct {
+	Assoc     Assoc
+	Terminals []SymbolType
+}
+
+//LROptions configures NewLR
+type LROptions struct {
+	Canonical  bool               //Canonical builds canonical LR(1) states, instead of merging them into LALR(1) states
+	Precedence []PrecedenceLevel  //Precedence levels, from the lowest
+	Prec       map[int]SymbolType //The terminal whose precedence a production has, by its index, like %prec. Otherwise it is its last terminal.
+}
+
+//ActionKind is what an LR parser does in a state at a lookahead
+type ActionKind int
+
+const (
+	Shift ActionKind = iota
+	Reduce
+	Accept
+	Fail //Fail is an error, for non-associative operators
+)
+
+//Action is an entry of the action table of an LR parser
+type Action struct {
+	Kind   ActionKind
+	Target int //The state to shift to, or the index of the production to reduce by
+}
+
+func (a Action) String() string {
+	switch a.Kind {
+	case Shift:
+		return fmt.Sprintf("shift, and go to state %d", a.Target)
+	case Reduce:
+		return fmt.Sprintf("reduce using rule %d", a.Target+1)
+	case Accept:
+		return "accept"
+	}
+	return "error (nonassociative)"
+}
+
+//LRItem is a production with a position in its right hand side, and the lookaheads which may follow it
+type LRItem struct {
+	Prod      int //Index in Grammar.Productions, or -1 for $accept -> Start
+	Dot       int
+	Lookahead SymbolSet
+}
+
+//LRState is a state of an LR automaton
+type LRState struct {
+	Index       int
+	Kernel      []LRItem
+	Items       []LRItem //The kernel, followed by the closure
+	Transitions map[SymbolType]int
+	Actions     map[SymbolType]Action
+	Resolved    []string //Conflicts resolved by precedence, as Bison reports them
+}
+
+//LRConflict is a lookahead for which an LR state has two actions
+type LRConflict struct {
+	Kind      ConflictKind
+	State     int
+	Lookahead SymbolType
+	Actions   [2]Action      //The action chosen, and the one left out
+	Items     [2]string      //The items of the actions
+	Example   SententialForm //The symbols leading to the state, followed by the lookahead
+	Input     SententialForm //Terminals leading to the state, followed by the lookahead
+
+	grammar *Grammar
+}
+
+func (c LRConflict) String() string {
+	n := len(c.Example) - 1
+	m := len(c.Input) - 1
+	g := c.grammar
+	return fmt.Sprintf("%v conflict in state %d on %s:\n\t%s\n\t%s\n\texample: %s • %s\n\tinput:   %s • %s",
+		c.Kind, c.State, g.lrName(c.Lookahead), c.Items[0], c.Items[1],
+		g.lrString(c.Example[:n]), g.lrName(c.Lookahead), g.lrString(c.Input[:m]), g.lrName(c.Lookahead))
+}
+
+//LRConflictError lists the conflicts of an LR parser not resolved by precedence
+type LRConflictError struct {
+	Grammar   string
+	Mode      string
+	Conflicts []LRConflict
+}
+
+func (e *LRConflictError) Error() string {
+	name := "The grammar"
+	if e.Grammar != "" {
+		name = "Grammar " + e.Grammar
+	}
+	lines := []string{fmt.Sprintf("%s is not %s, it has %d conflicts:", name, e.Mode, len(e.Conflicts))}
+	for _, c := range e.Conflicts {
+		lines = append(lines, c.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+const (
+	acceptSymbol = SymbolType(math.MinInt32)     //$accept, the left hand side of the augmented production
+	dummySymbol  = SymbolType(math.MinInt32 + 1) //Marks propagated lookaheads while computing LALR(1) lookaheads
+)
+
+//lrName names a symbol like Bison
+func (g *Grammar) lrName(s SymbolType) string {
+	switch s {
+	case acceptSymbol:
+		return "$accept"
+	case EndOfInput:
+		return "$end"
+	}
+	return g.SymbolName(s)
+}
+
+func (g *Grammar) lrString(f SententialForm) string {
+	names := make([]string, len(f))
+	for i, s := range f {
+		names[i] = g.lrName(s)
+	}
+	return strings.Join(names, " ")
+}
+
+//LR is an LALR(1) or canonical LR(1) parser of a grammar, which may be left recursive
+type LR struct {
+	Grammar   *Grammar
+	Options   LROptions
+	Analysis  *Analysis
+	States    []*LRState
+	Conflicts []LRConflict
+
+	alts      map[SymbolType][]int //Indices of the productions of each non-terminal
+	kernels   []itemSet
+	prec      map[SymbolType]int
+	assoc     map[SymbolType]Assoc
+	terminals *terminals
+}
+
+type lrCore struct {
+	prod, dot int
+}
+
+//itemSet maps items to their lookaheads
+type itemSet map[lrCore]SymbolSet
+
+//NewLR builds the LR automaton and action table of a grammar.
+//
+//Conflicts are resolved with the precedence of the lookahead and the production like Bison does.
+//Unresolved conflicts are returned in an LRConflictError, along with the parser, which then
+//prefers to shift, and otherwise to reduce by the production which comes first in the grammar.
+func NewLR(g *Grammar, opts LROptions) (*LR, error) {
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+	lr := &LR{
+		Grammar:   g,
+		Options:   opts,
+		Analysis:  Analyze(g, 1),
+		alts:      make(map[SymbolType][]int),
+		prec:      make(map[SymbolType]int),
+		assoc:     make(map[SymbolType]Assoc),
+		terminals: newTerminals(g),
+	}
+	for i, p := range g.Productions {
+		lr.alts[p.LHS] = append(lr.alts[p.LHS], i)
+	}
+	for level, pl := range opts.Precedence {
+		for _, t := range pl.Terminals {
+			lr.prec[t] = level + 1
+			lr.assoc[t] = pl.Assoc
+		}
+	}
+
+	lr.build()
+	if !opts.Canonical {
+		lr.lookaheads()
+	}
+	for i, st := range lr.States {
+		st.Kernel = lr.sortedItems(lr.kernels[i], nil)
+		st.Items = lr.sortedItems(lr.closure(lr.kernels[i]), lr.kernels[i])
+		lr.actions(st)
+	}
+
+	if len(lr.Conflicts) > 0 {
+		mode := "LALR(1)"
+		if opts.Canonical {
+			mode = "LR(1)"
+		}
+		return lr, &LRConflictError{g.Name, mode, lr.Conflicts}
+	}
+	return lr, nil
+}
+
+//production returns a production by index, or the augmented production $accept -> Start for -1
+func (lr *LR) production(i int) Production {
+	if i < 0 {
+		return Production{acceptSymbol, SententialForm{lr.Grammar.Start}}
+	}
+	return lr.Grammar.Productions[i]
+}
+
+//closure adds the items predicted by a set of items, with their lookaheads
+func (lr *LR) closure(kernel itemSet) itemSet {
+	items := make(itemSet)
+	var work []lrCore
+	add := func(c lrCore, la SymbolSet) {
+		set, ok := items[c]
+		if !ok {
+			set = make(SymbolSet)
+			items[c] = set
+		}
+		changed := !ok
+		for t := range la {
+			if !set[t] {
+				set[t] = true
+				changed = true
+			}
+		}
+		if changed {
+			work = append(work, c)
+		}
+	}
+	for c, la := range kernel {
+		add(c, la)
+	}
+	for len(work) > 0 {
+		c := work[len(work)-1]
+		work = work[:len(work)-1]
+		p := lr.production(c.prod)
+		if c.dot >= len(p.RHS) || lr.Grammar.IsTerminal(p.RHS[c.dot]) {
+			continue
+		}
+		first := lr.Analysis.FirstOf(p.RHS[c.dot+1:])
+		la := first.Terminals()
+		if first.HasEmpty() {
+			for t := range items[c] {
+				la[t] = true
+			}
+		}
+		for _, i := range lr.alts[p.RHS[c.dot]] {
+			add(lrCore{i, 0}, la)
+		}
+	}
+	return items
+}
+
+//advance returns the kernel of the state reached from a set of items with a symbol
+func (lr *LR) advance(items itemSet, x SymbolType) itemSet {
+	kernel := make(itemSet)
+	for c, la := range items {
+		p := lr.production(c.prod)
+		if c.dot < len(p.RHS) && p.RHS[c.dot] == x {
+			set := make(SymbolSet)
+			for t := range la {
+				set[t] = true
+			}
+			kernel[lrCore{c.prod, c.dot + 1}] = set
+		}
+	}
+	return kernel
+}
+
+func sortedCores(items itemSet) []lrCore {
+	cores := make([]lrCore, 0, len(items))
+	for c := range items {
+		cores = append(cores, c)
+	}
+	sort.Slice(cores, func(i, j int) bool {
+		if cores[i].prod != cores[j].prod {
+			return cores[i].prod < cores[j].prod
+		}
+		return cores[i].dot < cores[j].dot
+	})
+	return cores
+}
+
+//kernelKey identifies a state by its kernel, and by its lookaheads for canonical LR(1)
+func (lr *LR) kernelKey(kernel itemSet) string {
+	var sb strings.Builder
+	for _, c := range sortedCores(kernel) {
+		fmt.Fprintf(&sb, "%d.%d", c.prod, c.dot)
+		if lr.Options.Canonical {
+			sb.WriteString(kernel[c].String())
+		}
+		sb.WriteByte(' ')
+	}
+	return sb.String()
+}
+
+//build creates the states reachable from the start state, without lookaheads for LALR(1)
+func (lr *LR) build() {
+	start := itemSet{{-1, 0}: {}}
+	if lr.Options.Canonical {
+		start[lrCore{-1, 0}][EndOfInput] = true
+	}
+	index := map[string]int{lr.kernelKey(start): 0}
+	lr.kernels = []itemSet{start}
+	lr.States = []*LRState{{Index: 0, Transitions: make(map[SymbolType]int)}}
+
+	for i := 0; i < len(lr.States); i++ {
+		items := lr.closure(lr.kernels[i])
+		next := make(SymbolSet)
+		for c := range items {
+			if p := lr.production(c.prod); c.dot < len(p.RHS) {
+				next[p.RHS[c.dot]] = true
+			}
+		}
+		for _, x := range next.Sorted() {
+			kernel := lr.advance(items, x)
+			key := lr.kernelKey(kernel)
+			j, ok := index[key]
+			if !ok {
+				j = len(lr.States)
+				index[key] = j
+				lr.kernels = append(lr.kernels, kernel)
+				lr.States = append(lr.States, &LRState{Index: j, Transitions: make(map[SymbolType]int)})
+			}
+			lr.States[i].Transitions[x] = j
+		}
+	}
+}
+
+//lookaheads computes the LALR(1) lookaheads of the kernel items, which are spontaneously generated
+//in a closure, or propagated from the item they were advanced from
+func (lr *LR) lookaheads() {
+	type ref struct {
+		state int
+		core  lrCore
+	}
+	propagate := make(map[ref][]ref)
+	lr.kernels[0][lrCore{-1, 0}][EndOfInput] = true
+
+	for i := range lr.States {
+		for k := range lr.kernels[i] {
+			from := ref{i, k}
+			for c, la := range lr.closure(itemSet{k: {dummySymbol: true}}) {
+				p := lr.production(c.prod)
+				if c.dot >= len(p.RHS) {
+					continue
+				}
+				to := ref{lr.States[i].Transitions[p.RHS[c.dot]], lrCore{c.prod, c.dot + 1}}
+				for t := range la {
+					if t == dummySymbol {
+						propagate[from] = append(propagate[from], to)
+					} else {
+						lr.kernels[to.state][to.core][t] = true
+					}
+				}
+			}
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for from, tos := range propagate {
+			for _, to := range tos {
+				set := lr.kernels[to.state][to.core]
+				for t := range lr.kernels[from.state][from.core] {
+					if !set[t] {
+						set[t] = true
+						changed = true
+					}
+				}
+			}
+		}
+	}
+}
+
+//sortedItems lists the items of a set, those in the kernel first
+func (lr *LR) sortedItems(items, kernel itemSet) []LRItem {
+	var list []LRItem
+	for _, c := range sortedCores(items) {
+		if _, ok := kernel[c]; ok {
+			list = append(list, LRItem{c.prod, c.dot, items[c]})
+		}
+	}
+	for _, c := range sortedCores(items) {
+		if _, ok := kernel[c]; !ok {
+			list = append(list, LRItem{c.prod, c.dot, items[c]})
+		}
+	}
+	return list
+}
+
+//ItemString prints an item like Bison, with the lookaheads of complete items
+func (lr *LR) ItemString(it LRItem) string {
+	p := lr.production(it.Prod)
+	rhs := make([]string, 0, len(p.RHS)+2)
+	for i, s := range p.RHS {
+		if i == it.Dot {
+			rhs = append(rhs, "•")
+		}
+		rhs = append(rhs, lr.Grammar.lrName(s))
+	}
+	if len(p.RHS) == 0 {
+		rhs = append(rhs, "ε")
+	}
+	if it.Dot == len(p.RHS) {
+		rhs = append(rhs, "•")
+	}
+	if it.Prod < 0 {
+		rhs = append(rhs, "$end")
+	}
+	s := fmt.Sprintf("%s: %s", lr.Grammar.lrName(p.LHS), strings.Join(rhs, " "))
+	if it.Dot == len(p.RHS) {
+		if it.Prod >= 0 {
+			names := make([]string, 0, len(it.Lookahead))
+			for _, t := range it.Lookahead.Sorted() {
+				names = append(names, lr.Grammar.lrName(t))
+			}
+			s += "  [" + strings.Join(names, ", ") + "]"
+		}
+	}
+	return s
+}
+
+//productionPrec returns the precedence level of a production, or 0 if it has none
+func (lr *LR) productionPrec(i int) (int, SymbolType) {
+	if t, ok := lr.Options.Prec[i]; ok {
+		return lr.prec[t], t
+	}
+	rhs := lr.production(i).RHS
+	for j := len(rhs) - 1; j >= 0; j-- {
+		if lr.Grammar.IsTerminal(rhs[j]) {
+			return lr.prec[rhs[j]], rhs[j]
+		}
+	}
+	return 0, 0
+}
+
+//actions fills in the actions of a state, resolving conflicts
+func (lr *LR) actions(st *LRState) {
+	st.Actions = make(map[SymbolType]Action)
+	candidates := make(map[SymbolType][]Action)
+	items := make(map[Action]LRItem)
+	for _, it := range st.Items {
+		p := lr.production(it.Prod)
+		switch {
+		case it.Dot < len(p.RHS):
+			if t := p.RHS[it.Dot]; lr.Grammar.IsTerminal(t) {
+				a := Action{Shift, st.Transitions[t]}
+				if _, ok := items[a]; !ok {
+					candidates[t] = append(candidates[t], a)
+					items[a] = it
+				}
+			}
+		case it.Prod < 0:
+			a := Action{Accept, 0}
+			candidates[EndOfInput] = append(candidates[EndOfInput], a)
+			items[a] = it
+		default:
+			a := Action{Reduce, it.Prod}
+			for t := range it.Lookahead {
+				candidates[t] = append(candidates[t], a)
+			}
+			items[a] = it
+		}
+	}
+
+	lookaheads := make(SymbolSet)
+	for t := range candidates {
+		lookaheads[t] = true
+	}
+	for _, t := range lookaheads.Sorted() {
+		actions := candidates[t]
+		sort.SliceStable(actions, func(i, j int) bool {
+			a, b := actions[i], actions[j]
+			return a.Kind != Reduce && b.Kind == Reduce || a.Kind == Reduce && b.Kind == Reduce && a.Target < b.Target
+		})
+		chosen := actions[0]
+		for _, other := range actions[1:] {
+			chosen = lr.resolve(st, t, chosen, other, items)
+		}
+		st.Actions[t] = chosen
+	}
+}
+
+//resolve chooses between two actions of a state at a lookahead, the first being a shift if either is
+func (lr *LR) resolve(st *LRState, t SymbolType, a, b Action, items map[Action]LRItem) Action {
+	if a.Kind == Shift && b.Kind == Reduce {
+		pp, pt := lr.productionPrec(b.Target)
+		tp := lr.prec[t]
+		if pp > 0 && tp > 0 {
+			var chosen Action
+			var how string
+			switch {
+			case pp > tp:
+				chosen, how = b, fmt.Sprintf("reduce (%s < %s)", lr.Grammar.lrName(t), lr.Grammar.lrName(pt))
+			case pp < tp:
+				chosen, how = a, fmt.Sprintf("shift (%s < %s)", lr.Grammar.lrName(pt), lr.Grammar.lrName(t))
+			default:
+				switch lr.assoc[t] {
+				case Left:
+					chosen = b
+				case Right:
+					chosen = a
+				default:
+					chosen = Action{Fail, 0}
+				}
+				how = fmt.Sprintf("%s (%s %s)", resolutionNames[chosen.Kind], assocNames[lr.assoc[t]], lr.Grammar.lrName(t))
+			}
+			st.Resolved = append(st.Resolved, fmt.Sprintf("Conflict between rule %d and token %s resolved as %s.", b.Target+1, lr.Grammar.lrName(t), how))
+			return chosen
+		}
+	}
+	if a.Kind == Fail {
+		return a
+	}
+
+	kind := ShiftReduce
+	if a.Kind == Reduce && b.Kind == Reduce {
+		kind = ReduceReduce
+	}
+	example, input := lr.example(st.Index)
+	lr.Conflicts = append(lr.Conflicts, LRConflict{
+		Kind:      kind,
+		State:     st.Index,
+		Lookahead: t,
+		Actions:   [2]Action{a, b},
+		Items:     [2]string{lr.ItemString(items[a]), lr.ItemString(items[b])},
+		Example:   append(example, t),
+		Input:     append(input, t),
+		grammar:   lr.Grammar,
+	})
+	return a
+}
+
+//example returns a shortest sequence of symbols leading from the start state to a state,
+//and a sequence of terminals derived from it
+func (lr *LR) example(state int) (SententialForm, SententialForm) {
+	type step struct {
+		from int
+		sym  SymbolType
+	}
+	prev := map[int]step{0: {-1, 0}}
+	queue := []int{0}
+	for len(queue) > 0 && queue[0] != state {
+		i := queue[0]
+		queue = queue[1:]
+		trans := make(SymbolSet)
+		for x := range lr.States[i].Transitions {
+			trans[x] = true
+		}
+		for _, x := range trans.Sorted() {
+			j := lr.States[i].Transitions[x]
+			if _, seen := prev[j]; !seen {
+				prev[j] = step{i, x}
+				queue = append(queue, j)
+			}
+		}
+	}
+	var symbols SententialForm
+	for i := state; prev[i].from >= 0; i = prev[i].from {
+		symbols = append(SententialForm{prev[i].sym}, symbols...)
+	}
+	short := lr.Grammar.shortest()
+	var input SententialForm
+	for _, s := range symbols {
+		input = append(input, short[s]...)
+	}
+	return symbols, input
+}
+
+//Report describes the grammar, the states and the conflicts, like the .output file of Bison
+func (lr *LR) Report() string {
+	var sb strings.Builder
+	counts := make(map[int][2]int)
+	for _, c := range lr.Conflicts {
+		n := counts[c.State]
+		if c.Kind == ShiftReduce {
+			n[0]++
+		} else {
+			n[1]++
+		}
+		counts[c.State] = n
+	}
+	for i := range lr.States {
+		if n, ok := counts[i]; ok {
+			var parts []string
+			if n[0] > 0 {
+				parts = append(parts, fmt.Sprintf("%d shift/reduce", n[0]))
+			}
+			if n[1] > 0 {
+				parts = append(parts, fmt.Sprintf("%d reduce/reduce", n[1]))
+			}
+			fmt.Fprintf(&sb, "State %d conflicts: %s\n", i, strings.Join(parts, ", "))
+		}
+	}
+	if len(counts) > 0 {
+		sb.WriteString("\n\n")
+	}
+
+	sb.WriteString("Grammar\n\n")
+	fmt.Fprintf(&sb, "    0 $accept: %v $end\n", lr.Grammar.lrName(lr.Grammar.Start))
+	var last SymbolType = acceptSymbol
+	for i, p := range lr.Grammar.Productions {
+		lhs := lr.Grammar.lrName(p.LHS) + ":"
+		if p.LHS == last {
+			lhs = strings.Repeat(" ", len(lhs)-1) + "|"
+		} else {
+			sb.WriteString("\n")
+		}
+		last = p.LHS
+		fmt.Fprintf(&sb, "%5d %s %s\n", i+1, lhs, lr.Grammar.formString(p.RHS))
+	}
+
+	for _, st := range lr.States {
+		fmt.Fprintf(&sb, "\n\nState %d\n\n", st.Index)
+		for _, it := range st.Items {
+			fmt.Fprintf(&sb, "%5d %s\n", it.Prod+1, lr.ItemString(it))
+		}
+		var shifts, gotos, others []string
+		targets := make(SymbolSet)
+		for t := range st.Actions {
+			targets[t] = true
+		}
+		for _, t := range targets.Sorted() {
+			a := st.Actions[t]
+			line := fmt.Sprintf("%-12s %v", lr.Grammar.lrName(t), a)
+			if a.Kind == Shift {
+				shifts = append(shifts, line)
+			} else {
+				others = append(others, line)
+			}
+		}
+		for _, c := range lr.Conflicts {
+			if c.State == st.Index {
+				others = append(others, fmt.Sprintf("%-12s [%v]", lr.Grammar.lrName(c.Lookahead), c.Actions[1]))
+			}
+		}
+		nts := make(SymbolSet)
+		for x := range st.Transitions {
+			if !lr.Grammar.IsTerminal(x) {
+				nts[x] = true
+			}
+		}
+		for _, x := range nts.Sorted() {
+			gotos = append(gotos, fmt.Sprintf("%-12s go to state %d", lr.Grammar.lrName(x), st.Transitions[x]))
+		}
+		for _, block := range [][]string{shifts, others, gotos, st.Resolved} {
+			if len(block) > 0 {
+				sb.WriteString("\n")
+				for _, line := range block {
+					sb.WriteString("    " + line + "\n")
+				}
+			}
+		}
+	}
+	for _, c := range lr.Conflicts {
+		fmt.Fprintf(&sb, "\n\n%v\n", c)
+	}
+	return sb.String()
+}
+
+//ParseFn returns a parsing entry point for parse.NewTree, which shifts and reduces with the action table
+func (lr *LR) ParseFn() parse.ParseFn {
+	return func(tree *parse.Tree) {
+		states := []int{0}
+		var values [][]parse.Node //The nodes of the symbols on the stack, which are spliced for helpers
+		tok := tree.Next()
+		for {
+			st := lr.States[states[len(states)-1]]
+			t, ok := lr.terminals.lookup(tok, func(s SymbolType) bool {
+				a, ok := st.Actions[s]
+				return ok && a.Kind != Fail
+			})
+			if !ok {
+				if t, ok := lr.terminals.lookup(tok, func(s SymbolType) bool { _, ok := st.Actions[s]; return ok }); ok {
+					tree.ErrorAtTokenf(tok, "%v is non-associative.", lr.Grammar.lrName(t))
+				}
+				tree.Unexpected(tok, lr.expected(st))
+			}
+
+			switch a := st.Actions[t]; a.Kind {
+			case Shift:
+				leaf := parse.NewTerminal(parse.NodeType(t), tok, tree)
+				leaf.Commit()
+				values = append(values, []parse.Node{leaf})
+				states = append(states, a.Target)
+				tok = tree.Next()
+			case Reduce:
+				p := lr.Grammar.Productions[a.Target]
+				n := len(p.RHS)
+				var children []parse.Node
+				for _, v := range values[len(values)-n:] {
+					children = append(children, v...)
+				}
+				values, states = values[:len(values)-n], states[:len(states)-n]
+				tree.Trace(lr.Grammar.productionString(p))()
+				if lr.Grammar.Helpers[p.LHS] {
+					values = append(values, children)
+				} else {
+					first := tok
+					if len(children) > 0 {
+						first = children[0].Token()
+					}
+					node := parse.NewNonTerminal(parse.NodeType(p.LHS), first, tree)
+					node.AddChildren(children)
+					node.Commit()
+					values = append(values, []parse.Node{node})
+				}
+				states = append(states, lr.States[states[len(states)-1]].Transitions[p.LHS])
+			case Accept:
+				tree.Root.AddChildren(values[len(values)-1])
+				return
+			}
+		}
+	}
+}
+
+//expected lists the terminals a state has actions for
+func (lr *LR) expected(st *LRState) parse.OneOf {
+	ts := make(SymbolSet)
+	for t, a := range st.Actions {
+		if a.Kind != Fail {
+			ts[t] = true
+		}
+	}
+	return lr.Grammar.expected(ts)
+}
+
+//Parse lexes and parses a source with the action table
+func (lr *LR) Parse(name, source string, lexStart lex.StateFn) (*parse.Tree, error) {
+	l := lex.Lex(name, source)
+	l.Run(lexStart)
+	defer l.Drain()
+	tree := parse.NewTree(name, source, lr.ParseFn())
+	return tree, tree.Parse(l)
+}
@@ -0,0 +1,438 @@
+package Gparse_test
+
+import (
+	"errors"
+	"kugg/compilers/Gparse"
+	"kugg/compilers/Gparse/arith"
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+	"strings"
+	"testing"
+)
+
+//lalrGrammar is the grammar of assignments of the dragon book, with "+" for = and NumberToken for id.
+//It is LALR(1) but not SLR(1): R -> L • is followed by "+" after "*", but not at the start.
+const lalrGrammar = `
+S = L "+" R | R ;
+L = "*" R | NumberToken ;
+R = L ;
+`
+
+//danglingElse is if-then-else with "(" NumberToken for if and "*" for else
+const danglingElse = `
+S = "(" NumberToken S | "(" NumberToken S "*" S | "-" ;
+`
+
+//lalrOnly merges the states after "(" NumberToken and ")" NumberToken in LALR(1), whose items A -> NumberToken •
+//and B -> NumberToken • then have the same lookaheads
+const lalrOnly = `
+S = "(" A "+" | ")" B "+" | "(" B "-" | ")" A "-" ;
+A = NumberToken ;
+B = NumberToken ;
+`
+
+func loadGrammar(t *testing.T, src string) *Gparse.Grammar {
+	g, err := Gparse.Load("lr.ebnf", src, arith.LexAny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func symbol(t *testing.T, g *Gparse.Grammar, name string) Gparse.SymbolType {
+	s, ok := g.Symbol(name)
+	if !ok {
+		t.Fatalf("no symbol %s", name)
+	}
+	return s
+}
+
+//TestLRLookaheads checks the lookaheads propagated between the kernel items of the LALR(1) states
+func TestLRLookaheads(t *testing.T) {
+	g := loadGrammar(t, lalrGrammar)
+	lr, err := Gparse.NewLR(g, Gparse.LROptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, star := symbol(t, g, "L"), symbol(t, g, `"*"`)
+	for _, c := range []struct {
+		path []Gparse.SymbolType
+		item string
+	}{
+		//$end is propagated from $accept -> • S $end
+		{[]Gparse.SymbolType{l}, `R: L •  [$end]`},
+		//"+" is generated spontaneously by S -> • L "+" R, and $end propagated
+		{[]Gparse.SymbolType{star, l}, `R: L •  [$end, "+"]`},
+		{[]Gparse.SymbolType{star, star, l}, `R: L •  [$end, "+"]`},
+		{[]Gparse.SymbolType{l, symbol(t, g, `"+"`), l}, `R: L •  [$end, "+"]`},
+		{[]Gparse.SymbolType{symbol(t, g, "NumberToken")}, `L: NumberToken •  [$end, "+"]`},
+	} {
+		st := lr.States[0]
+		for _, x := range c.path {
+			st = lr.States[st.Transitions[x]]
+		}
+		var items []string
+		for _, it := range st.Items {
+			items = append(items, lr.ItemString(it))
+		}
+		if !strings.Contains(strings.Join(items, "\n"), c.item) {
+			t.Errorf("state %d has items\n%s\nexpected %s", st.Index, strings.Join(items, "\n"), c.item)
+		}
+	}
+}
+
+//TestLRStates compares the numbers of LALR(1) and canonical LR(1) states, and their conflicts
+func TestLRStates(t *testing.T) {
+	for _, c := range []struct {
+		name      string
+		src       string
+		states    [2]int    //LALR(1) and LR(1) states
+		conflicts [2]string //The kinds of their conflicts
+	}{
+		{"lalr", lalrGrammar, [2]int{10, 14}, [2]string{"", ""}},
+		{"lalrOnly", lalrOnly, [2]int{13, 14}, [2]string{"reduce/reduce reduce/reduce", ""}},
+		{"danglingElse", danglingElse, [2]int{8, 14}, [2]string{"shift/reduce", "shift/reduce"}},
+	} {
+		g := loadGrammar(t, c.src)
+		for i, canonical := range []bool{false, true} {
+			lr, err := Gparse.NewLR(g, Gparse.LROptions{Canonical: canonical})
+			var kinds []string
+			for _, conflict := range lr.Conflicts {
+				kinds = append(kinds, conflict.Kind.String())
+			}
+			if got := strings.Join(kinds, " "); len(lr.States) != c.states[i] || got != c.conflicts[i] || (err == nil) != (got == "") {
+				t.Errorf("%s with Canonical %v has %d states and conflicts %q, expected %d and %q (%v)",
+					c.name, canonical, len(lr.States), got, c.states[i], c.conflicts[i], err)
+			}
+		}
+	}
+}
+
+//TestLRConflicts checks the conflicts and the choices of the tables which have them
+func TestLRConflicts(t *testing.T) {
+	for _, c := range []struct {
+		src   string
+		err   string
+		input string
+		tree  string
+	}{
+		//The parser prefers to shift, so "*" is the else of the innermost if
+		{danglingElse, `
+Grammar lr.ebnf is not LALR(1), it has 1 conflicts:
+shift/reduce conflict in state 5 on "*":
+	S: "(" NumberToken S • "*" S
+	S: "(" NumberToken S •  [$end, "*"]
+	example: "(" NumberToken S • "*"
+	input:   "(" NumberToken "-" • "*"`, "(1 (2 - * -", `S(( 1 S(( 2 S(-) * S(-)))`},
+		//and to reduce by the production which comes first
+		{lalrOnly, `
+Grammar lr.ebnf is not LALR(1), it has 2 conflicts:
+reduce/reduce conflict in state 6 on "+":
+	A: NumberToken •  ["+", "-"]
+	B: NumberToken •  ["+", "-"]
+	example: "(" NumberToken • "+"
+	input:   "(" NumberToken • "+"
+reduce/reduce conflict in state 6 on "-":
+	A: NumberToken •  ["+", "-"]
+	B: NumberToken •  ["+", "-"]
+	example: "(" NumberToken • "-"
+	input:   "(" NumberToken • "-"`, "(7 +", `S(( A(7) +)`},
+	} {
+		g := loadGrammar(t, c.src)
+		lr, err := Gparse.NewLR(g, Gparse.LROptions{})
+		var conflicts *Gparse.LRConflictError
+		if !errors.As(err, &conflicts) || err.Error() != c.err[1:] {
+			t.Errorf("building the parser returned\n%v\nexpected\n%s", err, c.err[1:])
+			continue
+		}
+		tree, err := lr.Parse(c.input, c.input, arith.LexAny)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := gsexpr(g, tree.Root.Children()[0]); got != c.tree {
+			t.Errorf("%s parses as %s, expected %s", c.input, got, c.tree)
+		}
+	}
+
+	//In canonical LR(1), the states of lalrOnly are not merged, and ")" 7 "+" is reduced by B
+	g := loadGrammar(t, lalrOnly)
+	lr, err := Gparse.NewLR(g, Gparse.LROptions{Canonical: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := lr.Parse("lalrOnly", ")7 +", arith.LexAny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := gsexpr(g, tree.Root.Children()[0]); got != `S() B(7) +)` {
+		t.Errorf(")7 + parses as %s", got)
+	}
+}
+
+const precGrammar = `
+E = E "+" E | E "-" E | E "*" E | E "/" E | "-" E | "(" E ")" | NumberToken ;
+`
+
+//TestLRPrecedence resolves the conflicts of an ambiguous expression grammar with precedence levels,
+//and gives unary minus the precedence of a terminal which is not in the grammar, like %prec UMINUS
+func TestLRPrecedence(t *testing.T) {
+	g := loadGrammar(t, precGrammar)
+	const uminus = Gparse.SymbolType(1000)
+	g.Names[uminus] = "UMINUS"
+	plus, minus, times, divide := symbol(t, g, `"+"`), symbol(t, g, `"-"`), symbol(t, g, `"*"`), symbol(t, g, `"/"`)
+	lr, err := Gparse.NewLR(g, Gparse.LROptions{
+		Precedence: []Gparse.PrecedenceLevel{
+			{Gparse.Left, []Gparse.SymbolType{plus, minus}},
+			{Gparse.Left, []Gparse.SymbolType{times}},
+			{Gparse.Right, []Gparse.SymbolType{divide}},
+			{Gparse.NonAssoc, []Gparse.SymbolType{uminus}},
+		},
+		Prec: map[int]Gparse.SymbolType{4: uminus},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		src  string
+		tree string
+	}{
+		{"1 + 2 - 3", `E(E(E(1) + E(2)) - E(3))`},
+		{"1 + 2 * 3 - 4", `E(E(E(1) + E(E(2) * E(3))) - E(4))`},
+		{"1 * 2 * 3", `E(E(E(1) * E(2)) * E(3))`},
+		{"1 / 2 / 3", `E(E(1) / E(E(2) / E(3)))`},
+		{"1 * 2 / 3 * 4", `E(E(E(1) * E(E(2) / E(3))) * E(4))`},
+		{"-1 * 2", `E(E(- E(1)) * E(2))`},
+		{"- -1 - 2", `E(E(- E(- E(1))) - E(2))`},
+		{"(1 + 2) * 3", `E(E(( E(E(1) + E(2)) )) * E(3))`},
+	} {
+		tree, err := lr.Parse(c.src, c.src, arith.LexAny)
+		if err != nil {
+			t.Errorf("parsing %q: %v", c.src, err)
+			continue
+		}
+		if got := gsexpr(g, tree.Root.Children()[0]); got != c.tree {
+			t.Errorf("%q parses as %s, expected %s", c.src, got, c.tree)
+		}
+	}
+
+	//Bison reports the resolutions after the actions of the state
+	want := `
+State 11
+
+    1 E: E • "+" E
+    1 E: E "+" E •  [$end, "+", "-", "*", "/", ")"]
+    2 E: E • "-" E
+    3 E: E • "*" E
+    4 E: E • "/" E
+
+    "*"          shift, and go to state 7
+    "/"          shift, and go to state 8
+
+    $end         reduce using rule 1
+    "+"          reduce using rule 1
+    "-"          reduce using rule 1
+    ")"          reduce using rule 1
+
+    Conflict between rule 1 and token "+" resolved as reduce (%left "+").
+    Conflict between rule 1 and token "-" resolved as reduce (%left "-").
+    Conflict between rule 1 and token "*" resolved as shift ("+" < "*").
+    Conflict between rule 1 and token "/" resolved as shift ("+" < "/").
+`
+	if report := lr.Report(); !strings.Contains(report, want) {
+		t.Errorf("the report is\n%s\nexpected to contain%s", report, want)
+	}
+	if got := strings.Join(lr.States[9].Resolved, "\n"); got != `Conflict between rule 5 and token "+" resolved as reduce ("+" < UMINUS).
+Conflict between rule 5 and token "-" resolved as reduce ("-" < UMINUS).
+Conflict between rule 5 and token "*" resolved as reduce ("*" < UMINUS).
+Conflict between rule 5 and token "/" resolved as reduce ("/" < UMINUS).` {
+		t.Errorf("the conflicts of unary minus are resolved as\n%s", got)
+	}
+}
+
+//TestLRReport checks the report of a grammar with a conflict
+func TestLRReport(t *testing.T) {
+	lr, _ := Gparse.NewLR(loadGrammar(t, danglingElse), Gparse.LROptions{})
+	want := `
+State 5 conflicts: 1 shift/reduce
+
+
+Grammar
+
+    0 $accept: S $end
+
+    1 S: "(" NumberToken S
+    2  | "(" NumberToken S "*" S
+    3  | "-"
+
+
+State 0
+
+    0 $accept: • S $end
+    1 S: • "(" NumberToken S
+    2 S: • "(" NumberToken S "*" S
+    3 S: • "-"
+
+    "("          shift, and go to state 2
+    "-"          shift, and go to state 3
+
+    S            go to state 1
+
+
+State 1
+
+    0 $accept: S • $end
+
+    $end         accept
+
+
+State 2
+
+    1 S: "(" • NumberToken S
+    2 S: "(" • NumberToken S "*" S
+
+    NumberToken  shift, and go to state 4
+
+
+State 3
+
+    3 S: "-" •  [$end, "*"]
+
+    $end         reduce using rule 3
+    "*"          reduce using rule 3
+
+
+State 4
+
+    1 S: "(" NumberToken • S
+    2 S: "(" NumberToken • S "*" S
+    1 S: • "(" NumberToken S
+    2 S: • "(" NumberToken S "*" S
+    3 S: • "-"
+
+    "("          shift, and go to state 2
+    "-"          shift, and go to state 3
+
+    S            go to state 5
+
+
+State 5
+
+    1 S: "(" NumberToken S •  [$end, "*"]
+    2 S: "(" NumberToken S • "*" S
+
+    "*"          shift, and go to state 6
+
+    $end         reduce using rule 1
+    "*"          [reduce using rule 1]
+
+
+State 6
+
+    2 S: "(" NumberToken S "*" • S
+    1 S: • "(" NumberToken S
+    2 S: • "(" NumberToken S "*" S
+    3 S: • "-"
+
+    "("          shift, and go to state 2
+    "-"          shift, and go to state 3
+
+    S            go to state 7
+
+
+State 7
+
+    2 S: "(" NumberToken S "*" S •  [$end, "*"]
+
+    $end         reduce using rule 2
+    "*"          reduce using rule 2
+
+
+shift/reduce conflict in state 5 on "*":
+	S: "(" NumberToken S • "*" S
+	S: "(" NumberToken S •  [$end, "*"]
+	example: "(" NumberToken S • "*"
+	input:   "(" NumberToken "-" • "*"
+`
+	if got := lr.Report(); got != want[1:] {
+		t.Errorf("the report is\n%s\nexpected\n%s", got, want[1:])
+	}
+}
+
+//TestLRAssoc parses the same sum with each associativity of "+"
+func TestLRAssoc(t *testing.T) {
+	g := loadGrammar(t, `E = E "+" E | NumberToken ;`)
+	plus := symbol(t, g, `"+"`)
+	for _, c := range []struct {
+		assoc Gparse.Assoc
+		tree  string
+		err   string
+	}{
+		{Gparse.Left, `E(E(E(1) + E(2)) + E(3))`, ""},
+		{Gparse.Right, `E(E(1) + E(E(2) + E(3)))`, ""},
+		{Gparse.NonAssoc, "", `1,6 : "+" is non-associative.`},
+	} {
+		lr, err := Gparse.NewLR(g, Gparse.LROptions{Precedence: []Gparse.PrecedenceLevel{{c.assoc, []Gparse.SymbolType{plus}}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := lr.Parse("2", "1 + 2", arith.LexAny); err != nil {
+			t.Errorf("parsing 1 + 2 with %v: %v", c.assoc, err)
+		}
+		tree, err := lr.Parse("3", "1 + 2 + 3", arith.LexAny)
+		if c.err != "" {
+			if err == nil || strings.SplitN(err.Error(), "\n", 2)[0] != c.err {
+				t.Errorf("parsing with %v returned %v, expected %s", c.assoc, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsing with %v: %v", c.assoc, err)
+			continue
+		}
+		if got := gsexpr(g, tree.Root.Children()[0]); got != c.tree {
+			t.Errorf("with %v, 1 + 2 + 3 parses as %s, expected %s", c.assoc, got, c.tree)
+		}
+	}
+}
+
+//TestLRParseFn parses with the entry point of the desugared expression grammar, whose helpers are
+//spliced into their parents
+func TestLRParseFn(t *testing.T) {
+	g := loadGrammar(t, `
+Expr   = Term ( ( "+" | "-" ) Term )* ;
+Term   = Factor ( ( "*" | "/" ) Factor )* ;
+Factor = "(" Expr ")" | "-" Factor | NumberToken ;
+`)
+	lr, err := Gparse.NewLR(g, Gparse.LROptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		src  string
+		tree string
+		err  string
+	}{
+		{"1 - 2 + 3", `Expr(Term(Factor(1)) - Term(Factor(2)) + Term(Factor(3)))`, ""},
+		{"-(1 * 2) / 3", `Expr(Term(Factor(- Factor(( Expr(Term(Factor(1) * Factor(2))) ))) / Factor(3)))`, ""},
+		{"1 2", "", `1,2 : expected one of end of input, "+", "-", "*", "/", ")", got NumberToken("2") (type:0).`},
+	} {
+		tree := parse.NewTree(c.src, c.src, lr.ParseFn())
+		l := lex.Lex(c.src, c.src)
+		l.Run(arith.LexAny)
+		err := tree.Parse(l)
+		l.Drain()
+		if c.err != "" {
+			if err == nil || strings.SplitN(err.Error(), "\n", 2)[0] != c.err {
+				t.Errorf("parsing %q returned %v, expected %s", c.src, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsing %q: %v", c.src, err)
+			continue
+		}
+		if got := gsexpr(g, tree.Root.Children()[0]); got != c.tree {
+			t.Errorf("%q parses as %s, expected %s", c.src, got, c.tree)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package Gparse
+
+import (
+	"fmt"
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+	"sort"
+	"strings"
+)
+
+//Parser parses the language of a Grammar into a parse.Tree, without hand-written parsing functions.
+//
+//Every non-terminal has a production function, which tries the alternatives of the non-terminal
+//in the order of the grammar, and takes the first one which matches, backtracking over the tokens
+//of the alternatives which don't. A non-terminal is a NonTerminal node, with a child for every
+//symbol of its alternative, and a terminal is a Terminal node holding its token. The node types are
+//the SymbolTypes of the grammar. The children of helper non-terminals are spliced into their parent.
+//
+//Since alternatives are ordered, put longer alternatives first, e.g. E -> T + E before E -> T.
+//Left recursive grammars are rejected, as they would recurse forever.
+//
+//The result of every non-terminal at every token is memoized for the parse, as in packrat parsing,
+//so backtracking parses a non-terminal at a token once, and the parse doesn't take exponential time.
+type Parser struct {
+	Grammar *Grammar
+
+	productionFns map[SymbolType]productionFn
+}
+
+//productionFn parses a symbol, and reports whether it matched
+type productionFn func(*run) bool
+
+//run holds the state of one parse
+type run struct {
+	p    *Parser
+	tree *parse.Tree
+
+	farthest int                 //Position in the token buffer of the farthest failed match
+	expected map[SymbolType]bool //The terminals expected there
+	memo     map[memoKey]memoized
+}
+
+//memoKey is a non-terminal and the position in the token buffer before it
+type memoKey struct {
+	nt  SymbolType
+	pos int
+}
+
+//memoized is the result of parsing a non-terminal at a position
+type memoized struct {
+	ok    bool
+	end   int          //Position in the token buffer after it
+	nodes []parse.Node //The nodes it added to its parent
+}
+
+//NewParser creates a parser for a grammar
+func NewParser(g *Grammar) (*Parser, error) {
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+	if cycle := g.leftRecursion(); cycle != nil {
+		return nil, fmt.Errorf("Grammar is left recursive: %s.", g.arrows(cycle))
+	}
+	p := &Parser{Grammar: g, productionFns: make(map[SymbolType]productionFn)}
+	p.buildMap()
+	return p, nil
+}
+
+//arrows writes a derivation, e.g. a left recursive cycle, with the names of the grammar
+func (g *Grammar) arrows(f SententialForm) string {
+	names := make([]string, len(f))
+	for i, s := range f {
+		names[i] = g.SymbolName(s)
+	}
+	return strings.Join(names, " => ")
+}
+
+func (p *Parser) buildMap() {
+	for _, nt := range p.Grammar.Nonterminals() {
+		p.productionFns[nt] = p.productionFnFactory(nt, p.Grammar.Alternatives(nt))
+	}
+	for t, typ := range p.Grammar.Terminals {
+		lexeme, ok := p.Grammar.Lexemes[t]
+		p.productionFns[t] = terminalFnFactory(t, typ, lexeme, ok)
+	}
+}
+
+//productionFnFactory returns the production function of a non-terminal
+func (p *Parser) productionFnFactory(nt SymbolType, alts []Production) productionFn {
+	return func(r *run) bool {
+		tree := r.tree
+		parent, pos := tree.Curr, tree.Pos
+		key := memoKey{nt, pos}
+		if m, ok := r.memo[key]; ok {
+			if m.ok {
+				for _, n := range m.nodes {
+					//Nodes still in the tree, e.g. when nt matched no tokens, are copied
+					if attached(n, tree.Root) {
+						n = n.Clone()
+					}
+					parent.AddChild(n)
+				}
+				for tree.Pos < m.end {
+					tree.Next()
+				}
+			}
+			return m.ok
+		}
+		before := len(parent.Children())
+		for _, alt := range alts {
+			if r.alternative(alt, parent, pos) {
+				r.memo[key] = memoized{true, tree.Pos, append([]parse.Node(nil), parent.Children()[before:]...)}
+				return true
+			}
+		}
+		r.memo[key] = memoized{ok: false}
+		return false
+	}
+}
+
+//attached returns whether a node is in a tree, and not in a subtree which was rolled back
+func attached(n, root parse.Node) bool {
+	for ; n != nil; n = n.Parent() {
+		if n == root {
+			return true
+		}
+	}
+	return false
+}
+
+//alternative tries to parse an alternative as a child of the parent, starting after pos
+func (r *run) alternative(alt Production, parent parse.Node, pos int) bool {
+	tree := r.tree
+	defer tree.Trace(r.p.Grammar.productionString(alt))()
+
+	n := parent.AddNonTerminal(parse.NodeType(alt.LHS), tree.Peek())
+	tree.Curr = n
+	for _, s := range alt.RHS {
+		if !r.p.productionFns[s](r) {
+			n.RollBack()
+			tree.Curr = parent
+			for tree.Pos > pos {
+				tree.Back()
+			}
+			return false
+		}
+	}
+	n.Commit()
+	tree.Curr = parent
+	if r.p.Grammar.Helpers[alt.LHS] {
+		parent.RemoveChild(n)
+		parent.AddChildren(n.Children())
+	}
+	return true
+}
+
+//terminalFnFactory returns the production function of a terminal
+func terminalFnFactory(t SymbolType, typ lex.TokenType, lexeme string, checkLexeme bool) productionFn {
+	return func(r *run) bool {
+		tok := r.tree.Next()
+		if tok == nil || tok.Type() != typ || checkLexeme && tok.Lexeme() != lexeme {
+			r.fail(t)
+			r.tree.Back()
+			return false
+		}
+		r.tree.AddTerminal(parse.NodeType(t), tok).Commit()
+		return true
+	}
+}
+
+//fail records that a terminal was expected at the next token
+func (r *run) fail(t SymbolType) {
+	pos := r.tree.Pos
+	if pos > r.farthest {
+		r.farthest = pos
+		r.expected = make(map[SymbolType]bool)
+	}
+	if pos == r.farthest {
+		r.expected[t] = true
+	}
+}
+
+//EndOfInput is the pseudo-terminal expected after the start symbol
+const EndOfInput = SymbolType(lex.EOF_Token)
+
+//ParseFn returns the parsing entry point for parse.NewTree
+func (p *Parser) ParseFn() parse.ParseFn {
+	return func(tree *parse.Tree) {
+		r := &run{p: p, tree: tree, farthest: -1, memo: make(map[memoKey]memoized)}
+		if r.p.productionFns[p.Grammar.Start](r) {
+			tok := tree.Next()
+			if tok != nil && tok.Type() == lex.EOF_Token {
+				return
+			}
+			r.fail(EndOfInput)
+			tree.Back()
+		}
+		r.unexpected()
+	}
+}
+
+//unexpected panics with the terminals expected at the farthest token reached
+func (r *run) unexpected() {
+	tree := r.tree
+	var expected parse.OneOf
+	for t := range r.expected {
+		expected = append(expected, r.p.Grammar.terminalName(t))
+	}
+	sort.Strings(expected)
+	if tree.Buffer[r.farthest] == nil {
+		tree.Errorf("expected %v, got end of input.", expected)
+	}
+	tree.Unexpected(tree.Buffer[r.farthest], expected)
+}
+
+//Parse lexes and parses a source
+func (p *Parser) Parse(name, source string, lexStart lex.StateFn) (*parse.Tree, error) {
+	l := lex.Lex(name, source)
+	l.Run(lexStart)
+	defer l.Drain()
+	tree := parse.NewTree(name, source, p.ParseFn())
+	return tree, tree.Parse(l)
+}
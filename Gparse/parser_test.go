@@ -0,0 +1,102 @@
+package Gparse_test
+
+import (
+	"kugg/compilers/Gparse"
+	"kugg/compilers/Gparse/arith"
+	"kugg/compilers/parse"
+	"strings"
+	"testing"
+	"time"
+)
+
+//sexpr writes a tree as nested lists of node names, with the lexemes of terminals
+func sexpr(n parse.Node) string {
+	if n.IsTerminal() {
+		return n.Token().Lexeme()
+	}
+	var parts []string
+	for _, c := range n.Children() {
+		parts = append(parts, sexpr(c))
+	}
+	return n.Type().String() + "(" + strings.Join(parts, " ") + ")"
+}
+
+func arithParser(t *testing.T) *Gparse.Parser {
+	p, err := Gparse.NewParser(arith.Grammar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestParser(t *testing.T) {
+	p := arithParser(t)
+	for src, want := range map[string]string{
+		"1":             "Expr(Term(Factor(1)))",
+		"1 + 2 * 3":     "Expr(Term(Factor(1)) + Expr(Term(Factor(2) * Term(Factor(3)))))",
+		"-(4 - 5) / 6":  "Expr(Term(Factor(- Factor(( Expr(Term(Factor(4)) - Expr(Term(Factor(5)))) ))) / Term(Factor(6))))",
+		"((7))":         "Expr(Term(Factor(( Expr(Term(Factor(( Expr(Term(Factor(7))) )))) ))))",
+		"1 - 2 - 3 * 4": "Expr(Term(Factor(1)) - Expr(Term(Factor(2)) - Expr(Term(Factor(3) * Term(Factor(4))))))",
+	} {
+		tree, err := p.Parse(src, src, arith.LexAny)
+		if err != nil {
+			t.Errorf("%q: %v", src, err)
+			continue
+		}
+		if got := sexpr(tree.Root.Children()[0]); got != want {
+			t.Errorf("%q parsed as\n%s\nexpected\n%s", src, got, want)
+		}
+	}
+}
+
+func TestParserError(t *testing.T) {
+	p := arithParser(t)
+	for src, want := range map[string]string{
+		"1 + * 2": "1,4 : expected one of LParen, Minus, Number, got TimesToken(\"*\")",
+		"(1 + 2":  "1,6 : expected one of Divide, Minus, Plus, RParen, Times, got EOF_Token",
+		"1 2":     "1,2 : expected one of Divide, Minus, Plus, Times, end of input, got NumberToken(\"2\")",
+	} {
+		_, err := p.Parse(src, src, arith.LexAny)
+		if err == nil {
+			t.Errorf("%q parsed", src)
+		} else if !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: the error\n%v\ndoes not contain %q", src, err, want)
+		}
+	}
+}
+
+//TestParserNesting parses deeply nested and long inputs, which backtracking takes exponential time for
+//without memoization
+func TestParserNesting(t *testing.T) {
+	p := arithParser(t)
+	depth := 200
+	srcs := []string{strings.Repeat("(", depth) + "1" + strings.Repeat(")", depth)}
+	gen, err := Gparse.NewGenerator(arith.Grammar(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for len(srcs) < 20 {
+		if s := gen.Generate(); len(s.Symbols) >= 64 {
+			srcs = append(srcs, gen.Render(s))
+		}
+	}
+
+	done := make(chan error)
+	go func() {
+		for _, src := range srcs {
+			if _, err := p.Parse("nested", src, arith.LexAny); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("parsing %d inputs of 64 tokens and more takes longer than 10s", len(srcs))
+	}
+}
@@ -0,0 +1,561 @@
+package Gparse
+
+import (
+	"fmt"
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+)
+
+//Transformed is a grammar rewritten from an original grammar, with a template for every production
+//telling how to build the tree of the original grammar from its nodes, see Reassociate.
+//
+//	t := Gparse.Transform(g)
+//	err := t.EliminateLeftRecursion()
+//	t.LeftFactor()
+//	p, err := Gparse.NewParser(t.Grammar)
+//	tree, err := p.Parse(name, source, lexStart)
+//	err = t.Reassociate(tree)
+//
+//The transformed grammar has no helpers, so that every node is kept for Reassociate,
+//which splices the helpers of the original grammar like its parsers do.
+type Transformed struct {
+	Original *Grammar
+	Grammar  *Grammar
+
+	templates []*template //By index in Grammar.Productions
+	first     SymbolType  //The SymbolType of the first new non-terminal
+	next      SymbolType
+}
+
+//template builds nodes of the original grammar from the children of a node of the transformed grammar,
+//and from the nodes passed down to it
+type template struct {
+	prod  int //The original production of the node built, or -1 to splice the items into the parent
+	items []templateItem
+	tail  int            //If not -1, the child to pass the nodes of pass to, whose nodes are those of the template
+	pass  []templateItem //The nodes passed to the tail child, one list for every item
+}
+
+type itemKind int
+
+const (
+	childItem  itemKind = iota //The nodes of a child
+	passedItem                 //A list of nodes passed down to the node
+	subItem                    //The nodes of a template
+)
+
+type templateItem struct {
+	kind  itemKind
+	index int
+	sub   *template
+}
+
+func child(i int) templateItem     { return templateItem{kind: childItem, index: i} }
+func passed(i int) templateItem    { return templateItem{kind: passedItem, index: i} }
+func sub(t *template) templateItem { return templateItem{kind: subItem, sub: t} }
+func build(prod int, items ...templateItem) *template {
+	return &template{prod: prod, items: items, tail: -1}
+}
+func passTo(tail int, pass ...templateItem) *template {
+	return &template{prod: -1, tail: tail, pass: pass}
+}
+
+//remap copies a template, replacing its child items
+func (t *template) remap(f func(i int) templateItem) *template {
+	items := func(its []templateItem) []templateItem {
+		var out []templateItem
+		for _, it := range its {
+			switch it.kind {
+			case childItem:
+				out = append(out, f(it.index))
+			case subItem:
+				out = append(out, sub(it.sub.remap(f)))
+			default:
+				out = append(out, it)
+			}
+		}
+		return out
+	}
+	c := &template{prod: t.prod, items: items(t.items), tail: t.tail, pass: items(t.pass)}
+	if t.tail >= 0 {
+		c.tail = f(t.tail).index
+	}
+	return c
+}
+
+//tails returns whether a child is passed nodes, at any depth of the template
+func (t *template) tails(i int) bool {
+	if t.tail == i {
+		return true
+	}
+	for _, it := range append(append([]templateItem{}, t.items...), t.pass...) {
+		if it.kind == subItem && it.sub.tails(i) {
+			return true
+		}
+	}
+	return false
+}
+
+//passes returns the number of lists of nodes passed down to the node which the template uses
+func (t *template) passes() int {
+	n := 0
+	for _, it := range append(append([]templateItem{}, t.items...), t.pass...) {
+		switch {
+		case it.kind == passedItem && it.index >= n:
+			n = it.index + 1
+		case it.kind == subItem && it.sub.passes() > n:
+			n = it.sub.passes()
+		}
+	}
+	return n
+}
+
+//Transform starts transforming a grammar, with a copy of it in which every production builds itself
+func Transform(g *Grammar) *Transformed {
+	t := &Transformed{Original: g, first: g.maxSymbol() + 1}
+	t.next = t.first
+	t.Grammar = &Grammar{
+		Name:      g.Name,
+		Start:     g.Start,
+		Terminals: g.Terminals,
+		Lexemes:   g.Lexemes,
+		Helpers:   make(map[SymbolType]bool),
+		Positions: make(map[SymbolType]Position),
+		Names:     make(map[SymbolType]string),
+	}
+	for s, pos := range g.Positions {
+		t.Grammar.Positions[s] = pos
+	}
+	for s, name := range g.Names {
+		t.Grammar.Names[s] = name
+	}
+	for i, p := range g.Productions {
+		items := make([]templateItem, len(p.RHS))
+		for j := range p.RHS {
+			items[j] = child(j)
+		}
+		t.Grammar.Productions = append(t.Grammar.Productions, Production{p.LHS, append(SententialForm{}, p.RHS...)})
+		t.templates = append(t.templates, build(i, items...))
+	}
+	return t
+}
+
+//maxSymbol returns the greatest SymbolType of the grammar
+func (g *Grammar) maxSymbol() SymbolType {
+	max := g.Start
+	for s := range g.Terminals {
+		max = maxSymbol(max, s)
+	}
+	for _, p := range g.Productions {
+		max = maxSymbol(max, p.LHS)
+		for _, s := range p.RHS {
+			max = maxSymbol(max, s)
+		}
+	}
+	return max
+}
+
+func maxSymbol(a, b SymbolType) SymbolType {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+//symbol creates a non-terminal named after another one
+func (t *Transformed) symbol(of SymbolType, kind string) SymbolType {
+	s := t.next
+	t.next++
+	t.Grammar.Names[s] = fmt.Sprintf("%s_%s%d", t.Grammar.SymbolName(of), kind, int(s-t.first))
+	if pos, ok := t.Grammar.Positions[of]; ok {
+		t.Grammar.Positions[s] = pos
+	}
+	return s
+}
+
+//tprod is a production with its template
+type tprod struct {
+	Production
+	t *template
+}
+
+func (t *Transformed) productions() []tprod {
+	ps := make([]tprod, len(t.Grammar.Productions))
+	for i, p := range t.Grammar.Productions {
+		ps[i] = tprod{p, t.templates[i]}
+	}
+	return ps
+}
+
+func (t *Transformed) set(ps []tprod) {
+	t.Grammar.Productions = t.Grammar.Productions[:0]
+	t.templates = t.templates[:0]
+	for _, p := range ps {
+		t.Grammar.Productions = append(t.Grammar.Productions, p.Production)
+		t.templates = append(t.templates, p.t)
+	}
+}
+
+//EliminateLeftRecursion rewrites the left recursive non-terminals of the grammar, so that it can be parsed
+//by Parser or LL1. A directly left recursive non-terminal
+//
+//	A -> A α | β
+//
+//becomes A -> β A_tail, A_tail -> α A_tail | ε. Indirect left recursion is made direct first, by substituting
+//the alternatives of the non-terminals of the cycle which come earlier in the grammar for their first symbol.
+//
+//It fails for cycles like A -> A, and for left recursion hidden behind nullable symbols, like A -> B A x with B -> ε.
+func (t *Transformed) EliminateLeftRecursion() error {
+	g := t.Grammar
+	if err := g.Validate(); err != nil {
+		return err
+	}
+	//Only the non-terminals in a left recursive cycle with each other are rewritten
+	component := make(map[SymbolType]int)
+	for i, c := range g.leftComponents(g.leftCorners()) {
+		for _, s := range c {
+			component[s] = i
+		}
+	}
+
+	order := g.Nonterminals()
+	for i, a := range order {
+		for _, b := range order[:i] {
+			if component[b] != component[a] {
+				continue
+			}
+			var ps []tprod
+			for _, p := range t.productions() {
+				if p.LHS != a || len(p.RHS) == 0 || p.RHS[0] != b {
+					ps = append(ps, p)
+					continue
+				}
+				for _, q := range t.productions() {
+					if q.LHS == b {
+						ps = append(ps, substitute(p, q))
+					}
+				}
+			}
+			t.set(ps)
+		}
+		if err := t.eliminateDirect(a); err != nil {
+			return err
+		}
+	}
+	if cycle := g.leftRecursion(); cycle != nil {
+		return fmt.Errorf("Left recursion through nullable symbols could not be eliminated: %v.", g.arrows(cycle))
+	}
+	return nil
+}
+
+//substitute replaces the first symbol of p by the right hand side of q
+func substitute(p, q tprod) tprod {
+	n := len(q.RHS)
+	rhs := append(append(SententialForm{}, q.RHS...), p.RHS[1:]...)
+	return tprod{Production{p.LHS, rhs}, p.t.remap(func(i int) templateItem {
+		if i == 0 {
+			return sub(q.t)
+		}
+		return child(i + n - 1)
+	})}
+}
+
+//eliminateDirect rewrites the directly left recursive alternatives of a non-terminal
+func (t *Transformed) eliminateDirect(a SymbolType) error {
+	ps := t.productions()
+	recursive := false
+	for _, p := range ps {
+		if p.LHS == a && len(p.RHS) > 0 && p.RHS[0] == a {
+			if len(p.RHS) == 1 {
+				return fmt.Errorf("Grammar has a cycle: %s.", t.Grammar.productionString(p.Production))
+			}
+			recursive = true
+		}
+	}
+	if !recursive {
+		return nil
+	}
+
+	tail := t.symbol(a, "tail")
+	var out, tails []tprod
+	based := false
+	for _, p := range ps {
+		switch {
+		case p.LHS != a:
+			out = append(out, p)
+		case len(p.RHS) > 0 && p.RHS[0] == a:
+			alpha := append(SententialForm{}, p.RHS[1:]...)
+			tmpl := p.t.remap(func(i int) templateItem {
+				if i == 0 {
+					return passed(0)
+				}
+				return child(i - 1)
+			})
+			tails = append(tails, tprod{Production{tail, append(alpha, tail)}, passTo(len(alpha), sub(tmpl))})
+		default:
+			based = true
+			beta := append(SententialForm{}, p.RHS...)
+			out = append(out, tprod{Production{a, append(beta, tail)}, passTo(len(beta), sub(p.t))})
+		}
+	}
+	if !based {
+		return fmt.Errorf("Every alternative of %s is left recursive.", t.Grammar.SymbolName(a))
+	}
+	tails = append(tails, tprod{Production{tail, SententialForm{}}, build(-1, passed(0))})
+	t.set(append(out, tails...))
+	return nil
+}
+
+//leftComponents returns the strongly connected components of the left corner graph
+func (g *Grammar) leftComponents(left map[SymbolType][]SymbolType) [][]SymbolType {
+	index := make(map[SymbolType]int)
+	low := make(map[SymbolType]int)
+	onStack := make(SymbolSet)
+	var stack []SymbolType
+	var components [][]SymbolType
+	var connect func(a SymbolType)
+	connect = func(a SymbolType) {
+		index[a] = len(index)
+		low[a] = index[a]
+		stack = append(stack, a)
+		onStack[a] = true
+		for _, b := range left[a] {
+			if _, ok := index[b]; !ok {
+				connect(b)
+				low[a] = min(low[a], low[b])
+			} else if onStack[b] {
+				low[a] = min(low[a], index[b])
+			}
+		}
+		if low[a] == index[a] {
+			var c []SymbolType
+			for {
+				b := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[b] = false
+				c = append(c, b)
+				if b == a {
+					break
+				}
+			}
+			components = append(components, c)
+		}
+	}
+	for _, nt := range g.Nonterminals() {
+		if _, ok := index[nt]; !ok {
+			connect(nt)
+		}
+	}
+	return components
+}
+
+//LeftFactor rewrites alternatives of a non-terminal with a common prefix
+//
+//	A -> α β1 | α β2
+//
+//into A -> α A_factor, A_factor -> β1 | β2, until no two alternatives start with the same symbol.
+//The order of the alternatives is kept, so Parser still tries them in the same order.
+func (t *Transformed) LeftFactor() {
+	for changed := true; changed; {
+		changed = false
+		ps := t.productions()
+		for _, a := range t.Grammar.Nonterminals() {
+			if out, ok := t.factor(ps, a); ok {
+				t.set(out)
+				changed = true
+				break
+			}
+		}
+	}
+}
+
+//factor factors the first group of alternatives of a non-terminal which start with the same symbol
+func (t *Transformed) factor(ps []tprod, a SymbolType) ([]tprod, bool) {
+	var alts []int
+	for i, p := range ps {
+		if p.LHS == a {
+			alts = append(alts, i)
+		}
+	}
+	for x, i := range alts {
+		var group []int
+		for _, j := range alts[x:] {
+			if len(ps[i].RHS) > 0 && len(ps[j].RHS) > 0 && ps[i].RHS[0] == ps[j].RHS[0] && !ps[i].t.tails(0) && !ps[j].t.tails(0) {
+				group = append(group, j)
+			}
+		}
+		if len(group) < 2 {
+			continue
+		}
+		//The longest prefix of the group, without the children passed nodes
+		n := 1
+	grow:
+		for ; ; n++ {
+			for _, j := range group {
+				rhs := ps[j].RHS
+				if len(rhs) <= n || rhs[n] != ps[group[0]].RHS[n] || ps[j].t.tails(n) {
+					break grow
+				}
+			}
+		}
+
+		prefix := append(SententialForm{}, ps[group[0]].RHS[:n]...)
+		f := t.symbol(a, "factor")
+		//The factor is passed the nodes passed to a, followed by the nodes of the prefix
+		m := 0
+		for _, j := range group {
+			if k := ps[j].t.passes(); k > m {
+				m = k
+			}
+		}
+		items := make([]templateItem, m+n)
+		for k := range items {
+			if k < m {
+				items[k] = passed(k)
+			} else {
+				items[k] = child(k - m)
+			}
+		}
+		var out, factored []tprod
+		seen := make(map[string]bool)
+		for k, p := range ps {
+			if k == group[0] {
+				out = append(out, tprod{Production{a, append(prefix, f)}, passTo(n, items...)})
+			}
+			if !containsInt(group, k) {
+				out = append(out, p)
+				continue
+			}
+			rest := append(SententialForm{}, p.RHS[n:]...)
+			if seen[key(rest)] {
+				continue //A duplicate alternative could never be chosen
+			}
+			seen[key(rest)] = true
+			factored = append(factored, tprod{Production{f, rest}, p.t.remap(func(i int) templateItem {
+				if i < n {
+					return passed(m + i)
+				}
+				return child(i - n)
+			})})
+		}
+		return append(out, factored...), true
+	}
+	return nil, false
+}
+
+func containsInt(is []int, i int) bool {
+	for _, j := range is {
+		if i == j {
+			return true
+		}
+	}
+	return false
+}
+
+//Reassociate rebuilds a tree parsed with the transformed grammar into the tree of the original grammar,
+//e.g. a left recursive Expr -> Expr "+" Term from Expr -> Term Expr_tail, Expr_tail -> "+" Term Expr_tail.
+func (t *Transformed) Reassociate(tree *parse.Tree) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(reassociateError); ok {
+				err = e
+				return
+			}
+			panic(r)
+		}
+	}()
+	index := make(map[string]int)
+	for i := len(t.Grammar.Productions) - 1; i >= 0; i-- {
+		p := t.Grammar.Productions[i]
+		index[key(append(SententialForm{p.LHS}, p.RHS...))] = i
+	}
+	r := &reassociation{t: t, tree: tree, index: index}
+	old := tree.Root.Children()
+	var nodes []parse.Node
+	for _, n := range old {
+		nodes = append(nodes, r.rebuild(n, nil)...)
+	}
+	for _, n := range old {
+		tree.Root.RemoveChild(n)
+	}
+	tree.Root.AddChildren(nodes)
+	return nil
+}
+
+type reassociateError struct{ error }
+
+type reassociation struct {
+	t     *Transformed
+	tree  *parse.Tree
+	index map[string]int //Productions of the transformed grammar by their symbols
+}
+
+//rebuild returns the nodes of the original grammar of a node, which is passed nodes by its parent
+func (r *reassociation) rebuild(n parse.Node, passed [][]parse.Node) []parse.Node {
+	if n.IsTerminal() {
+		return []parse.Node{n}
+	}
+	symbols := SententialForm{SymbolType(n.Type())}
+	for _, c := range n.Children() {
+		symbols = append(symbols, SymbolType(c.Type()))
+	}
+	i, ok := r.index[key(symbols)]
+	if !ok {
+		g := r.t.Grammar
+		panic(reassociateError{fmt.Errorf("Node %s is not derived by a production of the transformed grammar: %s.",
+			g.SymbolName(symbols[0]), g.productionString(Production{symbols[0], symbols[1:]}))})
+	}
+	return r.eval(r.t.templates[i], n, passed)
+}
+
+func (r *reassociation) eval(t *template, n parse.Node, passed [][]parse.Node) []parse.Node {
+	item := func(it templateItem) []parse.Node {
+		switch it.kind {
+		case childItem:
+			return r.rebuild(n.Children()[it.index], nil)
+		case passedItem:
+			return passed[it.index]
+		}
+		return r.eval(it.sub, n, passed)
+	}
+	if t.tail >= 0 {
+		var pass [][]parse.Node
+		for _, it := range t.pass {
+			pass = append(pass, item(it))
+		}
+		return r.rebuild(n.Children()[t.tail], pass)
+	}
+
+	var items []parse.Node
+	for _, it := range t.items {
+		items = append(items, item(it)...)
+	}
+	if t.prod < 0 {
+		return items
+	}
+	p := r.t.Original.Productions[t.prod]
+	if r.t.Original.Helpers[p.LHS] {
+		return items
+	}
+	tok := n.Token()
+	if len(items) > 0 {
+		tok = items[0].Token()
+	}
+	node := parse.NewNonTerminal(parse.NodeType(p.LHS), tok, r.tree)
+	node.AddChildren(items)
+	node.Commit()
+	return []parse.Node{node}
+}
+
+//Parse parses a source with a Parser of the transformed grammar, and reassociates the tree
+func (t *Transformed) Parse(name, source string, lexStart lex.StateFn) (*parse.Tree, error) {
+	p, err := NewParser(t.Grammar)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := p.Parse(name, source, lexStart)
+	if err != nil {
+		return tree, err
+	}
+	return tree, t.Reassociate(tree)
+}
@@ -0,0 +1,124 @@
+package Gparse_test
+
+import (
+	"kugg/compilers/Gparse"
+	"kugg/compilers/Gparse/arith"
+	"strings"
+	"testing"
+)
+
+//leftRecursive is a left recursive expression grammar, whose operators of sums are in a helper
+const leftRecursive = `
+E = E ( "+" | "-" ) T | T ;
+T = T "*" F | F ;
+F = "(" E ")" | "-" F | NumberToken ;
+`
+
+//commonPrefix has alternatives starting with the same symbols, and no left recursion
+const commonPrefix = `
+S = "(" NumberToken ")" | "(" NumberToken "+" S ")" | "(" "-" | NumberToken ;
+`
+
+//TestTransform checks the grammars rewritten by EliminateLeftRecursion and LeftFactor, which are LL(1)
+func TestTransform(t *testing.T) {
+	for _, c := range []struct {
+		src  string
+		want string
+	}{
+		{leftRecursive, `
+E_group5 -> "+"
+E_group5 -> "-"
+E -> T E_tail0
+T -> F T_tail1
+F -> "(" E ")"
+F -> "-" F
+F -> NumberToken
+E_tail0 -> E_group5 T E_tail0
+E_tail0 -> ε
+T_tail1 -> "*" F T_tail1
+T_tail1 -> ε`},
+		{commonPrefix, `
+S -> "(" S_factor0
+S -> NumberToken
+S_factor0 -> NumberToken S_factor0_factor1
+S_factor0 -> "-"
+S_factor0_factor1 -> ")"
+S_factor0_factor1 -> "+" S ")"`},
+	} {
+		tr := Gparse.Transform(loadGrammar(t, c.src))
+		if err := tr.EliminateLeftRecursion(); err != nil {
+			t.Fatal(err)
+		}
+		tr.LeftFactor()
+		if got := tr.Grammar.String(); got != c.want[1:] {
+			t.Errorf("the grammar is transformed into\n%s\nexpected\n%s", got, c.want[1:])
+		}
+		if _, err := Gparse.NewLL1(tr.Grammar); err != nil {
+			t.Errorf("the transformed grammar is not LL(1): %v", err)
+		}
+	}
+}
+
+//TestReassociate parses with the transformed grammars, and checks that the trees are those of the original
+//grammars, with left associative operators, as the LR parser of the original grammars builds them
+func TestReassociate(t *testing.T) {
+	for _, c := range []struct {
+		src   string
+		input string
+		tree  string
+	}{
+		{leftRecursive, "1 - 2 - 3", `E(E(E(T(F(1))) - T(F(2))) - T(F(3)))`},
+		{leftRecursive, "1 * 2 * 3 + 4", `E(E(T(T(T(F(1)) * F(2)) * F(3))) + T(F(4)))`},
+		{leftRecursive, "-(1 + 2) * 3", `E(T(T(F(- F(( E(E(T(F(1))) + T(F(2))) )))) * F(3)))`},
+		{leftRecursive, "(1)", `E(T(F(( E(T(F(1))) ))))`},
+		{commonPrefix, "(1)", `S(( 1 ))`},
+		{commonPrefix, "(1 + (2 + 3))", `S(( 1 + S(( 2 + S(3) )) ))`},
+		{commonPrefix, "(-", `S(( -)`},
+	} {
+		g := loadGrammar(t, c.src)
+		tr := Gparse.Transform(g)
+		if err := tr.EliminateLeftRecursion(); err != nil {
+			t.Fatal(err)
+		}
+		tr.LeftFactor()
+		tree, err := tr.Parse(c.input, c.input, arith.LexAny)
+		if err != nil {
+			t.Errorf("parsing %q: %v", c.input, err)
+			continue
+		}
+		if got := gsexpr(g, tree.Root.Children()[0]); got != c.tree {
+			t.Errorf("%q parses as %s, expected %s", c.input, got, c.tree)
+		}
+		lr, err := Gparse.NewLR(g, Gparse.LROptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		original, err := lr.Parse(c.input, c.input, arith.LexAny)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := tree.SPPrint(), original.SPPrint(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("%q is reassociated into\n%s\nand parsed by the original grammar into\n%s", c.input, strings.Join(got, "\n"), strings.Join(want, "\n"))
+		}
+	}
+}
+
+//TestReassociateError reassociates a tree which is not parsed with the transformed grammar
+func TestReassociateError(t *testing.T) {
+	g := loadGrammar(t, leftRecursive)
+	tr := Gparse.Transform(g)
+	if err := tr.EliminateLeftRecursion(); err != nil {
+		t.Fatal(err)
+	}
+	lr, err := Gparse.NewLR(g, Gparse.LROptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := lr.Parse("1 * 2", "1 * 2", arith.LexAny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Reassociate(tree); err == nil || err.Error() != "Node E is not derived by a production of the transformed grammar: E -> T." {
+		t.Errorf("reassociating the tree of the original grammar returned %v", err)
+	}
+}
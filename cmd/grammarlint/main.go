@@ -0,0 +1,127 @@
+/*
+Grammarlint checks Gparse grammar files for common mistakes, see Gparse.Lint.
+
+Usage:
+
+	grammarlint [-lexer name] [-disable checks] grammar.ebnf...
+
+It prints a line per finding, with its position in the grammar file and the check which found it:
+
+	expr.ebnf:3:10: undefined: Factr is neither a rule nor a token
+
+The lexer named with -lexer lexes the quoted terminals of the grammars, and its token names are
+the names of tokens in the grammars. The checks are
+
+	undefined        names which are neither rules nor tokens
+	unreachable      rules which are not reachable from the start rule
+	nonproductive    rules which derive no string of terminals
+	left-recursion   rules which derive themselves at their start, directly or indirectly
+	duplicate        rules defined twice, and alternatives listed twice
+	token            terminals which are not lexed as one token, or match no token type
+
+The exit status is 1 if there are findings or a grammar does not load, and 2 for usage errors.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"kugg/compilers/Gparse"
+	_ "kugg/compilers/Gparse/arith"
+	"os"
+	"sort"
+	"strings"
+)
+
+var (
+	lexer   = flag.String("lexer", "", "the lexer of the language of the grammars, one of "+lexerNames())
+	disable = flag.String("disable", "", "comma separated checks to skip, e.g. left-recursion,unreachable")
+)
+
+func lexerNames() string {
+	var names []string
+	for name := range Gparse.Lexers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: grammarlint [flags] grammar.ebnf...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	loader := &Gparse.Loader{}
+	if *lexer != "" {
+		start, ok := Gparse.Lexers[*lexer]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "grammarlint: unknown lexer %s, expected one of %s\n", *lexer, lexerNames())
+			os.Exit(2)
+		}
+		loader.Lex = start
+	}
+	skip := make(map[string]bool)
+	if *disable != "" {
+		for _, check := range strings.Split(*disable, ",") {
+			if !known(check) {
+				fmt.Fprintf(os.Stderr, "grammarlint: unknown check %s, expected one of %s\n", check, strings.Join(Gparse.LintChecks, ", "))
+				os.Exit(2)
+			}
+			skip[check] = true
+		}
+	}
+
+	failed := false
+	for _, file := range flag.Args() {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "grammarlint: %v\n", err)
+			failed = true
+			continue
+		}
+		findings, err := lint(loader, file, string(src), skip)
+		if err != nil {
+			fmt.Println(err)
+			failed = true
+			continue
+		}
+		for _, f := range findings {
+			fmt.Println(f)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+//lint checks a grammar file, leaving out the findings of the skipped checks
+func lint(loader *Gparse.Loader, file, src string, skip map[string]bool) ([]Gparse.Finding, error) {
+	findings, err := loader.Lint(file, src)
+	if err != nil {
+		return nil, err
+	}
+	var kept []Gparse.Finding
+	for _, f := range findings {
+		if !skip[f.Check] {
+			kept = append(kept, f)
+		}
+	}
+	return kept, nil
+}
+
+func known(check string) bool {
+	for _, c := range Gparse.LintChecks {
+		if c == check {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"kugg/compilers/Gparse"
+	_ "kugg/compilers/Gparse/arith"
+	"os"
+	"strings"
+	"testing"
+)
+
+//lintFile lints a grammar of testdata with the lexer of arith
+func lintFile(t *testing.T, file string, skip map[string]bool) string {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	findings, err := lint(&Gparse.Loader{Lex: Gparse.Lexers["arith"]}, file, string(src), skip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := make([]string, len(findings))
+	for i, f := range findings {
+		lines[i] = f.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+//TestChecks lints the grammar of testdata named after each check
+func TestChecks(t *testing.T) {
+	want := map[string]string{
+		"undefined": `
+testdata/undefined.ebnf:3:10: undefined: Factr is neither a rule nor a token`,
+		"unreachable": `
+testdata/unreachable.ebnf:3:1: unreachable: rule Group is not reachable from Expr`,
+		"nonproductive": `
+testdata/nonproductive.ebnf:3:1: nonproductive: rule List derives no string of terminals, every alternative recurses forever`,
+		"left-recursion": `
+testdata/left-recursion.ebnf:3:1: left-recursion: rule Sum is left recursive: Sum => Sum
+testdata/left-recursion.ebnf:4:1: left-recursion: rule Prod is indirectly left recursive: Prod => Pow => Neg => Prod`,
+		"duplicate": `
+testdata/duplicate.ebnf:3:1: duplicate: the alternative NumberToken of Term is listed twice
+testdata/duplicate.ebnf:4:1: duplicate: rule Expr is already defined at testdata/duplicate.ebnf:2:1`,
+		"token": `
+testdata/token.ebnf:2:22: token: terminal "1 2" is not lexed as one token
+testdata/token.ebnf:2:43: token: terminal EOF_Token matches token type -2, which is not a token type of lex.TokenNames`,
+	}
+	for _, check := range Gparse.LintChecks {
+		file := "testdata/" + check + ".ebnf"
+		if got := lintFile(t, file, nil); got != want[check][1:] {
+			t.Errorf("the findings of %s are\n%s\nexpected\n%s", file, got, want[check][1:])
+		}
+		//Disabling the check leaves nothing to report
+		if got := lintFile(t, file, map[string]bool{check: true}); got != "" {
+			t.Errorf("the findings of %s without %s are\n%s", file, check, got)
+		}
+	}
+}
+
+//TestSyntaxError checks that syntax errors fail the lint instead of being findings
+func TestSyntaxError(t *testing.T) {
+	findings, err := lint(&Gparse.Loader{}, "bad.ebnf", "Expr = ( NumberToken ;", nil)
+	if err == nil || err.Error() != `bad.ebnf:1:22: expected ), got ";"` || findings != nil {
+		t.Errorf("linting a syntax error returned %v and %v", findings, err)
+	}
+}
@@ -0,0 +1,231 @@
+/*
+Parsedbg steps through a parse trace recorded with parse.Tree.Record and written with
+parse.Recorder.WriteJSON, showing the source next to the tree as it was after each step.
+
+Usage:
+
+	parsedbg [-timeline] [-height n] trace.json
+
+Commands, read from standard input:
+
+	n [k], or an empty line   step forward k steps
+	b [k]                     step back k steps
+	g i                       go to step i
+	f text                    go forward to the next step containing text, e.g. "rollback" or "Call#12"
+	r text                    go back to the previous step containing text
+	t [k]                     print the timeline of the k steps around the current one
+	q                         quit
+*/
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"kugg/compilers/parse"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	timeline = flag.Bool("timeline", false, "print the timeline of the trace and exit")
+	height   = flag.Int("height", 20, "number of lines of source and tree to show")
+	width    = flag.Int("width", 60, "width of the source column")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: parsedbg [flags] trace.json")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	rec, err := parse.ReadTrace(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *timeline {
+		fmt.Print(rec.Timeline())
+		return
+	}
+
+	d := &debugger{rec: rec, lines: strings.Split(rec.Source, "\n")}
+	d.show()
+	in := bufio.NewScanner(os.Stdin)
+	for fmt.Print("(parsedbg) "); in.Scan(); fmt.Print("(parsedbg) ") {
+		if !d.command(strings.Fields(in.Text())) {
+			return
+		}
+	}
+}
+
+type debugger struct {
+	rec   *parse.Recorder
+	lines []string //Lines of the source
+	step  int      //Number of steps taken
+}
+
+//command runs a command, and returns false to quit
+func (d *debugger) command(args []string) bool {
+	cmd, arg := "n", ""
+	if len(args) > 0 {
+		cmd = args[0]
+	}
+	if len(args) > 1 {
+		arg = strings.Join(args[1:], " ")
+	}
+	count := func(def int) int {
+		if k, err := strconv.Atoi(arg); err == nil {
+			return k
+		}
+		return def
+	}
+
+	switch cmd {
+	case "n":
+		d.goTo(d.step + count(1))
+	case "b":
+		d.goTo(d.step - count(1))
+	case "g":
+		d.goTo(count(d.step))
+	case "f", "r":
+		dir := 1
+		if cmd == "r" {
+			dir = -1
+		}
+		for i := d.step + dir; i >= 1 && i <= len(d.rec.Steps); i += dir {
+			if strings.Contains(d.rec.Steps[i-1].String(), arg) {
+				d.goTo(i)
+				return true
+			}
+		}
+		fmt.Printf("no step containing %q\n", arg)
+	case "t":
+		k := count(10)
+		for i := maxInt(0, d.step-k/2-1); i < minInt(len(d.rec.Steps), d.step+k/2); i++ {
+			marker := "  "
+			if i == d.step-1 {
+				marker = "=>"
+			}
+			s := d.rec.Steps[i]
+			fmt.Printf("%s%5d %s%s\n", marker, i+1, strings.Repeat("  ", s.Depth), s)
+		}
+	case "q":
+		return false
+	default:
+		fmt.Println("commands: n [k], b [k], g i, f text, r text, t [k], q")
+	}
+	return true
+}
+
+func (d *debugger) goTo(step int) {
+	d.step = maxInt(0, minInt(step, len(d.rec.Steps)))
+	d.show()
+}
+
+//show prints the current step, with the source next to the tree
+func (d *debugger) show() {
+	var current *parse.Step
+	if d.step > 0 {
+		current = &d.rec.Steps[d.step-1]
+		fmt.Printf("step %d/%d: %s\n", d.step, len(d.rec.Steps), current)
+	} else {
+		fmt.Printf("step 0/%d: start\n", len(d.rec.Steps))
+	}
+
+	//The last token seen is where the parser is in the source
+	var tok *parse.StepToken
+	for i := d.step - 1; i >= 0 && tok == nil; i-- {
+		tok = d.rec.Steps[i].Token
+	}
+	left := d.source(tok)
+
+	right := d.rec.TreeAt(d.step).Lines()
+	focus := len(right) - 1
+	if current != nil && current.Node != 0 {
+		mark := fmt.Sprintf(" #%d", current.Node)
+		for i, line := range right {
+			if strings.HasSuffix(line, mark) {
+				focus = i
+				right[i] = line + "  <="
+			}
+		}
+	}
+	right = window(right, focus, *height)
+
+	for i := 0; i < maxInt(len(left), len(right)); i++ {
+		l, r := "", ""
+		if i < len(left) {
+			l = left[i]
+		}
+		if i < len(right) {
+			r = right[i]
+		}
+		fmt.Printf("%s | %s\n", pad(l, *width), r)
+	}
+}
+
+//source returns the lines of the source around a token, with a cursor under it
+func (d *debugger) source(tok *parse.StepToken) []string {
+	line := 1
+	if tok != nil {
+		line = tok.Line
+	}
+	var out []string
+	focus := 0
+	for i, text := range d.lines {
+		out = append(out, fmt.Sprintf("%4d %s", i+1, strings.ReplaceAll(text, "\t", "    ")))
+		if i+1 == line {
+			focus = len(out) - 1
+			if tok != nil {
+				//The row counts runes, and tabs before the token are expanded like in the line
+				before := []rune(text)[:minInt(maxInt(0, tok.Row), utf8.RuneCountInString(text))]
+				start := utf8.RuneCountInString(strings.ReplaceAll(string(before), "\t", "    "))
+				out = append(out, "     "+strings.Repeat(" ", start)+strings.Repeat("^", maxInt(1, utf8.RuneCountInString(tok.Lexeme))))
+			}
+		}
+	}
+	return window(out, focus, *height)
+}
+
+//window returns at most n lines around the focused line
+func window(lines []string, focus, n int) []string {
+	if len(lines) <= n {
+		return lines
+	}
+	start := maxInt(0, minInt(focus-n/2, len(lines)-n))
+	return lines[start : start+n]
+}
+
+func pad(s string, w int) string {
+	if n := utf8.RuneCountInString(s); n < w {
+		return s + strings.Repeat(" ", w-n)
+	}
+	return string([]rune(s)[:w])
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
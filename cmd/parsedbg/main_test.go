@@ -0,0 +1,83 @@
+package main
+
+import (
+	"kugg/compilers/Gparse"
+	"kugg/compilers/Gparse/arith"
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+	"os"
+	"strings"
+	"testing"
+)
+
+func recordedParse(t *testing.T, src string) *parse.Recorder {
+	p, err := Gparse.NewParser(arith.Grammar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := parse.NewTree(src, src, p.ParseFn())
+	rec := tree.Record()
+	l := lex.Lex(src, src)
+	l.Run(arith.LexAny)
+	defer l.Drain()
+	if err := tree.Parse(l); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+func TestCommands(t *testing.T) {
+	stdout := os.Stdout
+	os.Stdout, _ = os.Open(os.DevNull)
+	defer func() { os.Stdout = stdout }()
+
+	rec := recordedParse(t, "1 + 2")
+	d := &debugger{rec: rec, lines: strings.Split(rec.Source, "\n")}
+	for _, c := range []struct {
+		cmd  string
+		step int
+	}{
+		{"", 1},
+		{"n 9", 10},
+		{"f rollback", 12},
+		{"f Factor#6", 25},
+		{"r remove", 21},
+		{"r nothing like it", 21},
+		{"b 5", 16},
+		{"g 1000", len(rec.Steps)},
+		{"n", len(rec.Steps)},
+		{"b 1000", 0},
+		{"t", 0},
+		{"help", 0},
+	} {
+		if !d.command(strings.Fields(c.cmd)) {
+			t.Fatalf("%q quit", c.cmd)
+		}
+		if d.step != c.step {
+			t.Errorf("%q went to step %d, expected %d", c.cmd, d.step, c.step)
+		}
+	}
+	if d.command([]string{"q"}) {
+		t.Errorf("q did not quit")
+	}
+}
+
+func TestSource(t *testing.T) {
+	d := &debugger{lines: []string{"1 +", "\t(2)", "* 3"}}
+	want := []string{
+		"   1 1 +",
+		"   2     (2)",
+		"          ^",
+		"   3 * 3",
+	}
+	tok := &parse.StepToken{Type: "NumberToken", Lexeme: "2", Line: 2, Row: 2}
+	if got := d.source(tok); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("the source is\n%s\nexpected\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if got := window([]string{"a", "b", "c", "d", "e"}, 4, 2); strings.Join(got, "") != "de" {
+		t.Errorf("the window is %v", got)
+	}
+	if got := window([]string{"a", "b", "c", "d", "e"}, 2, 3); strings.Join(got, "") != "bcd" {
+		t.Errorf("the window is %v", got)
+	}
+}
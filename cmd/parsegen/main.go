@@ -0,0 +1,134 @@
+/*
+Parsegen writes the recursive descent parser of an LL(1) grammar file as Go source, see Gparse.GenerateGo.
+
+Usage:
+
+	parsegen [-lexer name] [-package name] [-first n] [-o file] [-check file] grammar.ebnf
+
+The lexer named with -lexer lexes the quoted terminals of the grammar, and its token names are
+the names of tokens in the grammar, as for cmd/grammarlint. The parser is written to standard output,
+or to the file of -o. The flags are
+
+	-package  the package of the parser, the name of the grammar file by default
+	-first    the node type of the first rule, so the node types don't clash with those of other packages
+	-check    compare the parser to a file instead of writing it, e.g. a golden file or a parser to keep current
+
+With -check, the exit status is 1 if the file differs, so
+
+	parsegen -lexer arith -check testdata/expr.go.golden testdata/expr.ebnf
+
+checks the golden file of the grammar of testdata, as go test does, and go test -update rewrites it. Otherwise the exit status is 1 if the grammar
+does not load or is not LL(1), and 2 for usage errors.
+*/
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"kugg/compilers/Gparse"
+	_ "kugg/compilers/Gparse/arith"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	lexer   = flag.String("lexer", "", "the lexer of the language of the grammar, one of "+lexerNames())
+	pkg     = flag.String("package", "", "the package of the parser, the name of the grammar file by default")
+	first   = flag.Int("first", 0, "the node type of the first rule")
+	output  = flag.String("o", "", "the file to write the parser to, standard output by default")
+	checked = flag.String("check", "", "the file to compare the parser to, instead of writing it")
+)
+
+func lexerNames() string {
+	var names []string
+	for name := range Gparse.Lexers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: parsegen [flags] grammar.ebnf")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	file := flag.Arg(0)
+
+	loader := &Gparse.Loader{First: Gparse.SymbolType(*first)}
+	if *lexer != "" {
+		start, ok := Gparse.Lexers[*lexer]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "parsegen: unknown lexer %s, expected one of %s\n", *lexer, lexerNames())
+			os.Exit(2)
+		}
+		loader.Lex = start
+	}
+	if *pkg == "" {
+		*pkg = packageName(file)
+	}
+
+	src, err := os.ReadFile(file)
+	if err != nil {
+		fail(err)
+	}
+	parser, err := generate(loader, file, string(src), *pkg)
+	if err != nil {
+		fail(err)
+	}
+
+	switch {
+	case *checked != "":
+		golden, err := os.ReadFile(*checked)
+		if err != nil {
+			fail(err)
+		}
+		if !bytes.Equal(golden, parser) {
+			fmt.Fprintf(os.Stderr, "parsegen: %s is not the parser of %s\n", *checked, file)
+			os.Exit(1)
+		}
+	case *output != "":
+		if err := os.WriteFile(*output, parser, 0666); err != nil {
+			fail(err)
+		}
+	default:
+		os.Stdout.Write(parser)
+	}
+}
+
+//generate loads a grammar file and writes its parser
+func generate(loader *Gparse.Loader, file, src, pkg string) ([]byte, error) {
+	g, err := loader.Load(file, src)
+	if err != nil {
+		return nil, err
+	}
+	return Gparse.GenerateGo(g, Gparse.GoOptions{Package: pkg, Source: filepath.Base(file)})
+}
+
+//packageName returns the name of a grammar file as a package name, e.g. expr for expr.ebnf
+func packageName(file string) string {
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	name = strings.ToLower(strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' || r == ' ' {
+			return '_'
+		}
+		return r
+	}, name))
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		name = "p" + name
+	}
+	return name
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "parsegen: %v\n", err)
+	os.Exit(1)
+}
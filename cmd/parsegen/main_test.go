@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"kugg/compilers/Gparse"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of testdata")
+
+const (
+	grammarFile = "testdata/expr.ebnf"
+	goldenFile  = "testdata/expr.go.golden"
+)
+
+func generateExpr(t *testing.T) []byte {
+	src, err := os.ReadFile(grammarFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser, err := generate(&Gparse.Loader{Lex: Gparse.Lexers["arith"]}, grammarFile, string(src), "expr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parser
+}
+
+//TestGolden compares the parser of testdata/expr.ebnf to its golden file. go test -update rewrites it.
+func TestGolden(t *testing.T) {
+	parser := generateExpr(t)
+	if *update {
+		if err := os.WriteFile(goldenFile, parser, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	golden, err := os.ReadFile(goldenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(golden, parser) {
+		t.Errorf("the parser of %s is not %s, run go test -update if the change is meant", grammarFile, goldenFile)
+	}
+}
+
+//exprMain parses its arguments with the generated parser, printing a tree or an error a line for each
+const exprMain = `package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"kugg/compilers/Gparse/arith"
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+	expr "%s"
+)
+
+func sexpr(n parse.Node) string {
+	if n.IsTerminal() {
+		return n.Token().Lexeme()
+	}
+	var parts []string
+	for _, c := range n.Children() {
+		parts = append(parts, sexpr(c))
+	}
+	return n.Type().String() + "(" + strings.Join(parts, " ") + ")"
+}
+
+func main() {
+	for _, src := range os.Args[1:] {
+		tree := parse.NewTree(src, src, expr.Parse)
+		if err := tree.Parse(lex.LexAll(src, src, arith.LexAny).Lexer()); err != nil {
+			fmt.Println("error")
+			continue
+		}
+		fmt.Println(sexpr(tree.Root.Children()[0]))
+	}
+}
+`
+
+//TestCompile builds the generated parser, and parses with it
+func TestCompile(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a program")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not installed")
+	}
+	out, err := exec.Command("go", "list", "-f", "{{.ImportPath}}", ".").Output()
+	if err != nil {
+		t.Skipf("the package is not in a module: %v", err)
+	}
+	//The program is written in the module, for the generated parser to import its packages
+	dir, err := os.MkdirTemp("testdata", "compile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "expr"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "expr", "expr.go"), generateExpr(t), 0666); err != nil {
+		t.Fatal(err)
+	}
+	exprPath := strings.TrimSpace(string(out)) + "/" + filepath.ToSlash(dir) + "/expr"
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(strings.Replace(exprMain, "%s", exprPath, 1)), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	inputs := map[string]string{
+		"1":          "Expr(Term(Factor(1)))",
+		"1 + 2 * 3":  "Expr(Term(Factor(1)) + Term(Factor(2) * Factor(3)))",
+		"-(4 - 5)/6": "Expr(Term(Factor(- Factor(( Expr(Term(Factor(4)) - Term(Factor(5))) ))) / Factor(6)))",
+		"1 + * 2":    "error",
+		"(1":         "error",
+	}
+	var srcs []string
+	for src := range inputs {
+		srcs = append(srcs, src)
+	}
+	cmd := exec.Command("go", append([]string{"run", "./" + filepath.ToSlash(dir)}, srcs...)...)
+	cmd.Stderr = os.Stderr
+	out, err = cmd.Output()
+	if err != nil {
+		t.Fatalf("the generated parser does not run: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	if len(lines) != len(srcs) {
+		t.Fatalf("%d lines of output for %d inputs:\n%s", len(lines), len(srcs), out)
+	}
+	for i, src := range srcs {
+		if lines[i] != inputs[src] {
+			t.Errorf("%q parsed as\n%s\nexpected\n%s", src, lines[i], inputs[src])
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package lex
+
+import (
+	"reflect"
+	"strings"
+)
+
+//Checkpoint is a point where a lexer can be restarted: a state about to run with no token in progress.
+//
+//States are told apart by their function, so a restarted state must not depend on
+//data captured by a closure or kept outside the BaseLexer.
+type Checkpoint struct {
+	Pos       int     //Position in the source
+	Line      int     //Line of the position
+	LineStart int     //Position of the first character on the line
+	State     StateFn //The state about to run
+	Emitted   int     //Number of tokens emitted before the checkpoint
+}
+
+//Lexed is the complete output of a lexer, which can be updated after edits of the source
+type Lexed struct {
+	Name        string
+	Source      string
+	Tokens      []Token
+	Checkpoints []Checkpoint
+}
+
+//Window describes the tokens replaced by an edit of a Lexed.
+//
+//The old tokens [Start,End) were replaced by the new tokens [Start,NewEnd).
+//The tokens before Start are the same, the tokens after are moved, but otherwise equal.
+type Window struct {
+	Start, End, NewEnd int
+}
+
+//LexAll lexes a whole source synchronously, recording checkpoints to restart from after edits
+func LexAll(name, source string, start StateFn) *Lexed {
+	x := &Lexed{Name: name, Source: source}
+	l := Lex(name, source)
+	l.emit = func(t Token) { x.Tokens = append(x.Tokens, t) }
+	for state := start; state != nil; {
+		if l.Start == l.Pos {
+			x.Checkpoints = append(x.Checkpoints, l.checkpoint(state, len(x.Tokens)))
+		}
+		state = state(l)
+	}
+	return x
+}
+
+func (l *BaseLexer) checkpoint(state StateFn, emitted int) Checkpoint {
+	return Checkpoint{Pos: l.Pos, Line: l.Line, LineStart: l.Lines[l.Line], State: state, Emitted: emitted}
+}
+
+func sameState(a, b StateFn) bool {
+	return reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+}
+
+//Edit replaces the source between start and end with text, and lexes only the affected part again.
+//
+//The lexer is restarted at the last checkpoint before the edit, and stopped at the first checkpoint
+//after the edit where it is in the same state as it was at the same place in the old source.
+//This assumes that the end of a token depends on at most one rune after it.
+func (x *Lexed) Edit(start, end int, text string) (*Lexed, Window) {
+	source := x.Source[:start] + text + x.Source[end:]
+	delta := len(text) - (end - start)
+	editEnd := start + len(text)
+
+	nx := &Lexed{Name: x.Name, Source: source}
+	if len(x.Checkpoints) == 0 {
+		return nx, Window{0, len(x.Tokens), 0}
+	}
+
+	//Restart before the edit, the token ending just before it may have looked at its first rune
+	from := 0
+	for i, cp := range x.Checkpoints {
+		if cp.Pos < start {
+			from = i
+		}
+	}
+	cp := x.Checkpoints[from]
+	nx.Checkpoints = append(nx.Checkpoints, x.Checkpoints[:from]...)
+	nx.Tokens = append(nx.Tokens, x.Tokens[:cp.Emitted]...)
+
+	//Old checkpoints after the edit, by position
+	after := make(map[int]int)
+	for i := from; i < len(x.Checkpoints); i++ {
+		if _, ok := after[x.Checkpoints[i].Pos]; !ok && x.Checkpoints[i].Pos >= end {
+			after[x.Checkpoints[i].Pos] = i
+		}
+	}
+
+	l := &BaseLexer{
+		Name:   x.Name,
+		Source: source,
+		Start:  cp.Pos,
+		Pos:    cp.Pos,
+		Line:   cp.Line,
+		Lines:  map[int]int{cp.Line: cp.LineStart},
+	}
+	l.emit = func(t Token) { nx.Tokens = append(nx.Tokens, t) }
+	for state := cp.State; state != nil; {
+		if l.Start == l.Pos {
+			if l.Pos >= editEnd {
+				if i, ok := after[l.Pos-delta]; ok && sameState(x.Checkpoints[i].State, state) {
+					w := Window{cp.Emitted, x.Checkpoints[i].Emitted, len(nx.Tokens)}
+					nx.shift(x, i, delta, l)
+					return nx, w
+				}
+			}
+			nx.Checkpoints = append(nx.Checkpoints, l.checkpoint(state, len(nx.Tokens)))
+		}
+		state = state(l)
+	}
+	return nx, Window{cp.Emitted, len(x.Tokens), len(nx.Tokens)}
+}
+
+//shift appends the old tokens and checkpoints from a checkpoint on, moved to where the lexer l converged
+func (nx *Lexed) shift(x *Lexed, from int, delta int, l *BaseLexer) {
+	old := x.Checkpoints[from]
+	lineDelta := l.Line - old.Line
+	newLineStart := l.Lines[l.Line]
+	emittedDelta := len(nx.Tokens) - old.Emitted
+
+	for _, t := range x.Tokens[old.Emitted:] {
+		row := t.Row()
+		if t.Line() == old.Line {
+			//On the line of the checkpoint, the columns move with the start of the line
+			row += delta + old.LineStart - newLineStart
+			if row < 0 {
+				row = 0
+			}
+		}
+		nx.Tokens = append(nx.Tokens, &token{
+			typ:   t.Type(),
+			value: t.Lexeme(),
+			pos:   t.Pos() + delta,
+			row:   row,
+			line:  t.Line() + lineDelta,
+		})
+	}
+	for _, cp := range x.Checkpoints[from:] {
+		lineStart := cp.LineStart + delta
+		if cp.Line == old.Line {
+			lineStart = newLineStart
+		}
+		nx.Checkpoints = append(nx.Checkpoints, Checkpoint{
+			Pos:       cp.Pos + delta,
+			Line:      cp.Line + lineDelta,
+			LineStart: lineStart,
+			State:     cp.State,
+			Emitted:   cp.Emitted + emittedDelta,
+		})
+	}
+}
+
+//Lexer returns a lexer which replays the tokens
+func (x *Lexed) Lexer() *BaseLexer {
+	return Replay(x.Name, x.Source, x.Tokens)
+}
+
+//Replay returns a lexer which emits already lexed tokens of a source, e.g. for Tree.Parse
+func Replay(name, source string, tokens []Token) *BaseLexer {
+	l := Lex(name, source)
+	l.Tokens = make(chan Token, len(tokens))
+	for _, t := range tokens {
+		l.Tokens <- t
+	}
+	close(l.Tokens)
+
+	line, pos := 1, 0
+	for {
+		i := strings.IndexByte(source[pos:], '\n')
+		if i < 0 {
+			break
+		}
+		pos += i + 1
+		line++
+		l.Lines[line] = pos
+	}
+	l.Line = line
+	l.Pos, l.Start = len(source), len(source)
+	return l
+}
@@ -63,6 +63,11 @@ func (t *token) String() string {
 	}
 }
 
+//NewToken creates a token, for parsers that need to synthesize or relocate tokens
+func NewToken(typ TokenType, value string, pos, row, line int) Token {
+	return &token{typ: typ, value: value, pos: pos, row: row, line: line}
+}
+
 func (t *token) Type() TokenType {
 	return t.typ
 }
@@ -146,6 +151,8 @@ type BaseLexer struct {
 	Line   int //Scanner line position
 	Tokens chan Token
 	Lines  map[int]int //Line index -> position in source of first character on line
+
+	emit func(Token) //Receives the tokens instead of Tokens when the lexer is stepped synchronously
 }
 
 //Run starts the statemachine of the lexer
@@ -195,16 +202,24 @@ func (l *BaseLexer) Back() {
 
 //Emit emits a token to the channel
 func (l *BaseLexer) Emit(t TokenType) {
-	l.Tokens <- &token{
+	l.send(&token{
 		typ:   t,
 		value: l.Source[l.Start:l.Pos],
 		pos:   l.Pos,
 		row:   l.Row(),
 		line:  l.Line,
-	}
+	})
 	l.Start = l.Pos
 }
 
+func (l *BaseLexer) send(t Token) {
+	if l.emit != nil {
+		l.emit(t)
+		return
+	}
+	l.Tokens <- t
+}
+
 func (l *BaseLexer) CheckForbiddenWords(forbidden []string) bool {
 	word := l.Source[l.Start:l.Pos]
 	for _, w := range forbidden {
@@ -235,13 +250,13 @@ func (l *BaseLexer) IgnoreNonNewlineSpaces() {
 //Errorf is used to emit a formatted error
 func (l *BaseLexer) Errorf(format string, args ...interface{}) {
 	//TODO: type switch to turn the runes in args into strings. They are being printed as char codes
-	l.Tokens <- &token{
+	l.send(&token{
 		typ:   LexingError,
 		value: fmt.Sprintf(format, args...),
 		pos:   l.Pos,
 		line:  l.Line,
 		row:   l.Row(),
-	}
+	})
 }
 
 func (l *BaseLexer) UnexpectedRune(unexpected rune, expected interface{}) {
@@ -416,21 +431,16 @@ func (l *BaseLexer) CurrentLexeme() string {
 }
 
 func (l *BaseLexer) TokenInContext(t Token) string {
-	lineNum := t.Line()
-	b := l.Lines[lineNum]
-	e, ok := l.Lines[lineNum+1]
-	line := ""
-	if !ok {
-		//race condition: The lexer hasn't gotten to the next line yet, so we find it
-		//issue if token is a newline?
-		o := strings.IndexRune(l.Source[b:], '\n')
-		if o > 0 {
-			line = l.Source[b : b+o]
-		} else {
-			line = l.Source[b:]
-		}
-	} else {
-		line = l.Source[b : e-1]
+	//The line is found from the position of the token rather than from Lines, which the lexer
+	//may be writing to concurrently
+	pos := t.Pos()
+	if pos > len(l.Source) {
+		pos = len(l.Source)
+	}
+	b := strings.LastIndexByte(l.Source[:pos], '\n') + 1
+	line := l.Source[b:]
+	if o := strings.IndexByte(line, '\n'); o >= 0 {
+		line = line[:o]
 	}
 	//TODO:Boundserror here:
 	spaces := util.StringWidth(line[:t.Row()])
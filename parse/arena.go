@@ -0,0 +1,108 @@
+package parse
+
+//Arena allocates the nodes of a tree, and the lists of their children, in bulk.
+//
+//Without an Arena, every node and every list of children is a separate heap allocation.
+//With one, nodes are numbered in the order they are created, and node i is stored at index i of the
+//Arena, in slabs of SlabSize nodes. A node refers to its parent by its index, and to its children by
+//a span of one array shared by all nodes: the offset of its first child, the number of children and
+//the room left for more. A full span is moved to the end of the array with twice the room, unless it
+//is already at the end. The garbage collector then tracks a few slabs and one array instead of every
+//node, and an Arena which is Reset allocates nothing until it outgrows them.
+//
+//The Nodes handed out by the tree still are pointers into the slabs, since Node is an interface,
+//and Children returns a slice of the span. Nodes in an Arena live as long as the Arena,
+//including the nodes removed by RollBack.
+//Set an Arena as the Arena of a tree before parsing, the root node of the tree is not in it.
+type Arena struct {
+	SlabSize int //Number of nodes in a slab
+
+	nodes [][]baseNode
+	count int    //Number of nodes allocated
+	kids  []Node //The spans of children of all nodes
+}
+
+//span is where the children of a node of an Arena are, in the kids of the Arena
+type span struct {
+	first int32 //Offset of the first child
+	len   int32 //Number of children
+	room  int32 //Number of children which fit before the span must move
+}
+
+//NewArena creates an Arena with slabs of a size, or of 4096 nodes if size is zero
+func NewArena(size int) *Arena {
+	if size <= 0 {
+		size = 4096
+	}
+	return &Arena{SlabSize: size}
+}
+
+//Len returns the number of nodes allocated in the Arena
+func (a *Arena) Len() int {
+	return a.count
+}
+
+//Node returns the node created i-th in the Arena
+func (a *Arena) Node(i int) Node {
+	if i < 0 || i >= a.count {
+		return nil
+	}
+	return a.at(int32(i))
+}
+
+//Reset makes the memory of the Arena available for the next tree.
+//
+//Every node allocated before becomes invalid, so the trees using them must not be used anymore.
+func (a *Arena) Reset() {
+	for _, slab := range a.nodes {
+		clear(slab)
+	}
+	clear(a.kids)
+	a.count, a.kids = 0, a.kids[:0]
+}
+
+func (a *Arena) at(i int32) *baseNode {
+	return &a.nodes[int(i)/a.SlabSize][int(i)%a.SlabSize]
+}
+
+//node allocates a node
+func (a *Arena) node() *baseNode {
+	slab := a.count / a.SlabSize
+	if slab == len(a.nodes) {
+		a.nodes = append(a.nodes, make([]baseNode, a.SlabSize))
+	}
+	n := &a.nodes[slab][a.count%a.SlabSize]
+	n.arena, n.id = a, int32(a.count)
+	a.count++
+	return n
+}
+
+//children returns the children of a span
+func (a *Arena) children(s span) []Node {
+	return a.kids[s.first : s.first+s.len : s.first+s.len]
+}
+
+//grow returns a span with the children of s and room for k more
+func (a *Arena) grow(s span, k int) span {
+	if int(s.len)+k <= int(s.room) {
+		return s
+	}
+	if int(s.first+s.room) == len(a.kids) {
+		//The span is the last one, so it grows in place
+		a.kids = append(a.kids, make([]Node, int(s.len)+k-int(s.room))...)
+		s.room = s.len + int32(k)
+		return s
+	}
+	room := 2 * int(s.room)
+	if room < 4 {
+		room = 4
+	}
+	if room < int(s.len)+k {
+		room = int(s.len) + k
+	}
+	first := len(a.kids)
+	a.kids = append(a.kids, make([]Node, room)...)
+	copy(a.kids[first:], a.children(s))
+	clear(a.kids[s.first : s.first+s.len])
+	return span{int32(first), s.len, int32(room)}
+}
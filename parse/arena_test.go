@@ -0,0 +1,265 @@
+package parse_test
+
+import (
+	"fmt"
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+	"math/rand"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+//The benchmarks parse a large file of nested lists like (a (b c) 12). It is lexed once, and every parse
+//replays its tokens, so the benchmarks only differ in how the nodes of the tree are allocated.
+
+const (
+	tokLParen lex.TokenType = 4400 + iota
+	tokRParen
+	tokAtom
+)
+
+const (
+	listFile parse.NodeType = 4400 + iota
+	list
+	atom
+)
+
+func init() {
+	lex.TokenNames[tokLParen] = "LParen"
+	lex.TokenNames[tokRParen] = "RParen"
+	lex.TokenNames[tokAtom] = "Atom"
+	parse.NodeNames[listFile] = "ListFile"
+	parse.NodeNames[list] = "List"
+	parse.NodeNames[atom] = "Atom"
+}
+
+func lexLists(l *lex.BaseLexer) lex.StateFn {
+	l.IgnoreSpaces()
+	switch r := l.Next(); r {
+	case lex.EOF:
+		l.Emit(lex.EOF_Token)
+		return nil
+	case '(':
+		l.Emit(tokLParen)
+	case ')':
+		l.Emit(tokRParen)
+	default:
+		l.AcceptUntil("() \t\n")
+		l.Emit(tokAtom)
+	}
+	return lexLists
+}
+
+func parseLists(t *parse.Tree) {
+	file := t.AddNonTerminal(listFile, t.Peek())
+	t.Curr = file
+	for t.Peek().Type() != lex.EOF_Token {
+		parseList(t)
+	}
+	file.Commit()
+}
+
+func parseList(t *parse.Tree) {
+	tok := t.Next()
+	if tok.Type() != tokLParen {
+		t.Unexpected(tok, "(")
+	}
+	parent := t.Curr
+	n := t.AddNonTerminal(list, tok)
+	t.Curr = n
+	for {
+		switch tok := t.Peek(); tok.Type() {
+		case tokLParen:
+			parseList(t)
+		case tokAtom:
+			t.AddTerminal(atom, t.Next()).Commit()
+		case tokRParen:
+			t.Next()
+			n.Commit()
+			t.Curr = parent
+			return
+		default:
+			t.Unexpected(tok, ")")
+		}
+	}
+}
+
+//generateLists returns nested lists of about size bytes
+func generateLists(size int, seed int64) string {
+	rnd := rand.New(rand.NewSource(seed))
+	var sb strings.Builder
+	var list func(depth int)
+	list = func(depth int) {
+		sb.WriteByte('(')
+		for i, k := 0, 1+rnd.Intn(6); i < k; i++ {
+			if i > 0 {
+				sb.WriteByte(' ')
+			}
+			if depth < 8 && rnd.Intn(3) == 0 {
+				list(depth + 1)
+			} else {
+				fmt.Fprintf(&sb, "%c%d", 'a'+rnd.Intn(26), rnd.Intn(1000))
+			}
+		}
+		sb.WriteByte(')')
+	}
+	for sb.Len() < size {
+		list(0)
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+var (
+	largeOnce sync.Once
+	large     *lex.Lexed
+)
+
+//largeLists returns the lexed input of the benchmarks, of about a megabyte
+func largeLists() *lex.Lexed {
+	largeOnce.Do(func() {
+		large = lex.LexAll("synthetic", generateLists(1<<20, 1), lexLists)
+	})
+	return large
+}
+
+func parseLexed(tb testing.TB, lexed *lex.Lexed, arena *parse.Arena) *parse.Tree {
+	tree := parse.NewTree(lexed.Name, lexed.Source, parseLists)
+	tree.Arena = arena
+	if err := tree.Parse(lexed.Lexer()); err != nil {
+		tb.Fatal(err)
+	}
+	return tree
+}
+
+func TestArena(t *testing.T) {
+	lexed := lex.LexAll("small", generateLists(1<<14, 2), lexLists)
+	heap := parseLexed(t, lexed, nil)
+	arena := parse.NewArena(64)
+	for i := 0; i < 3; i++ {
+		arena.Reset()
+		if !parse.Equal(heap, parseLexed(t, lexed, arena), parse.EqualOptions{}) {
+			t.Fatalf("the trees parsed on the heap and in an arena differ, after %d resets", i)
+		}
+	}
+	if arena.Node(arena.Len()-1) == nil || arena.Node(arena.Len()) != nil {
+		t.Errorf("the arena does not number its %d nodes", arena.Len())
+	}
+}
+
+//TestArenaEdits checks that editing the nodes of an arena keeps their parents and spans of children consistent
+func TestArenaEdits(t *testing.T) {
+	lexed := lex.LexAll("edits", "(a (b c) d) (e)", lexLists)
+	arena := parse.NewArena(2)
+	tree := parseLexed(t, lexed, arena)
+	if arena.Len() != 9 {
+		t.Fatalf("%d nodes in the arena, expected 9", arena.Len())
+	}
+	file := arena.Node(0)
+	first, second := file.Children()[0], file.Children()[1]
+	if file.Parent() != tree.Root || first.Parent() != file || first.Children()[1].Children()[0].Parent() != first.Children()[1] {
+		t.Fatalf("the parents of the arena are wrong")
+	}
+
+	//Growing the span of a node which is not the last one moves it
+	for _, name := range []string{"f", "g", "h", "i", "j"} {
+		first.AddTerminal(atom, lex.NewToken(tokAtom, name, 0, 0, 1))
+	}
+	second.AddChildren([]parse.Node{parse.NewTerminal(atom, lex.NewToken(tokAtom, "k", 0, 0, 1), tree)})
+	first.RemoveChild(first.Children()[0])
+	first.Children()[0].ReplaceWith(parse.NewTerminal(atom, lex.NewToken(tokAtom, "x", 0, 0, 1), tree))
+	d := first.Children()[1]
+	first.RemoveChild(d)
+	second.AddChild(d)
+
+	want := []string{
+		"ListFile",
+		"  List",
+		"    Atom: Atom(\"x\")",
+		"    Atom: Atom(\"f\")",
+		"    Atom: Atom(\"g\")",
+		"    Atom: Atom(\"h\")",
+		"    Atom: Atom(\"i\")",
+		"    Atom: Atom(\"j\")",
+		"  List",
+		"    Atom: Atom(\"e\")",
+		"    Atom: Atom(\"k\")",
+		"    Atom: Atom(\"d\")",
+	}
+	lines := file.SPPrint(0)
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("the edited tree is\n%s\nexpected\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+	var check func(n parse.Node)
+	check = func(n parse.Node) {
+		for _, c := range n.Children() {
+			if c.Parent() != n {
+				t.Errorf("%v is a child of %v, but its parent is %v", c, n, c.Parent())
+			}
+			check(c)
+		}
+	}
+	check(tree.Root)
+
+	//A clone is on the heap, and equal to the original
+	clone := file.Clone()
+	if clone.Parent() != nil || !parse.EqualNodes(clone, file, parse.EqualOptions{}) {
+		t.Errorf("the clone of the arena tree differs")
+	}
+	first.AddTerminal(atom, lex.NewToken(tokAtom, "y", 0, 0, 1))
+	if len(clone.Children()[0].Children()) != 6 {
+		t.Errorf("adding to the arena tree changed its clone")
+	}
+}
+
+func TestArenaAllocs(t *testing.T) {
+	lexed := lex.LexAll("allocs", generateLists(1<<14, 3), lexLists)
+	arena := parse.NewArena(0)
+	parseLexed(t, lexed, arena)
+	nodes := arena.Len()
+	allocs := testing.AllocsPerRun(5, func() {
+		arena.Reset()
+		parseLexed(t, lexed, arena)
+	})
+	if allocs > float64(nodes)/100 {
+		t.Errorf("parsing %d nodes into a reset arena allocates %v times", nodes, allocs)
+	}
+}
+
+//benchParse benchmarks a parse, reporting the garbage collections and their pauses per parse as well
+func benchParse(b *testing.B, parseOnce func(*lex.Lexed)) {
+	lexed := largeLists()
+	b.ReportAllocs()
+	b.SetBytes(int64(len(lexed.Source)))
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		parseOnce(lexed)
+	}
+	b.StopTimer()
+	runtime.ReadMemStats(&after)
+	b.ReportMetric(float64(after.NumGC-before.NumGC)/float64(b.N), "GCs/op")
+	b.ReportMetric(float64(after.PauseTotalNs-before.PauseTotalNs)/float64(b.N), "GC-pause-ns/op")
+}
+
+//BenchmarkHeap allocates every node and list of children on the heap
+func BenchmarkHeap(b *testing.B) {
+	benchParse(b, func(lexed *lex.Lexed) { parseLexed(b, lexed, nil) })
+}
+
+//BenchmarkArena gives every tree a new Arena
+func BenchmarkArena(b *testing.B) {
+	benchParse(b, func(lexed *lex.Lexed) { parseLexed(b, lexed, parse.NewArena(0)) })
+}
+
+//BenchmarkArenaReuse resets one Arena before every parse
+func BenchmarkArenaReuse(b *testing.B) {
+	arena := parse.NewArena(0)
+	benchParse(b, func(lexed *lex.Lexed) {
+		arena.Reset()
+		parseLexed(b, lexed, arena)
+	})
+}
@@ -0,0 +1,144 @@
+package parse
+
+import (
+	"fmt"
+	"sort"
+)
+
+//Key identifies a typed attribute of a Node, such as an inferred type or a constant value.
+//
+//Keys are compared by identity, so create them once, e.g. as package level variables:
+//
+//	var ConstValue = parse.NewKey[int]("const")
+//
+//	parse.Set(n, ConstValue, 42)
+//	v, ok := parse.Get(n, ConstValue)
+type Key[T any] struct {
+	name   string
+	encode func(T) string
+	decode func(string) (T, error)
+}
+
+//attrKey is the untyped view of a Key used by the attribute store and the serializer
+type attrKey interface {
+	attrName() string
+	encodeAttr(interface{}) (string, bool)
+	decodeAttr(string) (interface{}, error)
+}
+
+//attrCodecs holds the keys with codecs by name, so that attributes can be deserialized
+var attrCodecs = map[string]attrKey{}
+
+//NewKey creates a new attribute key. The name is used when printing and serializing attributes.
+func NewKey[T any](name string) *Key[T] {
+	return &Key[T]{name: name}
+}
+
+//Name returns the name of the key
+func (k *Key[T]) Name() string {
+	return k.name
+}
+
+//WithCodec registers functions converting values to and from strings,
+//which makes the attribute survive SerializeTree and DeserializeTree.
+//
+//The name of the key must be unique among the keys with codecs.
+func (k *Key[T]) WithCodec(encode func(T) string, decode func(string) (T, error)) *Key[T] {
+	if prev, ok := attrCodecs[k.name]; ok && prev != attrKey(k) {
+		panic(fmt.Sprintf("An attribute named %q already has a codec", k.name))
+	}
+	k.encode, k.decode = encode, decode
+	attrCodecs[k.name] = k
+	return k
+}
+
+func (k *Key[T]) attrName() string {
+	return k.name
+}
+
+func (k *Key[T]) encodeAttr(v interface{}) (string, bool) {
+	if k.encode == nil {
+		return "", false
+	}
+	return k.encode(v.(T)), true
+}
+
+func (k *Key[T]) decodeAttr(s string) (interface{}, error) {
+	return k.decode(s)
+}
+
+//Get returns the value of an attribute of a node, and whether it was set
+func Get[T any](n Node, k *Key[T]) (T, bool) {
+	v, ok := n.attrs(false)[k]
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	return v.(T), true
+}
+
+//Set sets an attribute of a node
+func Set[T any](n Node, k *Key[T], v T) {
+	n.attrs(true)[k] = v
+}
+
+//Has reports whether an attribute is set on a node
+func Has[T any](n Node, k *Key[T]) bool {
+	_, ok := n.attrs(false)[k]
+	return ok
+}
+
+//Unset removes an attribute from a node
+func Unset[T any](n Node, k *Key[T]) {
+	delete(n.attrs(false), k)
+}
+
+//CopyAttributes copies all attributes of one node to another, e.g. when replacing a node
+func CopyAttributes(dst, src Node) {
+	for k, v := range src.attrs(false) {
+		dst.attrs(true)[k] = v
+	}
+}
+
+//attrs returns the attribute store of the node, creating it if asked to
+func (n *baseNode) attrs(create bool) map[attrKey]interface{} {
+	if n.attributes == nil && create {
+		n.attributes = make(map[attrKey]interface{})
+	}
+	return n.attributes
+}
+
+//encodedAttributes returns the attributes with codecs as strings, sorted by name
+func encodedAttributes(n Node) (names, values []string) {
+	for k, v := range n.attrs(false) {
+		if s, ok := k.encodeAttr(v); ok {
+			names = append(names, k.attrName())
+			values = append(values, s)
+		}
+	}
+	sort.Sort(byName{names, values})
+	return names, values
+}
+
+type byName struct{ names, values []string }
+
+func (b byName) Len() int           { return len(b.names) }
+func (b byName) Less(i, j int) bool { return b.names[i] < b.names[j] }
+func (b byName) Swap(i, j int) {
+	b.names[i], b.names[j] = b.names[j], b.names[i]
+	b.values[i], b.values[j] = b.values[j], b.values[i]
+}
+
+//decodeAttribute sets an attribute from its serialized form
+func decodeAttribute(n Node, name, value string) error {
+	k, ok := attrCodecs[name]
+	if !ok {
+		return fmt.Errorf("no codec registered for attribute %q", name)
+	}
+	v, err := k.decodeAttr(value)
+	if err != nil {
+		return fmt.Errorf("attribute %q: %v", name, err)
+	}
+	n.attrs(true)[k] = v
+	return nil
+}
@@ -0,0 +1,214 @@
+package attrgrammar_test
+
+import (
+	"errors"
+	"kugg/compilers/Gparse"
+	"kugg/compilers/Gparse/arith"
+	"kugg/compilers/parse"
+	"kugg/compilers/parse/attrgrammar"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var (
+	expr   = parse.NodeType(arith.Expr)
+	term   = parse.NodeType(arith.Term)
+	factor = parse.NodeType(arith.Factor)
+	number = parse.NodeType(arith.Number)
+
+	value = parse.NewKey[int]("value") //Synthesized, the value of an expression
+	depth = parse.NewKey[int]("depth") //Inherited, the number of expressions around a node
+)
+
+func arithTree(t *testing.T, src string) *parse.Tree {
+	p, err := Gparse.NewParser(arith.Grammar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := p.Parse(src, src, arith.LexAny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+//arithGrammar computes the values of arithmetic expressions, counting the equations evaluated by type
+func arithGrammar(evaluated map[parse.NodeType]int) *attrgrammar.Grammar {
+	g := attrgrammar.New()
+	attrgrammar.Synthesized(g, value, number, func(c *attrgrammar.Context) int {
+		evaluated[number]++
+		v, _ := strconv.Atoi(c.Node().Token().Lexeme())
+		return v
+	})
+	attrgrammar.Synthesized(g, value, factor, func(c *attrgrammar.Context) int {
+		evaluated[factor]++
+		switch len(c.Node().Children()) {
+		case 1:
+			return attrgrammar.Attr(c, c.Child(0), value)
+		case 2:
+			return -attrgrammar.Attr(c, c.Child(1), value)
+		}
+		return attrgrammar.Attr(c, c.Child(1), value)
+	}, attrgrammar.OfChildren(value))
+	//Terms and expressions are binary operations, or a single operand
+	binary := func(typ parse.NodeType) {
+		attrgrammar.Synthesized(g, value, typ, func(c *attrgrammar.Context) int {
+			evaluated[typ]++
+			left := attrgrammar.Attr(c, c.Child(0), value)
+			if len(c.Node().Children()) == 1 {
+				return left
+			}
+			right := attrgrammar.Attr(c, c.Child(2), value)
+			switch c.Child(1).Token().Lexeme() {
+			case "+":
+				return left + right
+			case "-":
+				return left - right
+			case "*":
+				return left * right
+			}
+			if right == 0 {
+				c.Errorf("division by zero")
+			}
+			return left / right
+		}, attrgrammar.OfChild(0, value), attrgrammar.OfChild(2, value))
+	}
+	binary(term)
+	binary(expr)
+
+	attrgrammar.Inherited(g, depth, parse.RootNode, func(c *attrgrammar.Context, child int) int { return 0 })
+	attrgrammar.Inherited(g, depth, expr, func(c *attrgrammar.Context, child int) int {
+		return attrgrammar.Attr(c, c.Node(), depth) + 1
+	}, attrgrammar.OfSelf(depth))
+	return g
+}
+
+func TestEval(t *testing.T) {
+	evaluated := make(map[parse.NodeType]int)
+	g := arithGrammar(evaluated)
+	tree := arithTree(t, "(1 + 2) * 3 - -4")
+	top := tree.Root.Children()[0]
+
+	//Only the left operand of the subtraction is evaluated
+	left := top.Children()[0]
+	if v, err := attrgrammar.Eval(g, left, value); err != nil || v != 9 {
+		t.Fatalf("(1 + 2) * 3 is %d, %v", v, err)
+	}
+	if evaluated[number] != 3 || parse.Has(top, value) || parse.Has(top.Children()[2], value) {
+		t.Errorf("evaluating the left operand evaluated %v, and more than its subtree", evaluated)
+	}
+	if v, err := attrgrammar.Eval(g, top, value); err != nil || v != 13 {
+		t.Fatalf("(1 + 2) * 3 - -4 is %d, %v", v, err)
+	}
+	if evaluated[number] != 4 {
+		t.Errorf("the stored values of the left operand were evaluated again, %d numbers", evaluated[number])
+	}
+	g.Clear(top)
+	if _, err := attrgrammar.Eval(g, top, value); err != nil || evaluated[number] != 8 {
+		t.Errorf("Clear did not remove the stored values, %d numbers, %v", evaluated[number], err)
+	}
+
+	//The 2 is in the expression in parentheses, which is in the operand of the subtraction
+	var found parse.Node
+	var find func(n parse.Node)
+	find = func(n parse.Node) {
+		if n.IsTerminal() && n.Token().Lexeme() == "2" {
+			found = n
+		}
+		for _, c := range n.Children() {
+			find(c)
+		}
+	}
+	find(top)
+	if d, err := attrgrammar.Eval(g, found, depth); err != nil || d != 3 {
+		t.Errorf("the 2 is in %d expressions, %v", d, err)
+	}
+	if d, err := attrgrammar.Eval(g, top, depth); err != nil || d != 0 {
+		t.Errorf("the top expression is in %d expressions, %v", d, err)
+	}
+
+	_, err := attrgrammar.Eval(g, arithTree(t, "1 / (2 - 2)").Root.Children()[0], value)
+	if err == nil || err.Error() != "attrgrammar: RootNode/Expr[0]/Term[0]: division by zero" {
+		t.Errorf("dividing by zero returned %v", err)
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	g := arithGrammar(make(map[parse.NodeType]int))
+	tree := arithTree(t, "1 + 2")
+	order, err := g.Schedule(tree.Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//Ready instances are taken in preorder, each after the instances it depends on
+	var got []string
+	for _, inst := range order {
+		got = append(got, inst.String())
+	}
+	want := []string{
+		"RootNode/Expr[0].depth",
+		"RootNode/Expr[0]/Term[0]/Factor[0]/Number[0].value",
+		"RootNode/Expr[0]/Expr[2]/Term[0]/Factor[0]/Number[0].value",
+		"RootNode/Expr[0]/Term[0].depth",
+		"RootNode/Expr[0]/Plus[1].depth",
+		"RootNode/Expr[0]/Expr[2].depth",
+		"RootNode/Expr[0]/Term[0]/Factor[0].value",
+		"RootNode/Expr[0]/Expr[2]/Term[0]/Factor[0].value",
+		"RootNode/Expr[0]/Term[0]/Factor[0].depth",
+		"RootNode/Expr[0]/Expr[2]/Term[0].depth",
+		"RootNode/Expr[0]/Term[0].value",
+		"RootNode/Expr[0]/Expr[2]/Term[0].value",
+		"RootNode/Expr[0]/Term[0]/Factor[0]/Number[0].depth",
+		"RootNode/Expr[0]/Expr[2]/Term[0]/Factor[0].depth",
+		"RootNode/Expr[0]/Expr[2].value",
+		"RootNode/Expr[0]/Expr[2]/Term[0]/Factor[0]/Number[0].depth",
+		"RootNode/Expr[0].value",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("the schedule is\n%s\nexpected\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if err := g.Evaluate(tree.Root); err != nil {
+		t.Fatal(err)
+	}
+	top := tree.Root.Children()[0]
+	if v, _ := parse.Get(top, value); v != 3 {
+		t.Errorf("1 + 2 evaluates to %d", v)
+	}
+	if d, _ := parse.Get(top.Children()[2].Children()[0], depth); d != 2 {
+		t.Errorf("the term of 2 is in %d expressions", d)
+	}
+}
+
+func TestCycleError(t *testing.T) {
+	a, b := parse.NewKey[int]("a"), parse.NewKey[int]("b")
+	g := attrgrammar.New()
+	//a of a term is b of its factor, and b of the factor is a of its term
+	attrgrammar.Synthesized(g, a, term, func(c *attrgrammar.Context) int {
+		return attrgrammar.Attr(c, c.Child(0), b)
+	}, attrgrammar.OfChild(0, b))
+	attrgrammar.Inherited(g, b, term, func(c *attrgrammar.Context, child int) int {
+		return attrgrammar.Attr(c, c.Node(), a)
+	}, attrgrammar.OfSelf(a))
+
+	const want = "attrgrammar: circular attribute dependency: " +
+		"RootNode/Expr[0]/Term[0].a -> RootNode/Expr[0]/Term[0]/Factor[0].b -> RootNode/Expr[0]/Term[0].a"
+	tree := arithTree(t, "7")
+	_, err := g.Schedule(tree.Root)
+	var cycle *attrgrammar.CycleError
+	if !errors.As(err, &cycle) || err.Error() != want {
+		t.Errorf("Schedule returned\n%v\nexpected\n%s", err, want)
+	}
+	if err := g.Evaluate(tree.Root); err == nil || err.Error() != want {
+		t.Errorf("Evaluate returned\n%v\nexpected\n%s", err, want)
+	}
+
+	_, err = attrgrammar.Eval(g, tree.Root.Children()[0].Children()[0], a)
+	if !errors.As(err, &cycle) || err.Error() != want {
+		t.Errorf("Eval returned\n%v\nexpected\n%s", err, want)
+	}
+	if len(cycle.Cycle) != 2 || cycle.Cycle[0].Name() != "a" || cycle.Cycle[1].Node.Type() != factor {
+		t.Errorf("the cycle is %v", cycle.Cycle)
+	}
+}
@@ -0,0 +1,32 @@
+/*
+Package attrgrammar evaluates attribute grammars over parse trees.
+
+Attributes are parse.Key values, and their computed values are stored on the
+nodes with parse.Set, so they can be read with parse.Get after evaluation.
+
+A synthesized attribute of a node is computed from the node and its subtree,
+by an equation declared for the type of the node:
+
+	attrgrammar.Synthesized(g, Type, Binary, func(c *attrgrammar.Context) *Type {
+		left := attrgrammar.Attr(c, c.Child(0), Type)
+		...
+	}, attrgrammar.OfChildren(Type))
+
+An inherited attribute of a node is computed by its ancestors, by an equation
+declared for the type of the parent, which is also given the index of the child:
+
+	attrgrammar.Inherited(g, Env, Block, func(c *attrgrammar.Context, child int) *Env {
+		...
+	})
+
+If the parent of a node has no equation for an inherited attribute, the value
+of the parent is copied, so an equation applies to a whole subtree unless a
+node further down overrides it.
+
+Attributes can be evaluated lazily, on demand with Eval, or all at once with
+Evaluate, which orders the evaluation by the dependencies declared along with
+the equations. Dependencies an equation does not declare are still evaluated
+on demand. Circular dependencies are reported as a CycleError, naming the
+attribute instances in the cycle by their node paths.
+*/
+package attrgrammar
@@ -0,0 +1,254 @@
+package attrgrammar
+
+import (
+	"fmt"
+	"kugg/compilers/parse"
+)
+
+//instKey identifies an attribute instance
+type instKey struct {
+	node parse.Node
+	attr *attribute
+}
+
+//evaluator computes attribute instances on demand, keeping track of the ones being computed
+type evaluator struct {
+	g       *Grammar
+	pending map[instKey]int //Instances being computed, to their index in stack
+	stack   []Instance
+}
+
+func newEvaluator(g *Grammar) *evaluator {
+	return &evaluator{g: g, pending: make(map[instKey]int)}
+}
+
+//value returns the value of an attribute instance, computing and storing it if it is not set
+func (ev *evaluator) value(n parse.Node, a *attribute) interface{} {
+	if a.has(n) {
+		return a.get(n)
+	}
+	key := instKey{n, a}
+	if i, ok := ev.pending[key]; ok {
+		cycle := make([]Instance, len(ev.stack)-i)
+		copy(cycle, ev.stack[i:])
+		panic(&CycleError{Cycle: cycle})
+	}
+	ev.pending[key] = len(ev.stack)
+	ev.stack = append(ev.stack, Instance{n, a})
+
+	var v interface{}
+	if a.inherited {
+		p := n.Parent()
+		if p == nil {
+			panic(&Error{Path: parse.Path(n), Msg: fmt.Sprintf("no equation for inherited attribute %q above the node", a.name)})
+		}
+		if eq, ok := a.equations[p.Type()]; ok {
+			v = eq.fn(&Context{ev, p}, childIndex(p, n))
+		} else {
+			v = ev.value(p, a)
+		}
+	} else {
+		eq, ok := a.equations[n.Type()]
+		if !ok {
+			panic(&Error{Path: parse.Path(n), Msg: fmt.Sprintf("no equation for synthesized attribute %q of %v", a.name, n.Type())})
+		}
+		v = eq.fn(&Context{ev, n}, -1)
+	}
+
+	a.set(n, v)
+	delete(ev.pending, key)
+	ev.stack = ev.stack[:len(ev.stack)-1]
+	return v
+}
+
+//catch turns the panics of an evaluation into an error
+func catch(err *error) {
+	if r := recover(); r != nil {
+		switch e := r.(type) {
+		case *Error:
+			*err = e
+		case *CycleError:
+			*err = e
+		default:
+			panic(r)
+		}
+	}
+}
+
+//Eval returns the value of an attribute of a node, evaluating only the attributes it depends on.
+//
+//Computed values are stored on the nodes and reused by later evaluations, see Clear.
+func Eval[T any](g *Grammar, n parse.Node, k *parse.Key[T]) (v T, err error) {
+	defer catch(&err)
+	return newEvaluator(g).value(n, g.attribute(k, k.Name())).(T), nil
+}
+
+//Evaluate computes every attribute of the grammar defined on a subtree, in the order given by Schedule
+func (g *Grammar) Evaluate(root parse.Node) (err error) {
+	order, err := g.Schedule(root)
+	if err != nil {
+		return err
+	}
+	defer catch(&err)
+	ev := newEvaluator(g)
+	for _, inst := range order {
+		ev.value(inst.Node, inst.attr)
+	}
+	return nil
+}
+
+//Schedule returns the attribute instances defined on a subtree, ordered so that every instance
+//comes after the instances its equation declares as dependencies.
+//
+//An instance is defined if its node has a synthesized equation for its type, or if an ancestor
+//in the subtree has an inherited equation for its type.
+//A CycleError is returned if the declared dependencies are circular.
+func (g *Grammar) Schedule(root parse.Node) ([]Instance, error) {
+	var nodes []parse.Node
+	preorder(root, func(n parse.Node) { nodes = append(nodes, n) })
+
+	//Number the defined instances, in preorder and declaration order
+	ids := make(map[instKey]int)
+	var insts []Instance
+	for _, n := range nodes {
+		for _, a := range g.order {
+			if g.defined(n, a, root, ids) {
+				ids[instKey{n, a}] = len(insts)
+				insts = append(insts, Instance{n, a})
+			}
+		}
+	}
+
+	//deps[i] are the instances i depends on, users[j] the instances depending on j
+	deps := make([][]int, len(insts))
+	users := make([][]int, len(insts))
+	for i, inst := range insts {
+		for _, j := range g.dependencies(inst, ids) {
+			deps[i] = append(deps[i], j)
+			users[j] = append(users[j], i)
+		}
+	}
+
+	//Kahn's algorithm, taking ready instances in numbering order
+	missing := make([]int, len(insts))
+	var queue []int
+	for i := range insts {
+		missing[i] = len(deps[i])
+		if missing[i] == 0 {
+			queue = append(queue, i)
+		}
+	}
+	order := make([]Instance, 0, len(insts))
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		order = append(order, insts[i])
+		for _, u := range users[i] {
+			missing[u]--
+			if missing[u] == 0 {
+				queue = append(queue, u)
+			}
+		}
+	}
+	if len(order) == len(insts) {
+		return order, nil
+	}
+
+	//Every instance left depends on another one left, so following dependencies finds a cycle
+	start := 0
+	for missing[start] == 0 {
+		start++
+	}
+	seen := make(map[int]int)
+	var path []int
+	for i := start; ; {
+		if at, ok := seen[i]; ok {
+			cycle := make([]Instance, 0, len(path)-at)
+			for _, j := range path[at:] {
+				cycle = append(cycle, insts[j])
+			}
+			return nil, &CycleError{Cycle: cycle}
+		}
+		seen[i] = len(path)
+		path = append(path, i)
+		for _, j := range deps[i] {
+			if missing[j] > 0 {
+				i = j
+				break
+			}
+		}
+	}
+}
+
+//defined reports whether an attribute instance is defined, the ids of the instances of
+//the ancestors of the node must already be known
+func (g *Grammar) defined(n parse.Node, a *attribute, root parse.Node, ids map[instKey]int) bool {
+	if !a.inherited {
+		_, ok := a.equations[n.Type()]
+		return ok
+	}
+	if n == root {
+		return false
+	}
+	p := n.Parent()
+	if _, ok := a.equations[p.Type()]; ok {
+		return true
+	}
+	_, ok := ids[instKey{p, a}]
+	return ok
+}
+
+//dependencies returns the ids of the defined instances an instance declares it depends on
+func (g *Grammar) dependencies(inst Instance, ids map[instKey]int) []int {
+	n, a := inst.Node, inst.attr
+	var eq *equation
+	if a.inherited {
+		p := n.Parent()
+		var ok bool
+		if eq, ok = a.equations[p.Type()]; !ok {
+			return []int{ids[instKey{p, a}]}
+		}
+		n = p
+	} else {
+		eq = a.equations[n.Type()]
+	}
+
+	var result []int
+	for _, dep := range eq.deps {
+		da, ok := g.attrs[dep.key]
+		if !ok {
+			continue
+		}
+		for _, m := range dep.nodes(n) {
+			if id, ok := ids[instKey{m, da}]; ok {
+				result = append(result, id)
+			}
+		}
+	}
+	return result
+}
+
+//Clear removes the values of the attributes of the grammar from a subtree, so they are computed again
+func (g *Grammar) Clear(root parse.Node) {
+	preorder(root, func(n parse.Node) {
+		for _, a := range g.order {
+			a.unset(n)
+		}
+	})
+}
+
+func preorder(n parse.Node, visit func(parse.Node)) {
+	visit(n)
+	for _, c := range n.Children() {
+		preorder(c, visit)
+	}
+}
+
+func childIndex(p, n parse.Node) int {
+	for i, c := range p.Children() {
+		if c == n {
+			return i
+		}
+	}
+	return -1
+}
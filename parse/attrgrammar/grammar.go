@@ -0,0 +1,241 @@
+package attrgrammar
+
+import (
+	"fmt"
+	"kugg/compilers/parse"
+	"strings"
+)
+
+//Grammar is a set of attribute equations
+type Grammar struct {
+	attrs map[interface{}]*attribute //The keys of the attributes to their untyped handles
+	order []*attribute               //Attributes in the order they were declared
+}
+
+//attribute is the untyped handle of a parse.Key and its equations
+type attribute struct {
+	name      string
+	inherited bool
+	equations map[parse.NodeType]*equation //For inherited attributes, by the type of the parent
+
+	has   func(parse.Node) bool
+	get   func(parse.Node) interface{}
+	set   func(parse.Node, interface{})
+	unset func(parse.Node)
+}
+
+type equation struct {
+	fn   func(c *Context, child int) interface{}
+	deps []Dep
+}
+
+//New creates an empty attribute grammar
+func New() *Grammar {
+	return &Grammar{attrs: make(map[interface{}]*attribute)}
+}
+
+//declare finds or creates the handle of an attribute
+func declare[T any](g *Grammar, k *parse.Key[T], inherited bool) *attribute {
+	a, ok := g.attrs[k]
+	if !ok {
+		a = &attribute{
+			name:      k.Name(),
+			inherited: inherited,
+			equations: make(map[parse.NodeType]*equation),
+			has:       func(n parse.Node) bool { return parse.Has(n, k) },
+			get: func(n parse.Node) interface{} {
+				v, _ := parse.Get(n, k)
+				return v
+			},
+			set:   func(n parse.Node, v interface{}) { parse.Set(n, k, v.(T)) },
+			unset: func(n parse.Node) { parse.Unset(n, k) },
+		}
+		g.attrs[k] = a
+		g.order = append(g.order, a)
+	}
+	if a.inherited != inherited {
+		kind := "synthesized"
+		if a.inherited {
+			kind = "inherited"
+		}
+		panic(fmt.Sprintf("Attribute %q is already declared as %s", a.name, kind))
+	}
+	return a
+}
+
+func (g *Grammar) attribute(k interface{}, name string) *attribute {
+	a, ok := g.attrs[k]
+	if !ok {
+		panic(&Error{Msg: fmt.Sprintf("attribute %q has no equations in this grammar", name)})
+	}
+	return a
+}
+
+//Synthesized declares the equation computing an attribute for nodes of a type.
+//
+//The deps are the attributes the equation reads, relative to the node, which are used by Evaluate.
+func Synthesized[T any](g *Grammar, k *parse.Key[T], typ parse.NodeType, fn func(*Context) T, deps ...Dep) {
+	a := declare(g, k, false)
+	if _, ok := a.equations[typ]; ok {
+		panic(fmt.Sprintf("Attribute %q already has an equation for %v", a.name, typ))
+	}
+	a.equations[typ] = &equation{
+		fn:   func(c *Context, _ int) interface{} { return fn(c) },
+		deps: deps,
+	}
+}
+
+//Inherited declares the equation computing an attribute for the children of nodes of a type.
+//
+//The equation is evaluated in the context of the parent, and is given the index of the child.
+//Use parse.RootNode as the type to define the attribute for the top of the tree.
+//The deps are the attributes the equation reads, relative to the parent, which are used by Evaluate.
+func Inherited[T any](g *Grammar, k *parse.Key[T], parent parse.NodeType, fn func(c *Context, child int) T, deps ...Dep) {
+	a := declare(g, k, true)
+	if _, ok := a.equations[parent]; ok {
+		panic(fmt.Sprintf("Attribute %q already has an equation for the children of %v", a.name, parent))
+	}
+	a.equations[parent] = &equation{
+		fn:   func(c *Context, child int) interface{} { return fn(c, child) },
+		deps: deps,
+	}
+}
+
+//Relation says which nodes a Dep refers to, relative to the node an equation is evaluated for
+type Relation int
+
+const (
+	Self     Relation = iota //The node itself
+	Parent                   //The parent of the node
+	Child                    //One child of the node, by index
+	Children                 //All children of the node
+)
+
+//Dep declares that an equation reads an attribute of some nodes
+type Dep struct {
+	Rel   Relation
+	Index int //The child, for Child. Negative indices count from the last child.
+	key   interface{}
+	name  string
+}
+
+//OfSelf declares a dependency on an attribute of the node itself
+func OfSelf[T any](k *parse.Key[T]) Dep {
+	return Dep{Rel: Self, key: k, name: k.Name()}
+}
+
+//OfParent declares a dependency on an attribute of the parent
+func OfParent[T any](k *parse.Key[T]) Dep {
+	return Dep{Rel: Parent, key: k, name: k.Name()}
+}
+
+//OfChild declares a dependency on an attribute of one child
+func OfChild[T any](i int, k *parse.Key[T]) Dep {
+	return Dep{Rel: Child, Index: i, key: k, name: k.Name()}
+}
+
+//OfChildren declares a dependency on an attribute of all children
+func OfChildren[T any](k *parse.Key[T]) Dep {
+	return Dep{Rel: Children, key: k, name: k.Name()}
+}
+
+//nodes returns the nodes a dependency refers to
+func (d Dep) nodes(n parse.Node) []parse.Node {
+	switch d.Rel {
+	case Self:
+		return []parse.Node{n}
+	case Parent:
+		if p := n.Parent(); p != nil {
+			return []parse.Node{p}
+		}
+	case Child:
+		children := n.Children()
+		i := d.Index
+		if i < 0 {
+			i += len(children)
+		}
+		if i >= 0 && i < len(children) {
+			return []parse.Node{children[i]}
+		}
+	case Children:
+		return n.Children()
+	}
+	return nil
+}
+
+//Context is given to equations
+type Context struct {
+	ev   *evaluator
+	node parse.Node
+}
+
+//Node returns the node the equation is evaluated for, for inherited attributes the parent
+func (c *Context) Node() parse.Node {
+	return c.node
+}
+
+//Child returns a child of the node, negative indices count from the last child
+func (c *Context) Child(i int) parse.Node {
+	children := c.node.Children()
+	if i < 0 {
+		i += len(children)
+	}
+	if i < 0 || i >= len(children) {
+		c.Errorf("no child %d, the node has %d children", i, len(children))
+	}
+	return children[i]
+}
+
+//Errorf aborts the evaluation with an error at the node of the context
+func (c *Context) Errorf(format string, args ...interface{}) {
+	panic(&Error{Path: parse.Path(c.node), Msg: fmt.Sprintf(format, args...)})
+}
+
+//Attr returns the value of an attribute of any node, evaluating it if needed.
+//
+//Equations use Attr to read the attributes they depend on.
+func Attr[T any](c *Context, n parse.Node, k *parse.Key[T]) T {
+	return c.ev.value(n, c.ev.g.attribute(k, k.Name())).(T)
+}
+
+//Error is an error during evaluation
+type Error struct {
+	Path string //Path of the node, see parse.Path
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	if e.Path == "" {
+		return "attrgrammar: " + e.Msg
+	}
+	return fmt.Sprintf("attrgrammar: %s: %s", e.Path, e.Msg)
+}
+
+//Instance is an attribute of a specific node
+type Instance struct {
+	Node parse.Node
+	attr *attribute
+}
+
+//Name returns the name of the attribute
+func (i Instance) Name() string {
+	return i.attr.name
+}
+
+func (i Instance) String() string {
+	return parse.Path(i.Node) + "." + i.attr.name
+}
+
+//CycleError reports attributes that depend on themselves
+type CycleError struct {
+	Cycle []Instance //The first instance depends on the second and so on, the last one on the first
+}
+
+func (e *CycleError) Error() string {
+	parts := make([]string, 0, len(e.Cycle)+1)
+	for _, inst := range e.Cycle {
+		parts = append(parts, inst.String())
+	}
+	parts = append(parts, e.Cycle[0].String())
+	return "attrgrammar: circular attribute dependency: " + strings.Join(parts, " -> ")
+}
@@ -0,0 +1,147 @@
+package parse
+
+import (
+	"fmt"
+	"kugg/compilers/lex"
+	"kugg/compilers/symbol"
+	"log/slog"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+//Source is a named source text to parse
+type Source struct {
+	Name string
+	Text string
+}
+
+//Batch parses many sources concurrently, and collects their scopes in a project scope.
+//
+//Every source is parsed into its own Tree, with its own lexer and global scope, so the
+//lexer and parser only need to be safe for concurrent use with different trees.
+//The registries NodeNames, lex.TokenNames and the attribute codecs are only read
+//while parsing, so they must be populated before, e.g. in init functions.
+type Batch struct {
+	Workers  int           //The number of sources parsed at once, GOMAXPROCS if zero
+	LexStart lex.StateFn   //The start state of the lexer
+	ParseFn  ParseFn       //The parsing entry point
+	Project  *symbol.Table //The project scope, created by Parse if nil
+	Logger   *slog.Logger  //The Logger of every tree
+	Coverage *Coverage     //The Coverage of every tree
+}
+
+//Diagnostic is an error in one of the sources of a Batch
+type Diagnostic struct {
+	Index  int    //Index of the source
+	Source string //Name of the source
+	Err    error
+}
+
+func (d Diagnostic) Error() string {
+	return fmt.Sprintf("%s: %v", d.Source, strings.TrimSuffix(d.Err.Error(), "\n"))
+}
+
+//Diagnostics are the errors of a Batch, in the order of the sources
+type Diagnostics []Diagnostic
+
+func (ds Diagnostics) Error() string {
+	lines := make([]string, len(ds))
+	for i, d := range ds {
+		lines[i] = d.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+//PanicError is what Batch.Parse panics with when the parser of a source panicked with a bug
+type PanicError struct {
+	Source string      //Name of the source
+	Value  interface{} //What the parser panicked with, usually a runtime.Error
+	Stack  []byte      //Stack of the worker where the parser panicked
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("%s: %v\n\n%s", p.Source, p.Value, p.Stack)
+}
+
+//Unwrap returns the value the parser panicked with, if it is an error
+func (p *PanicError) Unwrap() error {
+	err, _ := p.Value.(error)
+	return err
+}
+
+//Parse lexes and parses the sources on a pool of workers, and returns their trees in the same order.
+//
+//When all sources are parsed, the global scope of every tree is attached to the project scope
+//under the name of its source, and global symbol ids are resolved for the whole project.
+//Trees with errors are returned as far as they were parsed, and their errors are returned as Diagnostics.
+//If the parser panics with a bug on a source, Parse panics with a *PanicError once all sources are done.
+func (b *Batch) Parse(sources []Source) ([]*Tree, error) {
+	if b.Project == nil {
+		b.Project = symbol.NewGlobalScope()
+	}
+	workers := b.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	trees := make([]*Tree, len(sources))
+	errs := make([]error, len(sources))
+	panics := make([]*PanicError, len(sources))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				trees[i] = NewTree(sources[i].Name, sources[i].Text, b.ParseFn)
+				trees[i].Logger = b.Logger
+				trees[i].Coverage = b.Coverage
+				errs[i], panics[i] = b.parseOne(trees[i], sources[i])
+			}
+		}()
+	}
+	for i := range sources {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	//Bugs in the parser are raised in the calling goroutine, like Tree.Parse does
+	for _, p := range panics {
+		if p != nil {
+			panic(p)
+		}
+	}
+
+	var diags Diagnostics
+	for i, tree := range trees {
+		if errs[i] != nil {
+			diags = append(diags, Diagnostic{i, sources[i].Name, errs[i]})
+		}
+		if _, err := b.Project.Attach(sources[i].Name, tree.Root.Scope()); err != nil {
+			diags = append(diags, Diagnostic{i, sources[i].Name, err})
+		}
+	}
+	b.Project.ResolveGlobalIds()
+
+	if diags != nil {
+		return trees, diags
+	}
+	return trees, nil
+}
+
+//parseOne parses a source into a tree, and returns what the parser panicked with if it was a bug
+func (b *Batch) parseOne(tree *Tree, src Source) (err error, bug *PanicError) {
+	l := lex.Lex(src.Name, src.Text)
+	l.Run(b.LexStart)
+	defer l.Drain()
+	defer func() {
+		if r := recover(); r != nil {
+			bug = &PanicError{Source: src.Name, Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return tree.Parse(l), nil
+}
@@ -0,0 +1,147 @@
+package parse_test
+
+import (
+	"errors"
+	"fmt"
+	"kugg/compilers/Gparse/arith"
+	"kugg/compilers/parse"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+//parseDeclaring parses factors, and declares a symbol nN in the global scope for every number N among them
+func parseDeclaring(t *parse.Tree) {
+	parseFactors(t)
+	for _, f := range t.Root.Children()[0].Children() {
+		if c := f.Children()[0]; c.Type() == parse.NodeType(arith.Number) {
+			if _, err := t.CurrScope.Add("n" + c.Token().Lexeme()); err != nil {
+				t.Errorf("%v", err)
+			}
+		}
+	}
+}
+
+//batchSources returns sources where every seventh one has a syntax error, the 50th declares a name twice,
+//and the last one has the name of the first
+func batchSources(n int) []parse.Source {
+	var sources []parse.Source
+	for i := 0; i < n; i++ {
+		text := fmt.Sprintf("%d (1 + %d) -2\n", i, i)
+		switch {
+		case i%7 == 3:
+			text += "(1 +"
+		case i == 50:
+			text += "50"
+		}
+		sources = append(sources, parse.Source{Name: fmt.Sprintf("f%d", i), Text: text})
+	}
+	sources[n-1].Name = "f0"
+	return sources
+}
+
+//TestBatch parses many sources at once, and should be run with -race
+func TestBatch(t *testing.T) {
+	sources := batchSources(200)
+	var first string
+	for run := 0; run < 5; run++ {
+		b := &parse.Batch{Workers: 8, LexStart: arith.LexAny, ParseFn: parseDeclaring, Coverage: parse.NewCoverage()}
+		trees, err := b.Parse(sources)
+		if len(trees) != len(sources) {
+			t.Fatalf("%d trees of %d sources", len(trees), len(sources))
+		}
+		for i, tree := range trees {
+			if tree.Name() != sources[i].Name {
+				t.Fatalf("tree %d is %s, not %s", i, tree.Name(), sources[i].Name)
+			}
+		}
+
+		diags, ok := err.(parse.Diagnostics)
+		if !ok {
+			t.Fatalf("got %T %v, not Diagnostics", err, err)
+		}
+		for i := 1; i < len(diags); i++ {
+			if diags[i-1].Index > diags[i].Index {
+				t.Errorf("diagnostic of %s after that of %s", diags[i].Source, diags[i-1].Source)
+			}
+		}
+		var want []int
+		for i := range sources {
+			if i%7 == 3 || i == 50 {
+				want = append(want, i)
+			}
+		}
+		want = append(want, len(sources)-1) //Attaching a second f0
+		if len(diags) != len(want) {
+			t.Fatalf("%d diagnostics, expected %d:\n%v", len(diags), len(want), diags)
+		}
+		for i, d := range diags {
+			if d.Index != want[i] {
+				t.Errorf("diagnostic %d is of source %d, expected %d: %v", i, d.Index, want[i], d)
+			}
+		}
+		if run == 0 {
+			first = err.Error()
+		} else if err.Error() != first {
+			t.Errorf("the diagnostics differ between runs:\n%s\n\n%s", first, err.Error())
+		}
+
+		//Every scope but the second f0 is attached, with its symbols numbered for the whole project
+		if len(b.Project.Children) != len(sources)-1 {
+			t.Errorf("%d scopes attached to the project, expected %d", len(b.Project.Children), len(sources)-1)
+		}
+		ids := make(map[uint]string)
+		for i := 0; i < len(sources)-1; i++ {
+			if trees[i].Root.Scope().Parent != b.Project {
+				t.Errorf("the scope of %s is not attached to the project", sources[i].Name)
+			}
+			if i%7 == 3 {
+				continue //Its parse failed before declaring anything
+			}
+			name := fmt.Sprintf("n%d", i)
+			sym, ok := b.Project.ByQualifiedName([]string{sources[i].Name, name})
+			if !ok {
+				t.Errorf("%s.%s is not found in the project", sources[i].Name, name)
+				continue
+			}
+			if other, dup := ids[sym.GlobalId]; dup {
+				t.Errorf("%s.%s has the global id %d of %s", sources[i].Name, name, sym.GlobalId, other)
+			}
+			ids[sym.GlobalId] = sources[i].Name + "." + name
+		}
+		if _, ok := b.Project.ByQualifiedName([]string{"f0", "n199"}); ok {
+			t.Errorf("the second f0 was attached")
+		}
+	}
+}
+
+//parseBuggy parses factors, but indexes out of range on a source named bug
+func parseBuggy(t *parse.Tree) {
+	parseFactors(t)
+	if t.Name() == "bug" {
+		_ = t.Root.Children()[len(t.Root.Children())+1]
+	}
+}
+
+func TestBatchPanic(t *testing.T) {
+	sources := batchSources(20)
+	sources[12].Name = "bug"
+	defer func() {
+		p, ok := recover().(*parse.PanicError)
+		if !ok {
+			t.Fatalf("Parse did not panic with a *PanicError")
+		}
+		var rerr runtime.Error
+		if p.Source != "bug" || !errors.As(p, &rerr) {
+			t.Errorf("the panic of %s is %T %v", p.Source, p.Value, p.Value)
+		}
+		if !strings.Contains(string(p.Stack), "parse_test.parseBuggy") {
+			t.Errorf("the stack is not that of the panic:\n%s", p.Stack)
+		}
+		if !strings.HasPrefix(p.Error(), "bug: runtime error: index out of range") {
+			t.Errorf("the panic is %s", p.Error())
+		}
+	}()
+	b := &parse.Batch{Workers: 4, LexStart: arith.LexAny, ParseFn: parseBuggy}
+	b.Parse(sources)
+}
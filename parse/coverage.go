@@ -0,0 +1,339 @@
+package parse
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+)
+
+//Coverage counts which parts of a grammar the parses of a corpus exercise.
+//
+//Set it as the Coverage of every tree parsed, e.g. with Batch. A Coverage is safe to share between
+//trees parsed concurrently. Node types are listed with the names in NodeNames, which should hold every
+//node type of the grammar, so that types never created are reported as uncovered.
+type Coverage struct {
+	Types    map[NodeType]*TypeCount
+	Pairs    map[TypePair]int  //Times a child of a type was added to a parent of a type, including speculative nodes
+	Rules    map[string]int    //Times each rule was entered, see Tree.Trace
+	Expected map[TypePair]bool //Pairs reported as uncovered if they never occur, see Expect
+
+	mu sync.Mutex
+}
+
+//TypeCount counts the nodes of a type
+type TypeCount struct {
+	Created    int
+	Committed  int
+	RolledBack int
+}
+
+//TypePair is a parent and child node type
+type TypePair struct {
+	Parent, Child NodeType
+}
+
+func (p TypePair) String() string {
+	return fmt.Sprintf("%v > %v", p.Parent, p.Child)
+}
+
+//NewCoverage creates an empty Coverage
+func NewCoverage() *Coverage {
+	return &Coverage{
+		Types:    make(map[NodeType]*TypeCount),
+		Pairs:    make(map[TypePair]int),
+		Rules:    make(map[string]int),
+		Expected: make(map[TypePair]bool),
+	}
+}
+
+//init makes the maps of a zero Coverage, it's called with the lock held
+func (c *Coverage) init() {
+	if c.Types == nil {
+		c.Types = make(map[NodeType]*TypeCount)
+	}
+	if c.Pairs == nil {
+		c.Pairs = make(map[TypePair]int)
+	}
+	if c.Rules == nil {
+		c.Rules = make(map[string]int)
+	}
+	if c.Expected == nil {
+		c.Expected = make(map[TypePair]bool)
+	}
+}
+
+//Expect declares that nodes of the parent type may have children of the child types
+func (c *Coverage) Expect(parent NodeType, children ...NodeType) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.init()
+	for _, child := range children {
+		c.Expected[TypePair{parent, child}] = true
+	}
+}
+
+func (c *Coverage) typeCount(typ NodeType) *TypeCount {
+	tc, ok := c.Types[typ]
+	if !ok {
+		tc = &TypeCount{}
+		c.Types[typ] = tc
+	}
+	return tc
+}
+
+//create is called for every node created
+func (c *Coverage) create(typ NodeType) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.init()
+	c.typeCount(typ).Created++
+	c.mu.Unlock()
+}
+
+//count is called for every TraceEvent
+func (c *Coverage) count(ev TraceEvent, n Node, rule string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.init()
+	switch ev {
+	case EnterRule:
+		c.Rules[rule]++
+	case AddNode:
+		if p := n.Parent(); p != nil {
+			c.Pairs[TypePair{p.Type(), n.Type()}]++
+		}
+	case CommitNode:
+		c.typeCount(n.Type()).Committed++
+	case RollBackNode:
+		c.typeCount(n.Type()).RolledBack++
+	}
+}
+
+//Merge adds the counts of another Coverage, e.g. of another test run
+func (c *Coverage) Merge(o *Coverage) {
+	if o == c {
+		return
+	}
+	//o is copied under its own lock, so two Coverages merged into each other at once can't deadlock
+	o.mu.Lock()
+	types := make(map[NodeType]TypeCount, len(o.Types))
+	for typ, tc := range o.Types {
+		types[typ] = *tc
+	}
+	pairs := make(map[TypePair]int, len(o.Pairs))
+	for p, k := range o.Pairs {
+		pairs[p] = k
+	}
+	rules := make(map[string]int, len(o.Rules))
+	for r, k := range o.Rules {
+		rules[r] = k
+	}
+	expected := make(map[TypePair]bool, len(o.Expected))
+	for p := range o.Expected {
+		expected[p] = true
+	}
+	o.mu.Unlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.init()
+	for typ, tc := range types {
+		mine := c.typeCount(typ)
+		mine.Created += tc.Created
+		mine.Committed += tc.Committed
+		mine.RolledBack += tc.RolledBack
+	}
+	for p, k := range pairs {
+		c.Pairs[p] += k
+	}
+	for r, k := range rules {
+		c.Rules[r] += k
+	}
+	for p := range expected {
+		c.Expected[p] = true
+	}
+}
+
+//Uncovered returns the named node types never created, and the expected pairs which never occurred
+func (c *Coverage) Uncovered() (types []NodeType, pairs []TypePair) {
+	report := c.report()
+	for _, row := range report.Types {
+		if row.Uncovered {
+			types = append(types, row.Type)
+		}
+	}
+	for _, row := range report.Pairs {
+		if row.Uncovered {
+			pairs = append(pairs, row.Pair)
+		}
+	}
+	return types, pairs
+}
+
+type typeRow struct {
+	Type NodeType
+	TypeCount
+	Uncovered bool
+}
+
+type pairRow struct {
+	Pair      TypePair
+	Count     int
+	Expected  bool
+	Uncovered bool
+}
+
+type ruleRow struct {
+	Rule  string
+	Count int
+}
+
+type coverageReport struct {
+	Types                      []typeRow
+	Pairs                      []pairRow
+	Rules                      []ruleRow
+	TypesCovered, PairsCovered int
+	PairsExpected              int
+}
+
+//report sorts the counts into rows, types and pairs by NodeType, and rules by name
+func (c *Coverage) report() coverageReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var r coverageReport
+
+	types := make(map[NodeType]bool)
+	for typ := range NodeNames {
+		if typ != RootNode {
+			types[typ] = true
+		}
+	}
+	for typ := range c.Types {
+		types[typ] = true
+	}
+	for typ := range types {
+		row := typeRow{Type: typ}
+		if tc, ok := c.Types[typ]; ok {
+			row.TypeCount = *tc
+		}
+		row.Uncovered = row.Created == 0
+		if !row.Uncovered {
+			r.TypesCovered++
+		}
+		r.Types = append(r.Types, row)
+	}
+	sort.Slice(r.Types, func(i, j int) bool { return r.Types[i].Type < r.Types[j].Type })
+
+	pairs := make(map[TypePair]bool)
+	for p := range c.Pairs {
+		pairs[p] = true
+	}
+	for p := range c.Expected {
+		pairs[p] = true
+	}
+	for p := range pairs {
+		row := pairRow{Pair: p, Count: c.Pairs[p], Expected: c.Expected[p]}
+		row.Uncovered = row.Count == 0
+		if row.Expected {
+			r.PairsExpected++
+			if !row.Uncovered {
+				r.PairsCovered++
+			}
+		}
+		r.Pairs = append(r.Pairs, row)
+	}
+	sort.Slice(r.Pairs, func(i, j int) bool {
+		a, b := r.Pairs[i].Pair, r.Pairs[j].Pair
+		if a.Parent != b.Parent {
+			return a.Parent < b.Parent
+		}
+		return a.Child < b.Child
+	})
+
+	for rule, k := range c.Rules {
+		r.Rules = append(r.Rules, ruleRow{rule, k})
+	}
+	sort.Slice(r.Rules, func(i, j int) bool { return r.Rules[i].Rule < r.Rules[j].Rule })
+	return r
+}
+
+//WriteText writes the coverage as text tables, marking uncovered types and pairs with a !
+func (c *Coverage) WriteText(w io.Writer) error {
+	r := c.report()
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	mark := func(uncovered bool) string {
+		if uncovered {
+			return "!"
+		}
+		return ""
+	}
+
+	fmt.Fprintf(tw, "Node types: %d/%d covered\n", r.TypesCovered, len(r.Types))
+	fmt.Fprintf(tw, "\ttype\tcreated\tcommitted\trolled back\t\n")
+	for _, row := range r.Types {
+		fmt.Fprintf(tw, "%s\t%v\t%d\t%d\t%d\t\n", mark(row.Uncovered), row.Type, row.Created, row.Committed, row.RolledBack)
+	}
+
+	fmt.Fprintf(tw, "\nPairs: %d/%d expected pairs covered\n", r.PairsCovered, r.PairsExpected)
+	fmt.Fprintf(tw, "\tparent\tchild\tcount\t\n")
+	for _, row := range r.Pairs {
+		fmt.Fprintf(tw, "%s\t%v\t%v\t%d\t\n", mark(row.Uncovered), row.Pair.Parent, row.Pair.Child, row.Count)
+	}
+
+	if len(r.Rules) > 0 {
+		fmt.Fprintf(tw, "\nRules\n")
+		fmt.Fprintf(tw, "\trule\tentered\t\n")
+		for _, row := range r.Rules {
+			fmt.Fprintf(tw, "\t%s\t%d\t\n", row.Rule, row.Count)
+		}
+	}
+	return tw.Flush()
+}
+
+var coverageHTML = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Grammar coverage</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; text-align: right; }
+th:first-child, td:first-child, td.name { text-align: left; }
+tr.uncovered { background: #fdd; }
+tr.speculative { background: #ffd; }
+</style>
+</head>
+<body>
+<h2>Node types: {{.TypesCovered}}/{{len .Types}} covered</h2>
+<table>
+<tr><th>type</th><th>created</th><th>committed</th><th>rolled back</th></tr>
+{{range .Types}}<tr{{if .Uncovered}} class="uncovered"{{else if eq .Committed 0}} class="speculative"{{end}}><td>{{.Type}}</td><td>{{.Created}}</td><td>{{.Committed}}</td><td>{{.RolledBack}}</td></tr>
+{{end}}</table>
+<h2>Pairs: {{.PairsCovered}}/{{.PairsExpected}} expected pairs covered</h2>
+<table>
+<tr><th>parent</th><th>child</th><th>count</th></tr>
+{{range .Pairs}}<tr{{if .Uncovered}} class="uncovered"{{end}}><td>{{.Pair.Parent}}</td><td class="name">{{.Pair.Child}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+{{if .Rules}}<h2>Rules</h2>
+<table>
+<tr><th>rule</th><th>entered</th></tr>
+{{range .Rules}}<tr><td>{{.Rule}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`))
+
+//WriteHTML writes the coverage as an HTML page, highlighting uncovered types and pairs,
+//and types whose nodes were created but never committed
+func (c *Coverage) WriteHTML(w io.Writer) error {
+	return coverageHTML.Execute(w, c.report())
+}
@@ -0,0 +1,71 @@
+package parse_test
+
+import (
+	"kugg/compilers/Gparse/arith"
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+	"sync"
+	"testing"
+)
+
+func covered(t *testing.T, src string) *parse.Coverage {
+	tree := parse.NewTree("coverage", src, parseFactors)
+	tree.Coverage = parse.NewCoverage()
+	l := lex.Lex("coverage", src)
+	l.Run(arith.LexAny)
+	if err := tree.Parse(l); err != nil {
+		t.Fatal(err)
+	}
+	return tree.Coverage
+}
+
+func TestCoverageMerge(t *testing.T) {
+	var zero parse.Coverage
+	zero.Merge(covered(t, "1 (2)"))
+	if zero.Types[parse.NodeType(arith.Number)].Created != 2 {
+		t.Fatalf("%d numbers after merging into a zero Coverage, expected 2", zero.Types[parse.NodeType(arith.Number)].Created)
+	}
+	zero.Merge(&zero)
+	if zero.Types[parse.NodeType(arith.Number)].Created != 2 {
+		t.Fatalf("merging a Coverage into itself changed it")
+	}
+
+	//Merged into each other at once, which used to deadlock
+	a, b := covered(t, "1"), covered(t, "2 3")
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func() { defer wg.Done(); a.Merge(b) }()
+		go func() { defer wg.Done(); b.Merge(a) }()
+	}
+	wg.Wait()
+}
+
+//TestCoverageCommitSubTree checks that committing a subtree counts the nodes committed before only once
+func TestCoverageCommitSubTree(t *testing.T) {
+	tree := parse.NewTree("commit", "", nil)
+	tree.Coverage = parse.NewCoverage()
+	expr := tree.Root.AddNonTerminal(parse.NodeType(arith.Expr), nil)
+	term := expr.AddNonTerminal(parse.NodeType(arith.Term), nil)
+	for _, lexeme := range []string{"1", "2", "3"} {
+		term.AddTerminal(parse.NodeType(arith.Number), lex.NewToken(arith.TNumber, lexeme, 0, 0, 1))
+	}
+	term.Children()[0].Commit()
+	term.Children()[1].Commit()
+	expr.CommitSubTree()
+	expr.CommitSubTree()
+
+	types := tree.Coverage.Types
+	for typ, want := range map[parse.NodeType]int{
+		parse.NodeType(arith.Expr):   1,
+		parse.NodeType(arith.Term):   1,
+		parse.NodeType(arith.Number): 3,
+	} {
+		if types[typ].Committed != want {
+			t.Errorf("%v committed %d times, expected %d", typ, types[typ].Committed, want)
+		}
+	}
+	if types[parse.NodeType(arith.Number)].Created != 3 {
+		t.Errorf("%d numbers created", types[parse.NodeType(arith.Number)].Created)
+	}
+}
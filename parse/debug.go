@@ -3,11 +3,29 @@ package parse
 import (
 	"fmt"
 	"kugg/compilers/lex"
+	"kugg/compilers/symbol"
 
 	"github.com/goccy/go-yaml"
 )
 
+//SerializeFlags selects the optional properties written by SerializeTree
+type SerializeFlags int
+
+const (
+	WithSpans  SerializeFlags = 1 << iota //Source positions of terminal tokens
+	WithStatus                            //Parse status of every node
+	WithScopes                            //Scope ids of every node and symbol ids where there is a symbol
+)
+
 func DeserializeTree(nodeNames map[NodeType]string, tokenNames map[lex.TokenType]string, text []byte) *Tree {
+	return DeserializeTreeScoped(nodeNames, tokenNames, text, nil)
+}
+
+//DeserializeTreeScoped is like DeserializeTree, but also resolves scope and symbol ids
+//in the global symbol table given, which becomes the global scope of the tree.
+//
+//Scope ids are indices into global.Scopes(), symbol ids are global ids.
+func DeserializeTreeScoped(nodeNames map[NodeType]string, tokenNames map[lex.TokenType]string, text []byte, global *symbol.Table) *Tree {
 
 	m := make(map[string]interface{})
 	err := yaml.Unmarshal(text, &m)
@@ -28,51 +46,240 @@ func DeserializeTree(nodeNames map[NodeType]string, tokenNames map[lex.TokenType
 
 	tree := NewTree("test_tree", string(text), nil)
 
-	var walkYAMLtree func(map[string]interface{}) Node
-	walkYAMLtree = func(yamlNode map[string]interface{}) Node {
-		treeNode := baseNode{}
+	var scopes []*symbol.Table
+	if global != nil {
+		tree.CurrScope = global
+		tree.Root.(*baseNode).scope = global
+		scopes = global.Scopes()
+	}
+
+	var walkYAMLtree func(map[string]interface{}) *baseNode
+	walkYAMLtree = func(yamlNode map[string]interface{}) *baseNode {
+		treeNode := baseNode{tree: tree, scope: tree.CurrScope}
 		hasToken := false
 		var (
-			nodeTokTyp lex.TokenType
-			lexeme     string
+			nodeTokTyp      lex.TokenType
+			lexeme          string
+			pos, row, line  int
+			children        []interface{}
+			scopeId, symbId interface{}
+			attributes      map[string]interface{}
 		)
 		for key, prop := range yamlNode {
 			switch key {
 			case "node":
-				treeNode.typ = nodeType[prop.(string)]
+				treeNode.typ = NodeType(deserializeName(nodeType, prop))
 
 			case "token":
-				nodeTokTyp = tokType[prop.(string)]
+				nodeTokTyp = lex.TokenType(deserializeName(tokType, prop))
 				hasToken = true
 			case "lexeme":
-				lexeme = prop.(string)
-			case "children":
-				for _, child := range prop.([]interface{}) {
-					switch child := child.(type) {
-					case map[string]interface{}:
-						treeNode.AddChild(walkYAMLtree(child))
-					default:
-						panic(fmt.Sprintf("Error walking deserialized YAML AST: expected children to be map[string]interface{}, but is %T:%v\n", child, child))
-					}
+				lexeme = fmt.Sprint(prop)
+			case "span":
+				span, ok := prop.(map[string]interface{})
+				if !ok {
+					panic(fmt.Sprintf("Error walking deserialized YAML AST: expected span to be a map, but is %T:%v\n", prop, prop))
 				}
-
+				pos, row, line = deserializeInt(span["pos"]), deserializeInt(span["row"]), deserializeInt(span["line"])
+			case "status":
+				switch prop {
+				case "FullyParsed":
+					treeNode.parseStatus = FullyParsed
+				case "Speculative":
+					treeNode.parseStatus = Speculative
+				default:
+					panic(fmt.Sprintf("Error walking deserialized YAML AST: unknown parse status %v\n", prop))
+				}
+			case "scope":
+				scopeId = prop
+			case "symbol":
+				symbId = prop
+			case "attributes":
+				var ok bool
+				if attributes, ok = prop.(map[string]interface{}); !ok {
+					panic(fmt.Sprintf("Error walking deserialized YAML AST: expected attributes to be a map, but is %T:%v\n", prop, prop))
+				}
+			case "children":
+				children = prop.([]interface{})
 			}
 		}
 		if hasToken {
-			treeNode.token = lex.DebugToken(nodeTokTyp, lexeme)
+			treeNode.token = lex.NewToken(nodeTokTyp, lexeme, pos, row, line)
 			//This is to get a pretty print with the tokens
 			//Of course this means there are some print oddities, but that's fine
 			treeNode.isTerminal = true
 		}
+		if global != nil {
+			if scopeId != nil {
+				id := deserializeInt(scopeId)
+				if id < 0 || id >= len(scopes) {
+					panic(fmt.Sprintf("Error walking deserialized YAML AST: no scope with id %d\n", id))
+				}
+				treeNode.scope = scopes[id]
+			}
+			if symbId != nil {
+				sym, ok := findGlobalId(scopes, uint(deserializeInt(symbId)))
+				if !ok {
+					panic(fmt.Sprintf("Error walking deserialized YAML AST: no symbol with global id %v\n", symbId))
+				}
+				treeNode.symbol = sym
+			}
+		}
+		for name, value := range attributes {
+			if err := decodeAttribute(&treeNode, name, fmt.Sprint(value)); err != nil {
+				panic(fmt.Sprintf("Error walking deserialized YAML AST: %v\n", err))
+			}
+		}
+		for _, child := range children {
+			switch child := child.(type) {
+			case map[string]interface{}:
+				treeNode.AddChild(walkYAMLtree(child))
+			default:
+				panic(fmt.Sprintf("Error walking deserialized YAML AST: expected children to be map[string]interface{}, but is %T:%v\n", child, child))
+			}
+		}
 		return &treeNode
 	}
 
-	tree.Root.AddChild(walkYAMLtree(m))
+	top := walkYAMLtree(m)
+	if top.typ == RootNode {
+		//A serialized root, see SerializeTree
+		root := tree.Root.(*baseNode)
+		root.parseStatus = top.parseStatus
+		for _, child := range top.Children() {
+			root.AddChild(child)
+		}
+	} else {
+		tree.Root.AddChild(top)
+	}
 
 	return tree
 }
 
-//TODO: implement
-func SerializeTree(nodeNames map[NodeType]string, tree Tree) string {
-	return ""
+//deserializeName looks up a name, names missing from the lookup table are serialized as integers
+func deserializeName[T ~int](lookup map[string]T, prop interface{}) T {
+	name, ok := prop.(string)
+	if !ok {
+		return T(deserializeInt(prop))
+	}
+	typ, ok := lookup[name]
+	if !ok {
+		panic(fmt.Sprintf("Error walking deserialized YAML AST: no type named %q in lookup table\n", name))
+	}
+	return typ
+}
+
+func deserializeInt(prop interface{}) int {
+	switch n := prop.(type) {
+	case uint64:
+		return int(n)
+	case int64:
+		return int(n)
+	case int:
+		return n
+	case nil:
+		return 0
+	}
+	panic(fmt.Sprintf("Error walking deserialized YAML AST: expected an integer, but is %T:%v\n", prop, prop))
+}
+
+func findGlobalId(scopes []*symbol.Table, id uint) (*symbol.Symbol, bool) {
+	for _, scope := range scopes {
+		for i := uint(0); i < scope.NumSymbols(); i++ {
+			if sym, ok := scope.ByLocalId(i); ok && sym.GlobalId == id {
+				return sym, true
+			}
+		}
+	}
+	return nil, false
+}
+
+//SerializeTree writes a tree in the YAML format read by DeserializeTree.
+//
+//Nodes are written with their type, and terminals with their token type and lexeme.
+//Names missing from the lookup tables are written as integers.
+//Attributes are written if their Key has a codec, see Key.WithCodec.
+//The flags add optional properties, which DeserializeTree also reads back.
+//
+//The tree is written starting from the only child of the root. Trees where the root
+//has several children, or where the parse status of the root matters, are written
+//starting from the root itself.
+func SerializeTree(nodeNames map[NodeType]string, tokenNames map[lex.TokenType]string, tree *Tree, flags SerializeFlags) string {
+	s := serializer{nodeNames: nodeNames, tokenNames: tokenNames, flags: flags}
+	if flags&WithScopes != 0 {
+		s.scopeIds = make(map[*symbol.Table]int)
+		for i, scope := range tree.Root.Scope().Scopes() {
+			s.scopeIds[scope] = i
+		}
+	}
+
+	text, err := yaml.Marshal(s.node(exportTop(tree, flags)))
+	if err != nil {
+		panic(fmt.Sprintf("Error serializing AST to YAML:%v\n", err))
+	}
+	return string(text)
+}
+
+type serializer struct {
+	nodeNames  map[NodeType]string
+	tokenNames map[lex.TokenType]string
+	flags      SerializeFlags
+	scopeIds   map[*symbol.Table]int
+}
+
+func (s *serializer) node(n Node) yaml.MapSlice {
+	m := yaml.MapSlice{{Key: "node", Value: serializeName(s.nodeNames, n.Type())}}
+
+	if tok := n.Token(); n.IsTerminal() && tok != nil {
+		m = append(m, yaml.MapItem{Key: "token", Value: serializeName(s.tokenNames, tok.Type())})
+		if tok.Lexeme() != "" {
+			m = append(m, yaml.MapItem{Key: "lexeme", Value: tok.Lexeme()})
+		}
+		if s.flags&WithSpans != 0 {
+			m = append(m, yaml.MapItem{Key: "span", Value: yaml.MapSlice{
+				{Key: "pos", Value: tok.Pos()},
+				{Key: "line", Value: tok.Line()},
+				{Key: "row", Value: tok.Row()},
+			}})
+		}
+	}
+	if s.flags&WithStatus != 0 {
+		status := "Speculative"
+		if n.Status() == FullyParsed {
+			status = "FullyParsed"
+		}
+		m = append(m, yaml.MapItem{Key: "status", Value: status})
+	}
+	if s.flags&WithScopes != 0 {
+		if id, ok := s.scopeIds[n.Scope()]; ok {
+			m = append(m, yaml.MapItem{Key: "scope", Value: id})
+		}
+		if sym := n.Symbol(); sym != nil {
+			m = append(m, yaml.MapItem{Key: "symbol", Value: sym.GlobalId})
+		}
+	}
+
+	if names, values := encodedAttributes(n); len(names) > 0 {
+		attrs := make(yaml.MapSlice, len(names))
+		for i := range names {
+			attrs[i] = yaml.MapItem{Key: names[i], Value: values[i]}
+		}
+		m = append(m, yaml.MapItem{Key: "attributes", Value: attrs})
+	}
+
+	if children := n.Children(); len(children) > 0 {
+		list := make([]yaml.MapSlice, len(children))
+		for i, child := range children {
+			list[i] = s.node(child)
+		}
+		m = append(m, yaml.MapItem{Key: "children", Value: list})
+	}
+	return m
+}
+
+func serializeName[T ~int](names map[T]string, typ T) interface{} {
+	if name, ok := names[typ]; ok {
+		return name
+	}
+	return int(typ)
 }
@@ -0,0 +1,136 @@
+package parse_test
+
+import (
+	"kugg/compilers/Gparse"
+	"kugg/compilers/Gparse/arith"
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+	"kugg/compilers/symbol"
+	"strconv"
+	"testing"
+)
+
+var allFlags = []parse.SerializeFlags{
+	0,
+	parse.WithSpans,
+	parse.WithStatus,
+	parse.WithScopes,
+	parse.WithSpans | parse.WithStatus,
+	parse.WithSpans | parse.WithScopes,
+	parse.WithStatus | parse.WithScopes,
+	parse.WithSpans | parse.WithStatus | parse.WithScopes,
+}
+
+var weight = parse.NewKey[int]("weight").WithCodec(strconv.Itoa, strconv.Atoi)
+
+//handBuilt returns a tree which no parser makes: speculative nodes, a root with two children,
+//an attribute, and tokens with an unnamed type and lexemes which need quoting in YAML
+func handBuilt() *parse.Tree {
+	tree := parse.NewTree("hand", "", nil)
+	a := tree.Root.AddNonTerminal(parse.NodeType(arith.Expr), nil)
+	a.AddTerminal(parse.NodeType(arith.Number), lex.NewToken(arith.TNumber, "007", 0, 0, 1)).Commit()
+	a.AddTerminal(parse.NodeType(arith.Plus), lex.NewToken(arith.TPlus, "+", 4, 4, 1))
+	a.AddTerminal(parse.NodeType(arith.Number), lex.NewToken(lex.TokenType(4242), "a: \"b\"\n- c", 6, 0, 2)).Commit()
+	parse.Set(a, weight, 3)
+	a.Commit()
+	b := tree.Root.AddNonTerminal(parse.NodeType(4243), nil)
+	b.AddTerminal(parse.NodeType(arith.Number), lex.NewToken(arith.TNumber, "true", 20, 0, 3)).Commit()
+	return tree
+}
+
+//declareScopes makes the scopes of scopedTree in a global scope: a symbol f with a symbol x in its namespace,
+//and a scope without a symbol
+func declareScopes(global *symbol.Table) {
+	f, _ := global.Add("f")
+	f.NameSpace.Add("x")
+	global.SubScope()
+	global.ResolveGlobalIds()
+}
+
+//scopedTree returns a tree with nodes in the scopes of declareScopes, declaring its symbols in the same order
+func scopedTree() *parse.Tree {
+	tree := parse.NewTree("scoped", "", nil)
+	global := tree.CurrScope
+	a := tree.Root.AddNonTerminal(parse.NodeType(arith.Expr), nil)
+	f, _ := a.CreateSymbol("f")
+	tree.CurrScope = f.NameSpace
+	b := a.AddNonTerminal(parse.NodeType(arith.Term), nil)
+	b.CreateSymbol("x")
+	b.AddTerminal(parse.NodeType(arith.Number), lex.NewToken(arith.TNumber, "1", 0, 0, 1)).Commit()
+	b.Commit()
+	tree.CurrScope = global.SubScope()
+	a.AddTerminal(parse.NodeType(arith.Number), lex.NewToken(arith.TNumber, "2", 2, 2, 1)).Commit()
+	a.Commit()
+	tree.CurrScope = global
+	global.ResolveGlobalIds()
+	return tree
+}
+
+//sameScopes checks that two trees have their nodes in the same scopes of their global scopes,
+//and with the same symbols
+func sameScopes(t *testing.T, name string, a, b parse.Node, aScopes, bScopes map[*symbol.Table]int) {
+	if aScopes[a.Scope()] != bScopes[b.Scope()] {
+		t.Errorf("%s: a %s is in scope %d, and read back in scope %d", name, a.Type(), aScopes[a.Scope()], bScopes[b.Scope()])
+	}
+	switch as, bs := a.Symbol(), b.Symbol(); {
+	case as == nil && bs == nil:
+	case as == nil || bs == nil || as.Name != bs.Name || as.GlobalId != bs.GlobalId || aScopes[as.Scope] != bScopes[bs.Scope]:
+		t.Errorf("%s: a %s has the symbol %v, and reads back with %v", name, a.Type(), as, bs)
+	}
+	for i := range a.Children() {
+		sameScopes(t, name, a.Children()[i], b.Children()[i], aScopes, bScopes)
+	}
+}
+
+func scopeIds(global *symbol.Table) map[*symbol.Table]int {
+	ids := make(map[*symbol.Table]int)
+	for i, scope := range global.Scopes() {
+		ids[scope] = i
+	}
+	return ids
+}
+
+//TestSerializeRoundTrip checks that DeserializeTree reads back the trees of SerializeTree, with every flag.
+//Without WithSpans the positions of tokens are lost, and without WithStatus the parse status.
+//With WithScopes, DeserializeTreeScoped reads back the scopes and symbols into a copy of the global scope.
+func TestSerializeRoundTrip(t *testing.T) {
+	p, err := Gparse.NewParser(arith.Grammar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	trees := []*parse.Tree{handBuilt(), scopedTree()}
+	for _, src := range []string{"1", "007 + 2", "-(1 + 2) * 3 / (4 - -5)", "((((0))))", "1 +\n  2 *\n 3"} {
+		tree, err := p.Parse(src, src, arith.LexAny)
+		if err != nil {
+			t.Fatalf("%q: %v", src, err)
+		}
+		trees = append(trees, tree)
+	}
+
+	for _, tree := range trees {
+		for _, flags := range allFlags {
+			text := parse.SerializeTree(parse.NodeNames, lex.TokenNames, tree, flags)
+			var back *parse.Tree
+			if flags&parse.WithScopes != 0 {
+				global := symbol.NewGlobalScope()
+				if tree.Name() == "scoped" {
+					declareScopes(global)
+				}
+				back = parse.DeserializeTreeScoped(parse.NodeNames, lex.TokenNames, []byte(text), global)
+			} else {
+				back = parse.DeserializeTree(parse.NodeNames, lex.TokenNames, []byte(text))
+			}
+			opts := parse.EqualOptions{IgnorePositions: flags&parse.WithSpans == 0, IgnoreStatus: flags&parse.WithStatus == 0}
+			if !parse.Equal(tree, back, opts) {
+				t.Errorf("%s with flags %d does not round trip:\n%s", tree.Name(), flags, text)
+				continue
+			}
+			if flags&parse.WithScopes != 0 {
+				sameScopes(t, tree.Name(), tree.Root, back.Root, scopeIds(tree.Root.Scope()), scopeIds(back.Root.Scope()))
+			}
+			if again := parse.SerializeTree(parse.NodeNames, lex.TokenNames, back, flags); again != text {
+				t.Errorf("%s with flags %d serializes differently after reading it back:\n%s\n%s", tree.Name(), flags, text, again)
+			}
+		}
+	}
+}
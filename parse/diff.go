@@ -0,0 +1,464 @@
+package parse
+
+import (
+	"fmt"
+	"strings"
+)
+
+//EqualOptions relaxes the comparisons made by Equal and Diff.
+//
+//Node types, whether nodes are terminals, and the token types of terminals are always compared.
+//The tokens of nonterminals are never compared, since they only repeat the leftmost terminal.
+type EqualOptions struct {
+	IgnorePositions bool //Don't compare the source positions of tokens
+	IgnoreStatus    bool //Don't compare the parse status of nodes
+	IgnoreLexemes   bool //Don't compare the lexemes of terminals
+}
+
+//Equal reports whether two trees are structurally equal
+func Equal(a, b *Tree, opts EqualOptions) bool {
+	return EqualNodes(a.Root, b.Root, opts)
+}
+
+//EqualNodes reports whether two subtrees are structurally equal
+func EqualNodes(a, b Node, opts EqualOptions) bool {
+	if !opts.sameLabel(a, b) || len(a.Children()) != len(b.Children()) {
+		return false
+	}
+	bc := b.Children()
+	for i, ac := range a.Children() {
+		if !EqualNodes(ac, bc[i], opts) {
+			return false
+		}
+	}
+	return true
+}
+
+//sameLabel compares two nodes without looking at their children
+func (opts EqualOptions) sameLabel(a, b Node) bool {
+	if a.Type() != b.Type() || a.IsTerminal() != b.IsTerminal() {
+		return false
+	}
+	if !opts.IgnoreStatus && a.Status() != b.Status() {
+		return false
+	}
+	if !a.IsTerminal() {
+		return true
+	}
+
+	at, bt := a.Token(), b.Token()
+	switch {
+	case at == nil || bt == nil:
+		return at == nil && bt == nil
+	case at.Type() != bt.Type():
+		return false
+	case !opts.IgnoreLexemes && at.Lexeme() != bt.Lexeme():
+		return false
+	case !opts.IgnorePositions && (at.Pos() != bt.Pos() || at.Line() != bt.Line() || at.Row() != bt.Row()):
+		return false
+	}
+	return true
+}
+
+//EditOp is the kind of an Edit
+type EditOp int
+
+const (
+	Insert  EditOp = iota //B was inserted
+	Delete                //A was deleted, its children were moved up to its parent
+	Relabel               //A was changed into B
+	Move                  //The subtree A was moved, and is now B
+)
+
+func (op EditOp) String() string {
+	switch op {
+	case Insert:
+		return "Insert"
+	case Delete:
+		return "Delete"
+	case Relabel:
+		return "Relabel"
+	case Move:
+		return "Move"
+	}
+	return fmt.Sprintf("EditOp(%d)", int(op))
+}
+
+//Edit is a single edit turning one tree into another
+type Edit struct {
+	Op EditOp
+	A  Node //The node in the old tree, nil for inserts
+	B  Node //The node in the new tree, nil for deletes
+}
+
+func (e Edit) String() string {
+	switch e.Op {
+	case Insert:
+		return fmt.Sprintf("Insert %v", e.B)
+	case Delete:
+		return fmt.Sprintf("Delete %v", e.A)
+	}
+	return fmt.Sprintf("%v %v -> %v", e.Op, e.A, e.B)
+}
+
+//EditScript is a minimal list of edits turning one tree into another
+type EditScript struct {
+	Edits []Edit
+
+	a, b    Node
+	opts    EqualOptions
+	mapping map[Node]Node //Nodes in a to the nodes in b they were kept, relabeled or moved as
+	reverse map[Node]Node //The inverse of mapping
+	moves   map[Node]Edit //The roots of moved subtrees in a and b to their moves
+}
+
+//Empty reports whether the trees were equal
+func (s *EditScript) Empty() bool {
+	return len(s.Edits) == 0
+}
+
+//Diff computes a minimal edit script turning tree a into tree b
+func Diff(a, b *Tree) *EditScript {
+	return DiffOptions(a, b, EqualOptions{})
+}
+
+//DiffOptions is like Diff, but only counts the differences not ignored by opts as relabels
+func DiffOptions(a, b *Tree, opts EqualOptions) *EditScript {
+	return DiffNodes(a.Root, b.Root, opts)
+}
+
+//DiffNodes computes a minimal edit script turning subtree a into subtree b.
+//
+//Inserts, deletes and relabels are minimal in the sense of the tree edit distance,
+//computed with the algorithm of Zhang and Shasha.
+//Deleted subtrees equal to inserted subtrees are then reported as moves.
+func DiffNodes(a, b Node, opts EqualOptions) *EditScript {
+	ta, tb := newPostorder(a), newPostorder(b)
+	z := &zhangShasha{a: ta, b: tb, opts: opts}
+	z.run()
+
+	s := &EditScript{a: a, b: b, opts: opts, mapping: make(map[Node]Node), reverse: make(map[Node]Node), moves: make(map[Node]Edit)}
+	for x, y := range z.mapping {
+		s.mapping[ta.nodes[x]] = tb.nodes[y]
+		s.reverse[tb.nodes[y]] = ta.nodes[x]
+	}
+
+	var deleted, inserted []Node
+	for _, n := range ta.nodes {
+		if _, ok := s.mapping[n]; !ok {
+			deleted = append(deleted, n)
+		}
+	}
+	for _, n := range tb.nodes {
+		if _, ok := s.reverse[n]; !ok {
+			inserted = append(inserted, n)
+		}
+	}
+
+	//Turn whole subtrees that were deleted and inserted elsewhere into moves
+	deletedSet := nodeSet(deleted)
+	insertedSet := nodeSet(inserted)
+	movedA, movedB := make(map[Node]bool), make(map[Node]bool)
+	for _, x := range maximalSubtrees(deleted, deletedSet) {
+		for _, y := range maximalSubtrees(inserted, insertedSet) {
+			if movedB[y] || !EqualNodes(x, y, opts) {
+				continue
+			}
+			e := Edit{Op: Move, A: x, B: y}
+			s.Edits = append(s.Edits, e)
+			s.moves[x], s.moves[y] = e, e
+			s.pairSubtrees(x, y, movedA, movedB)
+			break
+		}
+	}
+
+	for _, n := range deleted {
+		if !movedA[n] {
+			s.Edits = append(s.Edits, Edit{Op: Delete, A: n})
+		}
+	}
+	for _, n := range inserted {
+		if !movedB[n] {
+			s.Edits = append(s.Edits, Edit{Op: Insert, B: n})
+		}
+	}
+	for _, x := range ta.nodes {
+		if y, ok := s.mapping[x]; ok && !movedA[x] && !opts.sameLabel(x, y) {
+			s.Edits = append(s.Edits, Edit{Op: Relabel, A: x, B: y})
+		}
+	}
+	return s
+}
+
+func nodeSet(ns []Node) map[Node]bool {
+	set := make(map[Node]bool, len(ns))
+	for _, n := range ns {
+		set[n] = true
+	}
+	return set
+}
+
+//maximalSubtrees returns the nodes whose whole subtree is in the set, but whose parent is not
+func maximalSubtrees(ns []Node, set map[Node]bool) []Node {
+	var whole func(Node) bool
+	whole = func(n Node) bool {
+		if !set[n] {
+			return false
+		}
+		for _, c := range n.Children() {
+			if !whole(c) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var roots []Node
+	for _, n := range ns {
+		if whole(n) && (n.Parent() == nil || !whole(n.Parent())) {
+			roots = append(roots, n)
+		}
+	}
+	return roots
+}
+
+func (s *EditScript) pairSubtrees(x, y Node, movedA, movedB map[Node]bool) {
+	s.mapping[x], s.reverse[y] = y, x
+	movedA[x], movedB[y] = true, true
+	yc := y.Children()
+	for i, c := range x.Children() {
+		s.pairSubtrees(c, yc[i], movedA, movedB)
+	}
+}
+
+//postorder numbers the nodes of a tree for the Zhang-Shasha algorithm
+type postorder struct {
+	nodes    []Node
+	lmd      []int //Index of the leftmost leaf descendant of each node
+	keyroots []int
+}
+
+func newPostorder(root Node) *postorder {
+	p := &postorder{}
+	var walk func(Node) int
+	walk = func(n Node) int {
+		lmd := -1
+		for _, c := range n.Children() {
+			l := walk(c)
+			if lmd < 0 {
+				lmd = l
+			}
+		}
+		p.nodes = append(p.nodes, n)
+		if lmd < 0 {
+			lmd = len(p.nodes) - 1
+		}
+		p.lmd = append(p.lmd, lmd)
+		return lmd
+	}
+	walk(root)
+
+	//A keyroot is the highest node with a given leftmost leaf descendant
+	highest := make(map[int]int)
+	for i, l := range p.lmd {
+		highest[l] = i
+	}
+	for i, l := range p.lmd {
+		if highest[l] == i {
+			p.keyroots = append(p.keyroots, i)
+		}
+	}
+	return p
+}
+
+type zhangShasha struct {
+	a, b    *postorder
+	opts    EqualOptions
+	td      [][]int     //Tree distances of all pairs of subtrees
+	mapping map[int]int //Node indices in a to node indices in b
+}
+
+func (z *zhangShasha) cost(x, y int) int {
+	if z.opts.sameLabel(z.a.nodes[x], z.b.nodes[y]) {
+		return 0
+	}
+	return 1
+}
+
+func (z *zhangShasha) run() {
+	z.td = make([][]int, len(z.a.nodes))
+	for i := range z.td {
+		z.td[i] = make([]int, len(z.b.nodes))
+	}
+	for _, i := range z.a.keyroots {
+		for _, j := range z.b.keyroots {
+			z.forestDist(i, j)
+		}
+	}
+
+	z.mapping = make(map[int]int)
+	z.backtrack(len(z.a.nodes)-1, len(z.b.nodes)-1)
+}
+
+//forestDist computes the distances between the forests of postorder prefixes of the subtrees i and j
+func (z *zhangShasha) forestDist(i, j int) [][]int {
+	li, lj := z.a.lmd[i], z.b.lmd[j]
+	fd := make([][]int, i-li+2)
+	for dx := range fd {
+		fd[dx] = make([]int, j-lj+2)
+		fd[dx][0] = dx
+	}
+	for dy := range fd[0] {
+		fd[0][dy] = dy
+	}
+
+	for x := li; x <= i; x++ {
+		dx := x - li + 1
+		for y := lj; y <= j; y++ {
+			dy := y - lj + 1
+			best := minInt(fd[dx-1][dy]+1, fd[dx][dy-1]+1)
+			if z.a.lmd[x] == li && z.b.lmd[y] == lj {
+				best = minInt(best, fd[dx-1][dy-1]+z.cost(x, y))
+				z.td[x][y] = best
+			} else {
+				best = minInt(best, fd[z.a.lmd[x]-li][z.b.lmd[y]-lj]+z.td[x][y])
+			}
+			fd[dx][dy] = best
+		}
+	}
+	return fd
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+//backtrack recovers the node mapping of an optimal edit script for the subtrees i and j
+func (z *zhangShasha) backtrack(i, j int) {
+	type pair struct{ i, j int }
+	stack := []pair{{i, j}}
+
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		li, lj := z.a.lmd[p.i], z.b.lmd[p.j]
+		fd := z.forestDist(p.i, p.j)
+		dx, dy := p.i-li+1, p.j-lj+1
+		for dx > 0 || dy > 0 {
+			x, y := dx+li-1, dy+lj-1
+			switch {
+			case dx > 0 && dy > 0 && z.a.lmd[x] == li && z.b.lmd[y] == lj && fd[dx][dy] == fd[dx-1][dy-1]+z.cost(x, y):
+				z.mapping[x] = y
+				dx--
+				dy--
+			case dx > 0 && dy > 0 && (z.a.lmd[x] != li || z.b.lmd[y] != lj) &&
+				fd[dx][dy] == fd[z.a.lmd[x]-li][z.b.lmd[y]-lj]+z.td[x][y]:
+				stack = append(stack, pair{x, y})
+				dx = z.a.lmd[x] - li
+				dy = z.b.lmd[y] - lj
+			case dx > 0 && fd[dx][dy] == fd[dx-1][dy]+1:
+				dx--
+			default:
+				dy--
+			}
+		}
+	}
+}
+
+//String renders the edits as an annotated tree, in the shape of the new tree.
+//
+//Lines are marked with + for inserts, - for deletes, ~ for relabels, > for the new place of
+//a moved subtree and < for its old place. Deleted nodes are listed under the closest kept ancestor.
+func (s *EditScript) String() string {
+	deletedUnder := make(map[Node][]Node) //Nodes in b to the deleted nodes in a to list under them
+	var orphans []Node
+	for _, e := range s.Edits {
+		var removed Node
+		switch e.Op {
+		case Delete, Move:
+			removed = e.A
+		default:
+			continue
+		}
+		if p := removed.Parent(); p != nil && s.isDeletedOrMoved(p) {
+			continue //Listed together with its parent
+		}
+		if anc := s.keptAncestor(removed); anc != nil {
+			deletedUnder[anc] = append(deletedUnder[anc], removed)
+		} else {
+			orphans = append(orphans, removed)
+		}
+	}
+
+	var lines []string
+	s.renderNew(s.b, 0, false, deletedUnder, &lines)
+	for _, n := range orphans {
+		s.renderOld(n, 0, &lines)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (s *EditScript) isDeletedOrMoved(a Node) bool {
+	if _, ok := s.moves[a]; ok {
+		return true
+	}
+	_, kept := s.mapping[a]
+	return !kept
+}
+
+//keptAncestor finds the node in b corresponding to the closest ancestor in a that was kept
+func (s *EditScript) keptAncestor(a Node) Node {
+	for p := a.Parent(); p != nil; p = p.Parent() {
+		if _, ok := s.moves[p]; ok {
+			continue
+		}
+		if b, ok := s.mapping[p]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+func (s *EditScript) renderNew(n Node, indent int, inMove bool, deletedUnder map[Node][]Node, lines *[]string) {
+	pad := strings.Repeat("  ", indent)
+	old, kept := s.reverse[n]
+	switch {
+	case inMove:
+		*lines = append(*lines, fmt.Sprintf("  %s%v", pad, n))
+	case s.moves[n].B == n:
+		*lines = append(*lines, fmt.Sprintf("> %s%v", pad, n))
+		inMove = true
+	case !kept:
+		*lines = append(*lines, fmt.Sprintf("+ %s%v", pad, n))
+	case !s.opts.sameLabel(old, n):
+		*lines = append(*lines, fmt.Sprintf("~ %s%v -> %v", pad, old, n))
+	default:
+		*lines = append(*lines, fmt.Sprintf("  %s%v", pad, n))
+	}
+
+	for _, child := range n.Children() {
+		s.renderNew(child, indent+1, inMove, deletedUnder, lines)
+	}
+	for _, removed := range deletedUnder[n] {
+		s.renderOld(removed, indent+1, lines)
+	}
+}
+
+//renderOld renders a deleted or moved node, and its deleted descendants
+func (s *EditScript) renderOld(n Node, indent int, lines *[]string) {
+	pad := strings.Repeat("  ", indent)
+	if _, ok := s.moves[n]; ok {
+		*lines = append(*lines, fmt.Sprintf("< %s%v", pad, n))
+		return
+	}
+	*lines = append(*lines, fmt.Sprintf("- %s%v", pad, n))
+	for _, child := range n.Children() {
+		if s.isDeletedOrMoved(child) {
+			s.renderOld(child, indent+1, lines)
+		}
+	}
+}
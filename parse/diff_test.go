@@ -0,0 +1,131 @@
+package parse_test
+
+import (
+	"kugg/compilers/Gparse/arith"
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+	"strings"
+	"testing"
+)
+
+//specTree builds a tree from a spec like Expr(Term(1 2) 3), where numbers are terminals and
+//names are the nonterminals of arith
+func specTree(spec string) *parse.Tree {
+	tree := parse.NewTree(spec, spec, nil)
+	types := map[string]parse.NodeType{"Expr": parse.NodeType(arith.Expr), "Term": parse.NodeType(arith.Term), "Factor": parse.NodeType(arith.Factor)}
+	fields := strings.Fields(strings.NewReplacer("(", " ( ", ")", " ) ").Replace(spec))
+	parents := []parse.Node{tree.Root}
+	var last parse.Node
+	for _, f := range fields {
+		parent := parents[len(parents)-1]
+		switch typ, ok := types[f]; {
+		case f == "(":
+			parents = append(parents, last)
+		case f == ")":
+			parents[len(parents)-1].Commit()
+			parents = parents[:len(parents)-1]
+		case ok:
+			last = parent.AddNonTerminal(typ, nil)
+		default:
+			last = parent.AddTerminal(parse.NodeType(arith.Number), lex.NewToken(arith.TNumber, f, 0, 0, 1))
+			last.Commit()
+		}
+	}
+	tree.Root.Commit()
+	return tree
+}
+
+func TestDiff(t *testing.T) {
+	for _, c := range []struct {
+		a, b  string
+		edits []string
+		text  string
+	}{
+		{"Expr(Term(1 2))", "Expr(Term(1 2))", nil, `
+  RootNode
+    Expr
+      Term
+        Number: NumberToken("1")
+        Number: NumberToken("2")`},
+		{"Expr(Term(1) Term(2))", "Expr(Term(1) Term(3))",
+			[]string{`Relabel Number: NumberToken("2") -> Number: NumberToken("3")`}, `
+  RootNode
+    Expr
+      Term
+        Number: NumberToken("1")
+      Term
+~       Number: NumberToken("2") -> Number: NumberToken("3")`},
+		{"Expr(Term(1))", "Expr(Term(1) Factor(2))",
+			[]string{`Insert Number: NumberToken("2")`, `Insert Factor`}, `
+  RootNode
+    Expr
+      Term
+        Number: NumberToken("1")
++     Factor
++       Number: NumberToken("2")`},
+		//The children of a deleted node are moved up to its parent
+		{"Expr(Factor(Term(1) Term(2)))", "Expr(Term(1) Term(2))",
+			[]string{`Delete Factor`}, `
+  RootNode
+    Expr
+      Term
+        Number: NumberToken("1")
+      Term
+        Number: NumberToken("2")
+-     Factor`},
+		{"Expr(Term(1 2) Factor(3))", "Expr(Factor(3) Term(1 2))",
+			[]string{`Move Factor -> Factor`}, `
+  RootNode
+    Expr
+>     Factor
+        Number: NumberToken("3")
+      Term
+        Number: NumberToken("1")
+        Number: NumberToken("2")
+<     Factor`},
+		{"Expr(Term(Factor(1 2) 5) Term(6))", "Expr(Term(5) Term(6 Factor(1 2)))",
+			[]string{`Move Factor -> Factor`}, `
+  RootNode
+    Expr
+      Term
+        Number: NumberToken("5")
+<       Factor
+      Term
+        Number: NumberToken("6")
+>       Factor
+          Number: NumberToken("1")
+          Number: NumberToken("2")`},
+	} {
+		a, b := specTree(c.a), specTree(c.b)
+		script := parse.DiffNodes(a.Root, b.Root, parse.EqualOptions{IgnorePositions: true})
+		var edits []string
+		for _, e := range script.Edits {
+			edits = append(edits, e.String())
+		}
+		if strings.Join(edits, "\n") != strings.Join(c.edits, "\n") || script.Empty() != (len(c.edits) == 0) {
+			t.Errorf("%s -> %s: the edits are\n%s\nexpected\n%s", c.a, c.b, strings.Join(edits, "\n"), strings.Join(c.edits, "\n"))
+		}
+		if text := script.String(); text != c.text[1:] {
+			t.Errorf("%s -> %s: the script is\n%s\nexpected\n%s", c.a, c.b, text, c.text[1:])
+		}
+	}
+}
+
+//TestDiffMinimal checks that the scripts of Zhang and Shasha are as short as the tree edit distance,
+//on copies of a tree with a few nodes relabeled, deleted or inserted
+func TestDiffMinimal(t *testing.T) {
+	a := specTree("Expr(Term(1 Factor(2 3)) Term(4) Factor(Term(5)))")
+	for spec, distance := range map[string]int{
+		"Expr(Term(1 Factor(2 3)) Term(4) Factor(Term(5)))": 0,
+		"Expr(Term(1 Factor(2 3)) Term(4) Factor(5))":       1,
+		"Expr(Term(1 Factor(2 3)) Term(4) Term(Term(5)))":   1,
+		"Expr(Term(1 2 3) Term(4) Factor(Term(5)))":         1,
+		"Expr(Term(1 Factor(2 3)) Factor(Term(5)))":         2,
+		"Expr(Term(9 Factor(2 8)) Term(4) Factor(Term(7)))": 3,
+	} {
+		script := parse.DiffNodes(a.Root, specTree(spec).Root, parse.EqualOptions{IgnorePositions: true})
+		if len(script.Edits) != distance {
+			t.Errorf("%s is %d edits away, expected %d:\n%s", spec, len(script.Edits), distance, script)
+		}
+	}
+}
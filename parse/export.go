@@ -0,0 +1,219 @@
+package parse
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"kugg/compilers/lex"
+	"kugg/compilers/symbol"
+	"strconv"
+	"strings"
+)
+
+//The exporters in this file write trees directly to an io.Writer while walking them,
+//using the names in NodeNames and lex.TokenNames.
+
+//exportTop picks the node a tree is exported from, the same way as SerializeTree
+func exportTop(tree *Tree, flags SerializeFlags) Node {
+	children := tree.Root.Children()
+	if len(children) == 1 && !(flags&WithStatus != 0 && tree.Root.Status() == FullyParsed) {
+		return children[0]
+	}
+	return tree.Root
+}
+
+func tokenName(typ lex.TokenType) string {
+	if name, ok := lex.TokenNames[typ]; ok {
+		return name
+	}
+	return fmt.Sprintf("TokenType(%d)", int(typ))
+}
+
+//WriteJSON writes a tree as JSON, with the same properties as SerializeTree.
+//
+//Since YAML is a superset of JSON, the output can be read back with DeserializeTree.
+func WriteJSON(w io.Writer, tree *Tree, flags SerializeFlags) error {
+	bw := bufio.NewWriter(w)
+	var scopeIds map[*symbol.Table]int
+	if flags&WithScopes != 0 {
+		scopeIds = make(map[*symbol.Table]int)
+		for i, scope := range tree.Root.Scope().Scopes() {
+			scopeIds[scope] = i
+		}
+	}
+	writeJSONNode(bw, exportTop(tree, flags), flags, scopeIds)
+	bw.WriteByte('\n')
+	return bw.Flush()
+}
+
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+func writeJSONNode(w *bufio.Writer, n Node, flags SerializeFlags, scopeIds map[*symbol.Table]int) {
+	w.WriteString(`{"node":`)
+	if name, ok := NodeNames[n.Type()]; ok {
+		w.WriteString(jsonString(name))
+	} else {
+		w.WriteString(strconv.Itoa(int(n.Type())))
+	}
+
+	if tok := n.Token(); n.IsTerminal() && tok != nil {
+		w.WriteString(`,"token":`)
+		if name, ok := lex.TokenNames[tok.Type()]; ok {
+			w.WriteString(jsonString(name))
+		} else {
+			w.WriteString(strconv.Itoa(int(tok.Type())))
+		}
+		if tok.Lexeme() != "" {
+			w.WriteString(`,"lexeme":`)
+			w.WriteString(jsonString(tok.Lexeme()))
+		}
+		if flags&WithSpans != 0 {
+			fmt.Fprintf(w, `,"span":{"pos":%d,"line":%d,"row":%d}`, tok.Pos(), tok.Line(), tok.Row())
+		}
+	}
+	if flags&WithStatus != 0 {
+		if n.Status() == FullyParsed {
+			w.WriteString(`,"status":"FullyParsed"`)
+		} else {
+			w.WriteString(`,"status":"Speculative"`)
+		}
+	}
+	if flags&WithScopes != 0 {
+		if id, ok := scopeIds[n.Scope()]; ok {
+			fmt.Fprintf(w, `,"scope":%d`, id)
+		}
+		if sym := n.Symbol(); sym != nil {
+			fmt.Fprintf(w, `,"symbol":%d`, sym.GlobalId)
+		}
+	}
+
+	if names, values := encodedAttributes(n); len(names) > 0 {
+		w.WriteString(`,"attributes":{`)
+		for i := range names {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(jsonString(names[i]))
+			w.WriteByte(':')
+			w.WriteString(jsonString(values[i]))
+		}
+		w.WriteByte('}')
+	}
+
+	if children := n.Children(); len(children) > 0 {
+		w.WriteString(`,"children":[`)
+		for i, child := range children {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			writeJSONNode(w, child, flags, scopeIds)
+		}
+		w.WriteByte(']')
+	}
+	w.WriteByte('}')
+}
+
+//WriteSExpr writes a tree as a single line S-expression, starting from the same node as SerializeTree.
+//
+//Nonterminals are written as (Type children...) and terminals as (Type TokenType "lexeme").
+//This is also the syntax of the patterns of the rewrite package.
+func WriteSExpr(w io.Writer, tree *Tree) error {
+	bw := bufio.NewWriter(w)
+	writeSExprNode(bw, exportTop(tree, 0))
+	bw.WriteByte('\n')
+	return bw.Flush()
+}
+
+//SExpr returns the S-expression of a subtree, see WriteSExpr
+func SExpr(n Node) string {
+	var sb strings.Builder
+	bw := bufio.NewWriter(&sb)
+	writeSExprNode(bw, n)
+	bw.Flush()
+	return sb.String()
+}
+
+func writeSExprNode(w *bufio.Writer, n Node) {
+	w.WriteByte('(')
+	w.WriteString(n.Type().String())
+	if tok := n.Token(); n.IsTerminal() && tok != nil {
+		w.WriteByte(' ')
+		w.WriteString(tokenName(tok.Type()))
+		w.WriteByte(' ')
+		w.WriteString(strconv.Quote(tok.Lexeme()))
+	}
+	for _, child := range n.Children() {
+		w.WriteByte(' ')
+		writeSExprNode(w, child)
+	}
+	w.WriteByte(')')
+}
+
+//WriteDOT writes a tree as a Graphviz digraph.
+//
+//Nonterminals are boxes labeled with their type, terminals are ellipses also labeled
+//with their token type and lexeme. With WithSpans terminals are also labeled with their position.
+//With WithScopes every symbol is drawn as a note, with a dashed edge from the nodes it is attached to.
+func WriteDOT(w io.Writer, tree *Tree, flags SerializeFlags) error {
+	bw := bufio.NewWriter(w)
+	d := dotWriter{w: bw, flags: flags, symbols: make(map[*symbol.Symbol]int)}
+	fmt.Fprintf(bw, "digraph %s {\n", dotString(tree.name))
+	bw.WriteString("\tnode [shape=box];\n")
+	d.node(tree.Root)
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
+
+type dotWriter struct {
+	w       *bufio.Writer
+	flags   SerializeFlags
+	nextId  int
+	symbols map[*symbol.Symbol]int //Ids of the symbols already written, which don't have global ids before ResolveGlobalIds
+}
+
+//node writes a node and its subtree, and returns the id of the node
+func (d *dotWriter) node(n Node) int {
+	id := d.nextId
+	d.nextId++
+
+	label := n.Type().String()
+	shape := ""
+	if tok := n.Token(); n.IsTerminal() && tok != nil {
+		label += "\n" + tokenName(tok.Type()) + " " + strconv.Quote(tok.Lexeme())
+		if d.flags&WithSpans != 0 {
+			label += fmt.Sprintf("\n%d:%d", tok.Line(), tok.Row())
+		}
+		shape = " shape=ellipse"
+	}
+	style := ""
+	if d.flags&WithStatus != 0 && n.Status() == Speculative {
+		style = " style=dotted"
+	}
+	fmt.Fprintf(d.w, "\tn%d [label=%s%s%s];\n", id, dotString(label), shape, style)
+
+	if sym := n.Symbol(); sym != nil && d.flags&WithScopes != 0 {
+		symId, ok := d.symbols[sym]
+		if !ok {
+			symId = len(d.symbols)
+			d.symbols[sym] = symId
+			fmt.Fprintf(d.w, "\ts%d [label=%s shape=note];\n", symId, dotString(fmt.Sprintf("%s #%d", sym.Name, sym.GlobalId)))
+		}
+		fmt.Fprintf(d.w, "\tn%d -> s%d [style=dashed];\n", id, symId)
+	}
+
+	for _, child := range n.Children() {
+		childId := d.node(child)
+		fmt.Fprintf(d.w, "\tn%d -> n%d;\n", id, childId)
+	}
+	return id
+}
+
+//dotString quotes a string for DOT, where \n in a label is a line break
+func dotString(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,80 @@
+package parse_test
+
+import (
+	"bytes"
+	"flag"
+	"kugg/compilers/Gparse/arith"
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of testdata")
+
+//unresolvedTree returns a tree with two symbols whose global ids are not resolved yet, so both are 0
+func unresolvedTree() *parse.Tree {
+	tree := parse.NewTree("unresolved", "", nil)
+	a := tree.Root.AddNonTerminal(parse.NodeType(arith.Expr), nil)
+	a.CreateSymbol("a")
+	b := a.AddTerminal(parse.NodeType(arith.Number), lex.NewToken(arith.TNumber, "1", 0, 0, 1))
+	b.CreateSymbol("b")
+	b.Commit()
+	a.Commit()
+	return tree
+}
+
+//golden compares an export with the file testdata/name, which -update rewrites
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.MkdirAll("testdata", 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run the test with -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("the export differs from %s:\n%s", path, got)
+	}
+}
+
+func TestExport(t *testing.T) {
+	const flags = parse.WithSpans | parse.WithStatus | parse.WithScopes
+	for _, tree := range []*parse.Tree{handBuilt(), scopedTree(), unresolvedTree()} {
+		var json, sexpr, dot bytes.Buffer
+		if err := parse.WriteJSON(&json, tree, flags); err != nil {
+			t.Fatal(err)
+		}
+		if err := parse.WriteSExpr(&sexpr, tree); err != nil {
+			t.Fatal(err)
+		}
+		if err := parse.WriteDOT(&dot, tree, flags); err != nil {
+			t.Fatal(err)
+		}
+		golden(t, tree.Name()+".json", json.Bytes())
+		golden(t, tree.Name()+".sexpr", sexpr.Bytes())
+		golden(t, tree.Name()+".dot", dot.Bytes())
+
+		//JSON is read back as YAML
+		back := parse.DeserializeTree(parse.NodeNames, lex.TokenNames, json.Bytes())
+		if !parse.Equal(tree, back, parse.EqualOptions{}) {
+			t.Errorf("the JSON of %s does not read back:\n%s", tree.Name(), json.String())
+		}
+	}
+
+	var dot bytes.Buffer
+	parse.WriteDOT(&dot, unresolvedTree(), parse.WithScopes)
+	if n := strings.Count(dot.String(), "shape=note"); n != 2 {
+		t.Errorf("two symbols without global ids are drawn as %d:\n%s", n, dot.String())
+	}
+}
@@ -0,0 +1,287 @@
+package parse
+
+import (
+	"fmt"
+	"kugg/compilers/lex"
+	"kugg/compilers/symbol"
+	"log/slog"
+)
+
+//TextEdit replaces the source text between Start and End with Text
+type TextEdit struct {
+	Start, End int
+	Text       string
+}
+
+//Incremental parses a source again after edits, lexing only the tokens around each edit,
+//and reusing the subtrees of the previous tree made of tokens outside of it.
+//
+//Subtrees are only reused where the parser asks for them with Tree.Reuse.
+//Reused subtrees must not contain symbols or nested scopes, since they are not rebuilt.
+type Incremental struct {
+	Name      string
+	LexStart  lex.StateFn
+	ParseFn   ParseFn
+	Lookahead int          //The number of tokens after a node the parser may have looked at to end it
+	Check     bool         //Check parses every edit fully as well, and returns a MismatchError if the results differ
+	Logger    *slog.Logger //The Logger of the trees
+
+	Reused int //The number of subtrees reused by the last parse
+
+	lexed *lex.Lexed
+	tree  *Tree
+	err   error
+}
+
+//NewIncremental creates an Incremental parser for a lexer and parser, with a lookahead of one token
+func NewIncremental(name string, lexStart lex.StateFn, parseFn ParseFn) *Incremental {
+	return &Incremental{Name: name, LexStart: lexStart, ParseFn: parseFn, Lookahead: 1}
+}
+
+//Tree returns the last tree parsed
+func (inc *Incremental) Tree() *Tree {
+	return inc.tree
+}
+
+//Source returns the source of the last tree parsed
+func (inc *Incremental) Source() string {
+	if inc.lexed == nil {
+		return ""
+	}
+	return inc.lexed.Source
+}
+
+//Parse parses a whole source, and remembers it for the following edits
+func (inc *Incremental) Parse(source string) (*Tree, error) {
+	inc.lexed = lex.LexAll(inc.Name, source, inc.LexStart)
+	inc.tree = NewTree(inc.Name, source, inc.ParseFn)
+	inc.tree.Logger = inc.Logger
+	inc.err = inc.tree.Parse(inc.lexed.Lexer())
+	inc.Reused = 0
+	return inc.tree, inc.err
+}
+
+//Apply edits the source of the last tree, and parses it again
+func (inc *Incremental) Apply(e TextEdit) (*Tree, error) {
+	if inc.lexed == nil {
+		return nil, fmt.Errorf("Nothing to edit. Call Parse first.")
+	}
+	if e.Start < 0 || e.Start > e.End || e.End > len(inc.lexed.Source) {
+		return nil, fmt.Errorf("Edit [%d,%d) is out of range, the source has length %d.", e.Start, e.End, len(inc.lexed.Source))
+	}
+	lexed, window := inc.lexed.Edit(e.Start, e.End, e.Text)
+
+	tree := NewTree(inc.Name, lexed.Source, inc.ParseFn)
+	tree.Logger = inc.Logger
+	if inc.err == nil {
+		tree.reuse = newReuseState(inc, window, lexed.Tokens)
+	}
+	err := tree.Parse(lexed.Lexer())
+	if tree.reuse != nil {
+		inc.Reused = tree.reuse.reused
+		tree.reuse = nil
+	}
+	inc.lexed, inc.tree, inc.err = lexed, tree, err
+
+	if inc.Check {
+		if cerr := inc.check(); cerr != nil {
+			return tree, cerr
+		}
+	}
+	return tree, err
+}
+
+//MismatchError is returned in Check mode when an incremental parse differs from a full parse
+type MismatchError struct {
+	Msg string
+}
+
+func (e *MismatchError) Error() string {
+	return e.Msg
+}
+
+func mismatchf(format string, args ...interface{}) error {
+	return &MismatchError{fmt.Sprintf(format, args...)}
+}
+
+//check compares the last tree with a full parse of its source
+func (inc *Incremental) check() error {
+	source := inc.lexed.Source
+	full := lex.Lex(inc.Name, source)
+	full.Run(inc.LexStart)
+	tree := NewTree(inc.Name, source, inc.ParseFn)
+	err := tree.Parse(full)
+	go full.Drain()
+
+	if fmt.Sprint(err) != fmt.Sprint(inc.err) {
+		return mismatchf("Incremental parse error %v differs from full parse error %v.", inc.err, err)
+	}
+	lexed := lex.LexAll(inc.Name, source, inc.LexStart)
+	if len(lexed.Tokens) != len(inc.lexed.Tokens) {
+		return mismatchf("Incremental lexing gave %d tokens, full lexing %d.", len(inc.lexed.Tokens), len(lexed.Tokens))
+	}
+	for i, t := range lexed.Tokens {
+		it := inc.lexed.Tokens[i]
+		if t.Type() != it.Type() || t.Lexeme() != it.Lexeme() || t.Pos() != it.Pos() || t.Line() != it.Line() || t.Row() != it.Row() {
+			return mismatchf("Incremental lexing gave token %d as %v, full lexing as %v.", i, it, t)
+		}
+	}
+	if !Equal(inc.tree, tree, EqualOptions{}) {
+		return mismatchf("Incremental parse differs from full parse:\n%s", Diff(tree, inc.tree))
+	}
+	return nil
+}
+
+//reuseState finds the subtrees of the previous tree which can be reused
+type reuseState struct {
+	window    lex.Window
+	lookahead int
+	old       map[int][]*baseNode //Reusable nonterminals of the old tree, by the index of their first token
+	last      map[*baseNode]int   //Index of the last token of each reusable nonterminal
+	newTokens []lex.Token
+	oldIndex  map[lex.Token]int //Index of each token of the old tree
+	reused    int
+}
+
+func newReuseState(inc *Incremental, window lex.Window, newTokens []lex.Token) *reuseState {
+	r := &reuseState{
+		window:    window,
+		lookahead: inc.Lookahead,
+		old:       make(map[int][]*baseNode),
+		last:      make(map[*baseNode]int),
+		newTokens: newTokens,
+		oldIndex:  make(map[lex.Token]int),
+	}
+	for i, t := range inc.lexed.Tokens {
+		r.oldIndex[t] = i
+	}
+	r.index(inc.tree.Root)
+	return r
+}
+
+//index records the reusable nonterminals of a subtree, and returns the indices of its first and last token
+func (r *reuseState) index(n Node) (first, last int, ok bool) {
+	b, isBase := n.(*baseNode)
+	if !isBase {
+		return 0, 0, false
+	}
+	if b.isTerminal {
+		i, found := r.oldIndex[b.token]
+		return i, i, found
+	}
+	first, last, ok = -1, -1, true
+	for _, c := range b.Children() {
+		f, l, cok := r.index(c)
+		ok = ok && cok
+		if first < 0 {
+			first = f
+		}
+		if l > last {
+			last = l
+		}
+	}
+	if len(b.Children()) == 0 {
+		return first, last, false
+	}
+	reusable := ok && b.parseStatus == FullyParsed && b.typ != RootNode && symbolFree(b, b.scope)
+	if reusable {
+		r.old[first] = append(r.old[first], b)
+		r.last[b] = last
+	}
+	return first, last, ok
+}
+
+//symbolFree reports whether a subtree has no symbols and no scopes of its own
+func symbolFree(n Node, scope *symbol.Table) bool {
+	b, ok := n.(*baseNode)
+	if !ok || b.scope != scope || b.symbol != nil {
+		return false
+	}
+	for _, c := range b.Children() {
+		if !symbolFree(c, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+//Reuse tries to reuse a subtree of the previous tree of an Incremental parse.
+//
+//Call it where a node of a type is about to be parsed. If the previous tree had a node of the type
+//starting at the next token, which is made of tokens that are not affected by the edit, a copy of it
+//is added to the current node, the tokens it covers are consumed, and Reuse returns true.
+//Otherwise, and outside of an incremental parse, Reuse returns false and the node should be parsed.
+//
+//Only reuse nodes whose parse does not depend on what was parsed before them.
+func (tree *Tree) Reuse(typ NodeType) bool {
+	r := tree.reuse
+	if r == nil || tree.Curr == nil {
+		return false
+	}
+	next := tree.Pos + 1
+	w := r.window
+	var oldNext int
+	switch {
+	case next < w.Start:
+		oldNext = next
+	case next >= w.NewEnd:
+		oldNext = next - w.NewEnd + w.End
+	default:
+		return false
+	}
+
+	for _, n := range r.old[oldNext] {
+		if n.typ != typ {
+			continue
+		}
+		last := r.last[n]
+		if oldNext < w.Start && last+r.lookahead >= w.Start {
+			continue
+		}
+		newLast := last
+		if oldNext >= w.End {
+			newLast = last - w.End + w.NewEnd
+		}
+		if newLast >= len(r.newTokens) {
+			continue
+		}
+
+		for len(tree.Buffer) <= newLast {
+			tree.Buffer = append(tree.Buffer, tree.lexer.NextToken())
+		}
+		tree.Pos = newLast
+		tree.Curr.AddChild(r.adopt(n, tree, oldNext, next))
+		r.reused++
+		return true
+	}
+	return false
+}
+
+//adopt copies an old subtree into a new tree, with the tokens of the new tree
+func (r *reuseState) adopt(n *baseNode, tree *Tree, oldFirst, newFirst int) Node {
+	c := tree.newNode()
+	*c = baseNode{
+		typ:         n.typ,
+		arena:       c.arena,
+		id:          c.id,
+		tree:        tree,
+		token:       n.token,
+		isTerminal:  n.isTerminal,
+		parseStatus: n.parseStatus,
+		scope:       tree.CurrScope,
+	}
+	if i, ok := r.oldIndex[n.token]; ok {
+		if j := i - oldFirst + newFirst; j >= 0 && j < len(r.newTokens) {
+			c.token = r.newTokens[j]
+		}
+	}
+	if !n.isTerminal {
+		if c.arena == nil {
+			c.children = make([]Node, 0, len(n.Children()))
+		}
+		for _, child := range n.Children() {
+			c.appendChild(r.adopt(child.(*baseNode), tree, oldFirst, newFirst))
+		}
+	}
+	return c
+}
@@ -0,0 +1,110 @@
+package parse_test
+
+import (
+	"kugg/compilers/Gparse/arith"
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+	"kugg/compilers/parse/parsetest"
+	"testing"
+)
+
+//factors is a list of arithmetic factors, like (1 + 2) -3 4, whose factors are parsed
+//alike wherever they are, so they can be reused
+const factors parse.NodeType = 4300
+
+func init() {
+	parse.NodeNames[factors] = "Factors"
+}
+
+func parseFactors(t *parse.Tree) {
+	parent := t.Curr
+	n := t.AddNonTerminal(factors, t.Peek())
+	t.Curr = n
+	for t.Peek().Type() != lex.EOF_Token {
+		if !t.Reuse(parse.NodeType(arith.Factor)) {
+			parseFactor(t)
+		}
+	}
+	n.Commit()
+	t.Curr = parent
+}
+
+//parseOperation parses operands separated by the operators of two token types
+func parseOperation(t *parse.Tree, typ parse.NodeType, operand func(*parse.Tree), ops map[lex.TokenType]parse.NodeType) {
+	parent := t.Curr
+	n := t.AddNonTerminal(typ, t.Peek())
+	t.Curr = n
+	operand(t)
+	for {
+		op, ok := ops[t.Peek().Type()]
+		if !ok {
+			break
+		}
+		t.AddTerminal(op, t.Next()).Commit()
+		operand(t)
+	}
+	n.Commit()
+	t.Curr = parent
+}
+
+func parseExpr(t *parse.Tree) {
+	parseOperation(t, parse.NodeType(arith.Expr), parseTerm,
+		map[lex.TokenType]parse.NodeType{arith.TPlus: parse.NodeType(arith.Plus), arith.TMinus: parse.NodeType(arith.Minus)})
+}
+
+func parseTerm(t *parse.Tree) {
+	parseOperation(t, parse.NodeType(arith.Term), parseFactor,
+		map[lex.TokenType]parse.NodeType{arith.TTimes: parse.NodeType(arith.Times), arith.TDivide: parse.NodeType(arith.Divide)})
+}
+
+func parseFactor(t *parse.Tree) {
+	parent := t.Curr
+	n := t.AddNonTerminal(parse.NodeType(arith.Factor), t.Peek())
+	t.Curr = n
+	switch tok := t.Next(); tok.Type() {
+	case arith.TLParen:
+		t.AddTerminal(parse.NodeType(arith.LParen), tok).Commit()
+		parseExpr(t)
+		if tok := t.Next(); tok.Type() != arith.TRParen {
+			t.Unexpected(tok, ")")
+		}
+		t.AddTerminal(parse.NodeType(arith.RParen), t.CurrentToken()).Commit()
+	case arith.TMinus:
+		t.AddTerminal(parse.NodeType(arith.Minus), tok).Commit()
+		parseFactor(t)
+	case arith.TNumber:
+		t.AddTerminal(parse.NodeType(arith.Number), tok).Commit()
+	default:
+		t.Unexpected(tok, parse.OneOf{"(", "-", "a number"})
+	}
+	n.Commit()
+	t.Curr = parent
+}
+
+const factorsSource = "(1 + 2) -3 4\n(5 * (6 - 7)) 8 (9 / 3)\n"
+
+func TestIncrementalReuse(t *testing.T) {
+	inc := parse.NewIncremental("factors", arith.LexAny, parseFactors)
+	inc.Check = true
+	if _, err := inc.Parse(factorsSource); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := inc.Apply(parse.TextEdit{Start: 9, End: 10, Text: "42"}); err != nil {
+		t.Fatal(err)
+	}
+	if inc.Source() != "(1 + 2) -42 4\n(5 * (6 - 7)) 8 (9 / 3)\n" {
+		t.Fatalf("wrong source after the edit: %q", inc.Source())
+	}
+	if inc.Reused == 0 {
+		t.Errorf("no factors were reused after editing one")
+	}
+}
+
+//TestIncrementalRandomEdits compares incremental parses after random edits with full parses
+func TestIncrementalRandomEdits(t *testing.T) {
+	fragments := []string{"1", "23", " ", "\n", "(", ")", "+", "-", "*", "/", "(4)", "- 5", "6 *"}
+	for seed := int64(1); seed <= 100; seed++ {
+		inc := parse.NewIncremental("factors", arith.LexAny, parseFactors)
+		parsetest.RandomEdits(t, inc, factorsSource, fragments, 40, seed)
+	}
+}
@@ -0,0 +1,46 @@
+/*
+Package lower converts parse trees into abstract syntax trees made of Go structs.
+
+Every NodeType that should become an AST node is registered with a Go struct type.
+When a node is lowered, the punctuation among its children is dropped, the children of
+list productions are spliced in, and what remains fills the fields of the struct in order:
+
+	type Call struct {
+		Func string
+		Args []Expr
+		Span parse.Span
+	}
+
+	l := lower.New()
+	l.Punctuation(Punct)
+	l.List(Args)
+	l.Register(CallNode, (*Call)(nil))
+
+	ast, err := l.Lower(tree.Root)
+
+A field takes the value of a child by its type:
+string, integer, float and bool fields take the lexeme of a terminal, parse.Node and
+lex.Token fields take the child itself or its token, and other fields take the lowered
+child, which must be assignable to the field. A slice field takes all remaining children.
+Fields of type parse.Span are set to the span of the node.
+
+The lower struct tag changes which child a field takes, or what it is set to:
+
+	`lower:"-"`        //The field is left alone
+	`lower:"#1"`       //The second remaining child
+	`lower:"Ident"`    //The first child of type Ident, or for a slice all of them
+	`lower:"lexeme"`   //The lexeme of the node itself
+	`lower:"token"`    //The token of the node itself
+	`lower:"node"`     //The node itself
+	`lower:"span"`     //The span of the node
+	`lower:",optional"` //The child may be missing, leaving the zero value
+
+Every child is taken by at most one field, so an index naming a child that an earlier
+field already took is an Error.
+
+Nodes that are not registered are lowered to their lexeme if they are terminals, or to
+their only remaining child, so chain productions such as parenthesized expressions
+disappear. Any other node that does not match the shape of its struct is reported as an
+Error, with the path of the node.
+*/
+package lower
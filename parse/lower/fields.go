@@ -0,0 +1,97 @@
+package lower
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+//structType is a registered struct type with its parsed lower tags
+type structType struct {
+	typ     reflect.Type //The struct type
+	pointer bool         //Whether nodes are lowered to pointers
+	fields  []field
+}
+
+type fieldKind int
+
+const (
+	positional fieldKind = iota //Takes the next remaining child
+	byIndex                     //Takes a remaining child by index
+	byType                      //Takes the first child of a node type, or for a slice all of them
+	self                        //Describes the node itself
+)
+
+type field struct {
+	index    int          //Index of the field in the struct
+	name     string       //Name of the field, for errors
+	owner    reflect.Type //The struct type, for errors
+	kind     fieldKind
+	child    int    //For byIndex
+	nodeType string //For byType, the name of the node type
+	what     string //For self: span, node, token or lexeme
+	slice    bool   //Whether the field takes several children
+	optional bool
+}
+
+func newStructType(t reflect.Type) (*structType, error) {
+	if t == nil {
+		return nil, fmt.Errorf("not a struct type")
+	}
+	st := &structType{typ: t}
+	if t.Kind() == reflect.Ptr {
+		st.typ, st.pointer = t.Elem(), true
+	}
+	if st.typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("not a struct type")
+	}
+
+	for i := 0; i < st.typ.NumField(); i++ {
+		sf := st.typ.Field(i)
+		tag, hasTag := sf.Tag.Lookup("lower")
+		if tag == "-" || sf.PkgPath != "" {
+			continue
+		}
+		f := field{index: i, name: sf.Name, owner: st.typ}
+		name, opts := tag, ""
+		if c := strings.IndexByte(tag, ','); c >= 0 {
+			name, opts = tag[:c], tag[c+1:]
+		}
+		for _, opt := range strings.Split(opts, ",") {
+			switch opt {
+			case "":
+			case "optional":
+				f.optional = true
+			default:
+				return nil, fmt.Errorf("field %s: unknown option %q", sf.Name, opt)
+			}
+		}
+		f.slice = sf.Type.Kind() == reflect.Slice
+
+		switch {
+		case name == "span" || name == "node" || name == "token" || name == "lexeme":
+			f.kind, f.what = self, name
+		case !hasTag && sf.Type == spanType:
+			f.kind, f.what = self, "span"
+		case strings.HasPrefix(name, "#"):
+			n, err := strconv.Atoi(name[1:])
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("field %s: bad child index %q", sf.Name, name)
+			}
+			if f.slice {
+				return nil, fmt.Errorf("field %s: a slice can't take a child by index", sf.Name)
+			}
+			f.kind, f.child = byIndex, n
+		case name != "":
+			f.kind, f.nodeType = byType, name
+		default:
+			f.kind = positional
+		}
+		if f.kind == self {
+			f.slice = false
+		}
+		st.fields = append(st.fields, f)
+	}
+	return st, nil
+}
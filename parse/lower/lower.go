@@ -0,0 +1,322 @@
+package lower
+
+import (
+	"fmt"
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+//Lowerer holds the registered node types and converts parse trees into ASTs
+type Lowerer struct {
+	types map[parse.NodeType]*structType
+	punct map[parse.NodeType]bool
+	lists map[parse.NodeType]bool
+}
+
+//New creates a Lowerer without any registered types
+func New() *Lowerer {
+	return &Lowerer{
+		types: make(map[parse.NodeType]*structType),
+		punct: make(map[parse.NodeType]bool),
+		lists: make(map[parse.NodeType]bool),
+	}
+}
+
+//Punctuation declares node types which are dropped from the children of every node
+func (l *Lowerer) Punctuation(types ...parse.NodeType) {
+	for _, t := range types {
+		l.punct[t] = true
+	}
+}
+
+//List declares list productions, whose children are spliced into the children of their parent.
+//
+//Recursive lists such as Args -> Expr "," Args are flattened completely.
+//A list node which is lowered by itself becomes a []interface{} of its lowered elements.
+func (l *Lowerer) List(types ...parse.NodeType) {
+	for _, t := range types {
+		l.lists[t] = true
+	}
+}
+
+//Register maps a node type to a Go struct type, given by a nil pointer or a zero value of it.
+//
+//With a pointer, nodes are lowered to pointers to new structs, otherwise to struct values.
+//Register panics if the struct has an invalid lower tag.
+func (l *Lowerer) Register(typ parse.NodeType, proto interface{}) {
+	t := reflect.TypeOf(proto)
+	st, err := newStructType(t)
+	if err != nil {
+		panic(fmt.Sprintf("Can't register %v for %v: %v", t, typ, err))
+	}
+	l.types[typ] = st
+}
+
+//Error is a node which could not be lowered
+type Error struct {
+	Path string //Path of the node, see parse.Path
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("lower: %s: %s", e.Path, e.Msg)
+}
+
+func errorf(n parse.Node, format string, args ...interface{}) {
+	panic(&Error{Path: parse.Path(n), Msg: fmt.Sprintf(format, args...)})
+}
+
+//Lower converts a subtree. The result is what the root of the subtree was lowered to.
+func (l *Lowerer) Lower(n parse.Node) (v interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+	return l.lower(n), nil
+}
+
+//LowerAs converts a subtree and checks that the result has the expected type
+func LowerAs[T any](l *Lowerer, n parse.Node) (T, error) {
+	var zero T
+	v, err := l.Lower(n)
+	if err != nil {
+		return zero, err
+	}
+	t, ok := v.(T)
+	if !ok {
+		return zero, &Error{Path: parse.Path(n), Msg: fmt.Sprintf("lowered to %T, expected %T", v, zero)}
+	}
+	return t, nil
+}
+
+func (l *Lowerer) lower(n parse.Node) interface{} {
+	if st, ok := l.types[n.Type()]; ok {
+		return l.fill(st, n)
+	}
+	if n.IsTerminal() {
+		if n.Token() == nil {
+			errorf(n, "terminal without a token")
+		}
+		return n.Token().Lexeme()
+	}
+	children := l.significant(n)
+	if l.lists[n.Type()] {
+		list := make([]interface{}, len(children))
+		for i, c := range children {
+			list[i] = l.lower(c)
+		}
+		return list
+	}
+	if len(children) != 1 {
+		errorf(n, "no Go type registered for %v, which has %d children", n.Type(), len(children))
+	}
+	return l.lower(children[0])
+}
+
+//significant returns the children of a node without punctuation, with lists spliced in
+func (l *Lowerer) significant(n parse.Node) []parse.Node {
+	var result []parse.Node
+	for _, c := range n.Children() {
+		switch {
+		case l.punct[c.Type()]:
+		case l.lists[c.Type()] && !c.IsTerminal():
+			result = append(result, l.significant(c)...)
+		default:
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+//fill creates the struct of a node
+func (l *Lowerer) fill(st *structType, n parse.Node) interface{} {
+	ptr := reflect.New(st.typ)
+	s := ptr.Elem()
+	children := l.significant(n)
+	used := make([]bool, len(children))
+
+	take := func(f *field, i int) {
+		used[i] = true
+		l.set(f, s.Field(f.index), children[i])
+	}
+
+	//Fields selecting their children come first, so that the others take what is left in order
+	for i := range st.fields {
+		f := &st.fields[i]
+		switch f.kind {
+		case self:
+			l.setSelf(f, s.Field(f.index), n)
+		case byIndex:
+			if f.child < len(children) {
+				if used[f.child] {
+					errorf(n, "field %s of %v: child %d is already taken by another field", f.name, st.typ, f.child)
+				}
+				take(f, f.child)
+			} else if !f.optional {
+				errorf(n, "field %s of %v: no child %d, %v has %d children", f.name, st.typ, f.child, n.Type(), len(children))
+			}
+		case byType:
+			found := false
+			for i, c := range children {
+				if !used[i] && c.Type().String() == f.nodeType {
+					found = true
+					if f.slice {
+						l.appendTo(f, s.Field(f.index), c)
+						used[i] = true
+						continue
+					}
+					take(f, i)
+					break
+				}
+			}
+			if !found && !f.optional {
+				errorf(n, "field %s of %v: %v has no %s child", f.name, st.typ, n.Type(), f.nodeType)
+			}
+		}
+	}
+
+	next := 0
+	for i := range st.fields {
+		f := &st.fields[i]
+		if f.kind != positional {
+			continue
+		}
+		for next < len(children) && used[next] {
+			next++
+		}
+		if f.slice {
+			for ; next < len(children); next++ {
+				if !used[next] {
+					used[next] = true
+					l.appendTo(f, s.Field(f.index), children[next])
+				}
+			}
+			continue
+		}
+		if next == len(children) {
+			if !f.optional {
+				errorf(n, "field %s of %v: too few children, %v has %d", f.name, st.typ, n.Type(), len(children))
+			}
+			continue
+		}
+		take(f, next)
+	}
+
+	var extra []string
+	for i, c := range children {
+		if !used[i] {
+			extra = append(extra, c.Type().String())
+		}
+	}
+	if len(extra) > 0 {
+		errorf(n, "%v has children %s, which no field of %v takes", n.Type(), strings.Join(extra, ", "), st.typ)
+	}
+
+	if st.pointer {
+		return ptr.Interface()
+	}
+	return s.Interface()
+}
+
+//setSelf sets a field describing the node itself
+func (l *Lowerer) setSelf(f *field, v reflect.Value, n parse.Node) {
+	switch f.what {
+	case "span":
+		span, _ := parse.SpanOf(n)
+		v.Set(reflect.ValueOf(span))
+	case "node":
+		v.Set(reflect.ValueOf(&n).Elem())
+	case "token":
+		if tok := n.Token(); tok != nil {
+			v.Set(reflect.ValueOf(&tok).Elem())
+		}
+	case "lexeme":
+		if tok := n.Token(); tok != nil {
+			l.setLexeme(f, v, tok.Lexeme(), n)
+		}
+	}
+}
+
+//appendTo appends the value of a child to a slice field
+func (l *Lowerer) appendTo(f *field, v reflect.Value, c parse.Node) {
+	elem := reflect.New(v.Type().Elem()).Elem()
+	l.set(f, elem, c)
+	v.Set(reflect.Append(v, elem))
+}
+
+//set sets a field, or an element of a slice field, to the value of a child
+func (l *Lowerer) set(f *field, v reflect.Value, c parse.Node) {
+	switch v.Type() {
+	case nodeType:
+		v.Set(reflect.ValueOf(&c).Elem())
+		return
+	case tokenType:
+		tok := c.Token()
+		v.Set(reflect.ValueOf(&tok).Elem())
+		return
+	case spanType:
+		span, _ := parse.SpanOf(c)
+		v.Set(reflect.ValueOf(span))
+		return
+	}
+	switch v.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		if !c.IsTerminal() || c.Token() == nil {
+			errorf(c, "field %s of %v needs a terminal, got %v", f.name, f.owner, c.Type())
+		}
+		l.setLexeme(f, v, c.Token().Lexeme(), c)
+		return
+	}
+
+	lowered := l.lower(c)
+	lv := reflect.ValueOf(lowered)
+	if lowered == nil || !lv.Type().AssignableTo(v.Type()) {
+		errorf(c, "field %s of %v: can't use %v lowered to %T as %v", f.name, f.owner, c.Type(), lowered, v.Type())
+	}
+	v.Set(lv)
+}
+
+//setLexeme parses a lexeme into a field of a basic type
+func (l *Lowerer) setLexeme(f *field, v reflect.Value, lexeme string, n parse.Node) {
+	var err error
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(lexeme)
+	case reflect.Bool:
+		var b bool
+		b, err = strconv.ParseBool(lexeme)
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		i, err = strconv.ParseInt(lexeme, 0, v.Type().Bits())
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var u uint64
+		u, err = strconv.ParseUint(lexeme, 0, v.Type().Bits())
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		var x float64
+		x, err = strconv.ParseFloat(lexeme, v.Type().Bits())
+		v.SetFloat(x)
+	default:
+		errorf(n, "field %s: can't set %v from a lexeme", f.name, v.Type())
+	}
+	if err != nil {
+		errorf(n, "field %s: %v", f.name, err)
+	}
+}
+
+var (
+	nodeType  = reflect.TypeOf((*parse.Node)(nil)).Elem()
+	tokenType = reflect.TypeOf((*lex.Token)(nil)).Elem()
+	spanType  = reflect.TypeOf(parse.Span{})
+)
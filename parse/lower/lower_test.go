@@ -0,0 +1,211 @@
+package lower_test
+
+import (
+	"kugg/compilers/Gparse"
+	"kugg/compilers/Gparse/arith"
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+	"kugg/compilers/parse/lower"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var (
+	expr   = parse.NodeType(arith.Expr)
+	term   = parse.NodeType(arith.Term)
+	factor = parse.NodeType(arith.Factor)
+	number = parse.NodeType(arith.Number)
+)
+
+//Sum lowers an Expr, taking its children by type
+type Sum struct {
+	Terms []interface{} `lower:"Term"`
+	Ops   []string      `lower:"Plus,optional"`
+	Rest  *Sum          `lower:"Expr,optional"`
+}
+
+//Product lowers a Term, taking its children by index
+type Product struct {
+	Left  interface{} `lower:"#0"`
+	Op    lex.Token   `lower:"#1,optional"`
+	Right *Product    `lower:"#2,optional"`
+}
+
+//Num lowers a Number from the node itself
+type Num struct {
+	Value  int    `lower:"lexeme"`
+	Lexeme string `lower:"lexeme"`
+	Span   parse.Span
+	Node   parse.Node `lower:"node"`
+}
+
+func arithTree(t *testing.T, src string) parse.Node {
+	p, err := Gparse.NewParser(arith.Grammar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := p.Parse(src, src, arith.LexAny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree.Root.Children()[0]
+}
+
+func TestLower(t *testing.T) {
+	l := lower.New()
+	l.Punctuation(parse.NodeType(arith.LParen), parse.NodeType(arith.RParen))
+	l.Register(expr, (*Sum)(nil))
+	l.Register(term, (*Product)(nil))
+	l.Register(number, Num{})
+
+	root := arithTree(t, "1 + (2 * 34)")
+	sum, err := lower.LowerAs[*Sum](l, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sum.Terms) != 1 || !reflect.DeepEqual(sum.Ops, []string{"+"}) || sum.Rest == nil || sum.Rest.Rest != nil {
+		t.Fatalf("1 + (2 * 34) is lowered to %+v", sum)
+	}
+
+	//The unregistered Factor disappears, leaving the Num of its Number
+	one := sum.Terms[0].(*Product).Left.(Num)
+	if one.Value != 1 || one.Lexeme != "1" || one.Span != (parse.Span{Start: 0, End: 1, Line: 1, Row: 0}) || one.Node.Type() != number {
+		t.Errorf("1 is lowered to %+v", one)
+	}
+
+	//The parentheses are dropped, so the Factor of (2 * 34) is lowered to its Expr
+	inner := sum.Rest.Terms[0].(*Product).Left.(*Sum)
+	product := inner.Terms[0].(*Product)
+	if product.Op == nil || product.Op.Lexeme() != "*" || product.Right == nil || product.Right.Op != nil {
+		t.Fatalf("2 * 34 is lowered to %+v", product)
+	}
+	if n := product.Right.Left.(Num); n.Value != 34 || n.Span != (parse.Span{Start: 9, End: 11, Line: 1, Row: 9}) {
+		t.Errorf("34 is lowered to %+v", n)
+	}
+}
+
+func TestLowerList(t *testing.T) {
+	//Terms are lists, so the factors of a product are spliced into the outermost Term
+	l := lower.New()
+	l.Punctuation(parse.NodeType(arith.Times))
+	l.List(term)
+	v, err := l.Lower(arithTree(t, "1 * 2 * 3").Children()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, []interface{}{"1", "2", "3"}) {
+		t.Errorf("1 * 2 * 3 is lowered to %#v", v)
+	}
+}
+
+//Slices take the children left by the other fields
+type Operands struct {
+	Last  string        `lower:"#2,optional"`
+	Rest  []interface{} `lower:""`
+	Whole string        `lower:"-"`
+}
+
+func TestLowerSlice(t *testing.T) {
+	l := lower.New()
+	l.Register(factor, Operands{})
+	//Factor -> ( Expr ), where the Expr is lowered to the Operands of its Factor -> Number
+	v, err := l.Lower(arithTree(t, "(5)").Children()[0].Children()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := v.(Operands); got.Last != ")" || !reflect.DeepEqual(got.Rest, []interface{}{"(", Operands{Rest: []interface{}{"5"}}}) || got.Whole != "" {
+		t.Errorf("(5) is lowered to %+v", got)
+	}
+}
+
+type twice struct {
+	A string `lower:"#0"`
+	B string `lower:"#0"`
+}
+
+type typeThenIndex struct {
+	N string `lower:"Number"`
+	M string `lower:"#0"`
+}
+
+type missingIndex struct {
+	A string `lower:"#1"`
+}
+
+type missingType struct {
+	A string `lower:"Plus"`
+}
+
+type tooFew struct {
+	A, B string
+}
+
+type nothing struct{}
+
+type wrongType struct {
+	A *Sum
+}
+
+type badLexeme struct {
+	A bool
+}
+
+func TestLowerErrors(t *testing.T) {
+	for _, c := range []struct {
+		proto interface{}
+		src   string
+		err   string
+	}{
+		{twice{}, "1", "lower: RootNode/Expr[0]/Term[0]/Factor[0]: field B of lower_test.twice: child 0 is already taken by another field"},
+		{typeThenIndex{}, "1", "lower: RootNode/Expr[0]/Term[0]/Factor[0]: field M of lower_test.typeThenIndex: child 0 is already taken by another field"},
+		{missingIndex{}, "1", "lower: RootNode/Expr[0]/Term[0]/Factor[0]: field A of lower_test.missingIndex: no child 1, Factor has 1 children"},
+		{missingType{}, "1", "lower: RootNode/Expr[0]/Term[0]/Factor[0]: field A of lower_test.missingType: Factor has no Plus child"},
+		{tooFew{}, "1", "lower: RootNode/Expr[0]/Term[0]/Factor[0]: field B of lower_test.tooFew: too few children, Factor has 1"},
+		{nothing{}, "1", "lower: RootNode/Expr[0]/Term[0]/Factor[0]: Factor has children Number, which no field of lower_test.nothing takes"},
+		{wrongType{}, "1", "lower: RootNode/Expr[0]/Term[0]/Factor[0]/Number[0]: field A of lower_test.wrongType: can't use Number lowered to string as *lower_test.Sum"},
+		{badLexeme{}, "7", `lower: RootNode/Expr[0]/Term[0]/Factor[0]/Number[0]: field A: strconv.ParseBool: parsing "7": invalid syntax`},
+		{nothing{}, "-1", "lower: RootNode/Expr[0]/Term[0]/Factor[0]: Factor has children Minus, Factor, which no field of lower_test.nothing takes"},
+	} {
+		l := lower.New()
+		l.Register(factor, c.proto)
+		_, err := l.Lower(arithTree(t, c.src))
+		if _, ok := err.(*lower.Error); !ok || err.Error() != c.err {
+			t.Errorf("%T: lowering %s returned\n%v\nexpected\n%s", c.proto, c.src, err, c.err)
+		}
+	}
+
+	l := lower.New()
+	if _, err := lower.LowerAs[*Sum](l, arithTree(t, "1")); err == nil || err.Error() != "lower: RootNode/Expr[0]: lowered to string, expected *lower_test.Sum" {
+		t.Errorf("LowerAs returned %v", err)
+	}
+	_, err := l.Lower(arithTree(t, "1 + 2"))
+	if err == nil || !strings.Contains(err.Error(), "no Go type registered for Expr, which has 3 children") {
+		t.Errorf("lowering an unregistered node with several children returned %v", err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	for _, proto := range []interface{}{
+		struct {
+			A string `lower:"#x"`
+		}{},
+		struct {
+			A []string `lower:"#0"`
+		}{},
+		struct {
+			A string `lower:",often"`
+		}{},
+		7,
+		nil,
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("registering %T did not panic", proto)
+				}
+			}()
+			lower.New().Register(factor, proto)
+		}()
+	}
+}
@@ -58,8 +58,12 @@ type Node interface {
 	ReplaceChild(Node, Node)
 	RemoveChild(Node)
 	ReplaceWith(Node)
+	Clone() Node    //Clone returns a deep copy of the subtree, without a parent
 	setParent(Node) //setParent is called by the parents AddChild method
 
+	//attrs gives access to the typed attributes, see Key
+	attrs(create bool) map[attrKey]interface{}
+
 	AddNonTerminal(NodeType, lex.Token) Node
 	AddTerminal(NodeType, lex.Token) Node
 
@@ -84,38 +88,89 @@ const (
 type baseNode struct {
 	typ         NodeType
 	token       lex.Token
-	parent      Node
-	children    []Node
+	parent      Node   //The parent, unless it is in the same Arena
+	children    []Node //The children, unless the node is in an Arena
+	arena       *Arena //The Arena of the node, nil if it is on the heap
+	id          int32  //Index of the node in its Arena
+	parentId    int32  //Index of the parent in the Arena plus one, 0 if parent is used instead
+	kids        span   //The children of a node in an Arena
 	tree        *Tree
 	parseStatus parseStatus
 	isTerminal  bool
 	scope       *symbol.Table
 	symbol      *symbol.Symbol
+	attributes  map[attrKey]interface{}
 }
 
 //NewNonTerminal creates a new non-terminal node
 func NewNonTerminal(typ NodeType, firstToken lex.Token, tree *Tree) Node {
-	return &baseNode{
+	tree.Coverage.create(typ)
+	n := tree.newNode()
+	*n = baseNode{
 		typ:        typ,
+		arena:      n.arena,
+		id:         n.id,
 		tree:       tree,
 		token:      firstToken,
-		children:   make([]Node, 0, 0),
 		isTerminal: false,
 		scope:      tree.CurrScope,
 		symbol:     nil,
 	}
+	if n.arena == nil {
+		n.children = make([]Node, 0, 0)
+	}
+	return n
 }
 
 //NewTerminal creates a new terminal node
 func NewTerminal(typ NodeType, token lex.Token, tree *Tree) Node {
-	return &baseNode{
+	tree.Coverage.create(typ)
+	n := tree.newNode()
+	*n = baseNode{
 		typ:        typ,
+		arena:      n.arena,
+		id:         n.id,
 		tree:       tree,
 		token:      token,
 		isTerminal: true,
 		scope:      tree.CurrScope,
 		symbol:     nil,
 	}
+	return n
+}
+
+//newNode allocates a node in the Arena of the tree, or on the heap
+func (tree *Tree) newNode() *baseNode {
+	if tree.Arena != nil {
+		return tree.Arena.node()
+	}
+	return &baseNode{}
+}
+
+//Path describes the position of a node in its tree, e.g. RootNode/Program[0]/Call[2]
+//
+//Every node below the root is written as its type and its index among its siblings.
+func Path(n Node) string {
+	var parts []string
+	for ; n != nil; n = n.Parent() {
+		p := n.Parent()
+		if p == nil {
+			parts = append(parts, n.Type().String())
+			break
+		}
+		idx := -1
+		for i, c := range p.Children() {
+			if c == n {
+				idx = i
+				break
+			}
+		}
+		parts = append(parts, fmt.Sprintf("%v[%d]", n.Type(), idx))
+	}
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+	return strings.Join(parts, "/")
 }
 
 //panic because someone is trying to use a terminal node as a nonterminal node
@@ -130,11 +185,17 @@ func (b *baseNode) Type() NodeType {
 
 //Children returns nil, since terminal nodes have no children
 func (b *baseNode) Children() []Node {
+	if b.arena != nil {
+		return b.arena.children(b.kids)
+	}
 	return b.children
 }
 
 //Parent returns the Nodes parent
 func (b *baseNode) Parent() Node {
+	if b.parentId != 0 {
+		return b.arena.at(b.parentId - 1)
+	}
 	return b.parent
 }
 
@@ -206,8 +267,8 @@ func (n *baseNode) AddChild(child Node) {
 	if n.isTerminal {
 		n.noChildren("add")
 	} else {
-		n.children = append(n.children, child)
-		child.setParent(n)
+		n.appendChild(child)
+		n.tree.event(AddNode, child, child.Token(), "")
 	}
 }
 
@@ -216,10 +277,25 @@ func (n *baseNode) AddChildren(ns []Node) {
 	if n.isTerminal {
 		n.noChildren("add")
 	}
-	n.children = append(n.children, ns...)
+	if n.arena != nil {
+		n.kids = n.arena.grow(n.kids, len(ns))
+	}
 	for _, child := range ns {
-		child.setParent(n)
+		n.appendChild(child)
+		n.tree.event(AddNode, child, child.Token(), "")
+	}
+}
+
+//appendChild adds a child at the end of the children, without an event
+func (n *baseNode) appendChild(child Node) {
+	if n.arena != nil {
+		n.kids = n.arena.grow(n.kids, 1)
+		n.arena.kids[n.kids.first+n.kids.len] = child
+		n.kids.len++
+	} else {
+		n.children = append(n.children, child)
 	}
+	child.setParent(n)
 }
 
 //AddNonbase panics, since terminal nodes have no children
@@ -248,14 +324,22 @@ func (n *baseNode) RemoveChild(problemChild Node) {
 		n.noChildren("remove")
 	}
 
-	for i, c := range n.children {
+	for i, c := range n.Children() {
 		if c == problemChild {
-			n.children = append(n.children[:i], n.children[i+1:]...)
+			n.tree.event(RemoveNode, problemChild, problemChild.Token(), "")
+			if n.arena != nil {
+				children := n.arena.children(n.kids)
+				copy(children[i:], children[i+1:])
+				children[len(children)-1] = nil
+				n.kids.len--
+			} else {
+				n.children = append(n.children[:i], n.children[i+1:]...)
+			}
 			problemChild.setParent(nil)
 			return
 		}
 	}
-	n.tree.ErrorAtTokenf(n.Token(), "Cannot remove child %v. Node is not a child of %v.", n, n)
+	n.tree.ErrorAtTokenf(n.Token(), "Cannot remove child %v. Node is not a child of %v.", problemChild, n)
 
 }
 
@@ -265,11 +349,16 @@ func (n *baseNode) ReplaceChild(old Node, nu Node) {
 		n.noChildren("replace")
 	}
 
-	for i, c := range n.children {
-		if c == n {
-			n.children[i] = nu
+	for i, c := range n.Children() {
+		if c == old {
+			//The old node may already have been moved into the new subtree
+			if c.Parent() == Node(n) {
+				n.tree.event(RemoveNode, old, old.Token(), "")
+				c.setParent(nil)
+			}
+			n.Children()[i] = nu
 			nu.setParent(n)
-			c.setParent(nil)
+			n.tree.event(AddNode, nu, nu.Token(), "")
 			return
 		}
 	}
@@ -279,12 +368,36 @@ func (n *baseNode) ReplaceChild(old Node, nu Node) {
 
 //setParent is only used internally, call AddChild to link the two
 func (n *baseNode) setParent(p Node) {
-	n.parent = p
+	if pb, ok := p.(*baseNode); ok && n.arena != nil && pb.arena == n.arena {
+		n.parent, n.parentId = nil, pb.id+1
+		return
+	}
+	n.parent, n.parentId = p, 0
 }
 
 //ReplaceWith replaces the Node in the containing tree with another node
 func (n *baseNode) ReplaceWith(nu Node) {
-	n.parent.ReplaceChild(n, nu)
+	n.Parent().ReplaceChild(n, nu)
+}
+
+//Clone returns a deep copy of the subtree rooted at the node.
+//
+//Tokens, scopes, symbols and attribute values are shared with the original, the copy has no parent.
+func (n *baseNode) Clone() Node {
+	c := *n
+	c.parent, c.parentId = nil, 0
+	c.arena, c.id, c.kids = nil, 0, span{}
+	c.attributes = nil
+	CopyAttributes(&c, n)
+	if !n.isTerminal {
+		c.children = make([]Node, 0, len(n.Children()))
+		for _, child := range n.Children() {
+			cc := child.Clone()
+			c.children = append(c.children, cc)
+			cc.setParent(&c)
+		}
+	}
+	return &c
 }
 
 //END tree manipulation methods
@@ -292,12 +405,17 @@ func (n *baseNode) ReplaceWith(nu Node) {
 //Commit marks the node as fully parsed
 func (n *baseNode) Commit() {
 	n.parseStatus = FullyParsed
+	n.tree.event(CommitNode, n, n.token, "")
 }
 
-//CommitSubTree commits all the node and all its children
+//CommitSubTree commits all the node and all its children.
+//
+//Nodes which are already committed are skipped, so they are not reported as committed again.
 func (n *baseNode) CommitSubTree() {
-	n.parseStatus = FullyParsed
-	for _, child := range n.children {
+	if n.parseStatus != FullyParsed {
+		n.Commit()
+	}
+	for _, child := range n.Children() {
 		child.CommitSubTree()
 	}
 }
@@ -306,9 +424,10 @@ func (n *baseNode) CommitSubTree() {
 func (n *baseNode) RollBack() {
 	//TODO:possible memory leak if child nodes still have references somewhere
 	if n.parseStatus == Speculative {
+		n.tree.event(RollBackNode, n, n.token, "")
 		n.Parent().RemoveChild(n)
 	}
-	for _, child := range n.children {
+	for _, child := range n.Children() {
 		child.RollBack()
 	}
 
@@ -317,7 +436,7 @@ func (n *baseNode) RollBack() {
 //PPrint prints the tree indented, left to right
 func (n *baseNode) PPrint(indent int) {
 	fmt.Println(strings.Repeat("  ", indent), n)
-	for _, child := range n.children {
+	for _, child := range n.Children() {
 		child.PPrint(indent + 1)
 	}
 }
@@ -326,7 +445,7 @@ func (n *baseNode) PPrint(indent int) {
 func (n *baseNode) SPPrint(indent int) []string {
 	ret := make([]string, 1)
 	ret[0] = fmt.Sprintf("%s%v", strings.Repeat("  ", indent), n)
-	for _, child := range n.children {
+	for _, child := range n.Children() {
 		ret = append(ret, child.SPPrint(indent+1)...)
 	}
 	return ret
@@ -0,0 +1,123 @@
+/*
+Package parsetest provides helpers for testing parsers built on parse.
+
+Trees are compared with parse.Equal, and differences are reported as the
+annotated tree of parse.Diff instead of two long pretty prints.
+
+Golden files are in the YAML format of parse.SerializeTree. Golden rewrites them
+from the trees the parser produces when asked to, e.g. by an -update flag of the tests:
+
+	var update = flag.Bool("update", false, "rewrite the golden files")
+	...
+	parsetest.Golden(t, tree, "testdata/expr.yaml", parse.EqualOptions{}, *update)
+*/
+package parsetest
+
+import (
+	"fmt"
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//AssertEqual fails the test if the trees are not equal, and reports their differences
+func AssertEqual(t testing.TB, got, want *parse.Tree, opts parse.EqualOptions) {
+	t.Helper()
+	if parse.Equal(got, want, opts) {
+		return
+	}
+	t.Errorf("parse trees differ (+ only in got, - only in want):\n%v", parse.DiffOptions(want, got, opts))
+}
+
+//AssertSExpr fails the test if the S-expression of the tree, see parse.WriteSExpr, is not want.
+//
+//This is convenient for small trees, where a golden file would be overkill.
+func AssertSExpr(t testing.TB, got *parse.Tree, want string) {
+	t.Helper()
+	var sb strings.Builder
+	parse.WriteSExpr(&sb, got)
+	if s := strings.TrimSuffix(sb.String(), "\n"); s != want {
+		t.Errorf("parse tree differs:\ngot:  %s\nwant: %s", s, want)
+	}
+}
+
+//Golden compares a tree with the tree stored in a golden file.
+//
+//Positions and parse status are stored in the golden file unless opts ignores them.
+//With update the golden file is written instead, creating its directory if needed.
+func Golden(t testing.TB, got *parse.Tree, path string, opts parse.EqualOptions, update bool) {
+	t.Helper()
+
+	var flags parse.SerializeFlags
+	if !opts.IgnorePositions {
+		flags |= parse.WithSpans
+	}
+	if !opts.IgnoreStatus {
+		flags |= parse.WithStatus
+	}
+
+	if update {
+		text := parse.SerializeTree(parse.NodeNames, lex.TokenNames, got, flags)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("updating golden file: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatalf("updating golden file: %v", err)
+		}
+		return
+	}
+
+	text, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading golden file: %v (run the test with -update to create it)", err)
+	}
+	want := parse.DeserializeTree(parse.NodeNames, lex.TokenNames, text)
+	if parse.Equal(got, want, opts) {
+		return
+	}
+	t.Errorf("parse tree differs from golden file %s (+ only in got, - only in golden file):\n%v", path, parse.DiffOptions(want, got, opts))
+}
+
+//RandomEdits applies a reproducible sequence of random edits to a source with an incremental parser,
+//and fails the test at the first edit where the incremental parse differs from a full parse.
+//
+//Every edit removes a random part of the source, inserts one of the fragments, or both.
+func RandomEdits(t testing.TB, inc *parse.Incremental, source string, fragments []string, edits int, seed int64) {
+	t.Helper()
+	check := inc.Check
+	inc.Check = true
+	defer func() { inc.Check = check }()
+
+	rnd := rand.New(rand.NewSource(seed))
+	inc.Parse(source)
+	var log []string
+	for i := 0; i < edits; i++ {
+		src := inc.Source()
+		e := parse.TextEdit{Start: rnd.Intn(len(src) + 1)}
+		e.End = e.Start
+		if rnd.Intn(3) > 0 && e.Start < len(src) {
+			e.End += rnd.Intn(minInt(len(src)-e.Start, 8) + 1)
+		}
+		if len(fragments) > 0 && (e.End == e.Start || rnd.Intn(2) == 0) {
+			e.Text = fragments[rnd.Intn(len(fragments))]
+		}
+		log = append(log, fmt.Sprintf("%q -> %q", src, src[:e.Start]+e.Text+src[e.End:]))
+		if _, err := inc.Apply(e); err != nil {
+			if _, ok := err.(*parse.MismatchError); !ok {
+				continue
+			}
+			t.Fatalf("edit %d of seed %d: %v\nedits:\n%s", i, seed, err, strings.Join(log, "\n"))
+		}
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,88 @@
+package parsetest_test
+
+import (
+	"fmt"
+	"kugg/compilers/Gparse"
+	"kugg/compilers/Gparse/arith"
+	"kugg/compilers/parse"
+	"kugg/compilers/parse/parsetest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//recorder is a testing.TB which records failures instead of failing the test
+type recorder struct {
+	testing.TB
+	errors []string
+	fatal  bool
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.Errorf(format, args...)
+	r.fatal = true
+}
+
+func arithTree(t *testing.T, src string) *parse.Tree {
+	p, err := Gparse.NewParser(arith.Grammar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := p.Parse(src, src, arith.LexAny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func TestAssertEqual(t *testing.T) {
+	var r recorder
+	parsetest.AssertEqual(&r, arithTree(t, "1 + 2"), arithTree(t, "1 + 2"), parse.EqualOptions{})
+	parsetest.AssertEqual(&r, arithTree(t, "1 + 2"), arithTree(t, "1 +  3"), parse.EqualOptions{IgnorePositions: true, IgnoreLexemes: true})
+	if len(r.errors) != 0 {
+		t.Fatalf("equal trees failed: %v", r.errors)
+	}
+	parsetest.AssertEqual(&r, arithTree(t, "1 + 3"), arithTree(t, "1 + 2"), parse.EqualOptions{})
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], `~           Number: NumberToken("2") -> Number: NumberToken("3")`) {
+		t.Errorf("the differences are not reported as a diff: %v", r.errors)
+	}
+}
+
+func TestAssertSExpr(t *testing.T) {
+	var r recorder
+	parsetest.AssertSExpr(&r, arithTree(t, "7"), `(Expr (Term (Factor (Number NumberToken "7"))))`)
+	if len(r.errors) != 0 {
+		t.Fatalf("the S-expression differs: %v", r.errors)
+	}
+	parsetest.AssertSExpr(&r, arithTree(t, "7"), `(Expr)`)
+	if len(r.errors) != 1 {
+		t.Errorf("a different S-expression passed")
+	}
+}
+
+func TestGolden(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "golden", "expr.yaml")
+	var r recorder
+	parsetest.Golden(&r, arithTree(t, "1"), path, parse.EqualOptions{}, false)
+	if !r.fatal || !strings.Contains(r.errors[0], "-update") {
+		t.Fatalf("a missing golden file is not reported: %v", r.errors)
+	}
+
+	r = recorder{}
+	parsetest.Golden(&r, arithTree(t, "1 * (2)"), path, parse.EqualOptions{}, true)
+	parsetest.Golden(&r, arithTree(t, "1 * (2)"), path, parse.EqualOptions{}, false)
+	parsetest.Golden(&r, arithTree(t, "1 * ( 2 )"), path, parse.EqualOptions{IgnorePositions: true}, false)
+	if len(r.errors) != 0 {
+		t.Fatalf("the tree differs from the golden file written from it: %v", r.errors)
+	}
+	parsetest.Golden(&r, arithTree(t, "1 * ( 2 )"), path, parse.EqualOptions{}, false)
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], "differs from golden file") {
+		t.Errorf("moved tokens are not reported: %v", r.errors)
+	}
+}
@@ -0,0 +1,26 @@
+/*
+Package query implements a small selector language over parse.Node,
+in the spirit of CSS selectors.
+
+A selector is compiled once with Compile and can then be matched against
+any number of nodes and trees.
+
+	Call:has(> Identifier:first-child[lexeme="eval"])
+
+Syntax:
+ - Name        a node of the NodeType called Name in parse.NodeNames
+ - *           any node
+ - A B         a B that is a descendant of an A
+ - A > B       a B that is a child of an A
+ - A, B        either A or B
+ - [token=T]   a node whose token has the TokenType called T in lex.TokenNames
+ - [lexeme=x]  a node whose token lexeme is x ("x" and 'x' may be quoted), != negates
+ - :nth-child(an+b), :nth-child(odd), :first-child, :last-child
+ - :terminal, :nonterminal
+ - :has(sel)   a node with a descendant (or with "> sel", a child) matching sel
+ - :not(sel)   a node not matching sel
+
+Names are resolved when the selector is compiled, so NodeNames and TokenNames
+must be populated before calling Compile.
+*/
+package query
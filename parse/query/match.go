@@ -0,0 +1,147 @@
+package query
+
+import (
+	"kugg/compilers/parse"
+)
+
+//Match reports whether the node matches the selector.
+//
+//Descendant and child combinators are matched against the ancestors of n,
+//all the way up to the root of its tree.
+func (s *Selector) Match(n parse.Node) bool {
+	return n != nil && matchAny(s.alts, n, nil)
+}
+
+//Select returns all nodes in the subtree rooted at n, including n itself, that match the selector.
+//
+//The nodes are returned in preorder.
+func (s *Selector) Select(n parse.Node) []parse.Node {
+	var matches []parse.Node
+	s.walk(n, func(m parse.Node) bool {
+		matches = append(matches, m)
+		return true
+	})
+	return matches
+}
+
+//First returns the first node in preorder in the subtree rooted at n that matches the selector,
+//or nil if there is none.
+func (s *Selector) First(n parse.Node) parse.Node {
+	var first parse.Node
+	s.walk(n, func(m parse.Node) bool {
+		first = m
+		return false
+	})
+	return first
+}
+
+//walk calls f with every match in preorder until f returns false
+func (s *Selector) walk(n parse.Node, f func(parse.Node) bool) bool {
+	if n == nil {
+		return true
+	}
+	if s.Match(n) && !f(n) {
+		return false
+	}
+	for _, c := range n.Children() {
+		if !s.walk(c, f) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchAny(alts []complexSel, n, anchor parse.Node) bool {
+	for i := range alts {
+		if alts[i].match(len(alts[i].parts)-1, n, anchor) {
+			return true
+		}
+	}
+	return false
+}
+
+//match matches the selector from right to left, starting with parts[i] against n
+func (cs *complexSel) match(i int, n, anchor parse.Node) bool {
+	if !cs.parts[i].match(n, anchor) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+
+	switch cs.combs[i-1] {
+	case child:
+		p := n.Parent()
+		return p != nil && cs.match(i-1, p, anchor)
+	default:
+		for p := n.Parent(); p != nil; p = p.Parent() {
+			if cs.match(i-1, p, anchor) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (c *compound) match(n, anchor parse.Node) bool {
+	if c.scope {
+		return n == anchor
+	}
+	if !c.anyType && n.Type() != c.typ {
+		return false
+	}
+	for _, pred := range c.preds {
+		if !pred(n) {
+			return false
+		}
+	}
+	return true
+}
+
+//hasDescendant checks if any node below n matches a relative selector anchored at the node tested by :has()
+func hasDescendant(alts []complexSel, n, anchor parse.Node) bool {
+	for _, c := range n.Children() {
+		if matchAny(alts, c, anchor) || hasDescendant(alts, c, anchor) {
+			return true
+		}
+	}
+	return false
+}
+
+func not(pred predicate) predicate {
+	return func(n parse.Node) bool {
+		return !pred(n)
+	}
+}
+
+//nthChild matches nodes at a sibling position an+b, counted from 1.
+//
+//If fromEnd is set, the position is counted from the last sibling.
+func nthChild(a, b int, fromEnd bool) predicate {
+	return func(n parse.Node) bool {
+		p := n.Parent()
+		if p == nil {
+			return false
+		}
+		siblings := p.Children()
+		pos := 0
+		for i, s := range siblings {
+			if s == n {
+				pos = i + 1
+				break
+			}
+		}
+		if pos == 0 {
+			return false
+		}
+		if fromEnd {
+			pos = len(siblings) - pos + 1
+		}
+
+		if a == 0 {
+			return pos == b
+		}
+		k := pos - b
+		return k%a == 0 && k/a >= 0
+	}
+}
@@ -0,0 +1,429 @@
+package query
+
+import (
+	"fmt"
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+	"strconv"
+	"strings"
+)
+
+//Selector is a compiled selector, safe to reuse for any number of matches
+type Selector struct {
+	src  string
+	alts []complexSel //The comma separated alternatives
+}
+
+//combinator describes how two compound selectors relate
+type combinator int
+
+const (
+	descendant combinator = iota
+	child
+)
+
+//complexSel is a chain of compound selectors, combs[i] sits between parts[i] and parts[i+1]
+type complexSel struct {
+	parts []compound
+	combs []combinator
+}
+
+//compound is a node type test followed by any number of predicates, e.g. Call[lexeme="f"]:first-child
+type compound struct {
+	typ     parse.NodeType
+	anyType bool //The * selector, or a selector with only predicates
+	scope   bool //Matches the anchor node of a :has() argument
+	preds   []predicate
+}
+
+//predicate tests a single node
+type predicate func(n parse.Node) bool
+
+//Error is returned by Compile for malformed selectors
+type Error struct {
+	Selector string
+	Pos      int //Byte offset in Selector
+	Msg      string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("query: col %d in %q: %s", e.Pos+1, e.Selector, e.Msg)
+}
+
+//Compile parses a selector and resolves its node and token names.
+func Compile(src string) (sel *Selector, err error) {
+	p := &parser{src: src}
+
+	defer func() {
+		if r := recover(); r != nil {
+			qerr, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			sel, err = nil, qerr
+		}
+	}()
+
+	alts := p.parseList(false)
+	p.skipSpaces()
+	if !p.done() {
+		p.errorf("unexpected %q", p.peek())
+	}
+	return &Selector{src: src, alts: alts}, nil
+}
+
+//MustCompile is like Compile but panics on malformed selectors.
+//
+//Useful for initializing package level selectors, e.g. tables of lint rules.
+func MustCompile(src string) *Selector {
+	sel, err := Compile(src)
+	if err != nil {
+		panic(err)
+	}
+	return sel
+}
+
+//String returns the source of the selector
+func (s *Selector) String() string {
+	return s.src
+}
+
+//parser is a hand written recursive descent parser for selectors
+type parser struct {
+	src string
+	pos int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) {
+	panic(&Error{Selector: p.src, Pos: p.pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *parser) peek() byte {
+	if p.done() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+//skipSpaces skips white space and reports whether there was any
+func (p *parser) skipSpaces() bool {
+	start := p.pos
+	for !p.done() && strings.IndexByte(" \t\r\n", p.peek()) >= 0 {
+		p.pos++
+	}
+	return p.pos > start
+}
+
+func (p *parser) expect(c byte) {
+	if p.peek() != c {
+		if p.done() {
+			p.errorf("expected %q, got end of selector", c)
+		}
+		p.errorf("expected %q, got %q", c, p.peek())
+	}
+	p.pos++
+}
+
+func isNameByte(c byte) bool {
+	return c == '_' || c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func (p *parser) name() string {
+	start := p.pos
+	for !p.done() && isNameByte(p.peek()) {
+		p.pos++
+	}
+	if start == p.pos {
+		if p.done() {
+			p.errorf("expected a name, got end of selector")
+		}
+		p.errorf("expected a name, got %q", p.peek())
+	}
+	return p.src[start:p.pos]
+}
+
+//parseList parses comma separated complex selectors.
+//
+//Relative selectors are the arguments of :has(), which are anchored at the node being tested.
+func (p *parser) parseList(relative bool) []complexSel {
+	var alts []complexSel
+	for {
+		p.skipSpaces()
+		alts = append(alts, p.parseComplex(relative))
+		p.skipSpaces()
+		if p.peek() != ',' {
+			return alts
+		}
+		p.pos++
+	}
+}
+
+func (p *parser) parseComplex(relative bool) complexSel {
+	var cs complexSel
+	if relative {
+		cs.parts = append(cs.parts, compound{scope: true})
+		if p.peek() == '>' {
+			p.pos++
+			p.skipSpaces()
+			cs.combs = append(cs.combs, child)
+		} else {
+			cs.combs = append(cs.combs, descendant)
+		}
+	}
+	cs.parts = append(cs.parts, p.parseCompound())
+
+	for {
+		spaces := p.skipSpaces()
+		switch {
+		case p.done() || p.peek() == ',' || p.peek() == ')':
+			return cs
+		case p.peek() == '>':
+			p.pos++
+			p.skipSpaces()
+			cs.combs = append(cs.combs, child)
+		case spaces:
+			cs.combs = append(cs.combs, descendant)
+		default:
+			p.errorf("unexpected %q", p.peek())
+		}
+		cs.parts = append(cs.parts, p.parseCompound())
+	}
+}
+
+func (p *parser) parseCompound() compound {
+	c := compound{anyType: true}
+	start := p.pos
+
+	switch {
+	case p.peek() == '*':
+		p.pos++
+	case isNameByte(p.peek()):
+		name := p.name()
+		typ, ok := lookupNodeType(name)
+		if !ok {
+			p.pos = start
+			p.errorf("no node type named %q in NodeNames", name)
+		}
+		c.typ, c.anyType = typ, false
+	}
+
+	for {
+		switch p.peek() {
+		case '[':
+			c.preds = append(c.preds, p.parseAttribute())
+		case ':':
+			c.preds = append(c.preds, p.parsePseudo())
+		default:
+			if p.pos == start {
+				if p.done() {
+					p.errorf("expected a selector, got end of selector")
+				}
+				p.errorf("expected a selector, got %q", p.peek())
+			}
+			return c
+		}
+	}
+}
+
+//parseAttribute parses [token=Name] and [lexeme="value"] predicates
+func (p *parser) parseAttribute() predicate {
+	p.expect('[')
+	p.skipSpaces()
+	attrPos := p.pos
+	attr := p.name()
+	p.skipSpaces()
+
+	negate := false
+	if p.peek() == '!' {
+		negate = true
+		p.pos++
+	}
+	p.expect('=')
+	p.skipSpaces()
+	valPos := p.pos
+	val := p.value()
+	p.skipSpaces()
+	p.expect(']')
+
+	var pred predicate
+	switch attr {
+	case "token":
+		typ, ok := lookupTokenType(val)
+		if !ok {
+			p.pos = valPos
+			p.errorf("no token type named %q in TokenNames", val)
+		}
+		pred = func(n parse.Node) bool {
+			return n.Token() != nil && n.Token().Type() == typ
+		}
+	case "lexeme":
+		pred = func(n parse.Node) bool {
+			return n.Token() != nil && n.Token().Lexeme() == val
+		}
+	default:
+		p.pos = attrPos
+		p.errorf("unknown attribute %q, expected token or lexeme", attr)
+	}
+	if negate {
+		return not(pred)
+	}
+	return pred
+}
+
+//value parses a quoted string, or a bare word ending at white space or ']'
+func (p *parser) value() string {
+	switch q := p.peek(); q {
+	case '"', '\'':
+		start := p.pos
+		p.pos++
+		for !p.done() && p.peek() != q {
+			if p.peek() == '\\' {
+				p.pos++
+			}
+			p.pos++
+		}
+		p.expect(q)
+		lit := p.src[start:p.pos]
+		if q == '\'' {
+			lit = `"` + strings.ReplaceAll(lit[1:len(lit)-1], `"`, `\"`) + `"`
+		}
+		s, err := strconv.Unquote(lit)
+		if err != nil {
+			p.pos = start
+			p.errorf("malformed string %s", p.src[start:])
+		}
+		return s
+	default:
+		start := p.pos
+		for !p.done() && strings.IndexByte(" \t\r\n]", p.peek()) < 0 {
+			p.pos++
+		}
+		if start == p.pos {
+			p.errorf("expected a value")
+		}
+		return p.src[start:p.pos]
+	}
+}
+
+//argument returns the raw text between the parentheses of a pseudo-class
+func (p *parser) argument() string {
+	p.expect('(')
+	start := p.pos
+	for !p.done() && p.peek() != ')' {
+		p.pos++
+	}
+	arg := p.src[start:p.pos]
+	p.expect(')')
+	return strings.TrimSpace(arg)
+}
+
+func (p *parser) parsePseudo() predicate {
+	p.expect(':')
+	namePos := p.pos
+	name := p.name()
+
+	switch name {
+	case "first-child":
+		return nthChild(0, 1, false)
+	case "last-child":
+		return nthChild(0, 1, true)
+	case "nth-child", "nth-last-child":
+		argPos := p.pos + 1
+		a, b, ok := parseNth(p.argument())
+		if !ok {
+			p.pos = argPos
+			p.errorf("malformed argument to :%s, expected an+b, odd or even", name)
+		}
+		return nthChild(a, b, name == "nth-last-child")
+	case "terminal":
+		return func(n parse.Node) bool {
+			return n.IsTerminal()
+		}
+	case "nonterminal":
+		return func(n parse.Node) bool {
+			return !n.IsTerminal()
+		}
+	case "has":
+		p.expect('(')
+		alts := p.parseList(true)
+		p.skipSpaces()
+		p.expect(')')
+		return func(n parse.Node) bool {
+			return hasDescendant(alts, n, n)
+		}
+	case "not":
+		p.expect('(')
+		alts := p.parseList(false)
+		p.skipSpaces()
+		p.expect(')')
+		return not(func(n parse.Node) bool {
+			return matchAny(alts, n, nil)
+		})
+	}
+	p.pos = namePos
+	p.errorf("unknown pseudo-class :%s", name)
+	return nil
+}
+
+//parseNth parses the an+b notation of CSS, as well as odd and even.
+func parseNth(s string) (a, b int, ok bool) {
+	s = strings.ReplaceAll(s, " ", "")
+	switch s {
+	case "odd":
+		return 2, 1, true
+	case "even":
+		return 2, 0, true
+	case "":
+		return 0, 0, false
+	}
+
+	i := strings.IndexByte(s, 'n')
+	if i < 0 {
+		b, err := strconv.Atoi(s)
+		return 0, b, err == nil
+	}
+
+	switch coef := s[:i]; coef {
+	case "", "+":
+		a = 1
+	case "-":
+		a = -1
+	default:
+		var err error
+		if a, err = strconv.Atoi(coef); err != nil {
+			return 0, 0, false
+		}
+	}
+	if rest := s[i+1:]; rest != "" {
+		if rest[0] != '+' && rest[0] != '-' {
+			return 0, 0, false
+		}
+		var err error
+		if b, err = strconv.Atoi(rest); err != nil {
+			return 0, 0, false
+		}
+	}
+	return a, b, true
+}
+
+func lookupNodeType(name string) (parse.NodeType, bool) {
+	for typ, n := range parse.NodeNames {
+		if n == name {
+			return typ, true
+		}
+	}
+	return 0, false
+}
+
+func lookupTokenType(name string) (lex.TokenType, bool) {
+	for typ, n := range lex.TokenNames {
+		if n == name {
+			return typ, true
+		}
+	}
+	return 0, false
+}
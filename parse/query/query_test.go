@@ -0,0 +1,124 @@
+package query_test
+
+import (
+	"kugg/compilers/Gparse"
+	"kugg/compilers/Gparse/arith"
+	"kugg/compilers/parse"
+	"kugg/compilers/parse/query"
+	"strings"
+	"testing"
+)
+
+//arithTree parses an arithmetic expression, e.g. 1 + 2 * 3 to
+//Expr(Term(Factor(1)) + Expr(Term(Factor(2) * Term(Factor(3)))))
+func arithTree(t *testing.T, src string) parse.Node {
+	p, err := Gparse.NewParser(arith.Grammar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := p.Parse(src, src, arith.LexAny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree.Root.Children()[0]
+}
+
+//describe writes nodes as their type and the lexeme of their first token
+func describe(nodes []parse.Node) string {
+	var parts []string
+	for _, n := range nodes {
+		parts = append(parts, n.Type().String()+":"+n.Token().Lexeme())
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestSelect(t *testing.T) {
+	root := arithTree(t, "1 + 2 * 3")
+	for _, c := range []struct{ sel, want string }{
+		{"Factor", "Factor:1 Factor:2 Factor:3"},
+		{"Expr Number", "Number:1 Number:2 Number:3"},
+		{"Expr > Term", "Term:1 Term:2"},
+		{"Term > Term", "Term:3"},
+		{"Expr > Expr > Term", "Term:2"},
+		{"Expr Expr Number", "Number:2 Number:3"},
+		{"Expr>Term>Factor", "Factor:1 Factor:2"},
+		{"Number, Plus", "Number:1 Plus:+ Number:2 Number:3"},
+		{"*", "Expr:1 Term:1 Factor:1 Number:1 Plus:+ Expr:2 Term:2 Factor:2 Number:2 Times:* Term:3 Factor:3 Number:3"},
+		{"Number[lexeme=2]", "Number:2"},
+		{`Factor[lexeme="3"]`, "Factor:3"},
+		{"Number[lexeme != '2']", "Number:1 Number:3"},
+		{"[token=PlusToken]", "Plus:+"},
+		{"Term[token=NumberToken][lexeme=3]", "Term:3"},
+		{":terminal:not(Number)", "Plus:+ Times:*"},
+		{"Term:has(> Times)", "Term:2"},
+		{"Expr:has(Times)", "Expr:1 Expr:2"},
+		{"Expr:has(> Term > Factor[lexeme=1])", "Expr:1"},
+		{"Term:last-child", "Term:2 Term:3"},
+		{":nth-child(2)", "Plus:+ Times:*"},
+		{"Expr > :nth-last-child(1)", "Expr:2 Term:2"},
+		{"Expr > :nth-child(odd)", "Term:1 Expr:2 Term:2"},
+		{"Factor:nonterminal:not(:has(Number[lexeme=2]))", "Factor:1 Factor:3"},
+	} {
+		sel, err := query.Compile(c.sel)
+		if err != nil {
+			t.Errorf("%s: %v", c.sel, err)
+			continue
+		}
+		if got := describe(sel.Select(root)); got != c.want {
+			t.Errorf("%s selected\n%s\nexpected\n%s", c.sel, got, c.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	root := arithTree(t, "(1)")
+	sel := query.MustCompile("Factor > Expr Number")
+	number := sel.First(root)
+	if number == nil || number.Token().Lexeme() != "1" || !sel.Match(number) {
+		t.Fatalf("the number in parentheses was not selected")
+	}
+	if query.MustCompile("Expr > Number").Match(number) || sel.Match(nil) {
+		t.Errorf("a descendant was matched as a child")
+	}
+	if first := query.MustCompile("Times").First(root); first != nil {
+		t.Errorf("First found %v where there is no match", first)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for sel, want := range map[string]string{
+		"":                `query: col 1 in "": expected a selector, got end of selector`,
+		"Expr >":          `query: col 7 in "Expr >": expected a selector, got end of selector`,
+		"Expr,,Term":      `query: col 6 in "Expr,,Term": expected a selector, got ','`,
+		"Expr )":          `query: col 6 in "Expr )": unexpected ')'`,
+		"Nope":            `query: col 1 in "Nope": no node type named "Nope" in NodeNames`,
+		"[lexeme=1":       `query: col 10 in "[lexeme=1": expected ']', got end of selector`,
+		"[color=red]":     `query: col 2 in "[color=red]": unknown attribute "color", expected token or lexeme`,
+		"[token=Nope]":    `query: col 8 in "[token=Nope]": no token type named "Nope" in TokenNames`,
+		"[lexeme]":        `query: col 8 in "[lexeme]": expected '=', got ']'`,
+		":nth-child(x)":   `query: col 12 in ":nth-child(x)": malformed argument to :nth-child, expected an+b, odd or even`,
+		":wat":            `query: col 2 in ":wat": unknown pseudo-class :wat`,
+		"Expr:has(Term":   `query: col 14 in "Expr:has(Term": expected ')', got end of selector`,
+		`[lexeme="1]`:     `query: col 12 in "[lexeme=\"1]": expected '"', got end of selector`,
+		"Expr ~ Term":     `query: col 6 in "Expr ~ Term": expected a selector, got '~'`,
+		":not(Expr > )":   `query: col 13 in ":not(Expr > )": expected a selector, got ')'`,
+		"Term:first-child": "",
+	} {
+		_, err := query.Compile(sel)
+		switch {
+		case want == "" && err != nil:
+			t.Errorf("%q: %v", sel, err)
+		case want != "" && err == nil:
+			t.Errorf("%q compiled", sel)
+		case want != "" && err.Error() != want:
+			t.Errorf("%q: the error\n%v\nis not\n%s", sel, err, want)
+		}
+	}
+
+	defer func() {
+		if _, ok := recover().(*query.Error); !ok {
+			t.Errorf("MustCompile did not panic with an Error")
+		}
+	}()
+	query.MustCompile("Expr >")
+}
@@ -0,0 +1,225 @@
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"kugg/compilers/lex"
+	"strings"
+)
+
+//Recorder records every step of a parse, to inspect it afterwards, e.g. with cmd/parsedbg
+type Recorder struct {
+	Name   string //Name of the tree
+	Source string //Source text of the tree
+	Steps  []Step
+
+	ids   map[Node]int
+	rules int //Number of rules entered with Tree.Trace and not exited
+}
+
+//Step is a recorded TraceEvent
+type Step struct {
+	Event  TraceEvent `json:"event"`
+	Rule   string     `json:"rule,omitempty"`   //For EnterRule and ExitRule
+	Node   int        `json:"node,omitempty"`   //Id of the node, numbered from 1 in the order the nodes were seen
+	Type   string     `json:"type,omitempty"`   //Type of the node
+	Parent int        `json:"parent,omitempty"` //Id of the parent, for AddNode and RemoveNode
+	Index  int        `json:"index,omitempty"`  //Index of the node among its siblings, for AddNode
+	Token  *StepToken `json:"token,omitempty"`
+	Pos    int        `json:"pos"`   //Position in the token buffer after the step
+	Depth  int        `json:"depth"` //Depth of the current node plus the number of open rules
+}
+
+//StepToken is a recorded token
+type StepToken struct {
+	Type   string `json:"type"`
+	Lexeme string `json:"lexeme"`
+	Pos    int    `json:"pos"` //Position in the source after the token
+	Line   int    `json:"line"`
+	Row    int    `json:"row"`
+}
+
+//Record starts recording the parse of the tree, and returns the Recorder
+func (tree *Tree) Record() *Recorder {
+	tree.Recorder = &Recorder{Name: tree.name, Source: tree.text, ids: make(map[Node]int)}
+	tree.Recorder.ids[tree.Root] = 1
+	return tree.Recorder
+}
+
+func (r *Recorder) id(n Node) int {
+	if n == nil {
+		return 0
+	}
+	if r.ids == nil {
+		r.ids = make(map[Node]int)
+	}
+	id, ok := r.ids[n]
+	if !ok {
+		id = len(r.ids) + 1
+		r.ids[n] = id
+	}
+	return id
+}
+
+func depth(n Node) int {
+	d := 0
+	for ; n != nil && n.Parent() != nil; n = n.Parent() {
+		d++
+	}
+	return d
+}
+
+func (r *Recorder) record(tree *Tree, ev TraceEvent, n Node, tok lex.Token, rule string) {
+	if ev == ExitRule {
+		r.rules--
+	}
+	s := Step{Event: ev, Rule: rule, Pos: tree.Pos, Depth: r.rules}
+	if tree.Curr != nil {
+		s.Depth += depth(tree.Curr) + 1
+	}
+	if n != nil {
+		s.Node = r.id(n)
+		s.Type = n.Type().String()
+		if p := n.Parent(); p != nil {
+			s.Depth = depth(p) + 1 + r.rules
+			if ev == AddNode || ev == RemoveNode {
+				s.Parent = r.id(p)
+				s.Index = -1
+				for i, c := range p.Children() {
+					if c == n {
+						s.Index = i
+					}
+				}
+			}
+		}
+	}
+	if tok != nil {
+		s.Token = &StepToken{tokenName(tok.Type()), tok.Lexeme(), tok.Pos(), tok.Line(), tok.Row()}
+	}
+	if ev == EnterRule {
+		r.rules++
+	}
+	r.Steps = append(r.Steps, s)
+}
+
+//WriteJSON writes the recorded trace as JSON
+func (r *Recorder) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", " ")
+	return enc.Encode(r)
+}
+
+//ReadTrace reads a trace written by WriteJSON
+func ReadTrace(rd io.Reader) (*Recorder, error) {
+	r := &Recorder{}
+	if err := json.NewDecoder(rd).Decode(r); err != nil {
+		return nil, fmt.Errorf("reading trace: %v", err)
+	}
+	return r, nil
+}
+
+func (s Step) String() string {
+	var sb strings.Builder
+	sb.WriteString(s.Event.String())
+	if s.Rule != "" {
+		sb.WriteString(" " + s.Rule)
+	}
+	if s.Type != "" {
+		fmt.Fprintf(&sb, " %s#%d", s.Type, s.Node)
+	}
+	if s.Token != nil {
+		fmt.Fprintf(&sb, " %s(%q) at %d:%d", s.Token.Type, s.Token.Lexeme, s.Token.Line, s.Token.Row)
+	}
+	return sb.String()
+}
+
+//Timeline returns the steps, one per line, numbered from 1 and indented by their depth
+func (r *Recorder) Timeline() string {
+	var sb strings.Builder
+	for i, s := range r.Steps {
+		fmt.Fprintf(&sb, "%5d %s%s\n", i+1, strings.Repeat("  ", s.Depth), s)
+	}
+	return sb.String()
+}
+
+//TraceNode is a node of the tree rebuilt from a trace
+type TraceNode struct {
+	Id        int
+	Type      string
+	Token     *StepToken
+	Committed bool
+	Parent    *TraceNode
+	Children  []*TraceNode
+}
+
+//TreeAt rebuilds the tree as it was after a number of steps, and returns its root
+func (r *Recorder) TreeAt(steps int) *TraceNode {
+	root := &TraceNode{Id: 1, Type: RootNode.String()}
+	nodes := map[int]*TraceNode{1: root}
+	get := func(id int, typ string) *TraceNode {
+		n, ok := nodes[id]
+		if !ok {
+			n = &TraceNode{Id: id, Type: typ}
+			nodes[id] = n
+		}
+		return n
+	}
+	detach := func(n *TraceNode) {
+		if p := n.Parent; p != nil {
+			for i, c := range p.Children {
+				if c == n {
+					p.Children = append(p.Children[:i], p.Children[i+1:]...)
+					break
+				}
+			}
+			n.Parent = nil
+		}
+	}
+
+	for _, s := range r.Steps[:minInt(steps, len(r.Steps))] {
+		switch s.Event {
+		case AddNode:
+			n := get(s.Node, s.Type)
+			if n.Token == nil {
+				n.Token = s.Token
+			}
+			detach(n)
+			p := get(s.Parent, "")
+			i := s.Index
+			if i < 0 || i > len(p.Children) {
+				i = len(p.Children)
+			}
+			p.Children = append(p.Children, nil)
+			copy(p.Children[i+1:], p.Children[i:])
+			p.Children[i] = n
+			n.Parent = p
+		case RemoveNode:
+			detach(get(s.Node, s.Type))
+		case CommitNode:
+			get(s.Node, s.Type).Committed = true
+		}
+	}
+	return root
+}
+
+//Lines prints the subtree, one node per line, marking speculative nodes with a ?
+func (n *TraceNode) Lines() []string {
+	var lines []string
+	var walk func(n *TraceNode, indent int)
+	walk = func(n *TraceNode, indent int) {
+		line := strings.Repeat("  ", indent) + n.Type
+		if n.Token != nil {
+			line += fmt.Sprintf(": %s(%q)", n.Token.Type, n.Token.Lexeme)
+		}
+		if !n.Committed && n.Parent != nil {
+			line += " ?"
+		}
+		lines = append(lines, fmt.Sprintf("%s #%d", line, n.Id))
+		for _, c := range n.Children {
+			walk(c, indent+1)
+		}
+	}
+	walk(n, 0)
+	return lines
+}
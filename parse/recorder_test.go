@@ -0,0 +1,135 @@
+package parse_test
+
+import (
+	"bytes"
+	"kugg/compilers/Gparse"
+	"kugg/compilers/Gparse/arith"
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+	"strings"
+	"testing"
+)
+
+//recordedParse records the parse of arith by the backtracking Parser of Gparse
+func recordedParse(t *testing.T, src string) *parse.Recorder {
+	p, err := Gparse.NewParser(arith.Grammar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := parse.NewTree(src, src, p.ParseFn())
+	rec := tree.Record()
+	l := lex.Lex(src, src)
+	l.Run(arith.LexAny)
+	defer l.Drain()
+	if err := tree.Parse(l); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+func TestTimeline(t *testing.T) {
+	rec := recordedParse(t, "1 + 2")
+	lines := strings.Split(rec.Timeline(), "\n")
+	if len(lines) != len(rec.Steps)+1 || len(rec.Steps) != 138 {
+		t.Fatalf("%d steps in %d lines", len(rec.Steps), len(lines))
+	}
+	//The first alternative of Factor is tried and rolled back
+	want := `
+    1   enter Expr -> Term Plus Expr
+    2     peek NumberToken("1") at 1:0
+    3     node Expr#2 NumberToken("1") at 1:0
+    4       enter Term -> Factor Times Term
+    5         peek NumberToken("1") at 1:0
+    6         node Term#3 NumberToken("1") at 1:0
+    7           enter Factor -> LParen Expr RParen
+    8             peek NumberToken("1") at 1:0
+    9             node Factor#4 NumberToken("1") at 1:0
+   10               token NumberToken("1") at 1:0
+   11               backtrack NumberToken("1") at 1:0
+   12             rollback Factor#4 NumberToken("1") at 1:0
+   13             remove Factor#4 NumberToken("1") at 1:0
+   14           exit Factor -> LParen Expr RParen`
+	if got := strings.Join(lines[:14], "\n"); got != want[1:] {
+		t.Errorf("the timeline starts with\n%s\nexpected\n%s", got, want[1:])
+	}
+	if last := lines[len(lines)-2]; last != `  138   token EOF_Token("") at 1:5` {
+		t.Errorf("the last step is %q", last)
+	}
+}
+
+func TestTreeAt(t *testing.T) {
+	rec := recordedParse(t, "1 + 2")
+	for _, c := range []struct {
+		steps int
+		tree  string
+	}{
+		{0, `
+RootNode #1`},
+		//The speculative Factor of the alternative ( Expr )
+		{10, `
+RootNode #1
+  Expr: NumberToken("1") ? #2
+    Term: NumberToken("1") ? #3
+      Factor: NumberToken("1") ? #4`},
+		//Its rollback leaves the speculative Term
+		{13, `
+RootNode #1
+  Expr: NumberToken("1") ? #2
+    Term: NumberToken("1") ? #3`},
+		//The committed Factor of Factor * Term is kept when * is missing
+		{32, `
+RootNode #1
+  Expr: NumberToken("1") ? #2
+    Term: NumberToken("1") ? #3
+      Factor: NumberToken("1") #6
+        Number: NumberToken("1") #7`},
+		{34, `
+RootNode #1
+  Expr: NumberToken("1") ? #2`},
+		//and reused by the next alternative
+		{40, `
+RootNode #1
+  Expr: NumberToken("1") ? #2
+    Term: NumberToken("1") ? #8
+      Factor: NumberToken("1") #6
+        Number: NumberToken("1") #7`},
+		{1000, `
+RootNode #1
+  Expr: NumberToken("1") #2
+    Term: NumberToken("1") #9
+      Factor: NumberToken("1") #6
+        Number: NumberToken("1") #7
+    Plus: PlusToken("+") #10
+    Expr: NumberToken("2") #20
+      Term: NumberToken("2") #18
+        Factor: NumberToken("2") #15
+          Number: NumberToken("2") #16`},
+	} {
+		if got := strings.Join(rec.TreeAt(c.steps).Lines(), "\n"); got != c.tree[1:] {
+			t.Errorf("after %d steps the tree is\n%s\nexpected\n%s", c.steps, got, c.tree[1:])
+		}
+	}
+}
+
+func TestReadTrace(t *testing.T) {
+	rec := recordedParse(t, "(3)")
+	var buf bytes.Buffer
+	if err := rec.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	back, err := parse.ReadTrace(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.Name != "(3)" || back.Source != "(3)" || back.Timeline() != rec.Timeline() {
+		t.Errorf("the trace reads back as\n%s", back.Timeline())
+	}
+	for _, steps := range []int{5, 20, len(rec.Steps)} {
+		if a, b := rec.TreeAt(steps).Lines(), back.TreeAt(steps).Lines(); strings.Join(a, "\n") != strings.Join(b, "\n") {
+			t.Errorf("after %d steps the tree read back is\n%s\nexpected\n%s", steps, strings.Join(b, "\n"), strings.Join(a, "\n"))
+		}
+	}
+	if _, err := parse.ReadTrace(strings.NewReader(`{"Steps": [{"event": "jump"}]}`)); err == nil || !strings.Contains(err.Error(), `unknown trace event "jump"`) {
+		t.Errorf("reading an unknown event returned %v", err)
+	}
+}
@@ -0,0 +1,25 @@
+/*
+Package rewrite implements declarative tree rewriting over parse.Node.
+
+A Rule pairs a tree pattern with a replacement template, both written as
+S-expressions over the names in parse.NodeNames and lex.TokenNames:
+
+	(Binary $x:Number (Op "+") (Number Num "0"))  =>  $x
+
+Patterns:
+ - (Name child...)         a nonterminal of the NodeType called Name, with exactly these children
+ - (Name Tok "lexeme")     a terminal, the token type and the lexeme are both optional
+ - (Name)                  a node of type Name without children
+ - _ and _:Name            any node, or any node of type Name
+ - $x and $x:Name          captures a node, a variable used twice must capture equal subtrees
+ - $xs... and _...         captures (or skips) any number of sibling nodes
+
+Templates use the same syntax, without wildcards. Captured nodes are moved
+into the replacement, and cloned if they are used more than once.
+Terminals in templates need both a token type and a lexeme.
+
+Rules are applied by a Rewriter, bottom-up or top-down, until no rule matches
+anywhere in the tree. Rules that undo each other are detected and reported
+as a CycleError instead of looping forever.
+*/
+package rewrite
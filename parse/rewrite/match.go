@@ -0,0 +1,210 @@
+package rewrite
+
+import (
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+	"strconv"
+	"strings"
+)
+
+//Bindings holds the node matched by a rule and the nodes captured by its variables
+type Bindings struct {
+	node parse.Node
+	vars map[string][]parse.Node
+}
+
+//Matched returns the node the pattern matched
+func (b *Bindings) Matched() parse.Node {
+	return b.node
+}
+
+//Get returns the node captured by $name, or nil if there is none
+func (b *Bindings) Get(name string) parse.Node {
+	ns := b.vars[name]
+	if len(ns) == 0 {
+		return nil
+	}
+	return ns[0]
+}
+
+//Seq returns the nodes captured by $name...
+func (b *Bindings) Seq(name string) []parse.Node {
+	return b.vars[name]
+}
+
+//Lexeme returns the lexeme of the token of the node captured by $name
+func (b *Bindings) Lexeme(name string) string {
+	n := b.Get(name)
+	if n == nil || n.Token() == nil {
+		return ""
+	}
+	return n.Token().Lexeme()
+}
+
+//NewTerminal creates a terminal for a replacement in the tree of the matched node
+func (b *Bindings) NewTerminal(typ parse.NodeType, tok lex.TokenType, lexeme string) parse.Node {
+	tree := b.node.Tree()
+	defer scoped(tree, b.node)()
+	t := parse.NewTerminal(typ, lex.DebugToken(tok, lexeme), tree)
+	t.Commit()
+	return t
+}
+
+//NewNonTerminal creates a nonterminal for a replacement in the tree of the matched node
+func (b *Bindings) NewNonTerminal(typ parse.NodeType, children ...parse.Node) parse.Node {
+	tree := b.node.Tree()
+	defer scoped(tree, b.node)()
+	var first lex.Token
+	if len(children) > 0 {
+		first = children[0].Token()
+	}
+	nt := parse.NewNonTerminal(typ, first, tree)
+	nt.AddChildren(children)
+	nt.Commit()
+	return nt
+}
+
+//scoped makes new nodes inherit the scope of the node they replace
+func scoped(tree *parse.Tree, n parse.Node) (restore func()) {
+	saved := tree.CurrScope
+	tree.CurrScope = n.Scope()
+	return func() {
+		tree.CurrScope = saved
+	}
+}
+
+//snapshot copies the variables, so that a failed match can be undone
+func (b *Bindings) snapshot() map[string][]parse.Node {
+	vars := make(map[string][]parse.Node, len(b.vars))
+	for k, v := range b.vars {
+		vars[k] = v
+	}
+	return vars
+}
+
+func (pat *pattern) match(n parse.Node, b *Bindings) bool {
+	if !pat.anyType && n.Type() != pat.typ {
+		return false
+	}
+
+	switch pat.kind {
+	case patWildcard:
+		return true
+	case patCapture:
+		return b.bind(pat.name, []parse.Node{n})
+	}
+
+	if pat.terminal {
+		tok := n.Token()
+		switch {
+		case !n.IsTerminal() || tok == nil:
+			return false
+		case pat.hasTok && tok.Type() != pat.tok:
+			return false
+		case pat.hasLex && tok.Lexeme() != pat.lexeme:
+			return false
+		}
+		return true
+	}
+	return matchList(pat.children, n.Children(), b)
+}
+
+//bind binds a variable, or checks that an already bound variable captured an equal subtree
+func (b *Bindings) bind(name string, ns []parse.Node) bool {
+	prev, bound := b.vars[name]
+	if !bound {
+		b.vars[name] = ns
+		return true
+	}
+	if len(prev) != len(ns) {
+		return false
+	}
+	for i := range ns {
+		if fingerprint(prev[i]) != fingerprint(ns[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+//matchList matches a list of patterns against siblings, backtracking over sequence patterns
+func matchList(pats []*pattern, ns []parse.Node, b *Bindings) bool {
+	if len(pats) == 0 {
+		return len(ns) == 0
+	}
+	pat := pats[0]
+
+	if !pat.seq {
+		return len(ns) > 0 && pat.match(ns[0], b) && matchList(pats[1:], ns[1:], b)
+	}
+
+	for k := 0; k <= len(ns); k++ {
+		saved := b.snapshot()
+		if pat.seqMatch(ns[:k], b) && matchList(pats[1:], ns[k:], b) {
+			return true
+		}
+		b.vars = saved
+	}
+	return false
+}
+
+func (pat *pattern) seqMatch(ns []parse.Node, b *Bindings) bool {
+	if !pat.anyType {
+		for _, n := range ns {
+			if n.Type() != pat.typ {
+				return false
+			}
+		}
+	}
+	if pat.kind == patWildcard {
+		return true
+	}
+	return b.bind(pat.name, ns)
+}
+
+//build instantiates a template, moving captured nodes the first time they are used and cloning them after that
+func (pat *pattern) build(b *Bindings, used map[parse.Node]bool) []parse.Node {
+	if pat.kind == patCapture {
+		ns := make([]parse.Node, 0, len(b.vars[pat.name]))
+		for _, n := range b.vars[pat.name] {
+			if used[n] {
+				n = n.Clone()
+			}
+			used[n] = true
+			ns = append(ns, n)
+		}
+		return ns
+	}
+
+	if pat.terminal {
+		return []parse.Node{b.NewTerminal(pat.typ, pat.tok, pat.lexeme)}
+	}
+	var children []parse.Node
+	for _, c := range pat.children {
+		children = append(children, c.build(b, used)...)
+	}
+	return []parse.Node{b.NewNonTerminal(pat.typ, children...)}
+}
+
+//fingerprint is a canonical string for the structure of a subtree
+func fingerprint(n parse.Node) string {
+	var sb strings.Builder
+	writeFingerprint(&sb, n)
+	return sb.String()
+}
+
+func writeFingerprint(sb *strings.Builder, n parse.Node) {
+	sb.WriteByte('(')
+	sb.WriteString(strconv.Itoa(int(n.Type())))
+	if n.IsTerminal() && n.Token() != nil {
+		sb.WriteByte(' ')
+		sb.WriteString(strconv.Itoa(int(n.Token().Type())))
+		sb.WriteByte(' ')
+		sb.WriteString(strconv.Quote(n.Token().Lexeme()))
+	}
+	for _, c := range n.Children() {
+		sb.WriteByte(' ')
+		writeFingerprint(sb, c)
+	}
+	sb.WriteByte(')')
+}
@@ -0,0 +1,264 @@
+package rewrite
+
+import (
+	"fmt"
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+	"strconv"
+	"strings"
+)
+
+type patKind int
+
+const (
+	patNode     patKind = iota //(Name ...)
+	patCapture                 //$x
+	patWildcard                //_
+)
+
+//pattern is a compiled pattern or template
+type pattern struct {
+	kind     patKind
+	typ      parse.NodeType
+	anyType  bool   //Captures and wildcards without a :Name
+	name     string //Name of a capture variable
+	seq      bool   //Matches any number of siblings
+	terminal bool   //A token type or a lexeme was given
+	hasTok   bool
+	tok      lex.TokenType
+	hasLex   bool
+	lexeme   string
+	children []*pattern
+}
+
+//SyntaxError is returned for malformed patterns and templates
+type SyntaxError struct {
+	Rule string
+	Src  string
+	Pos  int //Byte offset in Src
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("rewrite: rule %q: col %d in %q: %s", e.Rule, e.Pos+1, e.Src, e.Msg)
+}
+
+//patParser is a small S-expression parser
+type patParser struct {
+	rule     string
+	src      string
+	pos      int
+	template bool
+}
+
+func compilePattern(rule, src string, template bool) (pat *pattern, err error) {
+	p := &patParser{rule: rule, src: src, template: template}
+
+	defer func() {
+		if r := recover(); r != nil {
+			serr, ok := r.(*SyntaxError)
+			if !ok {
+				panic(r)
+			}
+			pat, err = nil, serr
+		}
+	}()
+
+	p.skipSpaces()
+	pat = p.parse()
+	if pat.seq {
+		p.pos = 0
+		p.errorf("a sequence can't be the outermost pattern")
+	}
+	p.skipSpaces()
+	if p.pos < len(p.src) {
+		p.errorf("unexpected %q after pattern", p.src[p.pos:])
+	}
+	return pat, nil
+}
+
+func (p *patParser) errorf(format string, args ...interface{}) {
+	panic(&SyntaxError{Rule: p.rule, Src: p.src, Pos: p.pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (p *patParser) skipSpaces() {
+	for p.pos < len(p.src) && strings.IndexByte(" \t\r\n", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+func (p *patParser) peek() byte {
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+//word reads a run of characters up to white space or a parenthesis
+func (p *patParser) word() string {
+	start := p.pos
+	for p.pos < len(p.src) && strings.IndexByte(" \t\r\n()\"", p.src[p.pos]) < 0 {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *patParser) str() string {
+	start := p.pos
+	p.pos++
+	for p.pos < len(p.src) && p.src[p.pos] != '"' {
+		if p.src[p.pos] == '\\' {
+			p.pos++
+		}
+		p.pos++
+	}
+	if p.pos >= len(p.src) {
+		p.pos = start
+		p.errorf("unterminated string")
+	}
+	p.pos++
+	s, err := strconv.Unquote(p.src[start:p.pos])
+	if err != nil {
+		p.pos = start
+		p.errorf("malformed string: %v", err)
+	}
+	return s
+}
+
+func (p *patParser) parse() *pattern {
+	switch c := p.peek(); {
+	case c == '(':
+		return p.parseNode()
+	case c == '$' || c == '_':
+		return p.parseVariable()
+	case c == 0:
+		p.errorf("unexpected end of pattern")
+	default:
+		p.errorf("unexpected %q, expected '(', '$' or '_'", c)
+	}
+	return nil
+}
+
+func (p *patParser) parseVariable() *pattern {
+	start := p.pos
+	w := p.word()
+	pat := &pattern{kind: patCapture, anyType: true}
+
+	if strings.HasSuffix(w, "...") {
+		pat.seq = true
+		w = strings.TrimSuffix(w, "...")
+	}
+	if i := strings.IndexByte(w, ':'); i >= 0 {
+		typ, ok := lookupNodeType(w[i+1:])
+		if !ok {
+			p.pos = start + i + 1
+			p.errorf("no node type named %q in NodeNames", w[i+1:])
+		}
+		pat.typ, pat.anyType = typ, false
+		w = w[:i]
+	}
+
+	switch {
+	case w == "_":
+		pat.kind = patWildcard
+	case len(w) > 1 && w[0] == '$':
+		pat.name = w[1:]
+	default:
+		p.pos = start
+		p.errorf("malformed variable %q", p.src[start:p.pos+len(w)])
+	}
+
+	if p.template {
+		switch {
+		case pat.kind == patWildcard:
+			p.pos = start
+			p.errorf("wildcards can't be used in a template")
+		case !pat.anyType:
+			p.pos = start
+			p.errorf("variables in a template can't have a node type")
+		}
+	}
+	return pat
+}
+
+func (p *patParser) parseNode() *pattern {
+	start := p.pos
+	p.pos++
+	p.skipSpaces()
+	name := p.word()
+	if name == "" {
+		p.errorf("expected a node type name")
+	}
+	typ, ok := lookupNodeType(name)
+	if !ok {
+		p.pos -= len(name)
+		p.errorf("no node type named %q in NodeNames", name)
+	}
+	pat := &pattern{kind: patNode, typ: typ}
+
+	p.skipSpaces()
+	//An optional token type name
+	if c := p.peek(); c != '(' && c != ')' && c != '"' && c != '$' && c != '_' && c != 0 {
+		tokName := p.word()
+		tok, ok := lookupTokenType(tokName)
+		if !ok {
+			p.pos -= len(tokName)
+			p.errorf("no token type named %q in TokenNames", tokName)
+		}
+		pat.terminal, pat.hasTok, pat.tok = true, true, tok
+		p.skipSpaces()
+	}
+	//An optional lexeme
+	if p.peek() == '"' {
+		pat.terminal, pat.hasLex, pat.lexeme = true, true, p.str()
+		p.skipSpaces()
+	}
+
+	for p.peek() != ')' {
+		if p.peek() == 0 {
+			p.pos = start
+			p.errorf("unclosed '('")
+		}
+		if pat.terminal {
+			p.errorf("a terminal can't have children")
+		}
+		pat.children = append(pat.children, p.parse())
+		p.skipSpaces()
+	}
+	p.pos++
+
+	if p.template && pat.terminal && !(pat.hasTok && pat.hasLex) {
+		p.pos = start
+		p.errorf("a terminal in a template needs both a token type and a lexeme")
+	}
+	return pat
+}
+
+//vars collects the variables in a pattern, and reports whether they capture sequences
+func (pat *pattern) vars(vs map[string]bool) map[string]bool {
+	if pat.kind == patCapture {
+		vs[pat.name] = pat.seq
+	}
+	for _, c := range pat.children {
+		c.vars(vs)
+	}
+	return vs
+}
+
+func lookupNodeType(name string) (parse.NodeType, bool) {
+	for typ, n := range parse.NodeNames {
+		if n == name {
+			return typ, true
+		}
+	}
+	return 0, false
+}
+
+func lookupTokenType(name string) (lex.TokenType, bool) {
+	for typ, n := range lex.TokenNames {
+		if n == name {
+			return typ, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,244 @@
+package rewrite
+
+import (
+	"fmt"
+	"kugg/compilers/parse"
+	"strings"
+)
+
+//Rule rewrites every subtree matching Pattern.
+//
+//The replacement is either instantiated from Template, or computed by Build.
+type Rule struct {
+	Name     string
+	Pattern  string
+	Template string
+
+	//Guard, if set, must return true for the rule to apply
+	Guard func(*Bindings) bool
+	//Build, if set, is used instead of Template. Returning nil means the rule does not apply.
+	Build func(*Bindings) parse.Node
+}
+
+//Order decides in which order the nodes of a tree are visited
+type Order int
+
+const (
+	BottomUp Order = iota //Children are rewritten before their parents
+	TopDown               //Parents are rewritten before their children
+)
+
+//DefaultMaxSteps is the default limit of rewrites in one call to Rewrite
+const DefaultMaxSteps = 100000
+
+//Rewriter applies a set of rules to a tree until none of them matches
+type Rewriter struct {
+	Order    Order
+	MaxSteps int //The maximum amount of rewrites, as a guard against rules that grow the tree forever
+
+	rules []compiledRule
+}
+
+type compiledRule struct {
+	Rule
+	pattern  *pattern
+	template *pattern
+}
+
+//CycleError is returned when a set of rules keeps rewriting a tree into a shape it has had before
+type CycleError struct {
+	Rules []string //The rules applied during the cycle, in order
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("rewrite: the rules do not reach a fixpoint, the tree repeats after applying %s", strings.Join(e.Rules, ", "))
+}
+
+//New compiles the patterns and templates of a set of rules.
+//
+//Rules are tried in order, the first rule that matches a node is applied.
+func New(order Order, rules ...Rule) (*Rewriter, error) {
+	rw := &Rewriter{Order: order, MaxSteps: DefaultMaxSteps}
+	for _, r := range rules {
+		cr := compiledRule{Rule: r}
+		var err error
+		if cr.pattern, err = compilePattern(r.Name, r.Pattern, false); err != nil {
+			return nil, err
+		}
+
+		switch {
+		case r.Build != nil:
+		case r.Template == "":
+			return nil, fmt.Errorf("rewrite: rule %q has neither a Template nor a Build function", r.Name)
+		default:
+			if cr.template, err = compilePattern(r.Name, r.Template, true); err != nil {
+				return nil, err
+			}
+			if err = checkVars(r, cr.pattern, cr.template); err != nil {
+				return nil, err
+			}
+		}
+		rw.rules = append(rw.rules, cr)
+	}
+	return rw, nil
+}
+
+//MustNew is like New but panics if a rule does not compile
+func MustNew(order Order, rules ...Rule) *Rewriter {
+	rw, err := New(order, rules...)
+	if err != nil {
+		panic(err)
+	}
+	return rw
+}
+
+//checkVars makes sure every variable in the template is captured by the pattern, in the same way
+func checkVars(r Rule, pattern, template *pattern) error {
+	captured := pattern.vars(map[string]bool{})
+	for name, seq := range template.vars(map[string]bool{}) {
+		capSeq, ok := captured[name]
+		switch {
+		case !ok:
+			return fmt.Errorf("rewrite: rule %q: $%s is not captured by the pattern", r.Name, name)
+		case seq != capSeq && seq:
+			return fmt.Errorf("rewrite: rule %q: $%s... is not a sequence in the pattern", r.Name, name)
+		case seq != capSeq:
+			return fmt.Errorf("rewrite: rule %q: $%s captures a sequence, use $%s...", r.Name, name, name)
+		}
+	}
+	return nil
+}
+
+//rewriteError is panicked with to end a call to Rewrite with an error
+type rewriteError struct{ error }
+
+//run holds the state of one call to Rewrite
+type run struct {
+	rw      *Rewriter
+	steps   int
+	applied []string //Names of the rules applied since the last fixpoint check
+}
+
+//Rewrite applies the rules to the subtree rooted at n until no rule matches.
+//
+//It returns the root of the rewritten subtree, which is a new node if n itself was replaced,
+//and the number of rewrites made.
+func (rw *Rewriter) Rewrite(n parse.Node) (root parse.Node, steps int, err error) {
+	r := &run{rw: rw}
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			//Only errors of the rewriter, so bugs in rules, like nil dereferences, still crash
+			rerr, ok := rec.(rewriteError)
+			if !ok {
+				panic(rec)
+			}
+			root, steps, err = nil, r.steps, rerr.error
+		}
+	}()
+
+	seen := map[string]bool{fingerprint(n): true}
+	for {
+		before := r.steps
+		r.applied = r.applied[:0]
+		if rw.Order == TopDown {
+			n = r.topDown(n)
+		} else {
+			n = r.bottomUp(n)
+		}
+		if r.steps == before {
+			return n, r.steps, nil
+		}
+
+		fp := fingerprint(n)
+		if seen[fp] {
+			return n, r.steps, &CycleError{Rules: r.applied}
+		}
+		seen[fp] = true
+	}
+}
+
+//RewriteTree rewrites a whole tree, replacing its root if necessary
+func (rw *Rewriter) RewriteTree(tree *parse.Tree) (int, error) {
+	root, steps, err := rw.Rewrite(tree.Root)
+	if err != nil {
+		return steps, err
+	}
+	tree.Root = root
+	return steps, nil
+}
+
+func (r *run) bottomUp(n parse.Node) parse.Node {
+	for _, c := range append([]parse.Node(nil), n.Children()...) {
+		r.bottomUp(c)
+	}
+	return r.applyAt(n)
+}
+
+func (r *run) topDown(n parse.Node) parse.Node {
+	n = r.applyAt(n)
+	for _, c := range append([]parse.Node(nil), n.Children()...) {
+		r.topDown(c)
+	}
+	return n
+}
+
+//applyAt rewrites a single node until no rule matches it, and returns whatever ends up in its place
+func (r *run) applyAt(n parse.Node) parse.Node {
+	var seen map[string]bool
+	var applied []string
+	for {
+		nu, rule := r.applyOnce(n)
+		if nu == nil {
+			return n
+		}
+		applied = append(applied, rule)
+
+		//Rules undoing each other in place would otherwise only be caught by MaxSteps
+		if seen == nil {
+			seen = map[string]bool{fingerprint(n): true}
+		}
+		fp := fingerprint(nu)
+		if seen[fp] {
+			panic(rewriteError{&CycleError{Rules: applied}})
+		}
+		seen[fp] = true
+		n = nu
+	}
+}
+
+//applyOnce applies the first matching rule to n, and returns the replacement and the name of the rule
+func (r *run) applyOnce(n parse.Node) (parse.Node, string) {
+	for i := range r.rw.rules {
+		rule := &r.rw.rules[i]
+		b := &Bindings{node: n, vars: map[string][]parse.Node{}}
+		if !rule.pattern.match(n, b) {
+			continue
+		}
+		if rule.Guard != nil && !rule.Guard(b) {
+			continue
+		}
+
+		parent := n.Parent()
+		var nu parse.Node
+		if rule.Build != nil {
+			nu = rule.Build(b)
+		} else {
+			nu = rule.template.build(b, map[parse.Node]bool{})[0]
+		}
+		if nu == nil {
+			continue
+		}
+		if parent != nil {
+			parent.ReplaceChild(n, nu)
+		}
+
+		r.steps++
+		r.applied = append(r.applied, rule.Name)
+		if max := r.rw.MaxSteps; max > 0 && r.steps > max {
+			panic(rewriteError{fmt.Errorf("rewrite: more than %d rewrites, last applied rule %q", max, rule.Name)})
+		}
+		return nu, rule.Name
+	}
+	return nil, ""
+}
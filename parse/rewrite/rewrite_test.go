@@ -0,0 +1,191 @@
+package rewrite_test
+
+import (
+	"errors"
+	"kugg/compilers/Gparse"
+	"kugg/compilers/Gparse/arith"
+	"kugg/compilers/parse"
+	"kugg/compilers/parse/rewrite"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func arithTree(t *testing.T, src string) *parse.Tree {
+	p, err := Gparse.NewParser(arith.Grammar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := p.Parse(src, src, arith.LexAny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+//sexpr writes a tree as nested lists of node names, with the lexemes of terminals
+func sexpr(n parse.Node) string {
+	if n.IsTerminal() {
+		return n.Token().Lexeme()
+	}
+	var parts []string
+	for _, c := range n.Children() {
+		parts = append(parts, sexpr(c))
+	}
+	return n.Type().String() + "(" + strings.Join(parts, " ") + ")"
+}
+
+//rewritten rewrites the expression of an arithmetic tree
+func rewritten(t *testing.T, rw *rewrite.Rewriter, src string) (string, int, error) {
+	tree := arithTree(t, src)
+	expr := tree.Root.Children()[0]
+	root, steps, err := rw.Rewrite(expr)
+	if err != nil {
+		return "", steps, err
+	}
+	return sexpr(root), steps, nil
+}
+
+var (
+	addZero = rewrite.Rule{
+		Name:     "add-zero",
+		Pattern:  `(Expr $x:Term (Plus) (Expr (Term (Factor (Number NumberToken "0")))))`,
+		Template: `(Expr $x)`,
+	}
+	parens = rewrite.Rule{
+		Name:     "parens",
+		Pattern:  `(Term (Factor (LParen) (Expr $t:Term) (RParen)))`,
+		Template: `$t`,
+	}
+	multiply = rewrite.Rule{
+		Name:    "multiply",
+		Pattern: `(Term (Factor $a:Number) (Times) (Term (Factor $b:Number)))`,
+		Guard: func(b *rewrite.Bindings) bool {
+			return b.Lexeme("a") != "0"
+		},
+		Build: func(b *rewrite.Bindings) parse.Node {
+			x, _ := strconv.Atoi(b.Lexeme("a"))
+			y, _ := strconv.Atoi(b.Lexeme("b"))
+			number := b.NewTerminal(parse.NodeType(arith.Number), arith.TNumber, strconv.Itoa(x*y))
+			return b.NewNonTerminal(parse.NodeType(arith.Term), b.NewNonTerminal(parse.NodeType(arith.Factor), number))
+		},
+	}
+)
+
+func TestRewrite(t *testing.T) {
+	for _, order := range []rewrite.Order{rewrite.BottomUp, rewrite.TopDown} {
+		rw, err := rewrite.New(order, addZero, parens, multiply)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range []struct {
+			src, want string
+			steps     int
+		}{
+			{"1 + 0", "Expr(Term(Factor(1)))", 1},
+			{"1 + 2", "Expr(Term(Factor(1)) + Expr(Term(Factor(2))))", 0},
+			{"((7))", "Expr(Term(Factor(7)))", 2},
+			{"2 * 3 * 4", "Expr(Term(Factor(24)))", 2},
+			{"0 * 3 * 4", "Expr(Term(Factor(0) * Term(Factor(12))))", 1},
+			{"(2 * 3) + 0", "Expr(Term(Factor(6)))", 3},
+		} {
+			got, steps, err := rewritten(t, rw, c.src)
+			if err != nil {
+				t.Errorf("%q: %v", c.src, err)
+				continue
+			}
+			if got != c.want || steps != c.steps {
+				t.Errorf("%q was rewritten in %d steps to\n%s\nexpected %d steps to\n%s", c.src, steps, got, c.steps, c.want)
+			}
+		}
+	}
+}
+
+func TestRewriteSequences(t *testing.T) {
+	//Repeating a captured node clones it
+	rw := rewrite.MustNew(rewrite.BottomUp, rewrite.Rule{
+		Name:     "square",
+		Pattern:  `(Term $f:Factor)`,
+		Template: `(Expr $f (Times TimesToken "*") $f)`,
+	}, rewrite.Rule{
+		Name:     "drop-first",
+		Pattern:  `(Expr _:Factor $rest...)`,
+		Template: `(Term $rest...)`,
+	})
+	got, _, err := rewritten(t, rw, "5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Expr(Term(* Factor(5)))"; got != want {
+		t.Errorf("rewritten to\n%s\nexpected\n%s", got, want)
+	}
+}
+
+func TestRewriteCycle(t *testing.T) {
+	rw := rewrite.MustNew(rewrite.BottomUp, rewrite.Rule{
+		Name:     "commute",
+		Pattern:  `(Expr $a:Term (Plus) (Expr $b:Term))`,
+		Template: `(Expr $b (Plus PlusToken "+") (Expr $a))`,
+	})
+	_, _, err := rewritten(t, rw, "1 + 2")
+	var cycle *rewrite.CycleError
+	if !errors.As(err, &cycle) {
+		t.Fatalf("commuting forever returned %v", err)
+	}
+	if strings.Join(cycle.Rules, " ") != "commute commute" {
+		t.Errorf("the cycle applied %v", cycle.Rules)
+	}
+}
+
+func TestRewriteMaxSteps(t *testing.T) {
+	rw := rewrite.MustNew(rewrite.BottomUp, rewrite.Rule{
+		Name:     "negate",
+		Pattern:  `(Factor $n:Number)`,
+		Template: `(Factor (Minus MinusToken "-") (Factor (Minus MinusToken "-") (Factor $n)))`,
+	})
+	rw.MaxSteps = 10
+	_, steps, err := rewritten(t, rw, "1")
+	if err == nil || err.Error() != `rewrite: more than 10 rewrites, last applied rule "negate"` || steps != 11 {
+		t.Errorf("a growing tree stopped after %d rewrites with %v", steps, err)
+	}
+}
+
+//TestRewritePanic checks that panics of the rules themselves are not turned into errors
+func TestRewritePanic(t *testing.T) {
+	rw := rewrite.MustNew(rewrite.BottomUp, rewrite.Rule{
+		Name:    "broken",
+		Pattern: `(Number)`,
+		Build: func(b *rewrite.Bindings) parse.Node {
+			return b.Get("missing").Children()[0]
+		},
+	})
+	defer func() {
+		if _, ok := recover().(runtime.Error); !ok {
+			t.Errorf("the nil dereference of the rule was not raised again")
+		}
+	}()
+	rewritten(t, rw, "1")
+}
+
+func TestRuleErrors(t *testing.T) {
+	for _, c := range []struct {
+		rule rewrite.Rule
+		want string
+	}{
+		{rewrite.Rule{Name: "r", Pattern: `(Expr $x)`}, `rewrite: rule "r" has neither a Template nor a Build function`},
+		{rewrite.Rule{Name: "r", Pattern: `(Expr $x)`, Template: `(Expr $y)`}, `rewrite: rule "r": $y is not captured by the pattern`},
+		{rewrite.Rule{Name: "r", Pattern: `(Expr $x...)`, Template: `(Expr $x)`}, `rewrite: rule "r": $x captures a sequence, use $x...`},
+		{rewrite.Rule{Name: "r", Pattern: `(Expr $x)`, Template: `(Expr $x...)`}, `rewrite: rule "r": $x... is not a sequence in the pattern`},
+		{rewrite.Rule{Name: "r", Pattern: `(Nope)`, Template: `(Expr)`}, `rewrite: rule "r": col 2 in "(Nope)": no node type named "Nope" in NodeNames`},
+		{rewrite.Rule{Name: "r", Pattern: `(Expr $x`, Template: `(Expr)`}, `rewrite: rule "r": col 1 in "(Expr $x": unclosed '('`},
+		{rewrite.Rule{Name: "r", Pattern: `(Expr $x)`, Template: `(Expr _)`}, `rewrite: rule "r": col 7 in "(Expr _)": wildcards can't be used in a template`},
+		{rewrite.Rule{Name: "r", Pattern: `(Expr $x)`, Template: `(Plus "+")`}, `rewrite: rule "r": col 1 in "(Plus \"+\")": a terminal in a template needs both a token type and a lexeme`},
+		{rewrite.Rule{Name: "r", Pattern: `$x...`, Template: `(Expr)`}, `rewrite: rule "r": col 1 in "$x...": a sequence can't be the outermost pattern`},
+	} {
+		_, err := rewrite.New(rewrite.BottomUp, c.rule)
+		if err == nil || err.Error() != c.want {
+			t.Errorf("%s => %s: the error\n%v\nis not\n%s", c.rule.Pattern, c.rule.Template, err, c.want)
+		}
+	}
+}
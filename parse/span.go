@@ -0,0 +1,64 @@
+package parse
+
+import "fmt"
+
+//Span is the part of the source text covered by a node
+type Span struct {
+	Start int //Offset of the first byte
+	End   int //Offset after the last byte
+	Line  int //Line of the first rune
+	Row   int //Row of the first rune
+}
+
+func (s Span) String() string {
+	return fmt.Sprintf("%d:%d[%d:%d]", s.Line, s.Row, s.Start, s.End)
+}
+
+//SpanOf returns the span of a subtree, from its first terminal to its last.
+//
+//Tokens only record where they end, so the start is found from the length of the lexeme.
+//A nonterminal without terminals has an empty span at its first token, if it has one.
+func SpanOf(n Node) (Span, bool) {
+	first, last := firstTerminal(n), lastTerminal(n)
+	if first == nil {
+		tok := n.Token()
+		if tok == nil {
+			return Span{}, false
+		}
+		start := tok.Pos() - len(tok.Lexeme())
+		return Span{start, start, tok.Line(), tok.Row()}, true
+	}
+	ft, lt := first.Token(), last.Token()
+	return Span{ft.Pos() - len(ft.Lexeme()), lt.Pos(), ft.Line(), ft.Row()}, true
+}
+
+func firstTerminal(n Node) Node {
+	if n.IsTerminal() {
+		if n.Token() == nil {
+			return nil
+		}
+		return n
+	}
+	for _, c := range n.Children() {
+		if t := firstTerminal(c); t != nil {
+			return t
+		}
+	}
+	return nil
+}
+
+func lastTerminal(n Node) Node {
+	if n.IsTerminal() {
+		if n.Token() == nil {
+			return nil
+		}
+		return n
+	}
+	children := n.Children()
+	for i := len(children) - 1; i >= 0; i-- {
+		if t := lastTerminal(children[i]); t != nil {
+			return t
+		}
+	}
+	return nil
+}
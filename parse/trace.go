@@ -0,0 +1,99 @@
+package parse
+
+import (
+	"context"
+	"fmt"
+	"kugg/compilers/lex"
+	"log/slog"
+)
+
+//TraceEvent is a step of a parse, which is logged to Tree.Logger and recorded by Tree.Recorder
+type TraceEvent int
+
+const (
+	EnterRule      TraceEvent = iota //A parsing function started, see Tree.Trace
+	ExitRule                         //A parsing function returned
+	AddNode                          //A node was added to the tree, or moved to another parent
+	ConsumeToken                     //The parser consumed a token with Next
+	BacktrackToken                   //The parser went back over a token with Back or BackUntil
+	CommitNode                       //A node was committed
+	RollBackNode                     //A speculative node is about to be removed by RollBack
+	PeekToken                        //The parser looked at the next token with Peek
+	RemoveNode                       //A node was removed from its parent
+)
+
+var traceEventNames = map[TraceEvent]string{
+	EnterRule:      "enter",
+	ExitRule:       "exit",
+	AddNode:        "node",
+	ConsumeToken:   "token",
+	BacktrackToken: "backtrack",
+	CommitNode:     "commit",
+	RollBackNode:   "rollback",
+	PeekToken:      "peek",
+	RemoveNode:     "remove",
+}
+
+func (ev TraceEvent) String() string {
+	return traceEventNames[ev]
+}
+
+//MarshalText writes the event as its name, e.g. in JSON traces
+func (ev TraceEvent) MarshalText() ([]byte, error) {
+	return []byte(ev.String()), nil
+}
+
+//UnmarshalText reads an event from its name
+func (ev *TraceEvent) UnmarshalText(text []byte) error {
+	for e, name := range traceEventNames {
+		if name == string(text) {
+			*ev = e
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown trace event %q", text)
+}
+
+//Trace marks a parsing function in the trace of the parse, call it as
+//
+//	defer tree.Trace("expression")()
+//
+//to log when the function is entered and when it returns.
+func (tree *Tree) Trace(rule string) func() {
+	if tree.Logger == nil && tree.Recorder == nil && tree.Coverage == nil {
+		return func() {}
+	}
+	tree.event(EnterRule, nil, nil, rule)
+	return func() { tree.event(ExitRule, nil, nil, rule) }
+}
+
+//event is called for every step of the parse
+func (tree *Tree) event(ev TraceEvent, n Node, tok lex.Token, rule string) {
+	if tree == nil {
+		return
+	}
+	if tree.Recorder != nil {
+		tree.Recorder.record(tree, ev, n, tok, rule)
+	}
+	tree.Coverage.count(ev, n, rule)
+	ctx := context.Background()
+	if tree.Logger == nil || !tree.Logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	attrs := make([]slog.Attr, 0, 6)
+	if rule != "" {
+		attrs = append(attrs, slog.String("rule", rule))
+	}
+	if n != nil {
+		attrs = append(attrs, slog.String("node", n.Type().String()))
+	}
+	if tok != nil {
+		attrs = append(attrs,
+			slog.String("token", tokenName(tok.Type())),
+			slog.String("lexeme", tok.Lexeme()),
+			slog.Int("line", tok.Line()),
+			slog.Int("row", tok.Row()))
+	}
+	attrs = append(attrs, slog.Int("pos", tree.Pos))
+	tree.Logger.LogAttrs(ctx, slog.LevelDebug, ev.String(), attrs...)
+}
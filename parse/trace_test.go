@@ -0,0 +1,105 @@
+package parse_test
+
+import (
+	"bytes"
+	"kugg/compilers/Gparse/arith"
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+//parseTraced parses a number, tries an operator and goes back over it, with every kind of event
+func parseTraced(t *parse.Tree) {
+	defer t.Trace("number")()
+	n := t.AddNonTerminal(parse.NodeType(arith.Factor), t.Peek())
+	t.Curr = n
+	t.AddTerminal(parse.NodeType(arith.Number), t.Next())
+	t.Next()
+	t.Back()
+	t.Commit()
+}
+
+func tracedTree(src string, logger *slog.Logger) *parse.Tree {
+	tree := parse.NewTree(src, src, parseTraced)
+	tree.Logger = logger
+	l := lex.Lex(src, src)
+	l.Run(arith.LexAny)
+	defer l.Drain()
+	if err := tree.Parse(l); err != nil {
+		panic(err)
+	}
+	return tree
+}
+
+func textLogger(w *bytes.Buffer, level slog.Level) *slog.Logger {
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+}
+
+func TestTrace(t *testing.T) {
+	var buf bytes.Buffer
+	tracedTree("12 +", textLogger(&buf, slog.LevelDebug))
+	want := `
+level=DEBUG msg=enter rule=number pos=-1
+level=DEBUG msg=peek token=NumberToken lexeme=12 line=1 row=0 pos=-1
+level=DEBUG msg=node node=Factor token=NumberToken lexeme=12 line=1 row=0 pos=-1
+level=DEBUG msg=token token=NumberToken lexeme=12 line=1 row=0 pos=0
+level=DEBUG msg=node node=Number token=NumberToken lexeme=12 line=1 row=0 pos=0
+level=DEBUG msg=token token=PlusToken lexeme=+ line=1 row=3 pos=1
+level=DEBUG msg=backtrack token=PlusToken lexeme=+ line=1 row=3 pos=1
+level=DEBUG msg=commit node=Factor token=NumberToken lexeme=12 line=1 row=0 pos=0
+level=DEBUG msg=exit rule=number pos=0
+`
+	if buf.String() != want[1:] {
+		t.Errorf("the trace is\n%s\nexpected\n%s", buf.String(), want[1:])
+	}
+
+	//Above debug level, and without a Logger, nothing is logged
+	buf.Reset()
+	tracedTree("12 +", textLogger(&buf, slog.LevelInfo))
+	if buf.Len() != 0 {
+		t.Errorf("an info logger logged\n%s", buf.String())
+	}
+	tree := tracedTree("12 +", nil)
+	if got := strings.Join(tree.SPPrint(), "\n"); !strings.Contains(got, "Number") {
+		t.Errorf("the parse without a Logger is\n%s", got)
+	}
+}
+
+//countingToken counts the calls of Lexeme
+type countingToken struct {
+	lex.Token
+	calls *int
+}
+
+func (t countingToken) Lexeme() string {
+	*t.calls++
+	return t.Token.Lexeme()
+}
+
+//TestTraceDisabled checks that events are not described when the Logger is above debug level
+func TestTraceDisabled(t *testing.T) {
+	var buf bytes.Buffer
+	calls := 0
+	tree := parse.NewTree("disabled", "7", nil)
+	tree.Buffer = []lex.Token{countingToken{lex.NewToken(arith.TNumber, "7", 1, 1, 1), &calls}}
+	tree.Logger = textLogger(&buf, slog.LevelInfo)
+	tree.Peek()
+	if calls != 0 {
+		t.Errorf("the lexeme was read %d times for a disabled Logger", calls)
+	}
+	tree.Logger = textLogger(&buf, slog.LevelDebug)
+	tree.Peek()
+	if calls != 1 || !strings.Contains(buf.String(), "lexeme=7") {
+		t.Errorf("the lexeme was read %d times for the trace\n%s", calls, buf.String())
+	}
+}
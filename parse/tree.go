@@ -4,35 +4,33 @@ import (
 	"fmt"
 	"kugg/compilers/lex"
 	"kugg/compilers/symbol"
+	"log/slog"
 	"runtime"
-
-	"go.uber.org/zap"
+	"strings"
 )
 
 type Tree struct {
 	Root      Node //Root of the parse tree
 	Curr      Node //Current node,
 	CurrScope *symbol.Table
-	Buffer    []lex.Token //Full token stream
-	NameSpace []string    //Current scope
-	Pos       int         //Position of Current token in Buffer
-	NestLevel int         //How many nested expressions are there currently
+	Buffer    []lex.Token  //Full token stream
+	NameSpace []string     //Current scope
+	Pos       int          //Position of Current token in Buffer
+	NestLevel int          //How many nested expressions are there currently
+	Logger    *slog.Logger //Logger receives a trace of the parse at debug level, see TraceEvent. Nil disables it.
+	Recorder  *Recorder    //Recorder records the trace of the parse, see Record. Nil disables it.
+	Coverage  *Coverage    //Coverage counts the node types and pairs of the parse. Nil disables it.
+	Arena     *Arena       //Arena allocates the nodes of the tree. Nil allocates them on the heap.
 
 	name      string
 	text      string
 	lexer     lex.Lexer
-	parserFun ParseFn //the parsing entry point
+	parserFun ParseFn     //the parsing entry point
+	reuse     *reuseState //set during an incremental parse, see Reuse
 }
 
 type ParseFn func(*Tree)
 
-var logger *zap.SugaredLogger
-
-func init() {
-	logger_, _ := zap.NewProduction()
-	logger = logger_.Sugar()
-}
-
 func NewTree(name, text string, start ParseFn) *Tree {
 	tree := &Tree{
 		name:      name,
@@ -70,6 +68,16 @@ func (tree *Tree) Parse(lexer lex.Lexer) (err error) {
 	return
 }
 
+//Name returns the name the tree was created with, usually a file name
+func (tree *Tree) Name() string {
+	return tree.name
+}
+
+//Text returns the source text the tree was created with
+func (tree *Tree) Text() string {
+	return tree.text
+}
+
 //CurrentToken returns the token last received from the token stream
 func (tree *Tree) CurrentToken() lex.Token {
 	return tree.Buffer[tree.Pos]
@@ -77,6 +85,12 @@ func (tree *Tree) CurrentToken() lex.Token {
 
 //Next returns the next token from the lexer
 func (tree *Tree) Next() lex.Token {
+	t := tree.next()
+	tree.event(ConsumeToken, nil, t, "")
+	return t
+}
+
+func (tree *Tree) next() lex.Token {
 	if tree.Pos == len(tree.Buffer)-1 {
 		tree.Buffer = append(tree.Buffer, tree.lexer.NextToken())
 	}
@@ -86,13 +100,17 @@ func (tree *Tree) Next() lex.Token {
 
 //Peek returns but does not consume the next token
 func (tree *Tree) Peek() lex.Token {
-	t := tree.Next()
-	tree.Back()
+	t := tree.next()
+	tree.Pos--
+	tree.event(PeekToken, nil, t, "")
 	return t
 }
 
 //Back rewinds the position in the buffer by one
 func (tree *Tree) Back() {
+	if tree.Pos >= 0 {
+		tree.event(BacktrackToken, nil, tree.Buffer[tree.Pos], "")
+	}
 	tree.Pos--
 }
 
@@ -100,6 +118,7 @@ func (tree *Tree) Back() {
 //Assumes the parser implementation knows that this token exists in the buffer.
 func (tree *Tree) BackUntil(typ lex.TokenType) {
 	for ; tree.Buffer[tree.Pos].Type() != typ; tree.Pos-- {
+		tree.event(BacktrackToken, nil, tree.Buffer[tree.Pos], "")
 	}
 }
 
@@ -133,7 +152,6 @@ func (tree *Tree) ClearBuffer() {
 
 //AddNonTerminal adds a non-terminal node to the current subtree being built
 func (tree *Tree) AddNonTerminal(typ NodeType, token lex.Token) Node {
-	logger.Debugf("New nonterminal %v node %v", typ, token)
 	if tree.Curr != nil {
 		return tree.Curr.AddNonTerminal(typ, token)
 	}
@@ -142,7 +160,6 @@ func (tree *Tree) AddNonTerminal(typ NodeType, token lex.Token) Node {
 
 //AddTerminal adds a terminal to the current subtree being built
 func (tree *Tree) AddTerminal(typ NodeType, token lex.Token) Node {
-	logger.Debugf("New terminal %v node %v", typ, token)
 	if tree.Curr != nil {
 		return tree.Curr.AddTerminal(typ, token)
 	}
@@ -184,6 +201,22 @@ func (tree *Tree) Unexpected(unexpected interface{}, expected interface{}) {
 	}
 }
 
+//OneOf lists the alternatives expected, e.g. for Unexpected
+type OneOf []string
+
+//String returns the alternatives as "a", "a or b" or "one of a, b, c"
+func (o OneOf) String() string {
+	switch len(o) {
+	case 0:
+		return "nothing"
+	case 1:
+		return o[0]
+	case 2:
+		return o[0] + " or " + o[1]
+	}
+	return "one of " + strings.Join(o, ", ")
+}
+
 //PPrint pretty prints (indents) the parse tree in preorder
 func (tree *Tree) PPrint() {
 	tree.Root.PPrint(0)
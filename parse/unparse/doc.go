@@ -0,0 +1,29 @@
+/*
+Package unparse turns parse trees back into source text.
+
+Reprint regenerates the source exactly, from the lexemes of the terminals and the
+trivia between them, i.e. the white space and comments the lexer skipped. Every token
+carries the trivia in front of it, so a tree changed by the rewrite package is reprinted
+with the original layout around the tokens it kept. Tokens the parser consumed without
+adding a terminal for them are lost, so an exact reprint needs a terminal for every token.
+
+Format instead lays the tree out from scratch, using a document algebra in the style of
+Wadler's "A prettier printer". A Doc is text with possible line breaks, which a Group
+puts on one line if it fits within the line width and breaks otherwise:
+
+	f := unparse.NewFormatter(80)
+	f.Rule(Call, func(n parse.Node, c []unparse.Doc) unparse.Doc {
+		return unparse.Concat(c[0], unparse.Text("("),
+			unparse.Group(unparse.Nest(4, unparse.SoftLine(), c[2]), unparse.SoftLine()),
+			unparse.Text(")"))
+	})
+	f.Rule(Args, func(n parse.Node, c []unparse.Doc) unparse.Doc {
+		return unparse.Join(unparse.Concat(unparse.Text(","), unparse.Line()), unparse.Without(n, c, Punct))
+	})
+
+	text := f.Format(tree)
+
+Rules are given the documents of the children of the node, and nodes without a rule
+are laid out with the default of the Formatter. Trivia is not kept when formatting.
+*/
+package unparse
@@ -0,0 +1,179 @@
+package unparse
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+//Doc is a document, text with possible line breaks and indentation
+type Doc interface {
+	doc()
+}
+
+type text struct{ s string }
+type line struct {
+	flat string //What the line is when its group is on one line
+	hard bool   //Whether the line always breaks
+}
+type nest struct {
+	indent int
+	d      Doc
+}
+type group struct{ d Doc }
+type concat struct{ docs []Doc }
+
+func (text) doc()   {}
+func (line) doc()   {}
+func (nest) doc()   {}
+func (group) doc()  {}
+func (concat) doc() {}
+
+//Text is a document of text without line breaks
+func Text(s string) Doc {
+	return text{s}
+}
+
+//Line is a line break, or a space if the enclosing group fits on one line
+func Line() Doc {
+	return line{flat: " "}
+}
+
+//SoftLine is a line break, or nothing if the enclosing group fits on one line
+func SoftLine() Doc {
+	return line{}
+}
+
+//HardLine is a line break which is always taken, and forces the enclosing groups to break
+func HardLine() Doc {
+	return line{hard: true}
+}
+
+//Nest indents the lines started by line breaks in a document
+func Nest(indent int, docs ...Doc) Doc {
+	return nest{indent, Concat(docs...)}
+}
+
+//Group lays out a document on one line if it fits, and otherwise breaks all of its lines.
+//
+//Groups nested in a broken group are laid out independently.
+func Group(docs ...Doc) Doc {
+	return group{Concat(docs...)}
+}
+
+//Concat puts documents after each other. Concat() is the empty document.
+func Concat(docs ...Doc) Doc {
+	if len(docs) == 1 {
+		return docs[0]
+	}
+	return concat{docs}
+}
+
+//Join puts documents after each other with a separator between them
+func Join(sep Doc, docs []Doc) Doc {
+	joined := make([]Doc, 0, 2*len(docs))
+	for i, d := range docs {
+		if i > 0 {
+			joined = append(joined, sep)
+		}
+		joined = append(joined, d)
+	}
+	return concat{joined}
+}
+
+//mode is how the lines of a document are laid out
+type mode bool
+
+const (
+	broken mode = false
+	flat   mode = true
+)
+
+type item struct {
+	indent int
+	mode   mode
+	d      Doc
+}
+
+//Render lays out a document within a line width.
+//
+//The width is a preference, text longer than it is not broken.
+func Render(d Doc, width int) string {
+	var sb strings.Builder
+	col := 0
+	pending := -1 //Indentation to write before the next text, after a line break
+	stack := []item{{0, broken, d}}
+	for len(stack) > 0 {
+		it := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch d := it.d.(type) {
+		case text:
+			if d.s == "" {
+				continue
+			}
+			if pending >= 0 {
+				sb.WriteString(strings.Repeat(" ", pending))
+				pending = -1
+			}
+			sb.WriteString(d.s)
+			col += utf8.RuneCountInString(d.s)
+		case line:
+			if it.mode == flat && !d.hard {
+				stack = append(stack, item{it.indent, flat, text{d.flat}})
+				continue
+			}
+			sb.WriteByte('\n')
+			col, pending = it.indent, it.indent
+		case nest:
+			stack = append(stack, item{it.indent + d.indent, it.mode, d.d})
+		case group:
+			m := it.mode
+			if m == broken && fits(width-col, item{it.indent, flat, d.d}, stack) {
+				m = flat
+			}
+			stack = append(stack, item{it.indent, m, d.d})
+		case concat:
+			for i := len(d.docs) - 1; i >= 0; i-- {
+				stack = append(stack, item{it.indent, it.mode, d.docs[i]})
+			}
+		}
+	}
+	return sb.String()
+}
+
+//fits reports whether a document laid out flat, and what follows it up to the next line break, fits in the width
+func fits(width int, it item, rest []item) bool {
+	items := []item{it}
+	next := len(rest) - 1
+	for width >= 0 {
+		if len(items) == 0 {
+			if next < 0 {
+				return true
+			}
+			items = append(items, rest[next])
+			next--
+		}
+		it := items[len(items)-1]
+		items = items[:len(items)-1]
+		switch d := it.d.(type) {
+		case text:
+			width -= utf8.RuneCountInString(d.s)
+		case line:
+			if it.mode == broken {
+				return true
+			}
+			if d.hard {
+				return false
+			}
+			width -= utf8.RuneCountInString(d.flat)
+		case nest:
+			items = append(items, item{it.indent + d.indent, it.mode, d.d})
+		case group:
+			items = append(items, item{it.indent, it.mode, d.d})
+		case concat:
+			for i := len(d.docs) - 1; i >= 0; i-- {
+				items = append(items, item{it.indent, it.mode, d.docs[i]})
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package unparse
+
+import (
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+)
+
+//Rule lays out a node, given the documents of its children
+type Rule func(n parse.Node, children []Doc) Doc
+
+//Formatter lays out trees with a Rule per NodeType
+type Formatter struct {
+	Width   int  //The preferred line width
+	Default Rule //The rule for nonterminals without a rule of their own, see DefaultRule
+	rules   map[parse.NodeType]Rule
+}
+
+//NewFormatter creates a Formatter without rules
+func NewFormatter(width int) *Formatter {
+	return &Formatter{
+		Width:   width,
+		Default: DefaultRule,
+		rules:   make(map[parse.NodeType]Rule),
+	}
+}
+
+//DefaultRule groups the children of a node, separated by lines
+func DefaultRule(n parse.Node, children []Doc) Doc {
+	return Group(Join(Line(), children))
+}
+
+//Rule sets the rule of a node type.
+//
+//Rules for terminals are given no children. Terminals without a rule are their lexeme.
+func (f *Formatter) Rule(typ parse.NodeType, rule Rule) {
+	f.rules[typ] = rule
+}
+
+//Doc returns the document of a subtree
+func (f *Formatter) Doc(n parse.Node) Doc {
+	var children []Doc
+	for _, c := range n.Children() {
+		children = append(children, f.Doc(c))
+	}
+	if rule, ok := f.rules[n.Type()]; ok {
+		return rule(n, children)
+	}
+	if n.IsTerminal() {
+		if tok := n.Token(); tok != nil && tok.Type() != lex.EOF_Token {
+			return Text(tok.Lexeme())
+		}
+		return Concat()
+	}
+	return f.Default(n, children)
+}
+
+//Format lays out a tree, from the only child of the root if it has one
+func (f *Formatter) Format(tree *parse.Tree) string {
+	n := tree.Root
+	if children := n.Children(); len(children) == 1 {
+		n = children[0]
+	}
+	return Render(f.Doc(n), f.Width)
+}
+
+//Without returns the documents of the children of a node, except those of the children of some types.
+//
+//Rules use it to drop punctuation they lay out themselves.
+func Without(n parse.Node, children []Doc, types ...parse.NodeType) []Doc {
+	result := make([]Doc, 0, len(children))
+outer:
+	for i, c := range n.Children() {
+		for _, t := range types {
+			if c.Type() == t {
+				continue outer
+			}
+		}
+		result = append(result, children[i])
+	}
+	return result
+}
@@ -0,0 +1,91 @@
+package unparse
+
+import (
+	"bufio"
+	"io"
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+	"strings"
+	"unicode"
+)
+
+//Reprint returns the source text of a tree, see WriteReprint
+func Reprint(tree *parse.Tree) string {
+	var sb strings.Builder
+	WriteReprint(&sb, tree)
+	return sb.String()
+}
+
+//WriteReprint writes the source text of a tree.
+//
+//Each terminal is written with the trivia that preceded its token in the source.
+//Terminals whose tokens are not from the token stream of the tree, e.g. ones created by a rewrite,
+//have no trivia, and are separated from the previous token by a space when both are words.
+//The trivia after the last token is written at the end.
+func WriteReprint(w io.Writer, tree *parse.Tree) error {
+	r := reprinter{
+		w:       bufio.NewWriter(w),
+		text:    tree.Text(),
+		leading: make(map[lex.Token]string),
+	}
+	end := 0
+	for _, tok := range tree.Buffer {
+		if tok == nil || tok.Type() == lex.EOF_Token {
+			continue
+		}
+		start := tok.Pos() - len(tok.Lexeme())
+		if start < end || tok.Pos() > len(r.text) || r.text[start:tok.Pos()] != tok.Lexeme() {
+			continue
+		}
+		r.leading[tok] = r.text[end:start]
+		end = tok.Pos()
+	}
+	r.node(tree.Root)
+	r.w.WriteString(r.text[end:])
+	return r.w.Flush()
+}
+
+type reprinter struct {
+	w       *bufio.Writer
+	text    string
+	leading map[lex.Token]string //The trivia in front of each token of the source
+	last    string               //The last lexeme written
+}
+
+func (r *reprinter) node(n parse.Node) {
+	if !n.IsTerminal() {
+		for _, c := range n.Children() {
+			r.node(c)
+		}
+		return
+	}
+	tok := n.Token()
+	if tok == nil || tok.Type() == lex.EOF_Token {
+		return
+	}
+	if trivia, ok := r.leading[tok]; ok {
+		r.w.WriteString(trivia)
+	} else if endsWord(r.last) && startsWord(tok.Lexeme()) {
+		r.w.WriteByte(' ')
+	}
+	r.w.WriteString(tok.Lexeme())
+	if tok.Lexeme() != "" {
+		r.last = tok.Lexeme()
+	}
+}
+
+func isWordRune(c rune) bool {
+	return c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+func endsWord(s string) bool {
+	rs := []rune(s)
+	return len(rs) > 0 && isWordRune(rs[len(rs)-1])
+}
+
+func startsWord(s string) bool {
+	for _, c := range s {
+		return isWordRune(c)
+	}
+	return false
+}
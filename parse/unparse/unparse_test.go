@@ -0,0 +1,131 @@
+package unparse_test
+
+import (
+	"kugg/compilers/Gparse"
+	"kugg/compilers/Gparse/arith"
+	"kugg/compilers/lex"
+	"kugg/compilers/parse"
+	"kugg/compilers/parse/unparse"
+	"testing"
+)
+
+//lexComments lexes arith with comments from # to the end of the line
+func lexComments(l *lex.BaseLexer) lex.StateFn {
+	for l.IgnoreSpaces(); l.Peek() == '#'; l.IgnoreSpaces() {
+		l.AcceptUntil("\n")
+		l.Ignore()
+	}
+	if arith.LexAny(l) == nil {
+		return nil
+	}
+	return lexComments
+}
+
+func arithTree(t *testing.T, src string) *parse.Tree {
+	p, err := Gparse.NewParser(arith.Grammar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := p.Parse(src, src, lexComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func TestReprint(t *testing.T) {
+	for _, src := range []string{
+		"1",
+		"1+2",
+		"  1 +\t2  ",
+		"# the sum\n(1 + 2) # of two\n\t* -3\n\n# and a product\n",
+		"\n\n-  ( 4/2 )\r\n*7",
+	} {
+		if got := unparse.Reprint(arithTree(t, src)); got != src {
+			t.Errorf("%q is reprinted as %q", src, got)
+		}
+	}
+}
+
+func TestReprintNewTokens(t *testing.T) {
+	//The terminals of a tree built by hand have no trivia, so words are separated by spaces
+	tree := parse.NewTree("built", "", nil)
+	expr := tree.Root.AddNonTerminal(parse.NodeType(arith.Expr), nil)
+	for _, tok := range []lex.Token{
+		lex.NewToken(arith.TNumber, "1", 0, 0, 1),
+		lex.NewToken(arith.TNumber, "2", 0, 0, 1),
+		lex.NewToken(arith.TPlus, "+", 0, 0, 1),
+		lex.NewToken(arith.TNumber, "3", 0, 0, 1),
+		lex.NewToken(arith.TLParen, "(", 0, 0, 1),
+		lex.NewToken(arith.TRParen, ")", 0, 0, 1),
+	} {
+		expr.AddTerminal(parse.NodeType(arith.Number), tok)
+	}
+	if got := unparse.Reprint(tree); got != "1 2+3()" {
+		t.Errorf("the built tree is reprinted as %q", got)
+	}
+}
+
+func TestRender(t *testing.T) {
+	args := []unparse.Doc{unparse.Text("a"), unparse.Text("b"), unparse.Text("c")}
+	call := unparse.Group(unparse.Text("f("),
+		unparse.Nest(2, unparse.SoftLine(), unparse.Join(unparse.Concat(unparse.Text(","), unparse.Line()), args)),
+		unparse.SoftLine(), unparse.Text(")"))
+	//The inner group is laid out by itself once the outer group breaks
+	nested := unparse.Group(unparse.Text("g("),
+		unparse.Nest(4, unparse.Line(), call, unparse.Text(","), unparse.Line(), unparse.Text("xyz")),
+		unparse.Text(")"))
+
+	for _, c := range []struct {
+		doc   unparse.Doc
+		width int
+		want  string
+	}{
+		{call, 10, "f(a, b, c)"},
+		{call, 9, "f(\n  a,\n  b,\n  c\n)"},
+		{nested, 23, "g( f(a, b, c), xyz)"},
+		{nested, 18, "g(\n    f(a, b, c),\n    xyz)"},
+		{nested, 13, "g(\n    f(\n      a,\n      b,\n      c\n    ),\n    xyz)"},
+		//What follows a group up to the next line break must fit as well
+		{unparse.Concat(unparse.Group(unparse.Text("ab"), unparse.Line(), unparse.Text("cd")), unparse.Text("efgh")), 9, "ab cdefgh"},
+		{unparse.Concat(unparse.Group(unparse.Text("ab"), unparse.Line(), unparse.Text("cd")), unparse.Text("efgh")), 8, "ab\ncdefgh"},
+		{unparse.Concat(unparse.Group(unparse.Text("ab"), unparse.Line(), unparse.Text("cd")), unparse.HardLine(), unparse.Text("efgh")), 5, "ab cd\nefgh"},
+		//A hard line breaks its groups whatever the width
+		{unparse.Group(unparse.Text("ab"), unparse.Line(), unparse.Text("cd"), unparse.HardLine(), unparse.Text("e")), 80, "ab\ncd\ne"},
+		//Text longer than the width is not broken, and empty lines are not indented
+		{unparse.Nest(2, unparse.Text("abcdef"), unparse.HardLine(), unparse.HardLine(), unparse.Text("g")), 3, "abcdef\n\n  g"},
+		{unparse.Concat(), 0, ""},
+	} {
+		if got := unparse.Render(c.doc, c.width); got != c.want {
+			t.Errorf("at width %d the document is\n%s\nexpected\n%s", c.width, got, c.want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tree := arithTree(t, "(1+2) *  3")
+	f := unparse.NewFormatter(80)
+	if got := f.Format(tree); got != "( 1 + 2 ) * 3" {
+		t.Errorf("the default layout is %q", got)
+	}
+
+	//Parentheses are laid out by the rule of Factor, without spaces inside them
+	f.Rule(parse.NodeType(arith.Factor), func(n parse.Node, c []unparse.Doc) unparse.Doc {
+		inner := unparse.Without(n, c, parse.NodeType(arith.LParen), parse.NodeType(arith.RParen))
+		if len(inner) == len(c) {
+			return unparse.Concat(c...)
+		}
+		return unparse.Group(unparse.Text("("), unparse.Nest(1, unparse.SoftLine(), inner[0]), unparse.SoftLine(), unparse.Text(")"))
+	})
+	if got := f.Format(tree); got != "(1 + 2) * 3" {
+		t.Errorf("the layout with a rule for factors is %q", got)
+	}
+	f.Width = 8
+	if got := f.Format(tree); got != "(1 + 2)\n*\n3" {
+		t.Errorf("the layout at width 8 is %q", got)
+	}
+	f.Width = 4
+	if got := f.Format(tree); got != "(\n 1\n +\n 2\n)\n*\n3" {
+		t.Errorf("the layout at width 4 is %q", got)
+	}
+}
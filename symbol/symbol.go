@@ -80,11 +80,22 @@ func (table *Table) ByQualifiedName(name []string) (*Symbol, bool) {
 	return nil, false
 }
 
+//Scopes lists the table and all tables below it in preorder
+//
+//The index of a table in this list is a stable id within its hierarchy.
+func (table *Table) Scopes() []*Table {
+	scopes := []*Table{table}
+	for _, child := range table.Children {
+		scopes = append(scopes, child.Scopes()...)
+	}
+	return scopes
+}
+
 //Add a symbol with a scope
 func (table *Table) Add(name string) (*Symbol, error) {
 	_, exists := table.symbols_by_name[name]
 	if exists {
-		return nil, fmt.Errorf("Name %q already defined in current scope")
+		return nil, fmt.Errorf("Name %q already defined in current scope", name)
 	}
 
 	ns := table.SubScope()
@@ -107,6 +118,33 @@ func (table *Table) Add(name string) (*Symbol, error) {
 	return sym, nil
 }
 
+//Attach adds a symbol whose namespace is an existing global scope, e.g. the scope of a file in a project.
+//
+//Names not found in the attached scope are then looked up in this table.
+func (table *Table) Attach(name string, scope *Table) (*Symbol, error) {
+	if scope.Parent != nil {
+		return nil, fmt.Errorf("Can't attach %q, its scope is already attached", name)
+	}
+	if _, exists := table.symbols_by_name[name]; exists {
+		return nil, fmt.Errorf("Name %q already defined in current scope", name)
+	}
+
+	scope.Parent = table
+	table.Children = append(table.Children, scope)
+	sym := &Symbol{
+		Name:       name,
+		LocalId:    table.nextId,
+		Attributes: make(map[string]interface{}),
+		NameSpace:  scope,
+		Scope:      table,
+	}
+	table.symbols_by_name[name] = sym
+	table.symbols_by_local_id[sym.LocalId] = sym
+	table.nextId++
+
+	return sym, nil
+}
+
 //Add a lower level scope
 func (table *Table) SubScope() *Table {
 	new_tab := &Table{
@@ -122,28 +160,38 @@ func (table *Table) SubScope() *Table {
 }
 
 //Recursively sets globally unique symbol ids for symbol tables
+//
+//Ids are given in preorder: a symbol, then the symbols in its namespace,
+//and after the symbols of a table the symbols of its scopes not belonging to a symbol.
 func (table *Table) ResolveGlobalIds() error {
 	if table.Parent != nil {
 		return nil
 	}
 	table.resolve_ids(0)
-
-	//TODO: resolve symtabs not attached to symbols
 	return nil
 
 }
 
-func (table *Table) resolve_ids(global_offset uint) uint {
+func (table *Table) resolve_ids(next_id uint) uint {
+	//Ids may have been resolved before, e.g. before the table was attached
+	table.symbols_by_global_id = make(map[uint]*Symbol)
+	namespaces := make(map[*Table]bool)
 	for i := uint(0); i < table.NumSymbols(); i++ {
 		sym := table.symbols_by_local_id[i]
 		//Set the global id
-		sym.GlobalId = sym.LocalId + global_offset
+		sym.GlobalId = next_id
 		table.symbols_by_global_id[sym.GlobalId] = sym
+		next_id++
 		//Recurse
-		sym.NameSpace.resolve_ids(global_offset + i + 1)
-		global_offset += sym.NameSpace.nextId
+		namespaces[sym.NameSpace] = true
+		next_id = sym.NameSpace.resolve_ids(next_id)
+	}
+	for _, child := range table.Children {
+		if !namespaces[child] {
+			next_id = child.resolve_ids(next_id)
+		}
 	}
-	return global_offset
+	return next_id
 }
 
 //Create a global level symtab